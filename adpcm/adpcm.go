@@ -0,0 +1,114 @@
+// Package adpcm encodes 16-bit audio as IMA ADPCM (also called DVI ADPCM), in the blocks used by WAV
+// files with format tag 0x0011. Each sample takes 4 bits, a quarter of the size of 16-bit PCM.
+package adpcm // import "gopkg.in/BenLubar/espeak.v2/adpcm"
+
+// BlockSize is the number of bytes in each block of mono audio at 8 kHz, as written by Windows and
+// most other encoders.
+const BlockSize = 256
+
+// SamplesPerBlock returns the number of mono samples in a block of the given number of bytes. The
+// block starts with a 4-byte header holding the first sample, followed by two samples per byte.
+func SamplesPerBlock(blockSize int) int {
+	return (blockSize-4)*2 + 1
+}
+
+var stepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+var indexTable = [8]int{-1, -1, -1, -1, 2, 4, 6, 8}
+
+// Encoder encodes mono audio one block at a time. The step size carries over from one block to the
+// next, so blocks must be encoded in order.
+type Encoder struct {
+	index int
+}
+
+// EncodeBlock encodes SamplesPerBlock(len(dst)) samples into dst. If there are fewer samples, the
+// rest of the block is silence.
+func (e *Encoder) EncodeBlock(dst []byte, samples []int16) {
+	n := SamplesPerBlock(len(dst))
+	if len(samples) > n {
+		samples = samples[:n]
+	}
+
+	var first int16
+	if len(samples) != 0 {
+		first = samples[0]
+	}
+
+	dst[0], dst[1] = byte(first), byte(uint16(first)>>8)
+	dst[2], dst[3] = byte(e.index), 0
+
+	predicted := int(first)
+	for i := 1; i < n; i++ {
+		var s int
+		if i < len(samples) {
+			s = int(samples[i])
+		}
+
+		code := e.encode(s, &predicted)
+		if i%2 == 1 {
+			dst[4+i/2] = code
+		} else {
+			dst[4+i/2-1] |= code << 4
+		}
+	}
+}
+
+// encode returns the 4-bit code for s, and updates the prediction the same way a decoder does.
+func (e *Encoder) encode(s int, predicted *int) byte {
+	step := stepTable[e.index]
+
+	diff := s - *predicted
+	var code byte
+	if diff < 0 {
+		code = 8
+		diff = -diff
+	}
+
+	// Each bit of the code halves the remaining step, and the decoder adds step/8 to round.
+	delta := step >> 3
+	if diff >= step {
+		code |= 4
+		diff -= step
+		delta += step
+	}
+	if diff >= step>>1 {
+		code |= 2
+		diff -= step >> 1
+		delta += step >> 1
+	}
+	if diff >= step>>2 {
+		code |= 1
+		delta += step >> 2
+	}
+
+	if code&8 != 0 {
+		*predicted -= delta
+	} else {
+		*predicted += delta
+	}
+	if *predicted > 32767 {
+		*predicted = 32767
+	} else if *predicted < -32768 {
+		*predicted = -32768
+	}
+
+	e.index += indexTable[code&7]
+	if e.index < 0 {
+		e.index = 0
+	} else if e.index > len(stepTable)-1 {
+		e.index = len(stepTable) - 1
+	}
+
+	return code
+}
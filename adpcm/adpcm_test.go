@@ -0,0 +1,94 @@
+package adpcm
+
+import (
+	"math"
+	"testing"
+)
+
+// decodeBlock is a decoder written from the description of the format, to check the encoder.
+func decodeBlock(block []byte) []int16 {
+	predicted := int(int16(uint16(block[0]) | uint16(block[1])<<8))
+	index := int(block[2])
+	out := []int16{int16(predicted)}
+
+	for _, b := range block[4:] {
+		for _, code := range [2]byte{b & 0x0f, b >> 4} {
+			step := stepTable[index]
+
+			delta := step >> 3
+			if code&4 != 0 {
+				delta += step
+			}
+			if code&2 != 0 {
+				delta += step >> 1
+			}
+			if code&1 != 0 {
+				delta += step >> 2
+			}
+			if code&8 != 0 {
+				predicted -= delta
+			} else {
+				predicted += delta
+			}
+			if predicted > 32767 {
+				predicted = 32767
+			} else if predicted < -32768 {
+				predicted = -32768
+			}
+
+			index += indexTable[code&7]
+			if index < 0 {
+				index = 0
+			} else if index > 88 {
+				index = 88
+			}
+
+			out = append(out, int16(predicted))
+		}
+	}
+
+	return out
+}
+
+func TestEncodeBlock(t *testing.T) {
+	if n := SamplesPerBlock(BlockSize); n != 505 {
+		t.Errorf("SamplesPerBlock(BlockSize) = %d, want 505", n)
+	}
+
+	in := make([]int16, 8000)
+	for i := range in {
+		f := 300 + 200*math.Sin(float64(i)/1000)
+		in[i] = int16(12000 * math.Sin(2*math.Pi*f*float64(i)/8000))
+	}
+
+	var e Encoder
+	var out []int16
+	block := make([]byte, BlockSize)
+	for rest := in; len(rest) != 0; {
+		e.EncodeBlock(block, rest)
+		out = append(out, decodeBlock(block)...)
+
+		n := SamplesPerBlock(BlockSize)
+		if n > len(rest) {
+			// The rest of the last block is silence, which the decoder reaches after a few samples.
+			if s := out[len(out)-1]; s > 100 || s < -100 {
+				t.Errorf("last sample of padding is %d", s)
+			}
+			n = len(rest)
+		}
+		out = out[:len(out)-SamplesPerBlock(BlockSize)+n]
+		rest = rest[n:]
+	}
+
+	var signal, noise float64
+	for i, s := range in {
+		d := float64(out[i]) - float64(s)
+		signal += float64(s) * float64(s)
+		noise += d * d
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < 20 {
+		t.Errorf("SNR is %.1f dB", snr)
+	} else {
+		t.Logf("SNR is %.1f dB", snr)
+	}
+}
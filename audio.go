@@ -0,0 +1,278 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// AudioResolver finds the audio for the src of an SSML <audio> element, so that it can be played in
+// the synthesized speech. See Context.Audio.
+type AudioResolver interface {
+	// ResolveAudio returns the audio for uri. If there is no audio for uri, the error wraps
+	// fs.ErrNotExist, and the content of the <audio> element is spoken instead.
+	ResolveAudio(uri string) (*Context, error)
+}
+
+// AudioResolverFunc is a function that implements AudioResolver.
+type AudioResolverFunc func(uri string) (*Context, error)
+
+// ResolveAudio calls f(uri).
+func (f AudioResolverFunc) ResolveAudio(uri string) (*Context, error) {
+	return f(uri)
+}
+
+// AudioMap is an AudioResolver for audio kept in memory, such as sounds that are played many times.
+type AudioMap map[string]*Context
+
+// ResolveAudio returns m[uri].
+func (m AudioMap) ResolveAudio(uri string) (*Context, error) {
+	if ctx, ok := m[uri]; ok {
+		return ctx, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: uri, Err: fs.ErrNotExist}
+}
+
+// AudioResolvers returns an AudioResolver that tries each of resolvers in order, and returns the audio
+// from the first one that finds it.
+func AudioResolvers(resolvers ...AudioResolver) AudioResolver {
+	return AudioResolverFunc(func(uri string) (*Context, error) {
+		for _, r := range resolvers {
+			ctx, err := r.ResolveAudio(uri)
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return ctx, err
+			}
+		}
+
+		return nil, &fs.PathError{Op: "open", Path: uri, Err: fs.ErrNotExist}
+	})
+}
+
+// AudioFS returns an AudioResolver that reads WAV and FLAC files from fsys with ReadAudio. A URI is
+// either a path, which may be absolute, or a file: URL, and either way it is relative to the root of
+// fsys. URIs with any other scheme are not found.
+func AudioFS(fsys fs.FS) AudioResolver {
+	return AudioResolverFunc(func(uri string) (*Context, error) {
+		u, err := url.Parse(uri)
+		if err != nil || (u.Scheme != "" && u.Scheme != "file") || u.Opaque != "" {
+			return nil, &fs.PathError{Op: "open", Path: uri, Err: fs.ErrNotExist}
+		}
+
+		name := strings.TrimPrefix(u.Path, "/")
+		if !fs.ValidPath(name) {
+			return nil, &fs.PathError{Op: "open", Path: uri, Err: fs.ErrNotExist}
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		ctx, err := ReadAudio(f)
+		if err != nil {
+			return nil, fmt.Errorf("espeak: reading %s: %w", uri, err)
+		}
+
+		return ctx, nil
+	})
+}
+
+// AudioDir returns an AudioResolver that reads files in the directory dir, as AudioFS does. Files
+// outside of dir cannot be read.
+func AudioDir(dir string) AudioResolver {
+	return AudioFS(os.DirFS(dir))
+}
+
+// audioElement is an SSML <audio> element whose audio was found.
+type audioElement struct {
+	start, end int    // characters before the start and end of the element
+	raw        string // src as written in the element
+	uri        string // src with character references replaced
+	audio      *Context
+}
+
+// resolveAudio finds the audio for each <audio> element in text. The returned text has each element
+// that was found replaced by a mark named after its src, padded with spaces to keep the TextPosition
+// of the rest of the text, so that the engine reports where it was without speaking its content.
+func (ctx *Context) resolveAudio(text string) (string, []*audioElement, error) {
+	if ctx.Audio == nil || !strings.Contains(text, "<audio") {
+		return text, nil, nil
+	}
+
+	var (
+		buf      strings.Builder
+		elements []*audioElement
+		chars    int // characters in text[:done]
+		done     int
+	)
+
+	for i := 0; ; {
+		start := strings.Index(text[i:], "<audio")
+		if start == -1 {
+			break
+		}
+		start += i
+		i = start + len("<audio")
+
+		tagEnd := tagLength(text[start:])
+		if i >= len(text) || !strings.ContainsRune(" \t\r\n/>", rune(text[i])) || tagEnd == -1 {
+			continue
+		}
+		tag := text[start : start+tagEnd]
+		end := start + tagEnd
+
+		if !strings.HasSuffix(tag, "/>") {
+			if close := strings.Index(text[end:], "</audio"); close != -1 {
+				if n := tagLength(text[end+close:]); n != -1 {
+					end += close + n
+				}
+			}
+		}
+		i = end
+
+		quote, raw, ok := tagAttr(tag, "src")
+		if !ok {
+			continue
+		}
+		uri := html.UnescapeString(raw)
+
+		// An <audio> start tag without a slash or an end tag is one character shorter than the mark,
+		// which could not replace it without moving the text after it. Such an element runs to the end of
+		// the document, so it is left to the engine.
+		mark := "<mark name=" + quote + raw + quote + "/>"
+		length := utf8.RuneCountInString(text[start:end])
+		if utf8.RuneCountInString(mark) > length {
+			continue
+		}
+
+		audio, err := ctx.Audio.ResolveAudio(uri)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			return text, nil, err
+		}
+
+		chars += utf8.RuneCountInString(text[done:start])
+		elements = append(elements, &audioElement{
+			start: chars,
+			end:   chars + length,
+			raw:   raw,
+			uri:   uri,
+			audio: audio,
+		})
+
+		buf.WriteString(text[done:start])
+		buf.WriteString(mark)
+		buf.WriteString(strings.Repeat(" ", length-utf8.RuneCountInString(mark)))
+
+		chars += length
+		done = end
+	}
+
+	if len(elements) == 0 {
+		return text, nil, nil
+	}
+
+	buf.WriteString(text[done:])
+
+	return buf.String(), elements, nil
+}
+
+// spliceAudio inserts the audio of each element at the mark that replaced it, turning the mark into an
+// EventPlay and moving the events after it to match. The events from index first on were synthesized
+// from text that started after textOffset characters.
+func (ctx *Context) spliceAudio(elements []*audioElement, first, textOffset int) {
+	rate := ctx.SampleRate()
+
+	for _, el := range elements {
+		for j := first; j < len(ctx.Events); j++ {
+			e := ctx.Events[j]
+			if e.Type != EventMark || (e.Name != el.raw && e.Name != el.uri) ||
+				e.TextPosition <= textOffset+el.start || e.TextPosition > textOffset+el.end+1 {
+				continue
+			}
+
+			e.Type = EventPlay
+			e.Name = el.uri
+
+			samples := el.audio.Samples
+			if from := el.audio.SampleRate(); len(samples) != 0 && from != rate {
+				samples = resample.Resample(samples, from, rate)
+			}
+
+			i := ctx.sampleAt(e.AudioPosition)
+			from := ctx.timeAt(i)
+			ctx.Samples = append(ctx.Samples[:i], append(append([]int16(nil), samples...), ctx.Samples[i:]...)...)
+
+			shift := ctx.timeAt(len(samples))
+			for _, later := range ctx.Events[j+1:] {
+				if later.AudioPosition >= from {
+					later.AudioPosition += shift
+				}
+			}
+
+			first = j + 1
+			break
+		}
+	}
+}
+
+// tagLength returns the length of the tag at the start of s, or -1 if it does not end.
+func tagLength(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '>':
+			return i + 1
+		case s[i] == '<':
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// tagAttr returns the quote and value of the named attribute of tag as they are written.
+func tagAttr(tag, name string) (quote, value string, ok bool) {
+	s := strings.TrimLeft(tag, "<")
+	s = strings.TrimLeft(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789:_-.")
+
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			return "", "", false
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\r\n")
+		if s == "" || (s[0] != '"' && s[0] != '\'') {
+			return "", "", false
+		}
+
+		end := strings.IndexByte(s[1:], s[0])
+		if end == -1 {
+			return "", "", false
+		}
+		if key == name {
+			return s[:1], s[1 : end+1], true
+		}
+		s = s[end+2:]
+	}
+}
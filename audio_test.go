@@ -0,0 +1,180 @@
+package espeak_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestReadAudio(t *testing.T) {
+	ctx := synthesize(t, 16000, `Hello, <mark name="there"/>there.`)
+
+	var wav, flac bytes.Buffer
+	if _, err := ctx.WriteWAV(&wav, &espeak.WAVOptions{Cues: []espeak.SynthEventType{espeak.EventMark}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.WriteFLAC(&flac, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"wav": wav.Bytes(), "flac": flac.Bytes()} {
+		got, err := espeak.ReadAudio(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if got.SampleRate() != 16000 {
+			t.Errorf("%s: sample rate is %d", name, got.SampleRate())
+		}
+		if !reflect.DeepEqual(got.Samples, ctx.Samples) {
+			t.Errorf("%s: %d samples, want %d", name, len(got.Samples), len(ctx.Samples))
+		}
+
+		var marks []string
+		for _, e := range got.Events {
+			if e.Type == espeak.EventMark {
+				marks = append(marks, e.Name)
+			}
+		}
+		if !reflect.DeepEqual(marks, []string{"there"}) {
+			t.Errorf("%s: marks are %q", name, marks)
+		}
+	}
+
+	if _, err := espeak.ReadAudio(strings.NewReader("OggS and some more")); err != espeak.ErrFormat {
+		t.Errorf("reading ogg: %v", err)
+	}
+}
+
+func TestAudioSplice(t *testing.T) {
+	ding := synthesize(t, 8000, "Ding.")
+	text := `Hello. <audio src="ding&amp;dong.wav">Bong.</audio> World.`
+
+	ctx := &espeak.Context{
+		Engine: espeaktest.New(22050),
+		Audio:  espeak.AudioMap{"ding&dong.wav": ding},
+	}
+	if err := ctx.SynthesizeText(text); err != nil {
+		t.Fatal(err)
+	}
+	plain := synthesize(t, 22050, "Hello. World.")
+
+	if ctx.Text != text {
+		t.Errorf("text is %q", ctx.Text)
+	}
+
+	var play *espeak.SynthEvent
+	var words []string
+	for _, e := range ctx.Events {
+		switch e.Type {
+		case espeak.EventPlay:
+			play = e
+		case espeak.EventWord:
+			words = append(words, string([]rune(text)[e.TextPosition-1:e.TextPosition-1+e.Length]))
+		}
+	}
+	if !reflect.DeepEqual(words, []string{"Hello", "World"}) {
+		t.Errorf("spoken words are %q", words)
+	}
+	if play == nil || play.Name != "ding&dong.wav" {
+		t.Fatalf("play event is %v", play)
+	}
+	if want := utf8.RuneCountInString("Hello. <"); play.TextPosition != want {
+		t.Errorf("play event is at character %d, want %d", play.TextPosition, want)
+	}
+
+	ding.SetSampleRate(22050)
+	if len(ctx.Samples) != len(plain.Samples)+len(ding.Samples) {
+		t.Fatalf("%d samples, want %d", len(ctx.Samples), len(plain.Samples)+len(ding.Samples))
+	}
+	at := int(play.AudioPosition * 22050 / 1e9)
+	if !reflect.DeepEqual(ctx.Samples[at:at+len(ding.Samples)], ding.Samples) {
+		t.Error("audio is not inserted at the play event")
+	}
+
+	last, want := ctx.Events[len(ctx.Events)-1], plain.Events[len(plain.Events)-1]
+	if d := last.AudioPosition - want.AudioPosition - ding.Duration(); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("end is at %v, want %v after %v", last.AudioPosition, ding.Duration(), want.AudioPosition)
+	}
+}
+
+func TestAudioMissing(t *testing.T) {
+	text := `Hello. <audio src="missing.wav">Bong.</audio>`
+
+	ctx := &espeak.Context{Engine: espeaktest.New(22050), Audio: espeak.AudioMap{}}
+	if err := ctx.SynthesizeText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	without := synthesize(t, 22050, text)
+	sameAudio(t, "missing", ctx, without)
+
+	failed := errors.New("no sound card")
+	ctx.Audio = espeak.AudioResolverFunc(func(uri string) (*espeak.Context, error) {
+		return nil, failed
+	})
+	if err := ctx.SynthesizeText(text); err != failed {
+		t.Errorf("error is %v", err)
+	}
+}
+
+// TestAudioUnclosed checks an <audio> element without an end tag, whose start tag is shorter than the
+// mark that would replace it.
+func TestAudioUnclosed(t *testing.T) {
+	for _, text := range []string{
+		`Hello. <audio src="ding.wav"> World.`,
+		`Hello. <audio src="ding.wav">`,
+		`<audio src=''>`,
+	} {
+		ctx := &espeak.Context{
+			Engine: espeaktest.New(22050),
+			Audio:  espeak.AudioMap{"ding.wav": synthesize(t, 22050, "Ding."), "": synthesize(t, 22050, "Dong.")},
+		}
+		if err := ctx.SynthesizeText(text); err != nil {
+			t.Fatal(err)
+		}
+
+		sameAudio(t, text, ctx, synthesize(t, 22050, text))
+	}
+}
+
+func TestAudioFS(t *testing.T) {
+	var wav bytes.Buffer
+	ding := synthesize(t, 8000, "Ding.")
+	if _, err := ding.WriteTo(&wav); err != nil {
+		t.Fatal(err)
+	}
+	resolver := espeak.AudioFS(fstest.MapFS{
+		"sounds/ding.wav": {Data: wav.Bytes()},
+		"sounds/bad.wav":  {Data: []byte("not a wav file")},
+	})
+
+	for _, uri := range []string{"sounds/ding.wav", "/sounds/ding.wav", "file:///sounds/ding.wav"} {
+		got, err := resolver.ResolveAudio(uri)
+		if err != nil {
+			t.Errorf("%s: %v", uri, err)
+		} else if !reflect.DeepEqual(got.Samples, ding.Samples) {
+			t.Errorf("%s: %d samples, want %d", uri, len(got.Samples), len(ding.Samples))
+		}
+	}
+
+	for _, uri := range []string{"sounds/dong.wav", "../sounds/ding.wav", "http://example.com/sounds/ding.wav"} {
+		if _, err := resolver.ResolveAudio(uri); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: error is %v", uri, err)
+		}
+	}
+
+	if _, err := resolver.ResolveAudio("sounds/bad.wav"); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("bad.wav: error is %v", err)
+	}
+}
@@ -58,7 +58,41 @@ emcc -o ../../libespeak-ng.inc.js \
 
 echo 'this.ESpeakNG = ESpeakNG;' >> ../../libespeak-ng.inc.js
 
+emcc -o ../../libespeak-ng.wasm.js \
+	src/.libs/libespeak-ng.a \
+	../get_stderr.c \
+	-s MODULARIZE=1 \
+	-s EXPORTED_FUNCTIONS='[
+		"_get_stderr",
+		"_malloc",
+		"_free",
+		"_espeak_SetSynthCallback",
+		"_espeak_ng_ClearErrorContext",
+		"_espeak_ng_GetSampleRate",
+		"_espeak_ng_GetStatusCodeMessage",
+		"_espeak_ng_Initialize",
+		"_espeak_ng_InitializeOutput",
+		"_espeak_ng_InitializePath",
+		"_espeak_ng_PrintStatusCodeMessage",
+		"_espeak_ng_SetParameter",
+		"_espeak_ng_SetVoiceByName",
+		"_espeak_ng_SetVoiceByProperties",
+		"_espeak_ng_Synthesize",
+		"_espeak_ListVoices"
+	]' \
+	-s ALLOW_TABLE_GROWTH=1 \
+	-s EXPORTED_RUNTIME_METHODS='["addFunction","getValue","setValue","HEAPU8"]' \
+	-s LZ4=1 \
+	-s EXPORT_NAME='"ESpeakNG"' \
+	-s WASM=1 \
+	--embed-file espeak-ng-data@/usr/share/espeak-ng-data \
+	--exclude-file espeak-ng-data/mbrola_ph \
+	--exclude-file espeak-ng-data/phondata-manifest \
+	-Oz
+
+echo 'this.ESpeakNG = ESpeakNG;' >> ../../libespeak-ng.wasm.js
+
 cd ../..
-echo '// +build js' > js_defs.gen.go
+echo '// +build js !cgo espeak_wazero' > js_defs.gen.go
 GOARCH=386 go tool cgo -godefs js_defs.go >> js_defs.gen.go
 rm -rf _obj
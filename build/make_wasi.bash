@@ -0,0 +1,59 @@
+#!/bin/bash -ex
+
+WASI_SDK_VERSION=20
+
+cd build
+[[ -d wasi-sdk ]] || (curl -L https://github.com/WebAssembly/wasi-sdk/releases/download/wasi-sdk-${WASI_SDK_VERSION}/wasi-sdk-${WASI_SDK_VERSION}.0-linux.tar.gz | tar xz && mv wasi-sdk-${WASI_SDK_VERSION}.0 wasi-sdk)
+[[ -d espeak-ng/.git ]] || git clone --depth=1 -b 1.49.2 https://github.com/espeak-ng/espeak-ng.git
+
+cd espeak-ng
+git fetch origin 1.49.2
+git checkout -f 1.49.2
+git reset --hard
+git clean -fdx
+
+./autogen.sh
+./configure --prefix=/usr --without-async --without-mbrola --without-sonic
+make
+
+rm -rf ../../wasi
+mkdir -p ../../wasi
+cp -r espeak-ng-data ../../wasi/espeak-ng-data
+rm -rf ../../wasi/espeak-ng-data/mbrola_ph ../../wasi/espeak-ng-data/phondata-manifest
+
+WASI_SDK="$(cd ../wasi-sdk && pwd)"
+
+make clean
+./configure --prefix=/usr --without-async --without-mbrola --without-sonic \
+	--host=wasm32-wasi \
+	CC="$WASI_SDK/bin/clang --sysroot=$WASI_SDK/share/wasi-sysroot" \
+	AR="$WASI_SDK/bin/llvm-ar" \
+	RANLIB="$WASI_SDK/bin/llvm-ranlib" \
+	CFLAGS="-Oz -D_WASI_EMULATED_SIGNAL -D_WASI_EMULATED_PROCESS_CLOCKS"
+make src/libespeak-ng.la
+
+"$WASI_SDK/bin/clang" --sysroot="$WASI_SDK/share/wasi-sysroot" \
+	-Oz \
+	-mexec-model=reactor \
+	-I src/include \
+	-o ../../wasi/libespeak-ng.wasm \
+	../get_stderr.c \
+	../wasi_callback.c \
+	src/.libs/libespeak-ng.a \
+	-lwasi-emulated-signal \
+	-lwasi-emulated-process-clocks \
+	-Wl,--export=malloc \
+	-Wl,--export=free \
+	-Wl,--export=get_stderr \
+	-Wl,--export=espeak_ng_ClearErrorContext \
+	-Wl,--export=espeak_ng_GetSampleRate \
+	-Wl,--export=espeak_ng_GetStatusCodeMessage \
+	-Wl,--export=espeak_ng_Initialize \
+	-Wl,--export=espeak_ng_InitializeOutput \
+	-Wl,--export=espeak_ng_InitializePath \
+	-Wl,--export=espeak_ng_PrintStatusCodeMessage \
+	-Wl,--export=espeak_ng_SetParameter \
+	-Wl,--export=espeak_ng_SetVoiceByName \
+	-Wl,--export=espeak_ng_SetVoiceByProperties \
+	-Wl,--export=espeak_ng_Synthesize \
+	-Wl,--export=espeak_ListVoices
@@ -0,0 +1,15 @@
+#include <espeak-ng/espeak_ng.h>
+
+__attribute__((import_module("env"), import_name("synth_callback")))
+extern int host_synth_callback(short *wav, int numsamples, espeak_EVENT *events);
+
+static int synth_callback(short *wav, int numsamples, espeak_EVENT *events)
+{
+	return host_synth_callback(wav, numsamples, events);
+}
+
+__attribute__((export_name("set_synth_callback")))
+void set_synth_callback(void)
+{
+	espeak_SetSynthCallback(synth_callback);
+}
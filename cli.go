@@ -0,0 +1,703 @@
+// +build !js
+
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// defaultCommandSampleRate is the sample rate reported by a CommandEngine that cannot run espeak-ng. It
+// is the rate of every voice that comes with espeak-ng.
+const defaultCommandSampleRate = 22050
+
+// phonemeSeparator separates the phonemes of a word in the phoneme mnemonics that espeak-ng prints.
+const phonemeSeparator = "|"
+
+// CommandEngine is an Engine that runs a locally installed espeak-ng program for each call, for when
+// neither cgo nor the WebAssembly build of espeak-ng can be used. It can be assigned to Context.Engine
+// or DefaultEngine at run time, and building with the espeak_cli tag makes it the DefaultEngine.
+//
+// The program does not report synthesis events, so they are rebuilt from the text and from the phonemes
+// that espeak-ng prints for it (espeak-ng -x). Word, sentence, mark, and phoneme events are at their
+// exact positions in the text, but their positions in the audio are estimated from the number of
+// phonemes spoken before them. Settings that the program cannot express, such as pitch range or choosing
+// a voice by age, are reported as errors rather than silently ignored.
+//
+// The program is not run until it is needed, so a CommandEngine can be created on a system that does
+// not have espeak-ng; its methods then return errors instead. A CommandEngine may be used from multiple
+// goroutines at the same time.
+type CommandEngine struct {
+	// Path is the espeak-ng program to run. If Path is empty, "espeak-ng" is looked up in $PATH.
+	Path string
+
+	mu         sync.Mutex
+	path       string
+	sampleRate int
+	voices     []*Voice
+}
+
+func unsupported(feature string) error {
+	return errors.New("espeak: " + feature + " is not supported by the espeak-ng command-line backend")
+}
+
+// command returns the path of the program, looking it up the first time it is found.
+func (e *CommandEngine) command() (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.path != "" {
+		return e.path, nil
+	}
+
+	name := e.Path
+	if name == "" {
+		name = "espeak-ng"
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("espeak: cannot find espeak-ng executable: %v", err)
+	}
+
+	e.path = path
+	return path, nil
+}
+
+// SampleRate implements Engine. The rate is only reported in the audio that espeak-ng produces, so the
+// first call synthesizes a short sound to find it. If the program cannot be run, SampleRate returns
+// 22050, the rate of the voices that come with espeak-ng, and Synthesize returns the error instead.
+//
+// SampleRate always returns the same value; audio from a voice with a different rate is converted.
+func (e *CommandEngine) SampleRate() int {
+	e.mu.Lock()
+	rate := e.sampleRate
+	e.mu.Unlock()
+
+	if rate != 0 {
+		return rate
+	}
+
+	_, rate, _, err := e.run("a", nil)
+	if err != nil {
+		rate = defaultCommandSampleRate
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.sampleRate == 0 {
+		e.sampleRate = rate
+	}
+
+	return e.sampleRate
+}
+
+// ListVoices implements Engine. It returns nil if the program cannot be run; use Voices to find out why.
+func (e *CommandEngine) ListVoices() []*Voice {
+	voices, _ := e.Voices()
+	return voices
+}
+
+// Voices is like ListVoices, but returns the error if the voices cannot be listed.
+func (e *CommandEngine) Voices() ([]*Voice, error) {
+	e.mu.Lock()
+	cached := e.voices
+	e.mu.Unlock()
+
+	if cached == nil {
+		path, err := e.command()
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := exec.Command(path, "--voices").Output()
+		if err != nil {
+			return nil, commandError(err)
+		}
+
+		cached, err = readVoices(out)
+		if err != nil {
+			return nil, err
+		}
+
+		e.mu.Lock()
+		e.voices = cached
+		e.mu.Unlock()
+	}
+
+	voices := make([]*Voice, len(cached))
+	for i, v := range cached {
+		voice := *v
+		voice.Languages = append([]Language(nil), v.Languages...)
+		voices[i] = &voice
+	}
+
+	return voices, nil
+}
+
+// readVoices parses the table printed by espeak-ng --voices:
+//
+//	Pty Language       Age/Gender VoiceName          File                 Other Languages
+//	 5  en-gb           --/M      English_(Great_Britain) gmw/en          (en 2)
+func readVoices(out []byte) ([]*Voice, error) {
+	voices := []*Voice{}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for first := true; s.Scan(); first = false {
+		if first {
+			continue
+		}
+
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		priority, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("espeak: cannot parse voice list: %v", err)
+		}
+
+		voice := &Voice{
+			Name:       strings.Replace(fields[3], "_", " ", -1),
+			Languages:  []Language{{Priority: uint8(priority), Name: fields[1]}},
+			Identifier: fields[4],
+		}
+
+		if ageGender := strings.SplitN(fields[2], "/", 2); len(ageGender) == 2 {
+			if age, err := strconv.Atoi(ageGender[0]); err == nil {
+				voice.Age = uint8(age)
+			}
+
+			switch ageGender[1] {
+			case "M":
+				voice.Gender = Male
+			case "F":
+				voice.Gender = Female
+			}
+		}
+
+		// Other languages are listed as (name priority) pairs.
+		other := strings.Join(fields[5:], " ")
+		for other != "" {
+			start := strings.IndexByte(other, '(')
+			end := strings.IndexByte(other, ')')
+			if start == -1 || end < start {
+				break
+			}
+
+			if pair := strings.Fields(other[start+1 : end]); len(pair) == 2 {
+				if p, err := strconv.Atoi(pair[1]); err == nil {
+					voice.Languages = append(voice.Languages, Language{Priority: uint8(p), Name: pair[0]})
+				}
+			}
+
+			other = other[end+1:]
+		}
+
+		voices = append(voices, voice)
+	}
+
+	return voices, s.Err()
+}
+
+// ValidVoice implements Engine.
+func (e *CommandEngine) ValidVoice(voice VoiceProperties) error {
+	_, err := e.voiceArg(voice)
+	return err
+}
+
+// voiceArg returns the argument of the -v flag that selects voice, or "" for the default voice.
+func (e *CommandEngine) voiceArg(voice VoiceProperties) (string, error) {
+	if voice.Age != 0 {
+		return "", unsupported("selecting a voice by age")
+	}
+
+	if voice.Gender == Neutral {
+		return "", unsupported("selecting a neutral voice")
+	}
+
+	if voice == (VoiceProperties{}) {
+		return "", nil
+	}
+
+	var arg string
+	switch {
+	case voice.Name != "":
+		v, err := e.findVoice(voice.Name, "")
+		if err != nil {
+			return "", err
+		}
+		if v == nil {
+			return "", errors.New("espeak: voice not found: " + voice.Name)
+		}
+		arg = v.Identifier
+	case voice.Language != "":
+		v, err := e.findVoice("", voice.Language)
+		if err != nil {
+			return "", err
+		}
+		if v == nil {
+			return "", errors.New("espeak: no voice found for language: " + voice.Language)
+		}
+		arg = voice.Language
+	}
+
+	if voice.Gender != Unknown || voice.Variant != 0 {
+		variant := voice.Variant
+		if variant == 0 {
+			variant = 1
+		}
+
+		if voice.Gender == Female {
+			arg += "+f" + strconv.Itoa(int(variant))
+		} else {
+			arg += "+m" + strconv.Itoa(int(variant))
+		}
+	}
+
+	return arg, nil
+}
+
+func (e *CommandEngine) findVoice(name, language string) (*Voice, error) {
+	voices, err := e.Voices()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range voices {
+		if name != "" && (strings.EqualFold(v.Name, name) || strings.EqualFold(v.Identifier, name)) {
+			return v, nil
+		}
+
+		for _, l := range v.Languages {
+			if language != "" && strings.EqualFold(l.Name, language) {
+				return v, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Synthesize implements Engine.
+func (e *CommandEngine) Synthesize(ctx *Context, text string, settings Settings) error {
+	if settings.Range != 50 {
+		return unsupported("pitch range")
+	}
+
+	// espeak-ng -p stops at 99, unlike the library, which allows 100.
+	if settings.Pitch > 99 {
+		return unsupported("a pitch of 100")
+	}
+
+	voice, err := e.voiceArg(settings.Voice)
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"-s", strconv.Itoa(settings.Rate),
+		"-a", strconv.Itoa(settings.Volume),
+		"-p", strconv.Itoa(settings.Pitch),
+	}
+	if voice != "" {
+		args = append(args, "-v", voice)
+	}
+
+	samples, rate, phonemes, err := e.run(text, args)
+	if err != nil {
+		return err
+	}
+
+	if want := e.SampleRate(); rate != want {
+		samples = resample.Resample(samples, rate, want)
+		rate = want
+	}
+
+	ctx.Samples = append(ctx.Samples, samples...)
+	ctx.Events = append(ctx.Events, rebuildEvents(text, parsePhonemes(phonemes), samples, rate)...)
+
+	return nil
+}
+
+// run runs espeak-ng on SSML text with the given extra arguments, and returns the audio, its sample rate,
+// and the phoneme mnemonics of the text.
+func (e *CommandEngine) run(text string, args []string) ([]int16, int, []byte, error) {
+	path, err := e.command()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// The audio is written to standard output, so the phonemes need a file of their own.
+	phonout, err := os.CreateTemp("", "espeak-ng-phonemes-*.txt")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer os.Remove(phonout.Name())
+	if err = phonout.Close(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	args = append([]string{
+		"--stdout",
+		"-m",
+		"-b", "1",
+		"-x",
+		"--sep=" + phonemeSeparator,
+		"--phonout=" + phonout.Name(),
+	}, args...)
+	args = append(args, "--stdin")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, 0, nil, errors.New("espeak: " + msg)
+		}
+		return nil, 0, nil, commandError(err)
+	}
+
+	samples, rate, err := readStdoutWAV(out)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	phonemes, err := os.ReadFile(phonout.Name())
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return samples, rate, phonemes, nil
+}
+
+func commandError(err error) error {
+	return fmt.Errorf("espeak: running espeak-ng: %v", err)
+}
+
+// readStdoutWAV decodes the WAV file written by espeak-ng --stdout. The sizes in the header are
+// placeholders because the output is streamed, so the data chunk extends to the end of the file.
+func readStdoutWAV(b []byte) ([]int16, int, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, 0, errors.New("espeak: espeak-ng did not produce a wav file")
+	}
+
+	var rate int
+
+	b = b[12:]
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+
+		switch id {
+		case "fmt ":
+			if len(b) < 16 {
+				return nil, 0, io.ErrUnexpectedEOF
+			}
+
+			format := binary.LittleEndian.Uint16(b[0:])
+			channels := binary.LittleEndian.Uint16(b[2:])
+			bits := binary.LittleEndian.Uint16(b[14:])
+			if format != 1 || channels != 1 || bits != 16 {
+				return nil, 0, fmt.Errorf("espeak: unexpected wav format from espeak-ng (format %d, %d channels, %d bits)", format, channels, bits)
+			}
+
+			rate = int(binary.LittleEndian.Uint32(b[4:]))
+		case "data":
+			if rate == 0 {
+				return nil, 0, errors.New("espeak: missing fmt chunk in wav file from espeak-ng")
+			}
+
+			samples := make([]int16, len(b)/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(b[i*2:]))
+			}
+
+			return samples, rate, nil
+		}
+
+		if size > len(b) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		b = b[size+size&1:]
+	}
+
+	return nil, 0, errors.New("espeak: missing data chunk in wav file from espeak-ng")
+}
+
+// parsePhonemes parses the phoneme mnemonics printed by espeak-ng -x with a separator. Each line is a
+// clause, words are separated by spaces, and the phonemes of a word are separated by phonemeSeparator:
+//
+//	h|@|l|'oU w|'3:|l|d
+//
+// Stress marks are removed, as are pauses, which start with an underscore.
+func parsePhonemes(out []byte) [][][]string {
+	var clauses [][][]string
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var clause [][]string
+		for _, field := range strings.Fields(s.Text()) {
+			var word []string
+			for _, ph := range strings.Split(field, phonemeSeparator) {
+				ph = strings.TrimLeft(ph, "',%=")
+				if ph != "" && !strings.HasPrefix(ph, "_") {
+					word = append(word, ph)
+				}
+			}
+
+			if len(word) != 0 {
+				clause = append(clause, word)
+			}
+		}
+
+		if len(clause) != 0 {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	return clauses
+}
+
+const (
+	// clausePause is the length of the pause between clauses, counted in phonemes.
+	clausePause = 4
+
+	// silenceThreshold is the level below which the audio at either end of the speech is silence.
+	silenceThreshold = 64
+)
+
+// rebuildEvents returns the events that espeak-ng would have reported for text. Text positions are
+// exact, counted in characters from 1 like the library does.
+//
+// Audio positions are estimated. The words that espeak-ng printed phonemes for are shared between the
+// words of the text in order, one each if there are as many of both, and the audible part of the audio is
+// shared between the phonemes, with a longer pause at the end of each clause.
+func rebuildEvents(text string, clauses [][][]string, samples []int16, sampleRate int) []*SynthEvent {
+	type word struct {
+		pos, length int
+		sentence    bool
+		end         bool
+		mark        *SynthEvent
+	}
+
+	var (
+		words     []word
+		count     int // words, not counting marks
+		pos       int
+		inWord    bool
+		newSent   = true
+		endOfSent bool
+	)
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if r == '<' {
+			if end := strings.IndexByte(text[i:], '>'); end != -1 {
+				tag := text[i : i+end+1]
+				if e := tagEvent(tag); e != nil {
+					e.TextPosition = pos + 1
+					words = append(words, word{mark: e})
+				}
+				pos += utf8.RuneCountInString(tag)
+				i += end + 1
+				inWord = false
+				continue
+			}
+		}
+
+		pos++
+		i += size
+
+		if unicode.IsSpace(r) {
+			inWord = false
+			if endOfSent {
+				newSent = true
+				endOfSent = false
+			}
+			continue
+		}
+
+		if r == '.' || r == '!' || r == '?' {
+			endOfSent = true
+			if n := len(words); n != 0 && words[n-1].mark == nil {
+				words[n-1].end = true
+			}
+		}
+
+		if unicode.IsPunct(r) && !inWord {
+			continue
+		}
+
+		if !inWord {
+			words = append(words, word{pos: pos, sentence: newSent})
+			count++
+			newSent = false
+			inWord = true
+		}
+		if w := &words[len(words)-1]; !unicode.IsPunct(r) {
+			w.length = pos - w.pos + 1
+		}
+	}
+
+	// Flatten the phonemes, and find the time, in phonemes and pauses, at which each spoken word starts.
+	var (
+		spoken [][]string
+		starts []int
+		units  int
+	)
+	for c, clause := range clauses {
+		if c != 0 {
+			units += clausePause
+		}
+		for _, w := range clause {
+			spoken = append(spoken, w)
+			starts = append(starts, units)
+			units += len(w)
+		}
+	}
+	starts = append(starts, units)
+
+	first, last := 0, len(samples)
+	for first < last && abs16(samples[first]) < silenceThreshold {
+		first++
+	}
+	for last > first && abs16(samples[last-1]) < silenceThreshold {
+		last--
+	}
+
+	at := func(unit int) time.Duration {
+		sample := first
+		if units != 0 {
+			sample += (last - first) * unit / units
+		}
+		return time.Duration(sample) * time.Second / time.Duration(sampleRate)
+	}
+
+	// spokenFor returns the range of spoken words for word i of the text.
+	spokenFor := func(i int) (int, int) {
+		if count == 0 {
+			return 0, 0
+		}
+		return i * len(spoken) / count, (i + 1) * len(spoken) / count
+	}
+
+	var events []*SynthEvent
+	wordNumber, sentenceNumber := 0, 0
+	for _, w := range words {
+		from, _ := spokenFor(wordNumber)
+		start := at(starts[from])
+
+		if w.mark != nil {
+			w.mark.AudioPosition = start
+			events = append(events, w.mark)
+			continue
+		}
+
+		if w.sentence {
+			sentenceNumber++
+			events = append(events, &SynthEvent{
+				Type:          EventSentence,
+				TextPosition:  w.pos,
+				AudioPosition: start,
+				Number:        sentenceNumber,
+			})
+		}
+
+		from, to := spokenFor(wordNumber)
+		wordNumber++
+		events = append(events, &SynthEvent{
+			Type:          EventWord,
+			TextPosition:  w.pos,
+			Length:        w.length,
+			AudioPosition: start,
+			Number:        wordNumber,
+		})
+
+		end := starts[from]
+		for j := from; j < to; j++ {
+			for k, ph := range spoken[j] {
+				events = append(events, &SynthEvent{
+					Type:          EventPhoneme,
+					TextPosition:  w.pos,
+					AudioPosition: at(starts[j] + k),
+					Phoneme:       ph,
+				})
+			}
+			end = starts[j] + len(spoken[j])
+		}
+
+		if w.end {
+			events = append(events, &SynthEvent{
+				Type:          EventEnd,
+				TextPosition:  w.pos + w.length,
+				AudioPosition: at(end),
+			})
+		}
+	}
+
+	events = append(events, &SynthEvent{
+		Type:          EventMsgTerminated,
+		TextPosition:  pos,
+		AudioPosition: time.Duration(len(samples)) * time.Second / time.Duration(sampleRate),
+	})
+
+	return events
+}
+
+func abs16(v int16) int {
+	if v < 0 {
+		return -int(v)
+	}
+	return int(v)
+}
+
+// tagEvent returns the event for an SSML <mark> or <audio> tag, or nil for any other tag.
+func tagEvent(tag string) *SynthEvent {
+	var (
+		typ  SynthEventType
+		attr string
+	)
+
+	switch {
+	case strings.HasPrefix(tag, "<mark"):
+		typ, attr = EventMark, "name"
+	case strings.HasPrefix(tag, "<audio"):
+		typ, attr = EventPlay, "src"
+	default:
+		return nil
+	}
+
+	for _, quote := range []string{`"`, `'`} {
+		key := attr + "=" + quote
+		if start := strings.Index(tag, key); start != -1 {
+			value := tag[start+len(key):]
+			if end := strings.Index(value, quote); end != -1 {
+				return &SynthEvent{Type: typ, Name: value[:end]}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+// +build !js
+
+package espeak_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+// fakeCLIEnv makes the test binary act as espeak-ng when it is set, so that CommandEngine can be tested on
+// machines that do not have espeak-ng installed.
+const fakeCLIEnv = "ESPEAK_TEST_FAKE_CLI"
+
+const (
+	fakeCLIRate    = 16000
+	fakeCLILead    = 1000 // silent samples before the speech
+	fakeCLIPhoneme = 400  // samples in each phoneme
+	fakeCLIPause   = 1600 // silent samples between clauses
+)
+
+func init() {
+	if os.Getenv(fakeCLIEnv) == "1" {
+		os.Exit(fakeCLI(os.Args[1:]))
+	}
+}
+
+var fakeCLITags = regexp.MustCompile(`<[^>]*>`)
+
+// fakeCLI writes a voice list, or a WAV file with a tone for each letter, and the phonemes of the text
+// in the format of espeak-ng -x --sep=|, where each letter is a phoneme and each sentence is a clause.
+func fakeCLI(args []string) int {
+	var phonout string
+	for i, arg := range args {
+		switch {
+		case arg == "--voices":
+			os.Stdout.WriteString("Pty Language       Age/Gender VoiceName          File                 Other Languages\n" +
+				" 5  en-gb           --/M      English_(Great_Britain) gmw/en          (en 2)\n" +
+				" 5  fr-fr           --/M      French_(France)    roa/fr               (fr 5)\n")
+			return 0
+		case arg == "-v" && args[i+1] == "fr":
+			os.Stderr.WriteString("Error: voice data is missing\n")
+			return 1
+		case strings.HasPrefix(arg, "--phonout="):
+			phonout = strings.TrimPrefix(arg, "--phonout=")
+		}
+	}
+
+	text, _ := io.ReadAll(os.Stdin)
+
+	var phonemes strings.Builder
+	samples := make([]int16, fakeCLILead)
+	for c, clause := range strings.Split(fakeCLITags.ReplaceAllString(string(text), " "), ".") {
+		var words []string
+		for _, w := range strings.Fields(clause) {
+			w = strings.Trim(w, ",!?")
+			if w != "" {
+				words = append(words, "'"+strings.Join(strings.Split(w, ""), "|"))
+			}
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		if c != 0 {
+			samples = append(samples, make([]int16, fakeCLIPause)...)
+		}
+		for _, w := range words {
+			for range strings.Split(w, "|") {
+				for i := 0; i < fakeCLIPhoneme; i++ {
+					samples = append(samples, int16(4000*(i%16-8)))
+				}
+			}
+		}
+		phonemes.WriteString(" " + strings.Join(words, " ") + "\n")
+	}
+	samples = append(samples, make([]int16, fakeCLILead)...)
+
+	if err := os.WriteFile(phonout, []byte(phonemes.String()), 0644); err != nil {
+		return 1
+	}
+
+	// espeak-ng streams its output, so the sizes in the header are placeholders.
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("RIFF\xff\xff\xff\x7fWAVEfmt ")
+	binary.Write(w, binary.LittleEndian, []uint32{16, 1 | 1<<16, fakeCLIRate, 2 * fakeCLIRate, 2 | 16<<16})
+	w.WriteString("data\xff\xff\xff\x7f")
+	binary.Write(w, binary.LittleEndian, samples)
+	if err := w.Flush(); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+func fakeCommandEngine(t *testing.T) *espeak.CommandEngine {
+	path, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	t.Setenv(fakeCLIEnv, "1")
+
+	return &espeak.CommandEngine{Path: path}
+}
+
+func TestCommandEngine(t *testing.T) {
+	engine := fakeCommandEngine(t)
+
+	if rate := engine.SampleRate(); rate != fakeCLIRate {
+		t.Errorf("sample rate %d, want %d", rate, fakeCLIRate)
+	}
+
+	voices, err := engine.Voices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 2 || voices[0].Name != "English (Great Britain)" || voices[1].Identifier != "roa/fr" {
+		t.Errorf("unexpected voices %+v", voices)
+	}
+
+	ctx := espeak.Context{Engine: engine}
+	if err := ctx.SetVoiceProperties("", "en", espeak.Female, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SynthesizeText(`Hi, you. <mark name="m"/>Go!`); err != nil {
+		t.Fatal(err)
+	}
+
+	// "hi" and "you" are five phonemes, and "go" follows a pause the length of four phonemes.
+	if want := 2*fakeCLILead + 7*fakeCLIPhoneme + fakeCLIPause; len(ctx.Samples) != want {
+		t.Errorf("%d samples, want %d", len(ctx.Samples), want)
+	}
+
+	type event struct {
+		Type     espeak.SynthEventType
+		Text     int
+		Length   int
+		Audio    int // samples
+		Name     string
+		Phonemes string
+	}
+
+	// The pause is shared between the phonemes, so the speech after it starts after nine of eleven
+	// units of time.
+	speech := 7*fakeCLIPhoneme + fakeCLIPause
+	at := func(unit int) int {
+		return fakeCLILead + speech*unit/11
+	}
+
+	want := []event{
+		{Type: espeak.EventSentence, Text: 1, Audio: at(0)},
+		{Type: espeak.EventWord, Text: 1, Length: 2, Audio: at(0), Phonemes: "Hi"},
+		{Type: espeak.EventWord, Text: 5, Length: 3, Audio: at(2), Phonemes: "you"},
+		{Type: espeak.EventEnd, Text: 8, Audio: at(5)},
+		{Type: espeak.EventMark, Text: 10, Audio: at(9), Name: "m"},
+		{Type: espeak.EventSentence, Text: 26, Audio: at(9)},
+		{Type: espeak.EventWord, Text: 26, Length: 2, Audio: at(9), Phonemes: "Go"},
+		{Type: espeak.EventEnd, Text: 28, Audio: at(11)},
+		{Type: espeak.EventMsgTerminated, Text: 28, Audio: len(ctx.Samples)},
+	}
+
+	sample := func(e *espeak.SynthEvent) int {
+		return int(e.AudioPosition * fakeCLIRate / 1e9)
+	}
+
+	var got []event
+	for _, e := range ctx.Events {
+		if e.Type == espeak.EventPhoneme {
+			if n := len(got); n != 0 && e.TextPosition == got[n-1].Text {
+				got[n-1].Phonemes += e.Phoneme
+			} else {
+				t.Errorf("phoneme %q does not follow its word", e.Phoneme)
+			}
+			continue
+		}
+
+		got = append(got, event{Type: e.Type, Text: e.TextPosition, Length: e.Length, Audio: sample(e), Name: e.Name})
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestCommandEngineErrors(t *testing.T) {
+	engine := fakeCommandEngine(t)
+
+	settings := espeak.Settings{Rate: 175, Volume: 100, Pitch: 50, Range: 50}
+	for name, change := range map[string]func(*espeak.Settings){
+		"pitch range": func(s *espeak.Settings) { s.Range = 40 },
+		"pitch 100":   func(s *espeak.Settings) { s.Pitch = 100 },
+		"age":         func(s *espeak.Settings) { s.Voice.Age = 30 },
+		"voice":       func(s *espeak.Settings) { s.Voice.Name = "no such voice" },
+		"program":     func(s *espeak.Settings) { s.Voice.Language = "fr" },
+	} {
+		s := settings
+		change(&s)
+
+		var ctx espeak.Context
+		if err := engine.Synthesize(&ctx, "Hello.", s); err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if !strings.HasPrefix(err.Error(), "espeak: ") {
+			t.Errorf("%s: error %q is not from package espeak", name, err)
+		}
+	}
+
+	var ctx espeak.Context
+	if err := engine.Synthesize(&ctx, "Hello.", settings); err != nil {
+		t.Errorf("default settings: %v", err)
+	}
+}
+
+func TestCommandEngineMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	for _, engine := range []*espeak.CommandEngine{
+		{},
+		{Path: filepath.Join(t.TempDir(), "espeak-ng")},
+	} {
+		if rate := engine.SampleRate(); rate != 22050 {
+			t.Errorf("sample rate %d, want 22050", rate)
+		}
+
+		if voices := engine.ListVoices(); voices != nil {
+			t.Errorf("voices %v, want nil", voices)
+		}
+
+		if _, err := engine.Voices(); err == nil {
+			t.Error("expected an error from Voices")
+		}
+
+		ctx := espeak.Context{Engine: engine}
+		if err := ctx.SetVoice("English"); err == nil {
+			t.Error("expected an error from SetVoice")
+		}
+		if err := ctx.SynthesizeText("Hello."); err == nil {
+			t.Error("expected an error from SynthesizeText")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// +build !js,espeak_cli
+
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+// This backend is selected with the espeak_cli build tag. It passes the settings of each call on to a
+// CommandEngine, so the espeak-ng program is not looked for until it is first needed.
+
+var (
+	commandEngine   CommandEngine
+	commandSettings Settings
+)
+
+func getSampleRate() int {
+	return commandEngine.SampleRate()
+}
+
+func listVoices() []*Voice {
+	return commandEngine.ListVoices()
+}
+
+func setRate(rate int) error {
+	commandSettings.Rate = rate
+	return nil
+}
+
+func setVolume(volume int) error {
+	commandSettings.Volume = volume
+	return nil
+}
+
+func setPitch(pitch int) error {
+	commandSettings.Pitch = pitch
+	return nil
+}
+
+func setTone(tone int) error {
+	commandSettings.Range = tone
+	return nil
+}
+
+func setVoice(name, language string, gender Gender, age, variant uint8) error {
+	voice := VoiceProperties{
+		Name:     name,
+		Language: language,
+		Gender:   gender,
+		Age:      age,
+		Variant:  variant,
+	}
+
+	if err := commandEngine.ValidVoice(voice); err != nil {
+		return err
+	}
+
+	commandSettings.Voice = voice
+	return nil
+}
+
+func synthesize(text string, ctx *Context) error {
+	return commandEngine.Synthesize(ctx, text, commandSettings)
+}
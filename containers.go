@@ -0,0 +1,463 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// ContainerOptions controls the files written by Context.WriteAIFF, Context.WriteAU, and
+// Context.WriteCAF, and by the same methods of MultiChannel.
+type ContainerOptions struct {
+	// Format is the encoding of each sample. Samples are always big-endian, and PCM8 samples are
+	// signed, as these formats require. AIFF files holding Float32, ULaw, or ALaw samples are written in
+	// the AIFF-C format.
+	Format SampleFormat
+
+	// Dither adds noise when reducing the bit depth, as described for RawOptions.
+	Dither bool
+
+	// Markers lists the types of events that are written as markers, named like the cue points written
+	// by WriteWAV. Sun AU files cannot hold markers, so WriteAU ignores it.
+	Markers []SynthEventType
+}
+
+// marker is a named position in the audio, in samples.
+type marker struct {
+	sample uint64
+	label  string
+}
+
+// markers returns the events of the types in opts.Markers that fall within the given number of frames.
+func (ctx *Context) markers(opts *ContainerOptions, sampleRate, frames int) []marker {
+	if len(opts.Markers) == 0 {
+		return nil
+	}
+
+	wanted := make(map[SynthEventType]bool)
+	for _, t := range opts.Markers {
+		wanted[t] = true
+	}
+
+	var markers []marker
+	for _, e := range ctx.Events {
+		if !wanted[e.Type] || e.AudioPosition < 0 {
+			continue
+		}
+
+		sample := uint64(e.AudioPosition * time.Duration(sampleRate) / time.Second)
+		if sample > uint64(frames) {
+			continue
+		}
+
+		markers = append(markers, marker{sample: sample, label: cueLabel(e, ctx.Text)})
+	}
+
+	return markers
+}
+
+// aifcVersion1 is the timestamp in the FVER chunk of AIFF-C files written to the current standard.
+const aifcVersion1 = 0xA2805140
+
+// WriteAIFF writes the Samples in this Context to w in the AIFF format used by Apple and by many
+// professional audio tools. A nil opts writes 16-bit samples without markers.
+//
+// Markers are written as a MARK chunk. An AIFF file can hold at most 32767 markers and 4 gigabytes of
+// audio; an error is returned for audio that needs more.
+func (ctx *Context) WriteAIFF(w io.Writer, opts *ContainerOptions) (int64, error) {
+	return ctx.writeAIFF(w, opts, ctx.Samples, Mono)
+}
+
+// writeAIFF writes interleaved samples with the given layout, using the events of ctx for markers.
+// Layouts other than Mono and Stereo are recorded in a CHAN chunk, as Apple's software does.
+func (ctx *Context) writeAIFF(w io.Writer, opts *ContainerOptions, samples []int16, layout Layout) (int64, error) {
+	if opts == nil {
+		opts = &ContainerOptions{}
+	}
+
+	enc, err := newSampleEncoder(opts.Format, binary.BigEndian, opts.Dither)
+	if err != nil {
+		return 0, err
+	}
+	enc.signed = true
+
+	sampleRate := ctx.SampleRate()
+	if sampleRate <= 0 {
+		return 0, fmt.Errorf("espeak: sample rate %d cannot be stored in an aiff file", sampleRate)
+	}
+	channels := layout.Channels()
+	frames := len(samples) / channels
+	if uint64(frames) > math.MaxUint32 {
+		return 0, errors.New("espeak: audio is too long for an aiff file")
+	}
+
+	width := opts.Format.Size()
+	sampleSize := width * 8
+
+	// Formats other than integer PCM need the compression type from AIFF-C, with its name as a Pascal
+	// string. Apple gives G.711 audio the size of the samples it decodes to.
+	var compression []byte
+	switch opts.Format {
+	case Float32:
+		compression = append([]byte("fl32"), pstring("32-bit floating point")...)
+	case ULaw:
+		compression = append([]byte("ulaw"), pstring("\xb5Law 2:1")...)
+		sampleSize = 16
+	case ALaw:
+		compression = append([]byte("alaw"), pstring("aLaw 2:1")...)
+		sampleSize = 16
+	}
+
+	var chunks bytes.Buffer
+
+	if compression != nil {
+		var fver [4]byte
+		binary.BigEndian.PutUint32(fver[:], aifcVersion1)
+		writeAIFFChunk(&chunks, "FVER", fver[:])
+	}
+
+	comm := make([]byte, 18, 18+len(compression))
+	binary.BigEndian.PutUint16(comm[0:], uint16(channels))
+	binary.BigEndian.PutUint32(comm[2:], uint32(frames))
+	binary.BigEndian.PutUint16(comm[6:], uint16(sampleSize))
+	putExtended(comm[8:], float64(sampleRate))
+	writeAIFFChunk(&chunks, "COMM", append(comm, compression...))
+
+	if layout != Mono && layout != Stereo {
+		writeAIFFChunk(&chunks, "CHAN", channelLayout(layout))
+	}
+
+	if markers := ctx.markers(opts, sampleRate, frames); len(markers) != 0 {
+		if len(markers) > math.MaxInt16 {
+			return 0, fmt.Errorf("espeak: %d markers cannot be stored in an aiff file", len(markers))
+		}
+
+		mark := make([]byte, 2)
+		binary.BigEndian.PutUint16(mark, uint16(len(markers)))
+		for i, m := range markers {
+			// Marker IDs must be positive.
+			var b [6]byte
+			binary.BigEndian.PutUint16(b[0:], uint16(i+1))
+			binary.BigEndian.PutUint32(b[2:], uint32(m.sample))
+			mark = append(append(mark, b[:]...), pstring(m.label)...)
+		}
+		writeAIFFChunk(&chunks, "MARK", mark)
+	}
+
+	dataBytes := uint64(len(samples)) * uint64(width)
+	var pad []byte
+	if dataBytes%2 == 1 {
+		pad = []byte{0}
+	}
+
+	formSize := uint64(4+chunks.Len()+binary.Size(chunkHeader{})+8+len(pad)) + dataBytes
+	if formSize > math.MaxUint32 {
+		return 0, errors.New("espeak: audio is too long for an aiff file")
+	}
+
+	form := chunkHeader{
+		ID:   [...]byte{'F', 'O', 'R', 'M'},
+		Size: uint32(formSize),
+	}
+	formType := []byte("AIFF")
+	if compression != nil {
+		formType = []byte("AIFC")
+	}
+
+	cw := countWriter{w: w}
+	cw.check(binary.Write(&cw, binary.BigEndian, &form))
+	cw.Write(formType)
+	cw.Write(chunks.Bytes())
+	cw.check(binary.Write(&cw, binary.BigEndian, &chunkHeader{
+		ID:   [...]byte{'S', 'S', 'N', 'D'},
+		Size: uint32(8 + dataBytes),
+	}))
+	cw.Write(make([]byte, 8)) // offset and block size
+	cw.writeSamples(samples, enc)
+	cw.Write(pad)
+
+	return cw.n, cw.err
+}
+
+// writeAIFFChunk is like writeSubChunk, but with the big-endian size used by AIFF files.
+func writeAIFFChunk(buf *bytes.Buffer, id string, data []byte) {
+	binary.Write(buf, binary.BigEndian, &chunkHeader{
+		ID:   [...]byte{id[0], id[1], id[2], id[3]},
+		Size: uint32(len(data)),
+	})
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// pstring encodes s as a Pascal string padded to an even length, as used by AIFF files. Strings longer
+// than 255 bytes are cut short at the end of a character.
+func pstring(s string) []byte {
+	for len(s) > 255 {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+
+	b := append([]byte{byte(len(s))}, s...)
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+
+	return b
+}
+
+// putExtended stores f, which must be positive, in the first 10 bytes of b as an IEEE 754 80-bit
+// extended precision number, which AIFF files use for the sample rate.
+func putExtended(b []byte, f float64) {
+	frac, exp := math.Frexp(f) // f = frac × 2^exp, where 0.5 <= frac < 1
+
+	binary.BigEndian.PutUint16(b, uint16(exp-1+16383))
+	binary.BigEndian.PutUint64(b[2:], uint64(math.Ldexp(frac, 64)))
+}
+
+// auEncodings are the encoding numbers that Sun AU files use for each SampleFormat.
+var auEncodings = map[SampleFormat]uint32{
+	ULaw:    1,
+	PCM8:    2,
+	PCM16:   3,
+	PCM24:   4,
+	PCM32:   5,
+	Float32: 6,
+	ALaw:    27,
+}
+
+// auUnknownSize is the data size of a Sun AU file whose length is not stored in its header.
+const auUnknownSize = 0xFFFFFFFF
+
+type auHeader struct {
+	Magic      [4]byte
+	DataOffset uint32
+	DataSize   uint32
+	Encoding   uint32
+	SampleRate uint32
+	Channels   uint32
+	Annotation [8]byte
+}
+
+// WriteAU writes the Samples in this Context to w in the Sun AU format, also known as .snd. A nil opts
+// writes 16-bit samples.
+//
+// The header of an AU file stores the size of the audio in 32 bits. Longer audio is written with the
+// size marked as unknown, which tells readers to continue to the end of the file.
+func (ctx *Context) WriteAU(w io.Writer, opts *ContainerOptions) (int64, error) {
+	if opts == nil {
+		opts = &ContainerOptions{}
+	}
+
+	enc, err := newSampleEncoder(opts.Format, binary.BigEndian, opts.Dither)
+	if err != nil {
+		return 0, err
+	}
+	enc.signed = true
+
+	sampleRate := ctx.SampleRate()
+	if sampleRate <= 0 || int64(sampleRate) > math.MaxUint32 {
+		return 0, fmt.Errorf("espeak: sample rate %d cannot be stored in an au file", sampleRate)
+	}
+
+	header := auHeader{
+		Magic:      [...]byte{'.', 's', 'n', 'd'},
+		DataOffset: uint32(binary.Size(auHeader{})),
+		DataSize:   auUnknownSize,
+		Encoding:   auEncodings[opts.Format],
+		SampleRate: uint32(sampleRate),
+		Channels:   1,
+	}
+	if dataBytes := uint64(len(ctx.Samples)) * uint64(opts.Format.Size()); dataBytes < auUnknownSize {
+		header.DataSize = uint32(dataBytes)
+	}
+
+	cw := countWriter{w: w}
+	cw.check(binary.Write(&cw, binary.BigEndian, &header))
+	cw.writeSamples(ctx.Samples, enc)
+
+	return cw.n, cw.err
+}
+
+// CAF format flags for linear PCM.
+const (
+	cafLinearPCMFormatFlagIsFloat = 1 << 0
+)
+
+type cafFileHeader struct {
+	FileType    [4]byte
+	FileVersion uint16
+	FileFlags   uint16
+}
+
+type cafChunkHeader struct {
+	ChunkType [4]byte
+	ChunkSize int64
+}
+
+type cafAudioDescription struct {
+	SampleRate       float64
+	FormatID         [4]byte
+	FormatFlags      uint32
+	BytesPerPacket   uint32
+	FramesPerPacket  uint32
+	ChannelsPerFrame uint32
+	BitsPerChannel   uint32
+}
+
+type cafMarker struct {
+	Type          uint32
+	FramePosition float64
+	MarkerID      uint32
+	SMPTETime     [8]byte
+	Channel       uint32
+}
+
+// WriteCAF writes the Samples in this Context to w in Apple's Core Audio Format, which stores sizes in
+// 64 bits and so has no practical limit on the length of the audio. A nil opts writes 16-bit samples
+// without markers.
+//
+// Markers are written as a mark chunk, with their names in a strg chunk.
+func (ctx *Context) WriteCAF(w io.Writer, opts *ContainerOptions) (int64, error) {
+	return ctx.writeCAF(w, opts, ctx.Samples, Mono)
+}
+
+// writeCAF writes interleaved samples with the given layout, using the events of ctx for markers.
+// Layouts other than Mono and Stereo are recorded in a chan chunk.
+func (ctx *Context) writeCAF(w io.Writer, opts *ContainerOptions, samples []int16, layout Layout) (int64, error) {
+	if opts == nil {
+		opts = &ContainerOptions{}
+	}
+
+	enc, err := newSampleEncoder(opts.Format, binary.BigEndian, opts.Dither)
+	if err != nil {
+		return 0, err
+	}
+	enc.signed = true
+
+	sampleRate := ctx.SampleRate()
+	if sampleRate <= 0 {
+		return 0, fmt.Errorf("espeak: sample rate %d cannot be stored in a caf file", sampleRate)
+	}
+
+	width := opts.Format.Size()
+	channels := layout.Channels()
+	desc := cafAudioDescription{
+		SampleRate:       float64(sampleRate),
+		FormatID:         [...]byte{'l', 'p', 'c', 'm'},
+		BytesPerPacket:   uint32(width * channels),
+		FramesPerPacket:  1,
+		ChannelsPerFrame: uint32(channels),
+		BitsPerChannel:   uint32(width * 8),
+	}
+	switch opts.Format {
+	case Float32:
+		desc.FormatFlags = cafLinearPCMFormatFlagIsFloat
+	case ULaw:
+		desc.FormatID = [...]byte{'u', 'l', 'a', 'w'}
+	case ALaw:
+		desc.FormatID = [...]byte{'a', 'l', 'a', 'w'}
+	}
+
+	var chunks bytes.Buffer
+	writeCAFChunk(&chunks, "desc", &desc)
+
+	if layout != Mono && layout != Stereo {
+		writeCAFChunk(&chunks, "chan", channelLayout(layout))
+	}
+
+	if markers := ctx.markers(opts, sampleRate, len(samples)/channels); len(markers) != 0 {
+		if uint64(len(markers)) > math.MaxUint32 {
+			return 0, fmt.Errorf("espeak: %d markers cannot be stored in a caf file", len(markers))
+		}
+
+		// Each marker refers to its name by the ID of a string in the strg chunk.
+		var (
+			ids     []uint32
+			offsets []int64
+			names   []byte
+			marks   []cafMarker
+		)
+		for i, m := range markers {
+			id := uint32(i + 1)
+			ids = append(ids, id)
+			offsets = append(offsets, int64(len(names)))
+			names = append(append(names, m.label...), 0)
+			marks = append(marks, cafMarker{
+				FramePosition: float64(m.sample),
+				MarkerID:      id,
+			})
+		}
+
+		var strg bytes.Buffer
+		binary.Write(&strg, binary.BigEndian, uint32(len(markers)))
+		for i := range ids {
+			binary.Write(&strg, binary.BigEndian, ids[i])
+			binary.Write(&strg, binary.BigEndian, offsets[i])
+		}
+		strg.Write(names)
+		writeCAFChunk(&chunks, "strg", strg.Bytes())
+
+		var mark bytes.Buffer
+		binary.Write(&mark, binary.BigEndian, uint32(0)) // no SMPTE times
+		binary.Write(&mark, binary.BigEndian, uint32(len(markers)))
+		binary.Write(&mark, binary.BigEndian, marks)
+		writeCAFChunk(&chunks, "mark", mark.Bytes())
+	}
+
+	dataBytes := uint64(len(samples)) * uint64(width)
+	if dataBytes > math.MaxInt64-4 {
+		return 0, errors.New("espeak: audio is too long for a caf file")
+	}
+
+	cw := countWriter{w: w}
+	cw.check(binary.Write(&cw, binary.BigEndian, &cafFileHeader{
+		FileType:    [...]byte{'c', 'a', 'f', 'f'},
+		FileVersion: 1,
+	}))
+	cw.Write(chunks.Bytes())
+	cw.check(binary.Write(&cw, binary.BigEndian, &cafChunkHeader{
+		ChunkType: [...]byte{'d', 'a', 't', 'a'},
+		ChunkSize: int64(4 + dataBytes),
+	}))
+	cw.Write(make([]byte, 4)) // edit count
+	cw.writeSamples(samples, enc)
+
+	return cw.n, cw.err
+}
+
+// cafChannelLayoutUseBitmap is the layout tag of an AudioChannelLayout that lists its speakers in a
+// bitmap. Apple numbers the speakers in the same order as the channel mask of a WAV file, so the bitmap
+// is the Layout itself.
+const cafChannelLayoutUseBitmap = 1 << 16
+
+// channelLayout returns an AudioChannelLayout for layout, as stored in the chan chunk of a CAF file and
+// the CHAN chunk of an AIFF file.
+func channelLayout(layout Layout) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[0:], cafChannelLayoutUseBitmap)
+	binary.BigEndian.PutUint32(b[4:], uint32(layout))
+	return b // no channel descriptions
+}
+
+// writeCAFChunk writes data, which is encoded with binary.Write unless it is a []byte, as a CAF chunk.
+func writeCAFChunk(buf *bytes.Buffer, id string, data interface{}) {
+	b, ok := data.([]byte)
+	if !ok {
+		var enc bytes.Buffer
+		binary.Write(&enc, binary.BigEndian, data)
+		b = enc.Bytes()
+	}
+
+	binary.Write(buf, binary.BigEndian, &cafChunkHeader{
+		ChunkType: [...]byte{id[0], id[1], id[2], id[3]},
+		ChunkSize: int64(len(b)),
+	})
+	buf.Write(b)
+}
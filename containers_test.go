@@ -0,0 +1,302 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+const containerText = `Hello, world. <mark name="here"/>Again!`
+
+// chunkFormat is the way that a container stores the size of each chunk.
+type chunkFormat int
+
+const (
+	riffFormat chunkFormat = iota // 32-bit little-endian sizes, padded to an even length
+	aiffFormat                    // 32-bit big-endian sizes, padded to an even length
+	cafFormat                     // 64-bit big-endian sizes, not padded
+)
+
+// chunks splits the chunks after a header of the given size, returning their bodies by ID and the IDs in
+// the order that they appear.
+func chunks(t *testing.T, data []byte, header int, format chunkFormat) (map[string][]byte, []string) {
+	found := make(map[string][]byte)
+	var ids []string
+
+	data = data[header:]
+	for len(data) != 0 {
+		var size uint64
+		switch {
+		case len(data) < 8 || format == cafFormat && len(data) < 12:
+			t.Fatalf("truncated chunk header after %q", ids)
+		case format == riffFormat:
+			size = uint64(binary.LittleEndian.Uint32(data[4:]))
+		case format == aiffFormat:
+			size = uint64(binary.BigEndian.Uint32(data[4:]))
+		default:
+			size = binary.BigEndian.Uint64(data[4:])
+		}
+
+		id := string(data[:4])
+		if format == cafFormat {
+			data = data[12:]
+		} else {
+			data = data[8:]
+		}
+		if size > uint64(len(data)) {
+			t.Fatalf("chunk %q has size %d, but only %d bytes remain", id, size, len(data))
+		}
+
+		found[id] = data[:size]
+		ids = append(ids, id)
+		if format != cafFormat && size%2 == 1 {
+			if size == uint64(len(data)) {
+				t.Fatalf("chunk %q is missing its padding byte", id)
+			}
+			size++
+		}
+		data = data[size:]
+	}
+
+	return found, ids
+}
+
+func TestWriteAIFF(t *testing.T) {
+	ctx := synthesize(t, 22050, containerText)
+
+	var buf bytes.Buffer
+	n, err := ctx.WriteAIFF(&buf, &espeak.ContainerOptions{
+		Markers: []espeak.SynthEventType{espeak.EventSentence, espeak.EventMark},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if n != int64(len(data)) {
+		t.Errorf("WriteAIFF returned %d, but wrote %d bytes", n, len(data))
+	}
+
+	if string(data[:4]) != "FORM" || string(data[8:12]) != "AIFF" {
+		t.Fatalf("bad header %q", data[:12])
+	}
+	if size := binary.BigEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Errorf("FORM size is %d, want %d", size, len(data)-8)
+	}
+
+	c, _ := chunks(t, data, 12, aiffFormat)
+
+	comm := c["COMM"]
+	if channels := binary.BigEndian.Uint16(comm); channels != 1 {
+		t.Errorf("%d channels", channels)
+	}
+	if frames := binary.BigEndian.Uint32(comm[2:]); int(frames) != len(ctx.Samples) {
+		t.Errorf("%d sample frames, want %d", frames, len(ctx.Samples))
+	}
+	if bits := binary.BigEndian.Uint16(comm[6:]); bits != 16 {
+		t.Errorf("%d bits per sample", bits)
+	}
+	exp := int(binary.BigEndian.Uint16(comm[8:])) - 16383
+	rate := math.Ldexp(float64(binary.BigEndian.Uint64(comm[10:])), exp-63)
+	if rate != 22050 {
+		t.Errorf("sample rate is %v", rate)
+	}
+
+	ssnd := c["SSND"][8:]
+	for i, s := range ctx.Samples {
+		if got := int16(binary.BigEndian.Uint16(ssnd[i*2:])); got != s {
+			t.Fatalf("sample %d is %d, want %d", i, got, s)
+		}
+	}
+
+	mark := c["MARK"]
+	var names []string
+	for count, p := binary.BigEndian.Uint16(mark), mark[2:]; count > 0; count-- {
+		id := binary.BigEndian.Uint16(p)
+		pos := binary.BigEndian.Uint32(p[2:])
+		name := string(p[7 : 7+p[6]])
+		if id == 0 || int(pos) > len(ctx.Samples) {
+			t.Errorf("marker %q has id %d and position %d", name, id, pos)
+		}
+		names = append(names, name)
+
+		size := 1 + int(p[6])
+		p = p[6+size+size%2:]
+	}
+	if got, want := strings.Join(names, ","), "sentence 1,here,sentence 2"; got != want {
+		t.Errorf("markers are %q, want %q", got, want)
+	}
+}
+
+func TestWriteAIFFC(t *testing.T) {
+	ctx := synthesize(t, 22050, containerText)
+
+	for _, test := range []struct {
+		format      espeak.SampleFormat
+		compression string
+	}{
+		{espeak.Float32, "fl32"},
+		{espeak.ULaw, "ulaw"},
+		{espeak.ALaw, "alaw"},
+	} {
+		var buf bytes.Buffer
+		if _, err := ctx.WriteAIFF(&buf, &espeak.ContainerOptions{Format: test.format}); err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+
+		data := buf.Bytes()
+		if string(data[8:12]) != "AIFC" {
+			t.Errorf("%v: form type %q", test.format, data[8:12])
+			continue
+		}
+
+		c, _ := chunks(t, data, 12, aiffFormat)
+		if _, ok := c["FVER"]; !ok {
+			t.Errorf("%v: missing FVER chunk", test.format)
+		}
+		if got := string(c["COMM"][18:22]); got != test.compression {
+			t.Errorf("%v: compression type %q, want %q", test.format, got, test.compression)
+		}
+		if got, want := len(c["SSND"])-8, len(ctx.Samples)*test.format.Size(); got != want {
+			t.Errorf("%v: %d bytes of samples, want %d", test.format, got, want)
+		}
+	}
+}
+
+func TestWriteAIFFTooManyMarkers(t *testing.T) {
+	ctx := &espeak.Context{Engine: espeaktest.New(8000), Samples: make([]int16, 40000)}
+	for i := 0; i < 40000; i++ {
+		ctx.Events = append(ctx.Events, &espeak.SynthEvent{
+			Type:          espeak.EventMark,
+			AudioPosition: time.Duration(i) * time.Second / 8000,
+			Name:          "m",
+		})
+	}
+
+	var buf bytes.Buffer
+	n, err := ctx.WriteAIFF(&buf, &espeak.ContainerOptions{Markers: []espeak.SynthEventType{espeak.EventMark}})
+	if err == nil {
+		t.Error("expected an error for 40000 markers")
+	}
+	if n != 0 || buf.Len() != 0 {
+		t.Errorf("wrote %d bytes before failing", buf.Len())
+	}
+}
+
+func TestWriteAU(t *testing.T) {
+	ctx := synthesize(t, 22050, containerText)
+
+	for _, test := range []struct {
+		format   espeak.SampleFormat
+		encoding uint32
+	}{
+		{espeak.ULaw, 1},
+		{espeak.PCM8, 2},
+		{espeak.PCM16, 3},
+		{espeak.PCM24, 4},
+		{espeak.PCM32, 5},
+		{espeak.Float32, 6},
+		{espeak.ALaw, 27},
+	} {
+		var buf bytes.Buffer
+		n, err := ctx.WriteAU(&buf, &espeak.ContainerOptions{Format: test.format})
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+
+		data := buf.Bytes()
+		if n != int64(len(data)) {
+			t.Errorf("%v: WriteAU returned %d, but wrote %d bytes", test.format, n, len(data))
+		}
+		if string(data[:4]) != ".snd" {
+			t.Errorf("%v: bad magic %q", test.format, data[:4])
+			continue
+		}
+
+		offset := binary.BigEndian.Uint32(data[4:])
+		size := binary.BigEndian.Uint32(data[8:])
+		if int(offset)+int(size) != len(data) || int(size) != len(ctx.Samples)*test.format.Size() {
+			t.Errorf("%v: offset %d and size %d in a file of %d bytes", test.format, offset, size, len(data))
+		}
+		if encoding := binary.BigEndian.Uint32(data[12:]); encoding != test.encoding {
+			t.Errorf("%v: encoding %d, want %d", test.format, encoding, test.encoding)
+		}
+		if rate := binary.BigEndian.Uint32(data[16:]); rate != 22050 {
+			t.Errorf("%v: sample rate %d", test.format, rate)
+		}
+
+		// 8-bit samples are signed in AU files.
+		if test.format == espeak.PCM8 {
+			for i, s := range ctx.Samples {
+				if got, want := int8(data[int(offset)+i]), int8(s>>8); got != want {
+					t.Errorf("sample %d is %d, want %d", i, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestWriteCAF(t *testing.T) {
+	ctx := synthesize(t, 22050, containerText)
+
+	var buf bytes.Buffer
+	n, err := ctx.WriteCAF(&buf, &espeak.ContainerOptions{
+		Format:  espeak.PCM24,
+		Markers: []espeak.SynthEventType{espeak.EventMark},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if n != int64(len(data)) {
+		t.Errorf("WriteCAF returned %d, but wrote %d bytes", n, len(data))
+	}
+	if string(data[:4]) != "caff" || binary.BigEndian.Uint16(data[4:]) != 1 {
+		t.Fatalf("bad header %q", data[:8])
+	}
+	if string(data[8:12]) != "desc" {
+		t.Errorf("first chunk is %q, want desc", data[8:12])
+	}
+
+	c, _ := chunks(t, data, 8, cafFormat)
+
+	desc := c["desc"]
+	if rate := math.Float64frombits(binary.BigEndian.Uint64(desc)); rate != 22050 {
+		t.Errorf("sample rate %v", rate)
+	}
+	if id := string(desc[8:12]); id != "lpcm" {
+		t.Errorf("format %q", id)
+	}
+	if flags, bits := binary.BigEndian.Uint32(desc[12:]), binary.BigEndian.Uint32(desc[28:]); flags != 0 || bits != 24 {
+		t.Errorf("flags %d and %d bits per channel", flags, bits)
+	}
+
+	if got, want := len(c["data"]), 4+len(ctx.Samples)*3; got != want {
+		t.Errorf("data chunk is %d bytes, want %d", got, want)
+	}
+
+	mark := c["mark"]
+	if count := binary.BigEndian.Uint32(mark[4:]); count != 1 {
+		t.Fatalf("%d markers", count)
+	}
+	id := binary.BigEndian.Uint32(mark[8+12:])
+
+	strg := c["strg"]
+	if count := binary.BigEndian.Uint32(strg); count != 1 {
+		t.Fatalf("%d strings", count)
+	}
+	if sid := binary.BigEndian.Uint32(strg[4:]); sid != id {
+		t.Errorf("string ID %d, want %d", sid, id)
+	}
+	if name := string(bytes.TrimRight(strg[16:], "\x00")); name != "here" {
+		t.Errorf("marker name %q", name)
+	}
+}
@@ -1,14 +1,36 @@
 //go:generate build/make_js.bash
 
-// Package espeak is a wrapper around espeak-ng that works both natively and in gopherjs with the same API.
-// espeak-ng is an open source text to speech library that has over one hundred voices and languages and
-// supports speech synthesis markup language (SSML).
+// Package espeak is a wrapper around espeak-ng that works natively, in gopherjs, and in WebAssembly
+// (GOOS=js GOARCH=wasm) with the same API. espeak-ng is an open source text to speech library that has
+// over one hundred voices and languages and supports speech synthesis markup language (SSML).
+//
+// The gopherjs backend requires libespeak-ng.inc.js, which is bundled automatically. The WebAssembly
+// backend requires libespeak-ng.wasm.js (and libespeak-ng.wasm next to it) to be loaded on the page
+// before the Go program is started.
+//
+// Building with the espeak_wazero tag replaces the native backend with a WASI build of espeak-ng that is
+// embedded in the binary and run with the pure-Go wazero WebAssembly runtime
+// (github.com/tetratelabs/wazero), so static binaries can be produced for any architecture without a C
+// toolchain or an installed copy of espeak-ng. The WASI build is not part of the repository; run
+// build/make_wasi.bash to create the wasi directory first. It downloads the WASI SDK and espeak-ng, so
+// go generate does not run it.
+//
+// Building with the espeak_cli tag instead runs the espeak-ng program found in $PATH for each call,
+// through a CommandEngine, which can also be chosen at run time by setting Context.Engine. The program
+// cannot report real synthesis events, so events are rebuilt from the text and the phonemes of each word,
+// and their audio positions are estimated.
+//
+// When cgo is disabled and neither tag is used, no backend is built in. DefaultEngine has no voices and
+// returns an error from SynthesizeText, but Contexts with another Engine, such as the fake in package
+// espeaktest, work as usual.
 package espeak // import "gopkg.in/BenLubar/espeak.v2"
 
 import (
 	"errors"
 	"sync"
 	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
 )
 
 // Error is the error type from espeak-ng.
@@ -22,9 +44,9 @@ func (err *Error) Error() string {
 	return "espeak: " + err.Message
 }
 
-// SampleRate returns the number of samples per second in audio generated by this package.
+// SampleRate returns the number of samples per second in audio generated by DefaultEngine.
 func SampleRate() int {
-	return getSampleRate()
+	return DefaultEngine.SampleRate()
 }
 
 var lock sync.Mutex
@@ -39,6 +61,19 @@ type Context struct {
 	// Events are generated along with Samples and contain information about placement of words and
 	// sentences, which may be useful, for example, when generating real time subtitles.
 	Events []*SynthEvent
+	// Text is the text that Samples were synthesized from, which the TextPosition of each event refers
+	// to. SynthesizeText, Append, and ReadFrom add to it, and Slice and Split cut it to match their
+	// audio.
+	Text string
+
+	// Engine performs text to speech for this Context. If Engine is nil, DefaultEngine is used.
+	Engine Engine
+
+	// Audio finds the audio for SSML <audio> elements. If Audio is nil, the content of each <audio>
+	// element is spoken, as it is when the audio is not found.
+	Audio AudioResolver
+
+	sampleRate int // sample rate of Samples, or 0 to use the Engine's sample rate
 
 	rate   int // words per minute, 80 to 450; default 175
 	volume int // percentage of normal volume, min 0; default 100
@@ -48,13 +83,7 @@ type Context struct {
 	// TODO: capitals?
 	// TODO: word gap?
 
-	voice struct {
-		name     string
-		language string
-		gender   Gender
-		age      uint8
-		variant  uint8
-	}
+	voice VoiceProperties
 
 	isInit bool
 }
@@ -71,6 +100,39 @@ func (ctx *Context) init() {
 	ctx.tone = 50
 }
 
+func (ctx *Context) engine() Engine {
+	if ctx.Engine == nil {
+		return DefaultEngine
+	}
+
+	return ctx.Engine
+}
+
+// SampleRate returns the number of samples per second in Samples. Unless SetSampleRate has been called,
+// this is the sample rate of the Context's Engine.
+func (ctx *Context) SampleRate() int {
+	if ctx.sampleRate != 0 {
+		return ctx.sampleRate
+	}
+
+	return ctx.engine().SampleRate()
+}
+
+// SetSampleRate converts Samples to the given number of samples per second, and causes future Synthesize
+// calls to convert their output to that rate as well. Common rates are 8000 for telephony, 16000 for
+// speech recognition, and 44100 or 48000 for music and video.
+//
+// The conversion uses a band-limited filter, so no aliasing is introduced when lowering the sample rate.
+// Events do not need to change, as AudioPosition is a time rather than a sample offset.
+func (ctx *Context) SetSampleRate(rate int) {
+	if rate <= 0 {
+		panic("espeak: Context.SetSampleRate: rate must be positive")
+	}
+
+	ctx.Samples = resample.Resample(ctx.Samples, ctx.SampleRate(), rate)
+	ctx.sampleRate = rate
+}
+
 // Rate returns the current speed of speech in words per minute.
 //
 // The default rate is 175 words per minute.
@@ -120,7 +182,8 @@ func (ctx *Context) SetRate(wpm int) {
 
 // SetVolume changes the loudness of the voice for future Synthesize calls to a percentage of the default.
 //
-// The percentage must not be negative. Percentages over 100 may cause distortion or clipping.
+// The percentage must not be negative. Percentages over 100 may cause distortion or clipping; to make
+// speech louder without clipping, use ApplyEffects with effects.Gain and effects.Limiter instead.
 func (ctx *Context) SetVolume(percentage int) {
 	if percentage < 0 {
 		panic("espeak: Context.SetVolume: percentage must not be negative")
@@ -185,13 +248,10 @@ type Language struct {
 	Name string
 }
 
-// ListVoices returns the complete list of voices supported by espeak. The returned slice is not shared,
-// and callers may modify it without any side effects.
+// ListVoices returns the complete list of voices supported by DefaultEngine. The returned slice is not
+// shared, and callers may modify it without any side effects.
 func ListVoices() []*Voice {
-	lock.Lock()
-	defer lock.Unlock()
-
-	return listVoices()
+	return DefaultEngine.ListVoices()
 }
 
 // Gender of a voice.
@@ -214,32 +274,42 @@ func (ctx *Context) SetVoice(name string) error {
 	return ctx.SetVoiceProperties(name, "", Unknown, 0, 0)
 }
 
-func validVoice(name, language string, gender Gender, age, variant uint8) error {
-	lock.Lock()
-	defer lock.Unlock()
-
-	return setVoice(name, language, gender, age, variant)
-}
-
 // SetVoiceProperties sets the voice for future calls to Synthesize. Any or all of the arguments can be set
 // to their zero values, in which case they will be ignored. Variant differentiates between multiple voices
 // if more than one voice is matched by the other arguments.
 func (ctx *Context) SetVoiceProperties(name, language string, gender Gender, age, variant uint8) error {
-	if err := validVoice(name, language, gender, age, variant); err != nil {
+	voice := VoiceProperties{
+		Name:     name,
+		Language: language,
+		Gender:   gender,
+		Age:      age,
+		Variant:  variant,
+	}
+
+	if err := ctx.engine().ValidVoice(voice); err != nil {
 		return err
 	}
 
 	ctx.init()
 
-	ctx.voice.name = name
-	ctx.voice.language = language
-	ctx.voice.gender = gender
-	ctx.voice.age = age
-	ctx.voice.variant = variant
+	ctx.voice = voice
 
 	return nil
 }
 
+// Settings returns the parameters that will be passed to the Engine by future calls to Synthesize.
+func (ctx *Context) Settings() Settings {
+	ctx.init()
+
+	return Settings{
+		Rate:   ctx.rate,
+		Volume: ctx.volume,
+		Pitch:  ctx.pitch,
+		Range:  ctx.tone,
+		Voice:  ctx.voice,
+	}
+}
+
 // SynthEventType is the type of a SynthEvent.
 type SynthEventType uint8
 
@@ -271,13 +341,14 @@ type SynthEvent struct {
 	// Type of the event.
 	Type SynthEventType
 
-	// TextPosition in characters from the start of the string. Unlike Go indexes, this starts at 1.
+	// TextPosition in characters from the start of the Text of the Context. Unlike Go indexes, this
+	// starts at 1.
 	TextPosition int
 
 	// Length of the word, in characters. (for EventWord)
 	Length int
 
-	// AudioPosition is the time within the generated speech output data.
+	// AudioPosition is the time from the start of the Samples of the Context.
 	AudioPosition time.Duration
 
 	Number  int    // Number is used for EventWord and EventSentence
@@ -302,6 +373,13 @@ func (ctx *Context) Synthesize(speak *ssml.Speak) error {
 // SynthesizeText converts the given text to speech.
 //
 // Some SSML tags are accepted. All other XML tags are ignored.
+//
+// The audio is appended to Samples, the text is appended to Text, and the AudioPosition and
+// TextPosition of the new events are measured from the start of Samples and Text.
+//
+// If Audio finds the src of an <audio> element, its audio is inserted where the element is instead of
+// speaking its content, at the sample rate of the Context. The element is reported as an EventPlay
+// named after its src, and the events after it are moved to follow the inserted audio.
 func (ctx *Context) SynthesizeText(text string) error {
 	ctx.init()
 
@@ -309,28 +387,31 @@ func (ctx *Context) SynthesizeText(text string) error {
 }
 
 func (ctx *Context) synthesize(text string) error {
-	lock.Lock()
-	defer lock.Unlock()
+	engine := ctx.engine()
 
-	if err := setRate(ctx.rate); err != nil {
-		return err
-	}
+	offset, textOffset, events := ctx.Duration(), ctx.textLength(), len(ctx.Events)
 
-	if err := setVolume(ctx.volume); err != nil {
+	spoken, audio, err := ctx.resolveAudio(text)
+	if err != nil {
 		return err
 	}
 
-	if err := setPitch(ctx.pitch); err != nil {
-		return err
-	}
+	if ctx.sampleRate == 0 || ctx.sampleRate == engine.SampleRate() {
+		err = engine.Synthesize(ctx, spoken, ctx.Settings())
+	} else {
+		tmp := Context{Engine: engine}
+		err = engine.Synthesize(&tmp, spoken, ctx.Settings())
 
-	if err := setTone(ctx.tone); err != nil {
-		return err
+		ctx.Samples = append(ctx.Samples, resample.Resample(tmp.Samples, engine.SampleRate(), ctx.sampleRate)...)
+		ctx.Events = append(ctx.Events, tmp.Events...)
 	}
 
-	if err := setVoice(ctx.voice.name, ctx.voice.language, ctx.voice.gender, ctx.voice.age, ctx.voice.variant); err != nil {
-		return err
+	rebaseEvents(ctx.Events[events:], offset, textOffset)
+	ctx.Text += text
+
+	if err == nil {
+		ctx.spliceAudio(audio, events, textOffset)
 	}
 
-	return synthesize(text, ctx)
+	return err
 }
@@ -0,0 +1,46 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"io/fs"
+	"strings"
+
+	"gopkg.in/BenLubar/espeak.v2/earcon"
+)
+
+// AppendSound renders s at the sample rate of this Context and adds it to the end of Samples, such as a
+// cue between two sentences.
+func (ctx *Context) AppendSound(s earcon.Sound) {
+	ctx.Samples = append(ctx.Samples, earcon.Render(s, ctx.SampleRate())...)
+}
+
+// Earcons returns an AudioResolver for URIs of the form earcon:name, which renders the sound with that
+// name in lib at the given sample rate. It should be the sample rate of the Context the sounds are
+// played in, so that they do not need to be resampled. If lib is nil, earcon.Default is used.
+//
+// To play both earcons and files, combine resolvers with AudioResolvers:
+//
+//	ctx.Audio = espeak.AudioResolvers(espeak.Earcons(nil, ctx.SampleRate()), espeak.AudioDir("sounds"))
+//
+// Earcons panics if the sample rate is not positive.
+func Earcons(lib earcon.Library, sampleRate int) AudioResolver {
+	if sampleRate <= 0 {
+		panic("espeak: Earcons: sample rate must be positive")
+	}
+
+	return AudioResolverFunc(func(uri string) (*Context, error) {
+		sounds := lib
+		if sounds == nil {
+			sounds = earcon.Default
+		}
+
+		s, ok := sounds[strings.TrimPrefix(uri, "earcon:")]
+		if !ok || !strings.HasPrefix(uri, "earcon:") {
+			return nil, &fs.PathError{Op: "open", Path: uri, Err: fs.ErrNotExist}
+		}
+
+		return &Context{
+			Samples:    earcon.Render(s, sampleRate),
+			sampleRate: sampleRate,
+		}, nil
+	})
+}
@@ -0,0 +1,93 @@
+// Package earcon synthesizes short non-speech sounds, such as beeps, chirps, and buzzes, to play along
+// with speech from package espeak as audible cues.
+//
+// A Sound is built from Tones, which are combined into a Chord to play together or a Sequence to play
+// one after another. Sounds are rendered at any sample rate, so they can match the sample rate of the
+// speech they are played with. Inside a Sound, samples are floating point numbers in the range [-1, 1),
+// and Render clips the result to 16 bits.
+package earcon // import "gopkg.in/BenLubar/espeak.v2/earcon"
+
+import (
+	"math"
+	"time"
+)
+
+// A Sound is audio that can be rendered at any sample rate.
+type Sound interface {
+	// Render returns the samples of the sound at the given sample rate.
+	Render(sampleRate int) []float64
+}
+
+// Render returns the samples of s as 16-bit audio at the given sample rate. Samples outside of the
+// range of 16 bits are clipped. Render panics if the sample rate is not positive.
+func Render(s Sound, sampleRate int) []int16 {
+	if sampleRate <= 0 {
+		panic("earcon: sample rate must be positive")
+	}
+
+	in := s.Render(sampleRate)
+	out := make([]int16, len(in))
+	for i, v := range in {
+		v = math.Floor(v*32768 + 0.5)
+		switch {
+		case v > math.MaxInt16:
+			out[i] = math.MaxInt16
+		case v < math.MinInt16:
+			out[i] = math.MinInt16
+		default:
+			out[i] = int16(v)
+		}
+	}
+
+	return out
+}
+
+// samplesIn returns the number of samples in d at the given sample rate.
+func samplesIn(d time.Duration, sampleRate int) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(d * time.Duration(sampleRate) / time.Second)
+}
+
+// Rest is a silence of the given length, such as a gap in a Sequence.
+type Rest time.Duration
+
+// Render implements Sound.
+func (r Rest) Render(sampleRate int) []float64 {
+	return make([]float64, samplesIn(time.Duration(r), sampleRate))
+}
+
+// Chord plays sounds at the same time. It lasts as long as the longest of them. The sounds are added
+// together, so their Gain should leave room for the sum.
+type Chord []Sound
+
+// Render implements Sound.
+func (c Chord) Render(sampleRate int) []float64 {
+	var out []float64
+	for _, s := range c {
+		samples := s.Render(sampleRate)
+		if len(samples) > len(out) {
+			out = append(out, make([]float64, len(samples)-len(out))...)
+		}
+		for i, v := range samples {
+			out[i] += v
+		}
+	}
+
+	return out
+}
+
+// Sequence plays sounds one after another.
+type Sequence []Sound
+
+// Render implements Sound.
+func (q Sequence) Render(sampleRate int) []float64 {
+	var out []float64
+	for _, s := range q {
+		out = append(out, s.Render(sampleRate)...)
+	}
+
+	return out
+}
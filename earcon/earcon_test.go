@@ -0,0 +1,174 @@
+package earcon
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const rate = 16000
+
+// crossings counts the times the samples go from negative to not negative.
+func crossings(samples []float64) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] < 0 && samples[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func peak(samples []float64) float64 {
+	var max float64
+	for _, v := range samples {
+		max = math.Max(max, math.Abs(v))
+	}
+	return max
+}
+
+func TestTone(t *testing.T) {
+	for _, wave := range []Waveform{Sine, Square, Triangle} {
+		samples := Tone{Wave: wave, Freq: 440, Duration: time.Second}.Render(rate)
+
+		if len(samples) != rate {
+			t.Errorf("wave %d: %d samples", wave, len(samples))
+		}
+		if n := crossings(samples); n < 439 || n > 441 {
+			t.Errorf("wave %d: %d cycles, want 440", wave, n)
+		}
+		if p := peak(samples); p < 0.95 || p > 1.1 {
+			t.Errorf("wave %d: peak is %v", wave, p)
+		}
+		if samples[0] != 0 || math.Abs(samples[len(samples)-1]) > 0.01 {
+			t.Errorf("wave %d: starts at %v and ends at %v", wave, samples[0], samples[len(samples)-1])
+		}
+	}
+
+	quiet := Tone{Wave: Sine, Freq: 440, Duration: time.Second, Gain: -20}.Render(rate)
+	if p := peak(quiet); math.Abs(p-0.1) > 0.001 {
+		t.Errorf("peak at -20 dB is %v", p)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	samples := Tone{Wave: Sine, Freq: 500, To: 2000, Duration: time.Second}.Render(rate)
+
+	// The frequency doubles over each half, so the second half has twice as many cycles.
+	first, second := crossings(samples[:rate/2]), crossings(samples[rate/2:])
+	if want := 3 * 500 / (2 * math.Ln2); math.Abs(float64(first+second)-want) > 2 {
+		t.Errorf("%d cycles, want %.0f", first+second, want)
+	}
+	if ratio := float64(second) / float64(first); ratio < 1.9 || ratio > 2.1 {
+		t.Errorf("%d cycles in the first half and %d in the second", first, second)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	env := Envelope{
+		Attack:  100 * time.Millisecond,
+		Decay:   100 * time.Millisecond,
+		Sustain: 0.5,
+		Release: 200 * time.Millisecond,
+	}
+	n := rate
+
+	for _, test := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 0},
+		{50 * time.Millisecond, 0.5},
+		{100 * time.Millisecond, 1},
+		{150 * time.Millisecond, 0.75},
+		{500 * time.Millisecond, 0.5},
+		{900 * time.Millisecond, 0.25},
+		{time.Second - time.Second/rate, 0},
+	} {
+		if got := env.level(samplesIn(test.at, rate), n, rate); math.Abs(got-test.want) > 1e-3 {
+			t.Errorf("level at %v is %v, want %v", test.at, got, test.want)
+		}
+	}
+
+	// A note that is released during the attack falls from where it got to.
+	short := samplesIn(250*time.Millisecond, rate)
+	if got := env.level(samplesIn(100*time.Millisecond, rate), short, rate); math.Abs(got-0.375) > 1e-3 {
+		t.Errorf("level of a short note is %v, want 0.375", got)
+	}
+}
+
+func TestNoise(t *testing.T) {
+	noise := Tone{Wave: Noise, Duration: time.Second, Envelope: Envelope{Sustain: 1}}
+	samples := noise.Render(rate)
+
+	var sum, squares float64
+	for _, v := range samples {
+		sum += v
+		squares += v * v
+	}
+	if mean := sum / rate; math.Abs(mean) > 0.02 {
+		t.Errorf("mean is %v", mean)
+	}
+	if rms := math.Sqrt(squares / rate); math.Abs(rms-1/math.Sqrt(3)) > 0.02 {
+		t.Errorf("RMS is %v, want %v", rms, 1/math.Sqrt(3))
+	}
+
+	if !reflect.DeepEqual(noise.Render(rate), samples) {
+		t.Error("noise is different each time")
+	}
+}
+
+func TestChordAndSequence(t *testing.T) {
+	a := Tone{Wave: Sine, Freq: 440, Duration: 100 * time.Millisecond}
+	b := Tone{Wave: Sine, Freq: 660, Duration: 200 * time.Millisecond}
+	ra, rb := a.Render(rate), b.Render(rate)
+
+	chord := Chord{a, b}.Render(rate)
+	if len(chord) != len(rb) {
+		t.Errorf("chord has %d samples, want %d", len(chord), len(rb))
+	}
+	for i := range rb {
+		want := rb[i]
+		if i < len(ra) {
+			want += ra[i]
+		}
+		if chord[i] != want {
+			t.Fatalf("chord sample %d is %v, want %v", i, chord[i], want)
+		}
+	}
+
+	seq := Sequence{a, Rest(50 * time.Millisecond), b}.Render(rate)
+	if want := len(ra) + rate/20 + len(rb); len(seq) != want {
+		t.Fatalf("sequence has %d samples, want %d", len(seq), want)
+	}
+	if !reflect.DeepEqual(seq[:len(ra)], ra) || !reflect.DeepEqual(seq[len(seq)-len(rb):], rb) {
+		t.Error("sequence does not play the tones in order")
+	}
+	if peak(seq[len(ra):len(ra)+rate/20]) != 0 {
+		t.Error("rest is not silent")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	for name, s := range Default {
+		for _, sampleRate := range []int{8000, 48000} {
+			samples := Render(s, sampleRate)
+			if len(samples) == 0 {
+				t.Errorf("%s: no samples at %d Hz", name, sampleRate)
+			}
+
+			var max int
+			for _, v := range samples {
+				if a := int(v); a > max {
+					max = a
+				} else if -a > max {
+					max = -a
+				}
+			}
+			if max == 0 || max >= math.MaxInt16 {
+				t.Errorf("%s: peak is %d at %d Hz", name, max, sampleRate)
+			}
+		}
+	}
+}
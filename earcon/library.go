@@ -0,0 +1,59 @@
+package earcon
+
+import (
+	"time"
+)
+
+// Library maps names to sounds, so that they can be played by name.
+type Library map[string]Sound
+
+// Default is a library of common cues:
+//
+//	beep      a short tone, for attention
+//	chirp     a quick rising sweep, for starting to listen
+//	click     a soft tick, for each step of a long task
+//	progress  a rising pair of tones, for progress in a task
+//	success   a rising major third, for a finished task
+//	warning   two tones of the same pitch, for something that needs care
+//	error     a low buzz, for a failure
+//
+// Default may be changed to add sounds that are shared by a program.
+var Default = Library{
+	"beep": Tone{Wave: Sine, Freq: 1000, Duration: 120 * time.Millisecond, Gain: -12},
+	"chirp": Tone{
+		Wave: Sine, Freq: 800, To: 2400, Duration: 80 * time.Millisecond, Gain: -12,
+	},
+	"click": Tone{
+		Wave: Noise, Duration: 15 * time.Millisecond, Gain: -18,
+		Envelope: Envelope{Attack: time.Millisecond, Decay: 14 * time.Millisecond},
+	},
+	"progress": Sequence{
+		Tone{Wave: Triangle, Freq: 660, Duration: 60 * time.Millisecond, Gain: -12},
+		Rest(30 * time.Millisecond),
+		Tone{Wave: Triangle, Freq: 880, Duration: 60 * time.Millisecond, Gain: -12},
+	},
+	"success": Sequence{
+		Tone{Wave: Sine, Freq: 523.25, Duration: 100 * time.Millisecond, Gain: -12},
+		Chord{
+			Tone{Wave: Sine, Freq: 523.25, Duration: 200 * time.Millisecond, Gain: -18, Envelope: pluck},
+			Tone{Wave: Sine, Freq: 659.25, Duration: 200 * time.Millisecond, Gain: -18, Envelope: pluck},
+		},
+	},
+	"warning": Sequence{
+		Tone{Wave: Square, Freq: 880, Duration: 100 * time.Millisecond, Gain: -20},
+		Rest(60 * time.Millisecond),
+		Tone{Wave: Square, Freq: 880, Duration: 100 * time.Millisecond, Gain: -20},
+	},
+	"error": Chord{
+		Tone{Wave: Square, Freq: 150, Duration: 300 * time.Millisecond, Gain: -20},
+		Tone{Wave: Square, Freq: 158, Duration: 300 * time.Millisecond, Gain: -20},
+	},
+}
+
+// pluck is an Envelope that dies away like a plucked string.
+var pluck = Envelope{
+	Attack:  5 * time.Millisecond,
+	Decay:   150 * time.Millisecond,
+	Sustain: 0.3,
+	Release: 45 * time.Millisecond,
+}
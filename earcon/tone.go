@@ -0,0 +1,156 @@
+package earcon
+
+import (
+	"math"
+	"time"
+)
+
+// Waveform is the shape of the wave of a Tone.
+type Waveform int
+
+// Waveforms.
+const (
+	// Sine is a pure tone, for soft beeps and chirps.
+	Sine Waveform = iota
+	// Square is a hollow, buzzing tone with odd harmonics, for errors and alarms.
+	Square
+	// Triangle is between Sine and Square, with weaker odd harmonics.
+	Triangle
+	// Noise is white noise, for clicks and hisses. It has no frequency.
+	Noise
+)
+
+// defaultEnvelope is the Envelope of a Tone that does not set one. The short attack and release avoid
+// clicks at the start and end of the tone.
+var defaultEnvelope = Envelope{
+	Attack:  5 * time.Millisecond,
+	Sustain: 1,
+	Release: 5 * time.Millisecond,
+}
+
+// Envelope is the level of a Tone over time. The level rises from silence to full over Attack, falls to
+// Sustain over Decay, and holds there until Release before the end of the tone, when it falls back to
+// silence by the last sample. If the tone is too short for all of these, the release starts from
+// whatever level has been reached.
+type Envelope struct {
+	Attack, Decay time.Duration
+	Sustain       float64 // level from 0 to 1
+	Release       time.Duration
+}
+
+// level returns the level at sample i of a tone of n samples.
+func (e *Envelope) level(i, n, sampleRate int) float64 {
+	attack := float64(samplesIn(e.Attack, sampleRate))
+	decay := float64(samplesIn(e.Decay, sampleRate))
+	release := samplesIn(e.Release, sampleRate)
+
+	off := n - release
+	if off < 0 {
+		off = 0
+	}
+	t := float64(i)
+	if i > off {
+		t = float64(off)
+	}
+
+	var l float64
+	switch {
+	case t < attack:
+		l = t / attack
+	case t < attack+decay:
+		l = 1 - (1-e.Sustain)*(t-attack)/decay
+	default:
+		l = e.Sustain
+	}
+
+	if i > off {
+		l *= float64(n-1-i) / float64(release)
+	}
+
+	return l
+}
+
+// Tone is a single sound of a Waveform, such as a beep, or a sweep from one frequency to another.
+type Tone struct {
+	Wave Waveform
+
+	// Freq is the frequency of the tone in Hz. If To is not zero, the frequency sweeps from Freq to To
+	// over the length of the tone, with each octave taking the same time.
+	Freq, To float64
+
+	Duration time.Duration
+
+	// Envelope shapes the level of the tone. If it is the zero value, the tone fades in and out over 5ms.
+	Envelope Envelope
+
+	// Gain is the level of the tone in dB, where 0 is a peak at full scale.
+	Gain float64
+}
+
+// Render implements Sound.
+func (t Tone) Render(sampleRate int) []float64 {
+	n := samplesIn(t.Duration, sampleRate)
+	out := make([]float64, n)
+
+	env := t.Envelope
+	if env == (Envelope{}) {
+		env = defaultEnvelope
+	}
+	gain := math.Pow(10, t.Gain/20)
+
+	// noise is a xorshift generator with a fixed seed, so that a Tone always renders the same samples.
+	noise := uint32(2463534242)
+
+	var phase float64 // fraction of a cycle
+	for i := range out {
+		freq := t.Freq
+		if t.To != 0 && t.Freq > 0 && t.To > 0 {
+			freq *= math.Pow(t.To/t.Freq, float64(i)/float64(n))
+		}
+		dt := freq / float64(sampleRate)
+
+		var v float64
+		switch t.Wave {
+		case Sine:
+			v = math.Sin(2 * math.Pi * phase)
+		case Square:
+			v = 1
+			if phase >= 0.5 {
+				v = -1
+			}
+			v += polyBLEP(phase, dt) - polyBLEP(math.Mod(phase+0.5, 1), dt)
+		case Triangle:
+			v = 4*math.Abs(phase-0.5) - 1
+		case Noise:
+			noise ^= noise << 13
+			noise ^= noise >> 17
+			noise ^= noise << 5
+			v = float64(noise)/(1<<31) - 1
+		}
+
+		out[i] = v * gain * env.level(i, n, sampleRate)
+
+		phase += dt
+		phase -= math.Floor(phase)
+	}
+
+	return out
+}
+
+// polyBLEP returns the correction near a jump in a wave at phase 0, where dt is the change in phase per
+// sample. Adding it to a wave that jumps up from -1 to 1 there smooths the jump over two samples, which
+// removes most of the aliasing that a sudden jump causes.
+func polyBLEP(phase, dt float64) float64 {
+	switch {
+	case dt <= 0:
+		return 0
+	case phase < dt:
+		x := phase / dt
+		return -(x*x - 2*x + 1)
+	case phase > 1-dt:
+		x := (phase - 1) / dt
+		return x*x + 2*x + 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,47 @@
+package espeak_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/earcon"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestEarcons(t *testing.T) {
+	ctx := &espeak.Context{Engine: espeaktest.New(16000)}
+	ctx.Audio = espeak.AudioResolvers(espeak.AudioMap{}, espeak.Earcons(nil, ctx.SampleRate()))
+
+	if err := ctx.SynthesizeText(`Done. <audio src="earcon:success"/> <audio src="earcon:fanfare">Hooray.</audio>`); err != nil {
+		t.Fatal(err)
+	}
+	success := earcon.Render(earcon.Default["success"], 16000)
+
+	var plays, words int
+	for _, e := range ctx.Events {
+		switch e.Type {
+		case espeak.EventPlay:
+			if e.Name == "earcon:fanfare" {
+				// There is no such earcon, so its text is spoken instead.
+				continue
+			}
+			plays++
+			at := int(e.AudioPosition * 16000 / 1e9)
+			if e.Name != "earcon:success" || !reflect.DeepEqual(ctx.Samples[at:at+len(success)], success) {
+				t.Errorf("%v does not play the success earcon", e)
+			}
+		case espeak.EventWord:
+			words++
+		}
+	}
+	if plays != 1 || words != 2 {
+		t.Errorf("%d sounds and %d words, want 1 sound and the words Done and Hooray", plays, words)
+	}
+
+	length := len(ctx.Samples)
+	ctx.AppendSound(earcon.Default["beep"])
+	if got, want := len(ctx.Samples)-length, len(earcon.Render(earcon.Default["beep"], 16000)); got != want {
+		t.Errorf("AppendSound added %d samples, want %d", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// Duration returns the length of the audio in Samples.
+func (ctx *Context) Duration() time.Duration {
+	return ctx.timeAt(len(ctx.Samples))
+}
+
+// timeAt returns the time of the sample at index n.
+func (ctx *Context) timeAt(n int) time.Duration {
+	if n == 0 {
+		return 0
+	}
+
+	return time.Duration(n) * time.Second / time.Duration(ctx.SampleRate())
+}
+
+// sampleAt returns the index of the sample at time d, limited to the range of Samples.
+func (ctx *Context) sampleAt(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	if d >= ctx.Duration() {
+		return len(ctx.Samples)
+	}
+
+	return int(d * time.Duration(ctx.SampleRate()) / time.Second)
+}
+
+// textLength returns the number of characters in Text, which is the TextPosition of its last character.
+func (ctx *Context) textLength() int {
+	return utf8.RuneCountInString(ctx.Text)
+}
+
+// rebaseEvents moves events that were measured from the start of their own audio and text so that they
+// follow offset of audio and textOffset characters of text.
+func rebaseEvents(events []*SynthEvent, offset time.Duration, textOffset int) {
+	for _, e := range events {
+		e.AudioPosition += offset
+		if e.TextPosition > 0 {
+			e.TextPosition += textOffset
+		}
+	}
+}
+
+// Append adds the audio, text, and events of other to the end of this Context, as if the text of other
+// had been synthesized after the text of this Context. The events are copied, with their AudioPosition
+// and TextPosition moved to follow the audio and text already in this Context. If other has a different
+// sample rate, its audio is resampled. other is not changed.
+func (ctx *Context) Append(other *Context) {
+	offset, textOffset := ctx.Duration(), ctx.textLength()
+
+	samples := other.Samples
+	if len(samples) != 0 {
+		if from, to := other.SampleRate(), ctx.SampleRate(); from != to {
+			samples = resample.Resample(samples, from, to)
+		}
+	}
+
+	events := make([]*SynthEvent, len(other.Events))
+	for i, e := range other.Events {
+		c := *e
+		events[i] = &c
+	}
+	rebaseEvents(events, offset, textOffset)
+
+	ctx.Samples = append(ctx.Samples, samples...)
+	ctx.Events = append(ctx.Events, events...)
+	ctx.Text += other.Text
+}
+
+// Slice returns a new Context holding the audio from time from up to time to, and the events in that
+// range, with the same settings and Engine as this Context. Times past the end of the audio are treated
+// as the end. Slice panics if from is negative or to is before from.
+//
+// The events are copied, with their AudioPosition measured from the start of the slice. The Text of the
+// slice starts at the first event at or after from that has a TextPosition, and ends before the first
+// such event at or after to, so that the TextPosition of each event, also measured from the start of the
+// slice, still refers to the same character. The slices of an SSML document are not valid documents on
+// their own.
+func (ctx *Context) Slice(from, to time.Duration) *Context {
+	if from < 0 || to < from {
+		panic("espeak: Context.Slice: invalid range")
+	}
+
+	return ctx.slice(ctx.sampleAt(from), ctx.sampleAt(to))
+}
+
+// Split divides this Context at time at into two new Contexts, which Append can join back together into
+// a copy of this Context. It is the same as calling Slice for the audio before and after at.
+func (ctx *Context) Split(at time.Duration) (before, after *Context) {
+	if at < 0 {
+		panic("espeak: Context.Split: time must not be negative")
+	}
+
+	i := ctx.sampleAt(at)
+	return ctx.slice(0, i), ctx.slice(i, len(ctx.Samples))
+}
+
+func (ctx *Context) slice(start, end int) *Context {
+	from, to := ctx.timeAt(start), ctx.timeAt(end)
+	textStart, textEnd := ctx.textBoundary(start), ctx.textBoundary(end)
+	if textEnd < textStart {
+		textEnd = textStart
+	}
+
+	s := *ctx
+	s.Samples = append([]int16(nil), ctx.Samples[start:end]...)
+	s.Events = nil
+	s.Text = runeSlice(ctx.Text, textStart, textEnd)
+
+	for _, e := range ctx.Events {
+		// Events at the very end of the audio, such as EventEnd, belong to the last slice.
+		if e.AudioPosition < from || (e.AudioPosition >= to && end != len(ctx.Samples)) {
+			continue
+		}
+
+		c := *e
+		c.AudioPosition -= from
+		if c.TextPosition > 0 {
+			c.TextPosition -= textStart
+		}
+		s.Events = append(s.Events, &c)
+	}
+
+	return &s
+}
+
+// textBoundary returns the number of characters of Text before the audio starting at the sample at
+// index n: all of Text before the first event at or after that sample that has a TextPosition.
+func (ctx *Context) textBoundary(n int) int {
+	if n == 0 {
+		return 0
+	}
+
+	length := ctx.textLength()
+	if n == len(ctx.Samples) {
+		return length
+	}
+
+	at, boundary := ctx.timeAt(n), length
+	for _, e := range ctx.Events {
+		if e.AudioPosition >= at && e.TextPosition > 0 && e.TextPosition-1 < boundary {
+			boundary = e.TextPosition - 1
+		}
+	}
+
+	return boundary
+}
+
+// runeSlice returns the characters of s from index start up to index end.
+func runeSlice(s string, start, end int) string {
+	i, from, to := 0, len(s), len(s)
+	for j := range s {
+		if i == start {
+			from = j
+		}
+		if i == end {
+			to = j
+			break
+		}
+		i++
+	}
+
+	if from > to {
+		return ""
+	}
+	return s[from:to]
+}
+
+// InsertSilence inserts d of silence into the audio at time at, and moves the events at or after that
+// time to match. A time past the end of the audio is treated as the end. InsertSilence panics if at or
+// d is negative.
+func (ctx *Context) InsertSilence(at, d time.Duration) {
+	if at < 0 || d < 0 {
+		panic("espeak: Context.InsertSilence: times must not be negative")
+	}
+
+	i := ctx.sampleAt(at)
+	from := ctx.timeAt(i)
+	n := int(d * time.Duration(ctx.SampleRate()) / time.Second)
+
+	ctx.Samples = append(ctx.Samples[:i], append(make([]int16, n), ctx.Samples[i:]...)...)
+
+	shift := ctx.timeAt(n)
+	for _, e := range ctx.Events {
+		if e.AudioPosition >= from {
+			e.AudioPosition += shift
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package espeak_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func synthesize(t *testing.T, rate int, texts ...string) *espeak.Context {
+	ctx := &espeak.Context{Engine: espeaktest.New(rate)}
+	for _, text := range texts {
+		if err := ctx.SynthesizeText(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ctx
+}
+
+func sameAudio(t *testing.T, name string, got, want *espeak.Context) {
+	if !reflect.DeepEqual(got.Samples, want.Samples) {
+		t.Errorf("%s: %d samples, want %d", name, len(got.Samples), len(want.Samples))
+	}
+	if !reflect.DeepEqual(got.Events, want.Events) {
+		t.Errorf("%s: events are\n%v\nwant\n%v", name, got.Events, want.Events)
+	}
+	if got.Text != want.Text {
+		t.Errorf("%s: text is %q, want %q", name, got.Text, want.Text)
+	}
+}
+
+func TestSynthesizeTimeline(t *testing.T) {
+	first, second := "Hello, world.", " How are you?"
+	ctx := synthesize(t, 22050, first, second)
+	a := synthesize(t, 22050, first)
+
+	if ctx.Text != first+second {
+		t.Errorf("text is %q", ctx.Text)
+	}
+
+	for _, e := range ctx.Events[len(a.Events):] {
+		if e.AudioPosition < a.Duration() {
+			t.Errorf("%v is before the end of the first text at %v", e, a.Duration())
+		}
+		if e.TextPosition != 0 && e.TextPosition <= len(first) {
+			t.Errorf("%v is in the first text", e)
+		}
+	}
+
+	a.Append(synthesize(t, 22050, second))
+	sameAudio(t, "append", a, ctx)
+}
+
+func TestAppendResample(t *testing.T) {
+	ctx := synthesize(t, 22050, "Hello.")
+	other := synthesize(t, 16000, "World.")
+	length := len(ctx.Samples)
+
+	ctx.Append(other)
+	if want := length + len(other.Samples)*22050/16000; len(ctx.Samples) < want-1 || len(ctx.Samples) > want+1 {
+		t.Errorf("%d samples after appending, want %d", len(ctx.Samples), want)
+	}
+	if len(other.Samples) == 0 || other.SampleRate() != 16000 {
+		t.Error("Append changed its argument")
+	}
+}
+
+func TestSliceAndSplit(t *testing.T) {
+	ctx := synthesize(t, 22050, "Hello, world. How are you? I am fine.")
+
+	var sentences []*espeak.SynthEvent
+	for _, e := range ctx.Events {
+		if e.Type == espeak.EventSentence {
+			sentences = append(sentences, e)
+		}
+	}
+	if len(sentences) != 3 {
+		t.Fatalf("%d sentences", len(sentences))
+	}
+
+	from, to := sentences[1].AudioPosition, sentences[2].AudioPosition
+	s := ctx.Slice(from, to)
+	if s.Text != "How are you? " {
+		t.Errorf("slice text is %q", s.Text)
+	}
+	if d := s.Duration(); d < to-from-time.Millisecond || d > to-from+time.Millisecond {
+		t.Errorf("slice is %v long, want %v", d, to-from)
+	}
+	// The slice starts on a sample, so its events may be up to a sample later than the times they were
+	// sliced at.
+	if len(s.Events) == 0 || s.Events[0].Type != espeak.EventSentence || s.Events[0].TextPosition != 1 ||
+		s.Events[0].AudioPosition >= time.Second/22050 {
+		t.Errorf("slice starts with %+v", s.Events[0])
+	}
+	for _, e := range s.Events[1:] {
+		if e.Type == espeak.EventSentence || e.Type == espeak.EventMsgTerminated {
+			t.Errorf("%+v is outside the slice", *e)
+		}
+	}
+
+	for _, at := range []time.Duration{0, from, from + 1234567, ctx.Duration(), time.Hour} {
+		before, after := ctx.Split(at)
+		before.Append(after)
+		sameAudio(t, "split at "+at.String(), before, ctx)
+	}
+}
+
+func TestInsertSilence(t *testing.T) {
+	ctx := synthesize(t, 22050, "Hello, world.")
+	original := synthesize(t, 22050, "Hello, world.")
+
+	var at time.Duration
+	for _, e := range ctx.Events {
+		if e.Type == espeak.EventWord && e.TextPosition == 8 {
+			at = e.AudioPosition
+		}
+	}
+
+	ctx.InsertSilence(at, time.Second)
+	if got, want := len(ctx.Samples), len(original.Samples)+22050; got != want {
+		t.Errorf("%d samples, want %d", got, want)
+	}
+
+	i := int(at * 22050 / time.Second)
+	for _, v := range ctx.Samples[i : i+22050] {
+		if v != 0 {
+			t.Fatal("inserted audio is not silent")
+		}
+	}
+
+	for j, e := range ctx.Events {
+		want := original.Events[j].AudioPosition
+		if want >= at {
+			want += time.Second
+		}
+		if e.AudioPosition != want {
+			t.Errorf("%v: want audio position %v", e, want)
+		}
+	}
+}
+
+// TestSynthesizeTextPositions checks that a second call continues the timeline of the first, instead of
+// starting its positions again at the beginning of its own text and audio.
+func TestSynthesizeTextPositions(t *testing.T) {
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := ctx.SynthesizeText("Hello."); err != nil {
+		t.Fatal(err)
+	}
+
+	duration, length, events := ctx.Duration(), len(ctx.Text), len(ctx.Events)
+
+	var alone espeak.Context
+	alone.Engine = ctx.Engine
+	if err := alone.SynthesizeText(" World."); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SynthesizeText(" World."); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, e := range alone.Events {
+		got := ctx.Events[events+i]
+		if got.TextPosition != e.TextPosition+length || got.AudioPosition != e.AudioPosition+duration {
+			t.Errorf("event %d at %d, %v; want %d, %v", i, got.TextPosition, got.AudioPosition, e.TextPosition+length, e.AudioPosition+duration)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/effects"
+)
+
+// ApplyEffects processes the Samples in this Context with the given effects, in order. If the effects
+// change the timing of the audio, as effects.TrimSilence does, the AudioPosition of each event is moved
+// to match. Events in audio that was removed are moved to the nearest remaining sample.
+//
+// To apply effects to audio while it is being written, use an effects.Chain.
+func (ctx *Context) ApplyEffects(fx ...effects.Effect) {
+	c := effects.NewChain(ctx.SampleRate(), fx...)
+	samples := c.Process(ctx.Samples)
+	samples = append(samples, c.Flush()...)
+
+	ctx.retime(c)
+	ctx.Samples = samples
+}
+
+// applyEffectsFloat is like ApplyEffects, but for samples that have not been clipped to 16 bits yet, in
+// the range [-1, 1). It returns the processed samples instead of changing Samples.
+func (ctx *Context) applyEffectsFloat(samples []float64, fx []effects.Effect) []float64 {
+	c := effects.NewChain(ctx.SampleRate(), fx...)
+	samples = c.ProcessFloat(samples)
+	samples = append(samples[:len(samples):len(samples)], c.FlushFloat()...)
+
+	ctx.retime(c)
+	return samples
+}
+
+// retime moves the events of ctx to follow the audio after it was processed by c.
+func (ctx *Context) retime(c *effects.Chain) {
+	rate := ctx.SampleRate()
+
+	for _, e := range ctx.Events {
+		n := int64(e.AudioPosition * time.Duration(rate) / time.Second)
+		if d := c.Position(n) - n; d != 0 {
+			e.AudioPosition += time.Duration(d) * time.Second / time.Duration(rate)
+		}
+	}
+}
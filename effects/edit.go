@@ -0,0 +1,192 @@
+package effects
+
+import (
+	"math"
+	"time"
+)
+
+// samplesIn returns the number of samples in d at the given sample rate.
+func samplesIn(d time.Duration, sampleRate int) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(d * time.Duration(sampleRate) / time.Second)
+}
+
+// fadeCurve returns the gain at the fraction x of the way through a fade in. The raised cosine starts and
+// ends smoothly, which avoids the click of a sudden change in slope.
+func fadeCurve(x float64) float64 {
+	if x >= 1 {
+		return 1
+	}
+
+	return 0.5 - 0.5*math.Cos(math.Pi*x)
+}
+
+// Fade makes the start of the audio rise from silence and the end fall to silence. Fading out holds
+// back the last Out of the audio until Flush, since the end is not known before then.
+type Fade struct {
+	In, Out time.Duration
+}
+
+// NewProcessor implements Effect.
+func (f Fade) NewProcessor(sampleRate int) Processor {
+	return &fadeProcessor{
+		in:  samplesIn(f.In, sampleRate),
+		out: samplesIn(f.Out, sampleRate),
+	}
+}
+
+type fadeProcessor struct {
+	in, out int
+	n       int64     // number of input samples so far
+	held    []float64 // the last out samples
+}
+
+func (p *fadeProcessor) Process(samples []float64) []float64 {
+	for i := range samples {
+		if pos := p.n + int64(i); pos < int64(p.in) {
+			samples[i] *= fadeCurve(float64(pos) / float64(p.in))
+		}
+	}
+	p.n += int64(len(samples))
+
+	if p.out == 0 {
+		return samples
+	}
+
+	p.held = append(p.held, samples...)
+	if len(p.held) <= p.out {
+		return nil
+	}
+
+	n := len(p.held) - p.out
+	out := p.held[:n:n]
+	p.held = append([]float64(nil), p.held[n:]...)
+	return out
+}
+
+func (p *fadeProcessor) Flush() []float64 {
+	// The last sample is silent, and the fade starts Out before the end even if the audio is shorter.
+	for i := range p.held {
+		remaining := len(p.held) - 1 - i
+		p.held[i] *= fadeCurve(float64(remaining) / float64(p.out))
+	}
+
+	return p.held
+}
+
+// defaultSilenceThreshold is the Threshold used by a TrimSilence that does not set one.
+const defaultSilenceThreshold = -50
+
+// TrimSilence removes silence from the start and end of the audio, such as the pauses that espeak-ng
+// leaves around each utterance. Silence in the middle of the audio is kept. Trimming the end holds back
+// each quiet stretch until the audio becomes loud again or the input ends.
+type TrimSilence struct {
+	// Threshold is the level in dBFS below which audio counts as silence. If it is 0, -50 dBFS is used.
+	Threshold float64
+
+	// Keep is the length of silence to leave at each end, so that the audio does not start or stop
+	// abruptly.
+	Keep time.Duration
+}
+
+// NewProcessor implements Effect.
+func (t TrimSilence) NewProcessor(sampleRate int) Processor {
+	threshold := t.Threshold
+	if threshold == 0 {
+		threshold = defaultSilenceThreshold
+	}
+
+	return &trimProcessor{
+		threshold: fromDB(threshold),
+		keep:      samplesIn(t.Keep, sampleRate),
+	}
+}
+
+type trimProcessor struct {
+	threshold float64
+	keep      int
+
+	started bool
+	lead    []float64 // the last keep samples of silence before the audio starts
+	pending []float64 // silence since the last loud sample
+
+	dropped int64 // number of samples removed from the start
+	in, out int64 // number of input and output samples so far
+}
+
+func (p *trimProcessor) loud(v float64) bool {
+	return math.Abs(v) >= p.threshold
+}
+
+func (p *trimProcessor) Process(samples []float64) []float64 {
+	p.in += int64(len(samples))
+
+	if !p.started {
+		i := 0
+		for i < len(samples) && !p.loud(samples[i]) {
+			i++
+		}
+
+		p.lead = append(p.lead, samples[:i]...)
+		if drop := len(p.lead) - p.keep; drop > 0 {
+			p.dropped += int64(drop)
+			p.lead = append(p.lead[:0], p.lead[drop:]...)
+		}
+
+		if i == len(samples) {
+			return nil
+		}
+
+		p.started = true
+		samples = append(p.lead, samples[i:]...)
+		p.lead = nil
+	}
+
+	j := len(samples) - 1
+	for j >= 0 && !p.loud(samples[j]) {
+		j--
+	}
+
+	if j < 0 {
+		p.pending = append(p.pending, samples...)
+		return nil
+	}
+
+	out := append(p.pending, samples[:j+1]...)
+	p.pending = append([]float64(nil), samples[j+1:]...)
+	p.out += int64(len(out))
+	return out
+}
+
+func (p *trimProcessor) Flush() []float64 {
+	if !p.started {
+		// The whole input was silence.
+		p.dropped = p.in
+		return nil
+	}
+
+	tail := p.pending
+	if len(tail) > p.keep {
+		tail = tail[:p.keep]
+	}
+	p.pending = nil
+	p.out += int64(len(tail))
+
+	return tail
+}
+
+// Position implements Retimer.
+func (p *trimProcessor) Position(n int64) int64 {
+	n -= p.dropped
+	if n < 0 {
+		return 0
+	}
+	if n > p.out {
+		return p.out
+	}
+
+	return n
+}
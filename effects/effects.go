@@ -0,0 +1,233 @@
+// Package effects shapes 16-bit mono audio from package espeak after it has been synthesized, with gain,
+// soft limiting, filters, reverb, fades, and silence trimming.
+//
+// Effects are combined in a Chain, which can process a whole recording or a stream of samples as they
+// are synthesized. Inside a Chain, samples are floating point numbers in the range [-1, 1), so a Gain
+// followed by a Limiter does not clip in between. The output of the Chain is clipped to 16 bits.
+package effects // import "gopkg.in/BenLubar/espeak.v2/effects"
+
+import (
+	"math"
+)
+
+// An Effect describes a change to audio. Effects are values that hold their settings; each stream that
+// an Effect is applied to gets its own Processor.
+type Effect interface {
+	// NewProcessor returns a Processor that applies the Effect to audio at the given sample rate.
+	NewProcessor(sampleRate int) Processor
+}
+
+// A Processor applies an Effect to one stream of audio. Samples are passed to Process as they become
+// available, and Flush returns the rest of the output once the stream has ended.
+type Processor interface {
+	// Process adds input samples to the stream and returns as many output samples as can be computed so
+	// far. It may modify samples and return them.
+	Process(samples []float64) []float64
+
+	// Flush returns the remaining output samples after the end of the input. The Processor must not
+	// be used after Flush.
+	Flush() []float64
+}
+
+// A Retimer is a Processor that moves audio in time, for example by removing some of it.
+type Retimer interface {
+	Processor
+
+	// Position returns the index in the output of the input sample at index n. It is only accurate
+	// after Flush.
+	Position(n int64) int64
+}
+
+// Chain applies a sequence of effects to a stream of audio.
+type Chain struct {
+	procs []Processor
+	buf   []float64
+}
+
+// NewChain returns a Chain that applies effects in order to audio at the given sample rate. NewChain
+// panics if the sample rate is not positive.
+func NewChain(sampleRate int, effects ...Effect) *Chain {
+	if sampleRate <= 0 {
+		panic("effects: sample rate must be positive")
+	}
+
+	c := &Chain{}
+	for _, e := range effects {
+		c.procs = append(c.procs, e.NewProcessor(sampleRate))
+	}
+
+	return c
+}
+
+// Process adds input samples to the stream and returns as many output samples as can be computed so far.
+// Some effects need to look ahead, so the output may lag behind the input until Flush is called.
+func (c *Chain) Process(samples []int16) []int16 {
+	c.buf = c.buf[:0]
+	for _, s := range samples {
+		c.buf = append(c.buf, float64(s)/32768)
+	}
+
+	return toInt16(c.ProcessFloat(c.buf))
+}
+
+// ProcessFloat is like Process, but for samples in the range [-1, 1) that are not clipped to 16 bits,
+// such as the sum of several recordings. The output is not clipped either. ProcessFloat may modify
+// samples and return them.
+func (c *Chain) ProcessFloat(samples []float64) []float64 {
+	for _, p := range c.procs {
+		samples = p.Process(samples)
+	}
+
+	return samples
+}
+
+// Flush returns the remaining output samples after the end of the input. The Chain must not be used
+// after Flush, except to call Position.
+func (c *Chain) Flush() []int16 {
+	return toInt16(c.FlushFloat())
+}
+
+// FlushFloat is like Flush, but for a Chain used with ProcessFloat.
+func (c *Chain) FlushFloat() []float64 {
+	var buf []float64
+	for _, p := range c.procs {
+		// Each effect sees the end of the stream after the output that the effects before it held back.
+		out := p.Process(buf)
+		buf = append(out[:len(out):len(out)], p.Flush()...)
+	}
+
+	return buf
+}
+
+// Position returns the index in the output of the input sample at index n, so that markers such as
+// synthesis events can follow the audio when effects remove some of it. It is only accurate after Flush.
+func (c *Chain) Position(n int64) int64 {
+	for _, p := range c.procs {
+		if r, ok := p.(Retimer); ok {
+			n = r.Position(n)
+		}
+	}
+
+	return n
+}
+
+// Apply applies effects in order to a whole recording at the given sample rate. The result is not shared
+// with the input.
+func Apply(samples []int16, sampleRate int, effects ...Effect) []int16 {
+	c := NewChain(sampleRate, effects...)
+	out := c.Process(samples)
+	return append(out, c.Flush()...)
+}
+
+func toInt16(buf []float64) []int16 {
+	if len(buf) == 0 {
+		return nil
+	}
+
+	out := make([]int16, len(buf))
+	for i, v := range buf {
+		out[i] = clip(v * 32768)
+	}
+
+	return out
+}
+
+func clip(v float64) int16 {
+	v = math.Floor(v + 0.5)
+
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return int16(v)
+}
+
+// fromDB converts a level in decibels to a linear factor.
+func fromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// Gain changes the volume of audio by a number of decibels. Positive gains make the audio louder, and
+// may need a Limiter after them to avoid clipping. The zero Gain has no effect.
+type Gain struct {
+	DB float64
+}
+
+// NewProcessor implements Effect.
+func (g Gain) NewProcessor(sampleRate int) Processor {
+	return &gainProcessor{factor: fromDB(g.DB)}
+}
+
+type gainProcessor struct {
+	factor float64
+}
+
+func (p *gainProcessor) Process(samples []float64) []float64 {
+	for i := range samples {
+		samples[i] *= p.factor
+	}
+
+	return samples
+}
+
+func (p *gainProcessor) Flush() []float64 {
+	return nil
+}
+
+// defaultLimiterThreshold is the Threshold used by a Limiter that does not set one.
+const defaultLimiterThreshold = -6
+
+// fullScale is the largest positive 16-bit sample, which the output of a Limiter approaches.
+const fullScale = math.MaxInt16 / 32768.0
+
+// Limiter keeps loud audio from clipping by compressing peaks above a threshold smoothly toward full
+// scale, which sounds much less harsh than the clipping caused by raising the volume of a Context above
+// 100 percent. Audio below the threshold is unchanged.
+type Limiter struct {
+	// Threshold is the level in dBFS, below 0, at which the limiter starts to compress peaks. If it is
+	// 0, -6 dBFS is used.
+	Threshold float64
+}
+
+// NewProcessor implements Effect.
+func (l Limiter) NewProcessor(sampleRate int) Processor {
+	threshold := l.Threshold
+	if threshold == 0 {
+		threshold = defaultLimiterThreshold
+	}
+	t := fromDB(threshold)
+	if t >= fullScale {
+		panic("effects: Limiter threshold must be below 0 dBFS")
+	}
+
+	return &limiterProcessor{threshold: t}
+}
+
+type limiterProcessor struct {
+	threshold float64
+}
+
+func (p *limiterProcessor) Process(samples []float64) []float64 {
+	t, r := p.threshold, fullScale-p.threshold
+	for i, v := range samples {
+		a := math.Abs(v)
+		if a <= t {
+			continue
+		}
+
+		// The curve continues the straight line below the threshold with the same slope, and
+		// approaches full scale without passing it.
+		a = t + r*math.Tanh((a-t)/r)
+		samples[i] = math.Copysign(a, v)
+	}
+
+	return samples
+}
+
+func (p *limiterProcessor) Flush() []float64 {
+	return nil
+}
@@ -0,0 +1,231 @@
+package effects
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const rate = 16000
+
+func sine(freq, amplitude float64, n int) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/rate))
+	}
+	return samples
+}
+
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func peak(samples []int16) int {
+	var max int
+	for _, s := range samples {
+		if a := int(s); a > max {
+			max = a
+		} else if -a > max {
+			max = -a
+		}
+	}
+	return max
+}
+
+func TestGain(t *testing.T) {
+	in := sine(440, 5000, rate/10)
+	out := Apply(in, rate, Gain{DB: 20 * math.Log10(2)})
+
+	if len(out) != len(in) {
+		t.Fatalf("%d samples, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if d := int(out[i]) - 2*int(in[i]); d < -1 || d > 1 {
+			t.Fatalf("sample %d is %d, want %d", i, out[i], 2*int(in[i]))
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	in := sine(440, 30000, rate/10)
+
+	clipped := Apply(in, rate, Gain{DB: 12})
+	limited := Apply(in, rate, Gain{DB: 12}, Limiter{Threshold: -3})
+
+	if peak(clipped) < math.MaxInt16 {
+		t.Fatal("expected the gain alone to clip")
+	}
+	if p := peak(limited); p > math.MaxInt16 || p < 30000 {
+		t.Errorf("limited peak is %d", p)
+	}
+
+	// Quiet audio passes through unchanged.
+	quiet := sine(440, 1000, rate/10)
+	if out := Apply(quiet, rate, Limiter{}); !reflect.DeepEqual(out, quiet) {
+		t.Error("limiter changed audio below the threshold")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		effect Effect
+		freq   float64
+		pass   bool
+	}{
+		{"high-pass", HighPass{Frequency: 500}, 100, false},
+		{"high-pass", HighPass{Frequency: 500}, 3000, true},
+		{"low-pass", LowPass{Frequency: 2000}, 500, true},
+		{"low-pass", LowPass{Frequency: 2000}, 7000, false},
+		{"telephone", Telephone{}, 100, false},
+		{"telephone", Telephone{}, 1000, true},
+		{"telephone", Telephone{}, 7000, false},
+	} {
+		in := sine(test.freq, 10000, rate)
+		out := Apply(in, rate, test.effect)
+
+		// Skip the start, where the filters settle.
+		ratio := rms(out[rate/10:]) / rms(in[rate/10:])
+		db := 20 * math.Log10(ratio)
+		if test.pass && db < -1 {
+			t.Errorf("%s: %v Hz attenuated by %.1f dB", test.name, test.freq, -db)
+		}
+		if !test.pass && db > -12 {
+			t.Errorf("%s: %v Hz only attenuated by %.1f dB", test.name, test.freq, -db)
+		}
+	}
+
+	// A cutoff that cannot be represented has no effect.
+	in := sine(440, 10000, rate/10)
+	if out := Apply(in, rate, LowPass{Frequency: rate}); !reflect.DeepEqual(out, in) {
+		t.Error("low-pass above the Nyquist frequency changed the audio")
+	}
+}
+
+func TestReverb(t *testing.T) {
+	in := make([]int16, rate/2)
+	copy(in, sine(440, 10000, rate/10))
+
+	out := Apply(in, rate, Reverb{Room: 0.8, Mix: 0.5})
+	if len(out) <= len(in) {
+		t.Fatalf("no tail: %d samples for %d", len(out), len(in))
+	}
+	if len(out) > len(in)+maxReverbTail*rate {
+		t.Fatalf("tail of %d samples is too long", len(out)-len(in))
+	}
+
+	// The echoes fill the silence after the tone and then die away.
+	if rms(out[rate/5:rate/5+rate/10]) < 10 {
+		t.Error("no echoes after the tone")
+	}
+	if p := peak(out[len(out)-rate/10:]); p > 10 {
+		t.Errorf("tail ends with a peak of %d", p)
+	}
+}
+
+func TestFade(t *testing.T) {
+	in := make([]int16, rate)
+	for i := range in {
+		in[i] = 10000
+	}
+
+	out := Apply(in, rate, Fade{In: 100 * time.Millisecond, Out: 200 * time.Millisecond})
+	if len(out) != len(in) {
+		t.Fatalf("%d samples, want %d", len(out), len(in))
+	}
+
+	if out[0] != 0 || out[len(out)-1] != 0 {
+		t.Errorf("ends are %d and %d, want silence", out[0], out[len(out)-1])
+	}
+	if out[rate/20] < 4000 || out[rate/20] > 6000 {
+		t.Errorf("halfway through the fade in is %d", out[rate/20])
+	}
+	for i := rate / 10; i < rate-rate/5; i++ {
+		if out[i] != 10000 {
+			t.Fatalf("sample %d is %d between the fades", i, out[i])
+		}
+	}
+	for i := rate - rate/5 + 1; i < rate; i++ {
+		if out[i] > out[i-1] {
+			t.Fatalf("fade out rises at sample %d", i)
+		}
+	}
+}
+
+func TestTrimSilence(t *testing.T) {
+	tone := sine(440, 10000, rate/10)
+	tone[0], tone[len(tone)-1] = 5000, 5000 // loud at both ends
+
+	in := make([]int16, 0, rate)
+	in = append(in, make([]int16, rate/4)...)
+	in = append(in, tone...)
+	in = append(in, make([]int16, rate/10)...)
+	in = append(in, tone...)
+	in = append(in, make([]int16, rate/4)...)
+
+	keep := 10 * time.Millisecond
+	c := NewChain(rate, TrimSilence{Keep: keep})
+	out := c.Process(in)
+	out = append(out, c.Flush()...)
+
+	k := rate / 100
+	if want := 2*len(tone) + rate/10 + 2*k; len(out) != want {
+		t.Fatalf("%d samples, want %d", len(out), want)
+	}
+	if out[k] != 5000 || out[len(out)-k-1] != 5000 {
+		t.Errorf("tone does not start at %d and end at %d", k, len(out)-k-1)
+	}
+
+	for _, test := range []struct {
+		in, out int64
+	}{
+		{0, 0},
+		{int64(rate/4 - k), 0},
+		{int64(rate / 4), int64(k)},
+		{int64(len(in) - 1), int64(len(out))},
+	} {
+		if got := c.Position(test.in); got != test.out {
+			t.Errorf("Position(%d) = %d, want %d", test.in, got, test.out)
+		}
+	}
+
+	if out := Apply(make([]int16, rate), rate, TrimSilence{}); len(out) != 0 {
+		t.Errorf("%d samples left of silence", len(out))
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	in := make([]int16, rate/4)
+	in = append(in, sine(300, 8000, rate)...)
+	in = append(in, make([]int16, rate/4)...)
+
+	chain := []Effect{
+		TrimSilence{Keep: 20 * time.Millisecond},
+		HighPass{Frequency: 100},
+		Gain{DB: 6},
+		Limiter{},
+		Reverb{Room: 0.5},
+		Fade{In: 50 * time.Millisecond, Out: 50 * time.Millisecond},
+	}
+	whole := Apply(in, rate, chain...)
+
+	c := NewChain(rate, chain...)
+	var streamed []int16
+	for rest, n := in, 1; len(rest) != 0; n = n*3 + 1 {
+		if n > len(rest) {
+			n = len(rest)
+		}
+		streamed = append(streamed, c.Process(rest[:n])...)
+		rest = rest[n:]
+	}
+	streamed = append(streamed, c.Flush()...)
+
+	if !reflect.DeepEqual(streamed, whole) {
+		t.Errorf("streaming gave %d samples, processing at once gave %d", len(streamed), len(whole))
+	}
+}
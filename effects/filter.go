@@ -0,0 +1,128 @@
+package effects
+
+import (
+	"math"
+)
+
+// biquad is a second order IIR filter, with coefficients from Robert Bristow-Johnson's "Cookbook
+// formulae for audio EQ biquad filter coefficients".
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// butterworthQ gives a flat passband with no resonance at the cutoff.
+var butterworthQ = 1 / math.Sqrt2
+
+// newBiquad returns a low-pass or high-pass filter with the given cutoff frequency, or nil if the cutoff
+// is outside of the range that can be represented at the sample rate, where the filter would have no
+// effect.
+func newBiquad(sampleRate int, freq float64, high bool) *biquad {
+	if freq <= 0 || freq >= float64(sampleRate)/2 {
+		return nil
+	}
+
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*butterworthQ)
+	a0 := 1 + alpha
+
+	f := &biquad{
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+	if high {
+		f.b0 = (1 + cos) / 2 / a0
+		f.b1 = -(1 + cos) / a0
+	} else {
+		f.b0 = (1 - cos) / 2 / a0
+		f.b1 = (1 - cos) / a0
+	}
+	f.b2 = f.b0
+
+	return f
+}
+
+func (f *biquad) next(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2 = x, f.x1
+	f.y1, f.y2 = y, f.y1
+	return y
+}
+
+// filterProcessor applies a cascade of biquad filters.
+type filterProcessor struct {
+	stages []*biquad
+}
+
+func (p *filterProcessor) add(f *biquad) {
+	if f != nil {
+		p.stages = append(p.stages, f)
+	}
+}
+
+func (p *filterProcessor) Process(samples []float64) []float64 {
+	for _, f := range p.stages {
+		for i, v := range samples {
+			samples[i] = f.next(v)
+		}
+	}
+
+	return samples
+}
+
+func (p *filterProcessor) Flush() []float64 {
+	return nil
+}
+
+// HighPass removes frequencies below a cutoff, such as rumble and breath noise, with a Butterworth filter
+// that falls off by 12 dB per octave. A cutoff of 0 has no effect.
+type HighPass struct {
+	Frequency float64 // in Hz
+}
+
+// NewProcessor implements Effect.
+func (h HighPass) NewProcessor(sampleRate int) Processor {
+	p := &filterProcessor{}
+	p.add(newBiquad(sampleRate, h.Frequency, true))
+	return p
+}
+
+// LowPass removes frequencies above a cutoff, which makes speech sound muffled or distant, with a
+// Butterworth filter that falls off by 12 dB per octave. A cutoff at or above half the sample rate has
+// no effect.
+type LowPass struct {
+	Frequency float64 // in Hz
+}
+
+// NewProcessor implements Effect.
+func (l LowPass) NewProcessor(sampleRate int) Processor {
+	p := &filterProcessor{}
+	p.add(newBiquad(sampleRate, l.Frequency, false))
+	return p
+}
+
+// Telephone limits audio to the narrow band of frequencies carried by a telephone line, so that speech
+// sounds as if it were heard over the phone. The filters fall off by 24 dB per octave.
+type Telephone struct {
+	// Low and High are the edges of the band in Hz. If they are 0, the 300 to 3400 Hz band of analog
+	// telephones is used.
+	Low, High float64
+}
+
+// NewProcessor implements Effect.
+func (t Telephone) NewProcessor(sampleRate int) Processor {
+	low, high := t.Low, t.High
+	if low == 0 {
+		low = 300
+	}
+	if high == 0 {
+		high = 3400
+	}
+
+	p := &filterProcessor{}
+	for i := 0; i < 2; i++ {
+		p.add(newBiquad(sampleRate, low, true))
+		p.add(newBiquad(sampleRate, high, false))
+	}
+	return p
+}
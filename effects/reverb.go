@@ -0,0 +1,170 @@
+package effects
+
+import (
+	"math"
+)
+
+// Tunings of the Freeverb algorithm by Jezar at Dreampoint, in samples at 44100 Hz. The delays are
+// mutually prime so that their echoes do not line up.
+var (
+	combTuning    = [...]int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	allpassTuning = [...]int{556, 441, 341, 225}
+)
+
+const (
+	reverbInputGain  = 0.015
+	reverbWetScale   = 3
+	allpassFeedback  = 0.5
+	defaultReverbMix = 0.25
+
+	// maxReverbTail limits the length of the tail that Flush adds after the end of the input.
+	maxReverbTail = 10 // seconds
+
+	// reverbSilence is the level below which the tail is considered to have died away (-80 dB).
+	reverbSilence = 1e-4
+)
+
+// Reverb simulates the echoes of a room, using the Freeverb algorithm. When the input ends, the
+// echoes continue for as long as they can be heard, so the output is longer than the input.
+type Reverb struct {
+	// Room is the size of the room, from 0 (a small room) to 1 (a large hall).
+	Room float64
+
+	// Damping is how much the walls absorb high frequencies, from 0 (hard walls) to 1 (soft walls).
+	Damping float64
+
+	// Mix is the fraction of the output that is reverberation, from 0 to 1. If it is 0, 0.25 is used.
+	Mix float64
+}
+
+// NewProcessor implements Effect.
+func (r Reverb) NewProcessor(sampleRate int) Processor {
+	if r.Room < 0 || r.Room > 1 || r.Damping < 0 || r.Damping > 1 || r.Mix < 0 || r.Mix > 1 {
+		panic("effects: Reverb settings must be between 0 and 1")
+	}
+
+	mix := r.Mix
+	if mix == 0 {
+		mix = defaultReverbMix
+	}
+
+	p := &reverbProcessor{
+		rate: sampleRate,
+		wet:  mix * reverbWetScale,
+		dry:  1 - mix,
+	}
+
+	scale := float64(sampleRate) / 44100
+	for i, n := range combTuning {
+		p.combs[i] = comb{
+			buf:      make([]float64, delayLength(n, scale)),
+			feedback: r.Room*0.28 + 0.7,
+			damp:     r.Damping * 0.4,
+		}
+	}
+	for i, n := range allpassTuning {
+		p.allpasses[i] = allpass{buf: make([]float64, delayLength(n, scale))}
+	}
+
+	return p
+}
+
+func delayLength(n int, scale float64) int {
+	if l := int(math.Floor(float64(n)*scale + 0.5)); l > 1 {
+		return l
+	}
+
+	return 1
+}
+
+// comb is a feedback comb filter with a low-pass filter in the feedback path.
+type comb struct {
+	buf            []float64
+	i              int
+	feedback, damp float64
+	store          float64
+}
+
+func (c *comb) next(x float64) float64 {
+	y := c.buf[c.i]
+	c.store = y*(1-c.damp) + c.store*c.damp
+	c.buf[c.i] = x + c.store*c.feedback
+
+	if c.i++; c.i == len(c.buf) {
+		c.i = 0
+	}
+
+	return y
+}
+
+// allpass is a Schroeder all-pass filter, which diffuses the echoes without coloring them.
+type allpass struct {
+	buf []float64
+	i   int
+}
+
+func (a *allpass) next(x float64) float64 {
+	b := a.buf[a.i]
+	a.buf[a.i] = x + b*allpassFeedback
+
+	if a.i++; a.i == len(a.buf) {
+		a.i = 0
+	}
+
+	return b - x
+}
+
+type reverbProcessor struct {
+	rate      int
+	wet, dry  float64
+	combs     [len(combTuning)]comb
+	allpasses [len(allpassTuning)]allpass
+}
+
+func (p *reverbProcessor) Process(samples []float64) []float64 {
+	for i, x := range samples {
+		samples[i] = x*p.dry + p.next(x)*p.wet
+	}
+
+	return samples
+}
+
+func (p *reverbProcessor) next(x float64) float64 {
+	in := x * reverbInputGain
+
+	var y float64
+	for i := range p.combs {
+		y += p.combs[i].next(in)
+	}
+	for i := range p.allpasses {
+		y = p.allpasses[i].next(y)
+	}
+
+	return y
+}
+
+// Flush returns the tail of the reverberation, a block at a time until a block is silent.
+func (p *reverbProcessor) Flush() []float64 {
+	var tail []float64
+
+	block := p.rate / 10
+	for len(tail) < maxReverbTail*p.rate {
+		var peak float64
+		for i := 0; i < block; i++ {
+			y := p.next(0) * p.wet
+			peak = math.Max(peak, math.Abs(y))
+			tail = append(tail, y)
+		}
+
+		if peak < reverbSilence {
+			break
+		}
+	}
+
+	// Leave out the silent end of the last block.
+	for len(tail) != 0 && math.Abs(tail[len(tail)-1]) < reverbSilence {
+		tail = tail[:len(tail)-1]
+	}
+
+	return tail
+}
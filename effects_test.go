@@ -0,0 +1,46 @@
+package espeak_test
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/effects"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestApplyEffects(t *testing.T) {
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := ctx.SynthesizeText(`Hello, world. <mark name="here"/>Again!`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Surround the speech with a second of silence.
+	const lead = time.Second
+	ctx.Samples = append(make([]int16, 16000), ctx.Samples...)
+	ctx.Samples = append(ctx.Samples, make([]int16, 16000)...)
+	var before []time.Duration
+	for _, e := range ctx.Events {
+		e.AudioPosition += lead
+		before = append(before, e.AudioPosition)
+	}
+	length := len(ctx.Samples)
+
+	ctx.ApplyEffects(effects.TrimSilence{}, effects.Fade{Out: 10 * time.Millisecond})
+
+	if len(ctx.Samples) >= length-2*16000 {
+		t.Errorf("%d samples after trimming %d", len(ctx.Samples), length)
+	}
+
+	end := time.Duration(len(ctx.Samples)) * time.Second / 16000
+	for i, e := range ctx.Events {
+		if e.AudioPosition < 0 || e.AudioPosition > end {
+			t.Errorf("event %d at %v is outside of %v of audio", i, e.AudioPosition, end)
+		}
+		if e.Type == espeak.EventMark {
+			if moved := before[i] - e.AudioPosition; moved < lead {
+				t.Errorf("mark moved by %v, want at least %v", moved, lead)
+			}
+		}
+	}
+}
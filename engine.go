@@ -0,0 +1,92 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+// Engine converts text to speech on behalf of a Context. The engine built into this package uses
+// espeak-ng; package espeaktest provides a deterministic fake for tests that cannot depend on it.
+//
+// Methods on an Engine may be called from multiple goroutines at the same time.
+type Engine interface {
+	// SampleRate returns the number of samples per second in audio generated by this Engine.
+	SampleRate() int
+
+	// ListVoices returns the complete list of voices supported by this Engine. The returned slice
+	// must not be shared.
+	ListVoices() []*Voice
+
+	// ValidVoice returns an error if no voice matches the given properties.
+	ValidVoice(voice VoiceProperties) error
+
+	// Synthesize converts text to speech using the given settings. Audio is appended to ctx.Samples and
+	// events are appended to ctx.Events, with AudioPosition measured from the start of this call's audio.
+	Synthesize(ctx *Context, text string, settings Settings) error
+}
+
+// VoiceProperties describes the voice to use for synthesis. Fields left as their zero values are ignored.
+type VoiceProperties struct {
+	Name     string
+	Language string
+	Gender   Gender
+	Age      uint8
+	Variant  uint8
+}
+
+// Settings are the parameters a Context passes to its Engine for each call to Synthesize.
+type Settings struct {
+	Rate   int // words per minute, 80 to 450
+	Volume int // percentage of normal volume
+	Pitch  int // base pitch, 0 to 100
+	Range  int // pitch range, 0 to 100
+
+	Voice VoiceProperties
+}
+
+// DefaultEngine is the Engine used by Contexts that do not have one set. It uses the espeak-ng backend
+// selected when this package was built.
+var DefaultEngine Engine = espeakEngine{}
+
+type espeakEngine struct{}
+
+func (espeakEngine) SampleRate() int {
+	return getSampleRate()
+}
+
+func (espeakEngine) ListVoices() []*Voice {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return listVoices()
+}
+
+func (espeakEngine) ValidVoice(voice VoiceProperties) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return setVoice(voice.Name, voice.Language, voice.Gender, voice.Age, voice.Variant)
+}
+
+func (espeakEngine) Synthesize(ctx *Context, text string, settings Settings) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := setRate(settings.Rate); err != nil {
+		return err
+	}
+
+	if err := setVolume(settings.Volume); err != nil {
+		return err
+	}
+
+	if err := setPitch(settings.Pitch); err != nil {
+		return err
+	}
+
+	if err := setTone(settings.Range); err != nil {
+		return err
+	}
+
+	voice := settings.Voice
+	if err := setVoice(voice.Name, voice.Language, voice.Gender, voice.Age, voice.Variant); err != nil {
+		return err
+	}
+
+	return synthesize(text, ctx)
+}
@@ -0,0 +1,81 @@
+package espeak_test
+
+import (
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+// TestDefaultEngine checks the backend built into the package, whichever one the build tags selected.
+func TestDefaultEngine(t *testing.T) {
+	voices := espeak.ListVoices()
+	if len(voices) == 0 {
+		var ctx espeak.Context
+		if err := ctx.SynthesizeText("Hello."); err == nil {
+			t.Error("expected an error from a backend without voices")
+		}
+		t.Skip("no espeak-ng backend is built in")
+	}
+
+	english := false
+	for _, v := range voices {
+		for _, l := range v.Languages {
+			english = english || l.Name == "en"
+		}
+	}
+	if !english {
+		t.Errorf("no English voice in %d voices", len(voices))
+	}
+
+	if rate := espeak.SampleRate(); rate <= 0 {
+		t.Fatalf("sample rate %d", rate)
+	}
+
+	var ctx espeak.Context
+	if err := ctx.SetVoiceProperties("", "en", espeak.Male, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SynthesizeText(`Hello, <mark name="m"/>world.`); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ctx.Samples) == 0 {
+		t.Fatal("no audio")
+	}
+
+	// Events are reported through the backend's callback, so their presence shows that it works.
+	var words []int
+	marks := 0
+	for i, e := range ctx.Events {
+		if i > 0 && e.AudioPosition < ctx.Events[i-1].AudioPosition {
+			t.Errorf("event %d is at %v, before the previous event at %v", i, e.AudioPosition, ctx.Events[i-1].AudioPosition)
+		}
+		if e.AudioPosition > ctx.Duration() {
+			t.Errorf("event %d is at %v, after the end of the audio at %v", i, e.AudioPosition, ctx.Duration())
+		}
+
+		switch e.Type {
+		case espeak.EventWord:
+			words = append(words, e.TextPosition)
+		case espeak.EventMark:
+			marks++
+			if e.Name != "m" {
+				t.Errorf("mark name %q", e.Name)
+			}
+		}
+	}
+
+	if len(words) != 2 || words[0] != 1 || words[1] != 30 {
+		t.Errorf("words at %v, want [1 30]", words)
+	}
+	if marks != 1 {
+		t.Errorf("%d marks, want 1", marks)
+	}
+	if n := len(ctx.Events); n == 0 || ctx.Events[n-1].Type != espeak.EventMsgTerminated {
+		t.Error("events do not end with EventMsgTerminated")
+	}
+
+	if err := ctx.SetVoice("no such voice"); err == nil {
+		t.Error("expected an error for a missing voice")
+	}
+}
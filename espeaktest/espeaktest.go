@@ -0,0 +1,379 @@
+// Package espeaktest provides a deterministic fake espeak.Engine, so that code using package espeak can
+// be tested on machines that do not have espeak-ng installed.
+//
+// Package espeak is still built with one of its backends, and the default backend needs espeak-ng to
+// build. Tests that only use this package can be run without it by building with CGO_ENABLED=0, which
+// leaves espeak without a backend, or with the espeak_cli tag, which only looks for the espeak-ng program
+// when espeak.DefaultEngine is used:
+//
+//	CGO_ENABLED=0 go test ./...
+package espeaktest // import "gopkg.in/BenLubar/espeak.v2/espeaktest"
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+// Engine is a fake espeak.Engine. Instead of speech, each word is rendered as a sine tone whose length
+// depends on the number of characters in the word and the speaking rate, and whose frequency depends on
+// the pitch and pitch range. Events are generated for sentences, words, the ends of sentences, SSML
+// <mark> and <audio> elements, and the end of the message, in the same order espeak-ng reports them.
+// SSML <break> elements insert silence. All other markup is ignored.
+//
+// The output only depends on the text and settings, so it can be compared exactly in tests.
+//
+// The zero value is ready to use. An Engine may be used from multiple goroutines at the same time.
+type Engine struct {
+	// SamplesPerSecond is the sample rate of the audio. If it is 0, 22050 is used, which matches most
+	// espeak-ng voices. It is not named SampleRate, because that is the method that reports it.
+	SamplesPerSecond int
+
+	// Voices is the list of voices supported by this Engine. If Voices is nil, DefaultVoices is used.
+	Voices []*espeak.Voice
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Call records the arguments of one call to Engine.Synthesize.
+type Call struct {
+	Text     string
+	Settings espeak.Settings
+}
+
+// New returns an Engine that uses the given sample rate. It is equivalent to
+// &Engine{SamplesPerSecond: rate}.
+func New(rate int) *Engine {
+	return &Engine{SamplesPerSecond: rate}
+}
+
+// DefaultVoices returns the voices supported by an Engine that does not have any Voices set.
+func DefaultVoices() []*espeak.Voice {
+	return []*espeak.Voice{
+		{
+			Name:       "English (Great Britain)",
+			Languages:  []espeak.Language{{Priority: 2, Name: "en-gb"}, {Priority: 2, Name: "en"}},
+			Identifier: "gmw/en",
+			Gender:     espeak.Male,
+		},
+		{
+			Name:       "English (America)",
+			Languages:  []espeak.Language{{Priority: 2, Name: "en-us"}, {Priority: 3, Name: "en"}},
+			Identifier: "gmw/en-US",
+			Gender:     espeak.Male,
+		},
+		{
+			Name:       "French (France)",
+			Languages:  []espeak.Language{{Priority: 5, Name: "fr-fr"}, {Priority: 5, Name: "fr"}},
+			Identifier: "roa/fr",
+			Gender:     espeak.Male,
+		},
+		{
+			Name:       "German",
+			Languages:  []espeak.Language{{Priority: 5, Name: "de"}},
+			Identifier: "gmw/de",
+			Gender:     espeak.Male,
+		},
+	}
+}
+
+// Calls returns the arguments of every call to Synthesize so far, in order.
+func (e *Engine) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Call(nil), e.calls...)
+}
+
+// SampleRate implements espeak.Engine.
+func (e *Engine) SampleRate() int {
+	if e.SamplesPerSecond == 0 {
+		return 22050
+	}
+
+	return e.SamplesPerSecond
+}
+
+// ListVoices implements espeak.Engine.
+func (e *Engine) ListVoices() []*espeak.Voice {
+	if e.Voices == nil {
+		return DefaultVoices()
+	}
+
+	voices := make([]*espeak.Voice, len(e.Voices))
+	for i, v := range e.Voices {
+		voice := *v
+		voice.Languages = append([]espeak.Language(nil), v.Languages...)
+		voices[i] = &voice
+	}
+
+	return voices
+}
+
+// errVoiceNotFound is the error espeak-ng returns when no voice matches (ENS_VOICE_NOT_FOUND).
+var errVoiceNotFound = &espeak.Error{Code: 0x100006FF, Message: "Voice not found"}
+
+// ValidVoice implements espeak.Engine. A voice is valid if at least one voice in ListVoices matches
+// every property that is set. Languages match by prefix, so "en" matches a voice for "en-gb".
+func (e *Engine) ValidVoice(voice espeak.VoiceProperties) error {
+	for _, v := range e.ListVoices() {
+		if voice.Name != "" && !strings.EqualFold(voice.Name, v.Name) && !strings.EqualFold(voice.Name, v.Identifier) {
+			continue
+		}
+
+		if voice.Gender != espeak.Unknown && v.Gender != espeak.Unknown && voice.Gender != v.Gender {
+			continue
+		}
+
+		if voice.Age != 0 && v.Age != 0 && voice.Age != v.Age {
+			continue
+		}
+
+		if voice.Language == "" {
+			return nil
+		}
+
+		for _, l := range v.Languages {
+			if strings.HasPrefix(strings.ToLower(l.Name), strings.ToLower(voice.Language)) {
+				return nil
+			}
+		}
+	}
+
+	return errVoiceNotFound
+}
+
+// Synthesize implements espeak.Engine.
+func (e *Engine) Synthesize(ctx *espeak.Context, text string, settings espeak.Settings) error {
+	if err := e.ValidVoice(settings.Voice); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.calls = append(e.calls, Call{Text: text, Settings: settings})
+	e.mu.Unlock()
+
+	s := synth{
+		rate:     e.SampleRate(),
+		settings: settings,
+	}
+	s.run(text)
+
+	ctx.Samples = append(ctx.Samples, s.samples...)
+	ctx.Events = append(ctx.Events, s.events...)
+
+	return nil
+}
+
+type synth struct {
+	rate     int
+	settings espeak.Settings
+
+	samples []int16
+	events  []*espeak.SynthEvent
+
+	words     int
+	sentences int
+}
+
+// charDuration is the time taken to speak one character. An average English word is about six
+// characters long, including the space after it.
+func (s *synth) charDuration() time.Duration {
+	rate := s.settings.Rate
+	if rate == 0 {
+		rate = 175
+	}
+
+	return time.Minute / time.Duration(rate*6)
+}
+
+func (s *synth) position() time.Duration {
+	return (time.Duration(len(s.samples)) * time.Second / time.Duration(s.rate)).Truncate(time.Millisecond)
+}
+
+func (s *synth) event(typ espeak.SynthEventType, pos int) *espeak.SynthEvent {
+	e := &espeak.SynthEvent{
+		Type:          typ,
+		TextPosition:  pos,
+		AudioPosition: s.position(),
+	}
+	s.events = append(s.events, e)
+	return e
+}
+
+func (s *synth) silence(d time.Duration) {
+	n := int(d * time.Duration(s.rate) / time.Second)
+	s.samples = append(s.samples, make([]int16, n)...)
+}
+
+func (s *synth) tone(d time.Duration) {
+	// The base frequency goes from 80 Hz to 280 Hz with pitch, and each word moves up or down from it
+	// by up to half of the pitch range.
+	base := 80 + 2*float64(s.settings.Pitch)
+	freq := base * (1 + float64(s.settings.Range)/200*math.Sin(float64(s.words)))
+
+	amplitude := 8000 * float64(s.settings.Volume) / 100
+	n := int(d * time.Duration(s.rate) / time.Second)
+	fade := s.rate / 200 // 5ms
+
+	for i := 0; i < n; i++ {
+		v := amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(s.rate))
+		if i < fade {
+			v *= float64(i) / float64(fade)
+		} else if n-i < fade {
+			v *= float64(n-i) / float64(fade)
+		}
+
+		s.samples = append(s.samples, clip(v))
+	}
+}
+
+func clip(v float64) int16 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return int16(v)
+}
+
+func (s *synth) run(text string) {
+	var (
+		pos           int // characters read so far
+		inSentence    bool
+		endOfSentence bool
+		word          *espeak.SynthEvent
+		wordChars     int
+	)
+
+	endWord := func() {
+		if word == nil {
+			return
+		}
+
+		s.tone(time.Duration(wordChars) * s.charDuration())
+		s.silence(s.charDuration())
+		word = nil
+	}
+
+	endSentence := func() {
+		endWord()
+		if !inSentence {
+			return
+		}
+
+		s.event(espeak.EventEnd, pos)
+		s.silence(4 * s.charDuration())
+		inSentence = false
+		endOfSentence = false
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if r == '<' {
+			if end := strings.IndexByte(text[i:], '>'); end != -1 {
+				tag := text[i : i+end+1]
+
+				if endOfSentence {
+					endSentence()
+				}
+				endWord()
+
+				switch tagName(tag) {
+				case "mark":
+					s.event(espeak.EventMark, pos+1).Name = attr(tag, "name")
+				case "audio":
+					s.event(espeak.EventPlay, pos+1).Name = attr(tag, "src")
+				case "break":
+					d, err := time.ParseDuration(attr(tag, "time"))
+					if err != nil {
+						d = 250 * time.Millisecond
+					}
+					s.silence(d)
+				case "/s", "/p":
+					endSentence()
+				}
+
+				pos += utf8.RuneCountInString(tag)
+				i += end + 1
+				continue
+			}
+		}
+
+		pos++
+		i += size
+
+		switch {
+		case unicode.IsSpace(r):
+			if endOfSentence {
+				endSentence()
+			}
+			endWord()
+		case r == '.' || r == '!' || r == '?':
+			endOfSentence = inSentence
+		case unicode.IsPunct(r):
+			// punctuation is only part of a word if more of the word follows it
+		default:
+			endOfSentence = false
+
+			if !inSentence {
+				s.sentences++
+				s.event(espeak.EventSentence, pos).Number = s.sentences
+				inSentence = true
+			}
+
+			if word == nil {
+				s.words++
+				word = s.event(espeak.EventWord, pos)
+				word.Number = s.words
+				wordChars = 0
+			}
+
+			wordChars = pos - word.TextPosition + 1
+			word.Length = wordChars
+		}
+	}
+
+	endSentence()
+
+	s.event(espeak.EventMsgTerminated, pos)
+}
+
+// tagName returns the name of an XML tag, including the slash for closing tags.
+func tagName(tag string) string {
+	name := strings.TrimPrefix(tag, "<")
+	if end := strings.IndexAny(name, " \t\r\n/>"); end > 0 {
+		name = name[:end]
+	} else if strings.HasPrefix(name, "/") {
+		if end := strings.IndexAny(name[1:], " \t\r\n>"); end != -1 {
+			name = name[:end+1]
+		}
+	}
+
+	return name
+}
+
+// attr returns the value of the named attribute in an XML tag, or "" if it is not present.
+func attr(tag, name string) string {
+	for _, quote := range []string{`"`, `'`} {
+		key := " " + name + "=" + quote
+		if start := strings.Index(tag, key); start != -1 {
+			value := tag[start+len(key):]
+			if end := strings.Index(value, quote); end != -1 {
+				return value[:end]
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,33 @@
+package espeaktest_test
+
+import (
+	"fmt"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func Example() {
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+
+	if err := ctx.SynthesizeText(`Hello, world. <mark name="question"/>How are you?`); err != nil {
+		panic(err)
+	}
+
+	for _, e := range ctx.Events {
+		fmt.Printf("%d %d+%d %v %d %q\n", e.Type, e.TextPosition, e.Length, e.AudioPosition, e.Number, e.Name)
+	}
+
+	// Output:
+	// 2 1+0 0s 1 ""
+	// 1 1+5 0s 1 ""
+	// 1 8+5 342ms 2 ""
+	// 5 14+0 685ms 0 ""
+	// 3 15+0 914ms 0 "question"
+	// 2 38+0 914ms 2 ""
+	// 1 38+3 914ms 3 ""
+	// 1 42+3 1.142s 4 ""
+	// 1 46+3 1.371s 5 ""
+	// 5 49+0 1.599s 0 ""
+	// 6 49+0 1.828s 0 ""
+}
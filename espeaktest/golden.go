@@ -0,0 +1,612 @@
+package espeaktest // import "gopkg.in/BenLubar/espeak.v2/espeaktest"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+// Recording is synthesized audio and its events, as stored in a pair of golden files.
+type Recording struct {
+	SampleRate int
+	Samples    []int16
+	Events     []*espeak.SynthEvent
+}
+
+// RecordingOf returns the audio and events in ctx. The slices are shared with ctx.
+func RecordingOf(ctx *espeak.Context) Recording {
+	return Recording{
+		SampleRate: ctx.SampleRate(),
+		Samples:    ctx.Samples,
+		Events:     ctx.Events,
+	}
+}
+
+// Tolerance controls how different two recordings may be before Diff reports them. Fields that are
+// zero use the default given in their description.
+//
+// The defaults allow for the small changes in timing and voice quality between espeak-ng releases,
+// while still catching a word that is pronounced differently or a change in sentence structure.
+type Tolerance struct {
+	// Duration is the allowed difference in total length. The default is 100ms.
+	Duration time.Duration
+
+	// WordTiming is the allowed difference in the AudioPosition of each event. The default is 50ms.
+	WordTiming time.Duration
+
+	// Spectral is the allowed root mean square difference, in decibels, between the spectra of the
+	// recordings, averaged over the short frames of audio in each word. The default is 6dB.
+	Spectral float64
+}
+
+func (tol Tolerance) withDefaults() Tolerance {
+	if tol.Duration == 0 {
+		tol.Duration = 100 * time.Millisecond
+	}
+
+	if tol.WordTiming == 0 {
+		tol.WordTiming = 50 * time.Millisecond
+	}
+
+	if tol.Spectral == 0 {
+		tol.Spectral = 6
+	}
+
+	return tol
+}
+
+// Golden compares the audio and events in ctx with testdata/name.wav and testdata/name.events,
+// reporting any differences as test errors. If update is true, the golden files are rewritten from ctx
+// instead. Tests usually take update from a flag, so that the golden files can be regenerated when a
+// change is expected:
+//
+//	var update = flag.Bool("update", false, "rewrite golden files")
+//
+//	func TestHello(t *testing.T) {
+//		var ctx espeak.Context
+//		if err := ctx.SynthesizeText("Hello."); err != nil {
+//			t.Fatal(err)
+//		}
+//		espeaktest.Golden(t, &ctx, "hello", espeaktest.Tolerance{}, *update)
+//	}
+func Golden(t testing.TB, ctx *espeak.Context, name string, tol Tolerance, update bool) {
+	t.Helper()
+
+	got := RecordingOf(ctx)
+	wavName := filepath.Join("testdata", name+".wav")
+	eventsName := filepath.Join("testdata", name+".events")
+
+	if update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFile(wavName, got.WriteWAV); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFile(eventsName, got.WriteEvents); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := readFiles(wavName, eventsName)
+	if err != nil {
+		t.Fatalf("%v (update the golden files to create them)", err)
+	}
+
+	if diff := Diff(got, want, tol); len(diff) != 0 {
+		t.Errorf("%s does not match golden files:\n%s", name, strings.Join(diff, "\n"))
+	}
+}
+
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err = write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func readFiles(wavName, eventsName string) (Recording, error) {
+	wav, err := os.Open(wavName)
+	if err != nil {
+		return Recording{}, err
+	}
+	defer wav.Close()
+
+	events, err := os.Open(eventsName)
+	if err != nil {
+		return Recording{}, err
+	}
+	defer events.Close()
+
+	return ReadRecording(wav, events)
+}
+
+// WriteWAV writes the audio in r in the same format as espeak.Context.WriteTo.
+func (r Recording) WriteWAV(w io.Writer) error {
+	ctx := espeak.Context{
+		Samples: r.Samples,
+		Engine:  New(r.SampleRate),
+	}
+
+	_, err := ctx.WriteTo(w)
+	return err
+}
+
+// WriteEvents writes the events in r as text, one event per line.
+func (r Recording) WriteEvents(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range r.Events {
+		if _, err := fmt.Fprintln(bw, formatEvent(e)); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ReadRecording reads a Recording written by WriteWAV and WriteEvents.
+func ReadRecording(wav, events io.Reader) (Recording, error) {
+	var r Recording
+
+	ctx, err := espeak.ReadAudio(wav)
+	if err != nil {
+		return r, err
+	}
+	r.SampleRate, r.Samples = ctx.SampleRate(), ctx.Samples
+
+	s := bufio.NewScanner(events)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+
+		e, err := parseEvent(s.Text())
+		if err != nil {
+			return r, fmt.Errorf("espeaktest: events line %d: %v", line, err)
+		}
+
+		r.Events = append(r.Events, e)
+	}
+
+	return r, s.Err()
+}
+
+var eventTypeNames = map[espeak.SynthEventType]string{
+	espeak.EventWord:          "word",
+	espeak.EventSentence:      "sentence",
+	espeak.EventMark:          "mark",
+	espeak.EventPlay:          "play",
+	espeak.EventEnd:           "end",
+	espeak.EventMsgTerminated: "msg-terminated",
+	espeak.EventPhoneme:       "phoneme",
+}
+
+// formatEvent formats an event as "type [#number|"name"] text=position+length audio=duration".
+func formatEvent(e *espeak.SynthEvent) string {
+	return fmt.Sprintf("%s text=%d+%d audio=%v", eventKey(e), e.TextPosition, e.Length, e.AudioPosition)
+}
+
+// eventKey identifies an event without its position in the audio.
+func eventKey(e *espeak.SynthEvent) string {
+	name, ok := eventTypeNames[e.Type]
+	if !ok {
+		name = strconv.Itoa(int(e.Type))
+	}
+
+	switch e.Type {
+	case espeak.EventWord, espeak.EventSentence:
+		name += " #" + strconv.Itoa(e.Number)
+	case espeak.EventMark, espeak.EventPlay:
+		name += " " + strconv.Quote(e.Name)
+	case espeak.EventPhoneme:
+		name += " " + strconv.Quote(e.Phoneme)
+	}
+
+	return name
+}
+
+func parseEvent(line string) (*espeak.SynthEvent, error) {
+	var e espeak.SynthEvent
+
+	typeName := line
+	if i := strings.IndexByte(line, ' '); i != -1 {
+		typeName, line = line[:i], line[i+1:]
+	} else {
+		line = ""
+	}
+
+	found := false
+	for t, name := range eventTypeNames {
+		if name == typeName {
+			e.Type, found = t, true
+		}
+	}
+	if !found {
+		t, err := strconv.Atoi(typeName)
+		if err != nil {
+			return nil, fmt.Errorf("unknown event type %q", typeName)
+		}
+		e.Type = espeak.SynthEventType(t)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "#"):
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			i = len(line)
+		}
+
+		n, err := strconv.Atoi(line[1:i])
+		if err != nil {
+			return nil, err
+		}
+
+		e.Number, line = n, strings.TrimPrefix(line[i:], " ")
+	case strings.HasPrefix(line, `"`):
+		prefix, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return nil, err
+		}
+
+		name, _ := strconv.Unquote(prefix)
+		if e.Type == espeak.EventPhoneme {
+			e.Phoneme = name
+		} else {
+			e.Name = name
+		}
+
+		line = strings.TrimPrefix(line[len(prefix):], " ")
+	}
+
+	for _, field := range strings.Fields(line) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed field %q", field)
+		}
+
+		switch kv[0] {
+		case "text":
+			pl := strings.SplitN(kv[1], "+", 2)
+			if len(pl) != 2 {
+				return nil, fmt.Errorf("malformed text position %q", kv[1])
+			}
+
+			var err error
+			if e.TextPosition, err = strconv.Atoi(pl[0]); err != nil {
+				return nil, err
+			}
+			if e.Length, err = strconv.Atoi(pl[1]); err != nil {
+				return nil, err
+			}
+		case "audio":
+			d, err := time.ParseDuration(kv[1])
+			if err != nil {
+				return nil, err
+			}
+			e.AudioPosition = d
+		default:
+			return nil, fmt.Errorf("unknown field %q", kv[0])
+		}
+	}
+
+	return &e, nil
+}
+
+// Diff compares got with want and returns a human readable description of each difference that is
+// larger than the tolerance allows. If the recordings match, Diff returns nil.
+func Diff(got, want Recording, tol Tolerance) []string {
+	tol = tol.withDefaults()
+
+	var diff []string
+
+	if got.SampleRate != want.SampleRate {
+		diff = append(diff, fmt.Sprintf("sample rate: got %d, want %d", got.SampleRate, want.SampleRate))
+	}
+
+	gotDuration := duration(got)
+	wantDuration := duration(want)
+	if d := gotDuration - wantDuration; d > tol.Duration || -d > tol.Duration {
+		diff = append(diff, fmt.Sprintf("duration: got %v, want %v (tolerance %v)", gotDuration, wantDuration, tol.Duration))
+	}
+
+	events, matches := diffEvents(got.Events, want.Events, tol.WordTiming)
+
+	if got.SampleRate == want.SampleRate && got.SampleRate > 0 {
+		diff = append(diff, diffSpectra(got, want, matches, tol.Spectral)...)
+	}
+
+	if events != nil {
+		diff = append(diff, "events (- want, + got, ~ timing):")
+		diff = append(diff, events...)
+	}
+
+	return diff
+}
+
+func duration(r Recording) time.Duration {
+	if r.SampleRate == 0 {
+		return 0
+	}
+
+	return time.Duration(len(r.Samples)) * time.Second / time.Duration(r.SampleRate)
+}
+
+// match is a pair of events, one from each recording, that are the same apart from their AudioPosition.
+type match struct {
+	got, want *espeak.SynthEvent
+}
+
+// diffEvents returns a line-by-line diff of two event lists, or nil if they match, and the events that
+// are in both. Events are matched by type, text position, and name using a longest common subsequence,
+// and matched events are then compared by audio position.
+func diffEvents(got, want []*espeak.SynthEvent, timing time.Duration) ([]string, []match) {
+	key := func(e *espeak.SynthEvent) string {
+		return fmt.Sprintf("%s text=%d+%d", eventKey(e), e.TextPosition, e.Length)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of want[i:] and got[j:].
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if key(want[i]) == key(got[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		lines   []string
+		matches []match
+	)
+	changed := false
+
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && key(want[i]) == key(got[j]):
+			d := got[j].AudioPosition - want[i].AudioPosition
+			if d > timing || -d > timing {
+				lines = append(lines, fmt.Sprintf("~ %s audio=%v (want %v)", key(got[j]), got[j].AudioPosition, want[i].AudioPosition))
+				changed = true
+			} else {
+				lines = append(lines, "  "+formatEvent(got[j]))
+			}
+			matches = append(matches, match{got: got[j], want: want[i]})
+			i++
+			j++
+		case j < len(got) && (i == len(want) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, "+ "+formatEvent(got[j]))
+			changed = true
+			j++
+		default:
+			lines = append(lines, "- "+formatEvent(want[i]))
+			changed = true
+			i++
+		}
+	}
+
+	if !changed {
+		return nil, matches
+	}
+
+	return lines, matches
+}
+
+const (
+	// frameDuration is the shortest length of the frames whose spectra diffSpectra compares.
+	frameDuration = 20 * time.Millisecond
+
+	// spectrumFloor is the level of the quietest part of a spectrum, in decibels relative to full scale,
+	// so that the differences between two silences are not counted.
+	spectrumFloor = -80
+
+	// alignSearch is the number of frames either side of the aligned frame that diffSpectra searches for
+	// the closest spectrum, to allow for small differences in timing within a word.
+	alignSearch = 2
+)
+
+// diffSpectra compares the spectra of two recordings at the same sample rate frame by frame, and returns a
+// line for each word of want whose frames differ from got by more than tol decibels on average.
+//
+// The frames of want are aligned with got by the events that they have in common, so that a word that
+// starts a little later, or is spoken a little faster, is still compared with itself.
+func diffSpectra(got, want Recording, matches []match, tol float64) []string {
+	frame := 1
+	for time.Duration(frame)*time.Second/time.Duration(want.SampleRate) < frameDuration {
+		frame <<= 1
+	}
+	hop := frame / 2
+
+	gotSpectra := spectra(got.Samples, got.SampleRate, frame, hop)
+	wantSpectra := spectra(want.Samples, want.SampleRate, frame, hop)
+	if len(gotSpectra) == 0 || len(wantSpectra) == 0 {
+		return nil
+	}
+
+	// Anchors map times in want to times in got, from the start and end of the audio and the matching
+	// events in between.
+	type anchor struct{ want, got time.Duration }
+	anchors := []anchor{{0, 0}}
+	for _, m := range matches {
+		last := anchors[len(anchors)-1]
+		if m.want.AudioPosition > last.want && m.got.AudioPosition > last.got {
+			anchors = append(anchors, anchor{m.want.AudioPosition, m.got.AudioPosition})
+		}
+	}
+	if end := (anchor{duration(want), duration(got)}); end.want > anchors[len(anchors)-1].want && end.got > anchors[len(anchors)-1].got {
+		anchors = append(anchors, end)
+	}
+
+	align := func(t time.Duration) time.Duration {
+		for i := 1; i < len(anchors); i++ {
+			if a, b := anchors[i-1], anchors[i]; t <= b.want || i == len(anchors)-1 {
+				return a.got + time.Duration(float64(b.got-a.got)*float64(t-a.want)/float64(b.want-a.want))
+			}
+		}
+		return t
+	}
+
+	frameAt := func(t time.Duration, rate int) int {
+		return int(t * time.Duration(rate) / time.Second / time.Duration(hop))
+	}
+	frameTime := func(i int, rate int) time.Duration {
+		return time.Duration(i*hop+frame/2) * time.Second / time.Duration(rate)
+	}
+
+	// Each frame of want is compared with the closest of the frames of got near where it is aligned.
+	distance := make([]float64, len(wantSpectra))
+	for i, ws := range wantSpectra {
+		center := frameAt(align(frameTime(i, want.SampleRate)), got.SampleRate)
+		distance[i] = math.Inf(1)
+		for j := center - alignSearch; j <= center+alignSearch; j++ {
+			if j >= 0 && j < len(gotSpectra) {
+				distance[i] = math.Min(distance[i], spectralDistance(gotSpectra[j], ws))
+			}
+		}
+		if math.IsInf(distance[i], 1) {
+			distance[i] = 0
+		}
+	}
+
+	// Each word runs from its event to the next event, other than a phoneme, that comes after it.
+	var lines []string
+	for i, e := range want.Events {
+		if e.Type != espeak.EventWord {
+			continue
+		}
+
+		end := duration(want)
+		for _, next := range want.Events[i+1:] {
+			if next.Type != espeak.EventPhoneme && next.AudioPosition > e.AudioPosition {
+				end = next.AudioPosition
+				break
+			}
+		}
+
+		var sum float64
+		n := 0
+		for f := frameAt(e.AudioPosition, want.SampleRate); f < len(distance) && frameTime(f, want.SampleRate) < end; f++ {
+			sum += distance[f]
+			n++
+		}
+
+		if n != 0 && sum/float64(n) > tol {
+			lines = append(lines, fmt.Sprintf("spectral distance of %s text=%d+%d at %v: %.2fdB (tolerance %.2fdB)", eventKey(e), e.TextPosition, e.Length, e.AudioPosition, sum/float64(n), tol))
+		}
+	}
+
+	return lines
+}
+
+// spectralDistance returns the root mean square difference in decibels between two spectra.
+func spectralDistance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+
+	return math.Sqrt(sum / float64(len(a)))
+}
+
+// spectra returns the spectrum of each frame of the audio, hop samples apart. Each spectrum is the power
+// in bands a third of an octave wide from 100Hz, in decibels relative to full scale, with a floor of
+// spectrumFloor. Bands are used rather than the frequencies of the Fourier transform so that a small
+// change in pitch does not count as a large difference.
+func spectra(samples []int16, sampleRate, frame, hop int) [][]float64 {
+	var edges []int
+	for f := 100.0; f < float64(sampleRate)/2; f *= math.Pow(2, 1.0/3) {
+		edges = append(edges, int(f*float64(frame)/float64(sampleRate)))
+	}
+	edges = append(edges, frame/2)
+
+	window := make([]float64, frame)
+	var gain float64
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+		gain += window[i]
+	}
+
+	var result [][]float64
+	buf := make([]complex128, frame)
+	for start := 0; start+frame <= len(samples); start += hop {
+		for i := range buf {
+			buf[i] = complex(window[i]*float64(samples[start+i])/32768, 0)
+		}
+
+		fft(buf)
+
+		bands := make([]float64, len(edges)-1)
+		for b := range bands {
+			var power float64
+			for k := edges[b]; k < edges[b+1] || k == edges[b]; k++ {
+				m := cmplx.Abs(buf[k]) / gain
+				power += m * m
+			}
+			bands[b] = math.Max(10*math.Log10(power), spectrumFloor)
+		}
+
+		result = append(result, bands)
+	}
+
+	return result
+}
+
+// fft computes an in-place radix-2 fast Fourier transform. len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := x[start+k]
+				v := x[start+k+size/2] * w
+				x[start+k] = u + v
+				x[start+k+size/2] = u - v
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package espeaktest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+func synthesizeRecording(t *testing.T, text string) Recording {
+	ctx := espeak.Context{Engine: New(16000)}
+	if err := ctx.SynthesizeText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	return RecordingOf(&ctx)
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	want := synthesizeRecording(t, `Hello, <mark name="a &quot;b&quot;"/>world.`)
+
+	var wav, events bytes.Buffer
+	if err := want.WriteWAV(&wav); err != nil {
+		t.Fatal(err)
+	}
+	if err := want.WriteEvents(&events); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadRecording(&wav, &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip changed recording:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	want := synthesizeRecording(t, "The quick brown fox jumps over the lazy dog.")
+
+	if diff := Diff(want, want, Tolerance{}); diff != nil {
+		t.Errorf("identical recordings differ:\n%v", diff)
+	}
+
+	shifted := want
+	shifted.Events = make([]*espeak.SynthEvent, len(want.Events))
+	for i, e := range want.Events {
+		c := *e
+		c.AudioPosition += 20 * time.Millisecond
+		shifted.Events[i] = &c
+	}
+	if diff := Diff(shifted, want, Tolerance{}); diff != nil {
+		t.Errorf("events within tolerance differ:\n%v", diff)
+	}
+
+	// The same audio starting a little later is still compared with itself.
+	delayed := shifted
+	delayed.Samples = append(make([]int16, want.SampleRate/50), want.Samples...)
+	if diff := Diff(delayed, want, Tolerance{}); diff != nil {
+		t.Errorf("delayed recording differs:\n%v", diff)
+	}
+
+	if diff := Diff(synthesizeRecording(t, "The quick brown fox leaps over the lazy dog. Woof!"), want, Tolerance{}); diff == nil {
+		t.Error("expected differences for a changed sentence")
+	}
+}
+
+// TestDiffPronunciation replaces the audio of one word, as a change in pronunciation would, without
+// changing the events or the spectrum of the recording as a whole.
+func TestDiffPronunciation(t *testing.T) {
+	want := synthesizeRecording(t, "The quick brown fox jumps over the lazy dog.")
+
+	word := func(r Recording, number int) []int16 {
+		for i, e := range r.Events {
+			if e.Type == espeak.EventWord && e.Number == number {
+				end := r.Events[i+1].AudioPosition
+				return r.Samples[int(e.AudioPosition)*r.SampleRate/1e9 : int(end)*r.SampleRate/1e9]
+			}
+		}
+		t.Fatalf("no word #%d", number)
+		return nil
+	}
+
+	// "fox" and "dog" are the same length, so swapping their audio keeps the long-term average spectrum.
+	got := want
+	got.Samples = append([]int16(nil), want.Samples...)
+	fox, dog := word(got, 4), word(got, 9)
+	for i := range fox {
+		fox[i], dog[i] = dog[i], fox[i]
+	}
+
+	diff := Diff(got, want, Tolerance{})
+	if len(diff) != 2 || !strings.Contains(diff[0], "word #4 ") || !strings.Contains(diff[1], "word #9 ") {
+		t.Errorf("expected differences in words 4 and 9 only:\n%s", strings.Join(diff, "\n"))
+	}
+}
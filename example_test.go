@@ -2,8 +2,10 @@ package espeak_test
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/earcon"
 )
 
 func Example_ssml() {
@@ -37,5 +39,34 @@ func Example_ssml() {
 	defer f.Close()
 	ctx.WriteTo(f)
 
-	// Output:
+	// The same document is checked against golden files by TestSSML.
+}
+
+func Example_timeline() {
+	var guard, thief espeak.Context
+	guard.SetVoiceProperties("", "en", espeak.Male, 0, 0)
+	guard.SynthesizeText("Halt! Who goes there?")
+	thief.SetVoiceProperties("", "en", espeak.Female, 0, 0)
+	thief.SynthesizeText("Nobody. Nobody at all.")
+
+	// The thief answers before the guard has finished, over rain that gets quieter while they speak.
+	tl := espeak.NewTimeline(espeak.SampleRate())
+	rain := tl.AddTrack("rain")
+	voices := tl.AddTrack("voices")
+	voices.Place(0, &guard)
+	voices.Place(guard.Duration()*3/4, &thief)
+
+	rain.Place(0, &espeak.Context{Samples: earcon.Render(earcon.Tone{
+		Wave:     earcon.Noise,
+		Duration: guard.Duration() + thief.Duration(),
+		Envelope: earcon.Envelope{Attack: time.Second, Sustain: 1, Release: time.Second},
+		Gain:     -20,
+	}, espeak.SampleRate())})
+	rain.DuckUnder = []*espeak.Track{voices}
+
+	ctx := tl.Render()
+
+	f, _ := os.Create("example-timeline.wav")
+	defer f.Close()
+	ctx.WriteTo(f)
 }
@@ -0,0 +1,10 @@
+package espeak
+
+// SetRIFFSizeLimit lowers the size at which WAV files are written as RF64 and WAV-only formats report
+// that the audio is too long, so that tests do not need gigabytes of audio. It returns a function that
+// restores the limit.
+func SetRIFFSizeLimit(size uint64) (restore func()) {
+	old := riffSizeLimit
+	riffSizeLimit = size
+	return func() { riffSizeLimit = old }
+}
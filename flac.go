@@ -0,0 +1,172 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/flac"
+)
+
+// DefaultFLACLevel is the FLACOptions.Level that selects level 5, which is also the default of the flac
+// command.
+const DefaultFLACLevel = -1
+
+// FLACOptions controls the stream written by Context.WriteFLAC.
+type FLACOptions struct {
+	// Level is the compression level from 0 (fastest) to 8 (smallest), as in the flac command, or
+	// DefaultFLACLevel. Since 0 is a level, a zero FLACOptions compresses the least, while a nil
+	// FLACOptions uses DefaultFLACLevel.
+	Level int
+
+	// Info is written as Vorbis comments (TITLE, ARTIST, ENCODER, and COMMENT) if it is not nil. The
+	// defaults are the same as for WriteWAV.
+	Info *WAVInfo
+}
+
+// WriteFLAC writes the Samples in this Context to an io.Writer in the lossless FLAC format, which is
+// usually less than half the size of a WAV file. A nil opts uses the default compression level.
+//
+// Each sentence event becomes a seek point, so that players can jump to the start of a sentence. Each
+// mark event becomes a track in a cue sheet and a CHAPTER comment with the name of the mark.
+//
+// The position of each seek point depends on the size of the compressed audio before it. If w is not
+// an io.WriteSeeker, the audio is compressed twice to find them.
+func (ctx *Context) WriteFLAC(w io.Writer, opts *FLACOptions) (int64, error) {
+	return ctx.writeFLAC(w, opts, ctx.Samples, Mono)
+}
+
+// flacLayouts are the channel layouts that FLAC assumes for each number of channels. Other layouts are
+// stored in a WAVEFORMATEXTENSIBLE_CHANNEL_MASK comment.
+var flacLayouts = [...]Layout{
+	1: Mono,
+	2: Stereo,
+	3: Stereo | SpeakerFrontCenter,
+	4: Quad,
+	5: Quad | SpeakerFrontCenter,
+	6: Surround51,
+	7: Stereo | SpeakerFrontCenter | SpeakerLowFrequency | SpeakerBackCenter | SpeakerSideLeft | SpeakerSideRight,
+	8: Surround71,
+}
+
+// writeFLAC writes interleaved samples with the given layout, using the events and settings of ctx for
+// metadata.
+func (ctx *Context) writeFLAC(w io.Writer, opts *FLACOptions, samples []int16, layout Layout) (int64, error) {
+	if opts == nil {
+		opts = &FLACOptions{Level: DefaultFLACLevel}
+	}
+
+	channels := layout.Channels()
+	if channels >= len(flacLayouts) {
+		return 0, fmt.Errorf("espeak: %d channels cannot be stored in a flac stream", channels)
+	}
+
+	h := &flac.Header{
+		SampleRate:   ctx.SampleRate(),
+		Channels:     channels,
+		TotalSamples: uint64(len(samples) / channels),
+		Level:        opts.Level,
+	}
+	if h.Level == DefaultFLACLevel {
+		h.Level = 5
+	}
+	if layout != flacLayouts[channels] {
+		h.Comments = append(h.Comments, fmt.Sprintf("WAVEFORMATEXTENSIBLE_CHANNEL_MASK=0x%X", uint32(layout)))
+	}
+
+	sum := md5.New()
+	binary.Write(sum, binary.LittleEndian, samples)
+	sum.Sum(h.MD5[:0])
+
+	if info := opts.Info; info != nil {
+		software, comment := info.Software, info.Comment
+		if software == "" {
+			software = Software
+		}
+		if comment == "" {
+			comment = ctx.describeSettings()
+		}
+
+		for _, tag := range []struct {
+			name, text string
+		}{
+			{"TITLE", info.Title},
+			{"ARTIST", info.Artist},
+			{"ENCODER", software},
+			{"COMMENT", comment},
+		} {
+			if tag.text != "" {
+				h.Comments = append(h.Comments, tag.name+"="+tag.text)
+			}
+		}
+	}
+
+	var tracks []uint64
+	for _, e := range ctx.Events {
+		sample := uint64(e.AudioPosition * time.Duration(h.SampleRate) / time.Second)
+		if sample >= h.TotalSamples {
+			continue
+		}
+
+		switch e.Type {
+		case EventSentence:
+			h.SeekTable = append(h.SeekTable, flac.SeekPoint{Sample: sample})
+		case EventMark:
+			chapter := fmt.Sprintf("CHAPTER%03d", len(tracks)+1)
+			h.Comments = append(h.Comments, chapter+"="+formatChapterTime(e.AudioPosition), chapter+"NAME="+e.Name)
+
+			if len(tracks) == 0 && sample != 0 {
+				// The first track covers the audio before the first mark.
+				tracks = append(tracks, 0)
+			}
+			if len(tracks) < 254 && (len(tracks) == 0 || sample > tracks[len(tracks)-1]) {
+				tracks = append(tracks, sample)
+			}
+		}
+	}
+	if len(tracks) != 0 {
+		h.CueSheet = &flac.CueSheet{Tracks: tracks}
+	}
+
+	if s, ok := w.(io.WriteSeeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			_, err = encodeFLAC(s, h, samples)
+			end, _ := s.Seek(0, io.SeekCurrent)
+			return end - start, err
+		}
+	}
+
+	if len(h.SeekTable) != 0 {
+		e, err := encodeFLAC(io.Discard, h, samples)
+		if err != nil {
+			return 0, err
+		}
+
+		h.SeekTable = e.SeekTable()
+	}
+
+	cw := countWriter{w: w}
+	_, err := encodeFLAC(&cw, h, samples)
+	return cw.n, err
+}
+
+func encodeFLAC(w io.Writer, h *flac.Header, samples []int16) (*flac.Encoder, error) {
+	e, err := flac.NewEncoder(w, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.WriteSamples(samples); err != nil {
+		return nil, err
+	}
+
+	return e, e.Close()
+}
+
+// formatChapterTime formats d as HH:MM:SS.mmm, as used by CHAPTER comments.
+func formatChapterTime(d time.Duration) string {
+	ms := d / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
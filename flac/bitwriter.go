@@ -0,0 +1,85 @@
+package flac
+
+// bitWriter packs values most significant bit first, as FLAC frames require.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64 // bits that do not fill a byte yet, in the low n bits
+	nbits uint
+}
+
+// write appends the low n bits of v, where n is at most 32.
+func (b *bitWriter) write(v uint64, n uint) {
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.nbits += n
+
+	for b.nbits >= 8 {
+		b.nbits -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.nbits))
+	}
+}
+
+// writeSigned appends v as an n-bit two's complement number.
+func (b *bitWriter) writeSigned(v int64, n uint) {
+	b.write(uint64(v), n)
+}
+
+// writeUnary appends q zero bits followed by a one bit.
+func (b *bitWriter) writeUnary(q uint64) {
+	for q >= 32 {
+		b.write(0, 32)
+		q -= 32
+	}
+	b.write(1, uint(q)+1)
+}
+
+// writeRice appends v with the zig-zag and Rice coding used for residuals.
+func (b *bitWriter) writeRice(v int32, k uint) {
+	u := zigzag(v)
+	b.writeUnary(uint64(u >> k))
+	b.write(uint64(u), k)
+}
+
+// align pads the output with zero bits to a whole number of bytes.
+func (b *bitWriter) align() {
+	if b.nbits != 0 {
+		b.write(0, 8-b.nbits)
+	}
+}
+
+func zigzag(v int32) uint32 {
+	return uint32(v<<1) ^ uint32(v>>31)
+}
+
+// crc8 uses the polynomial x^8 + x^2 + x + 1, which protects frame headers.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, d := range data {
+		crc ^= d
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// crc16 uses the polynomial x^16 + x^15 + x^2 + 1, which protects whole frames.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, d := range data {
+		crc ^= uint16(d) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
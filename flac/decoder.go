@@ -0,0 +1,524 @@
+package flac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Errors returned by Decode.
+var (
+	ErrFormat   = errors.New("flac: not a flac stream")
+	ErrCorrupt  = errors.New("flac: corrupt stream")
+	errReserved = errors.New("flac: stream uses a reserved feature")
+)
+
+// Decode reads a whole FLAC stream from r. Any bit depth from 4 to 32 bits is accepted, and the samples
+// are converted to 16 bits and returned with the channels interleaved. The returned Header holds the
+// sample rate, number of channels, total samples, MD5 sum, vendor, and comments from the stream.
+func Decode(r io.Reader) (*Header, []int16, error) {
+	br := bufio.NewReader(r)
+
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, nil, ErrFormat
+	}
+
+	// Some tools put an ID3v2 tag before the stream.
+	if string(magic[:3]) == "ID3" {
+		var rest [6]byte
+		if _, err := io.ReadFull(br, rest[:]); err != nil {
+			return nil, nil, ErrFormat
+		}
+		size := int64(rest[2]&0x7F)<<21 | int64(rest[3]&0x7F)<<14 | int64(rest[4]&0x7F)<<7 | int64(rest[5]&0x7F)
+		if _, err := io.CopyN(io.Discard, br, size); err != nil {
+			return nil, nil, ErrFormat
+		}
+		if _, err := io.ReadFull(br, magic[:]); err != nil {
+			return nil, nil, ErrFormat
+		}
+	}
+
+	if string(magic[:]) != "fLaC" {
+		return nil, nil, ErrFormat
+	}
+
+	d := &decoder{h: &Header{}}
+	if err := d.readMetadata(br); err != nil {
+		return nil, nil, err
+	}
+
+	b := &frameReader{r: br}
+	var samples []int16
+	for d.h.TotalSamples == 0 || uint64(len(samples)/d.h.Channels) < d.h.TotalSamples {
+		frame, err := d.readFrame(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		samples = append(samples, frame...)
+	}
+
+	if d.h.TotalSamples != 0 && uint64(len(samples)/d.h.Channels) > d.h.TotalSamples {
+		samples = samples[:d.h.TotalSamples*uint64(d.h.Channels)]
+	}
+
+	return d.h, samples, nil
+}
+
+type decoder struct {
+	h             *Header
+	bitsPerSample int
+}
+
+func (d *decoder) readMetadata(r io.Reader) error {
+	sawStreamInfo := false
+
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return ErrCorrupt
+		}
+		last := header[0]&0x80 != 0
+		typ := header[0] & 0x7F
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return ErrCorrupt
+		}
+
+		switch typ {
+		case blockStreamInfo:
+			if size < 34 {
+				return ErrCorrupt
+			}
+			v := binary.BigEndian.Uint64(data[10:])
+			d.h.SampleRate = int(v >> 44)
+			d.h.Channels = int(v>>41&7) + 1
+			d.bitsPerSample = int(v>>36&31) + 1
+			d.h.TotalSamples = v & (1<<36 - 1)
+			copy(d.h.MD5[:], data[18:34])
+			sawStreamInfo = true
+		case blockVorbisComment:
+			d.parseComments(data)
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if !sawStreamInfo {
+		return ErrCorrupt
+	}
+
+	return nil
+}
+
+func (d *decoder) parseComments(data []byte) {
+	next := func() (string, bool) {
+		if len(data) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return "", false
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, true
+	}
+
+	vendor, ok := next()
+	if !ok || len(data) < 4 {
+		return
+	}
+	d.h.Vendor = vendor
+
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+		d.h.Comments = append(d.h.Comments, comment)
+	}
+}
+
+// readFrame decodes one frame, returning its samples interleaved and converted to 16 bits. It returns
+// io.EOF if the stream ends before the frame.
+func (d *decoder) readFrame(b *frameReader) ([]int16, error) {
+	b.start()
+
+	sync := b.read(15)
+	if b.err == io.EOF || b.err == io.ErrUnexpectedEOF {
+		return nil, io.EOF
+	}
+	if sync != 0xFFF8>>1 {
+		return nil, ErrCorrupt
+	}
+	b.read(1) // blocking strategy
+
+	bsCode := b.read(4)
+	srCode := b.read(4)
+	assignment := int(b.read(4))
+	bpsCode := b.read(3)
+	if b.read(1) != 0 {
+		return nil, errReserved
+	}
+	b.readUTF8()
+
+	var blockSize int
+	switch {
+	case bsCode == 0:
+		return nil, errReserved
+	case bsCode == 1:
+		blockSize = 192
+	case bsCode <= 5:
+		blockSize = 576 << (bsCode - 2)
+	case bsCode == 6:
+		blockSize = int(b.read(8)) + 1
+	case bsCode == 7:
+		blockSize = int(b.read(16)) + 1
+	default:
+		blockSize = 256 << (bsCode - 8)
+	}
+
+	switch srCode {
+	case 12, 13, 14:
+		// The frame may have its own sample rate, but the stream has only one, from STREAMINFO.
+		if srCode == 12 {
+			b.read(8)
+		} else {
+			b.read(16)
+		}
+	case 15:
+		return nil, ErrCorrupt
+	}
+
+	bps := d.bitsPerSample
+	switch bpsCode {
+	case 0:
+	case 1:
+		bps = 8
+	case 2:
+		bps = 12
+	case 4:
+		bps = 16
+	case 5:
+		bps = 20
+	case 6:
+		bps = 24
+	case 7:
+		bps = 32
+	default:
+		return nil, errReserved
+	}
+
+	if crc := crc8(b.recorded()); byte(b.read(8)) != crc {
+		return nil, ErrCorrupt
+	}
+
+	channels := assignment + 1
+	if assignment > 7 {
+		if assignment > 10 {
+			return nil, errReserved
+		}
+		channels = 2
+	}
+	if channels != d.h.Channels {
+		return nil, ErrCorrupt
+	}
+
+	x := make([][]int32, channels)
+	for c := range x {
+		// The side channel of a stereo frame needs an extra bit.
+		sideBits := 0
+		if (assignment == 8 && c == 1) || (assignment == 9 && c == 0) || (assignment == 10 && c == 1) {
+			sideBits = 1
+		}
+
+		var err error
+		if x[c], err = readSubframe(b, blockSize, bps+sideBits); err != nil {
+			return nil, err
+		}
+	}
+
+	b.align()
+	if crc := crc16(b.recorded()); uint16(b.read(16)) != crc {
+		return nil, ErrCorrupt
+	}
+	if b.err != nil {
+		return nil, ErrCorrupt
+	}
+
+	switch assignment {
+	case 8: // left, side
+		for i, side := range x[1] {
+			x[1][i] = x[0][i] - side
+		}
+	case 9: // side, right
+		for i, side := range x[0] {
+			x[0][i] = x[1][i] + side
+		}
+	case 10: // mid, side
+		for i, side := range x[1] {
+			mid := int64(x[0][i])<<1 | int64(side)&1
+			x[0][i] = int32((mid + int64(side)) >> 1)
+			x[1][i] = int32((mid - int64(side)) >> 1)
+		}
+	}
+
+	samples := make([]int16, blockSize*channels)
+	for c, ch := range x {
+		for i, v := range ch {
+			samples[i*channels+c] = to16(v, bps)
+		}
+	}
+
+	return samples, nil
+}
+
+// to16 converts a sample of the given bit depth to 16 bits.
+func to16(v int32, bps int) int16 {
+	if bps > 16 {
+		return int16(v >> uint(bps-16))
+	}
+	return int16(v << uint(16-bps))
+}
+
+func readSubframe(b *frameReader, n, bps int) ([]int32, error) {
+	if b.read(1) != 0 {
+		return nil, ErrCorrupt
+	}
+	typ := b.read(6)
+
+	wasted := 0
+	if b.read(1) != 0 {
+		wasted = int(b.readUnary()) + 1
+		bps -= wasted
+	}
+	if bps <= 0 {
+		return nil, ErrCorrupt
+	}
+
+	x := make([]int32, n)
+	switch {
+	case typ == 0x00:
+		v := int32(b.readSigned(uint(bps)))
+		for i := range x {
+			x[i] = v
+		}
+	case typ == 0x01:
+		for i := range x {
+			x[i] = int32(b.readSigned(uint(bps)))
+		}
+	case typ >= 0x08 && typ <= 0x0C:
+		order := int(typ & 7)
+		if order > n {
+			return nil, ErrCorrupt
+		}
+		for i := 0; i < order; i++ {
+			x[i] = int32(b.readSigned(uint(bps)))
+		}
+		if err := readResidual(b, x, order); err != nil {
+			return nil, err
+		}
+		restoreFixed(x, order)
+	case typ >= 0x20:
+		order := int(typ&0x1F) + 1
+		if order > n {
+			return nil, ErrCorrupt
+		}
+		for i := 0; i < order; i++ {
+			x[i] = int32(b.readSigned(uint(bps)))
+		}
+		precision := b.read(4) + 1
+		if precision == 16 {
+			return nil, ErrCorrupt
+		}
+		shift := b.readSigned(5)
+		if shift < 0 {
+			return nil, ErrCorrupt
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = b.readSigned(uint(precision))
+		}
+		if err := readResidual(b, x, order); err != nil {
+			return nil, err
+		}
+		for i := order; i < n; i++ {
+			var sum int64
+			for j, c := range coefs {
+				sum += c * int64(x[i-j-1])
+			}
+			x[i] += int32(sum >> uint(shift))
+		}
+	default:
+		return nil, errReserved
+	}
+
+	if wasted != 0 {
+		for i := range x {
+			x[i] <<= uint(wasted)
+		}
+	}
+
+	return x, b.err
+}
+
+// readResidual reads the Rice-coded residual of a predicted subframe into x after the warm-up samples.
+func readResidual(b *frameReader, x []int32, order int) error {
+	paramBits, escape := uint(4), uint64(15)
+	switch b.read(2) {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return errReserved
+	}
+
+	partitionOrder := b.read(4)
+	partitions := 1 << partitionOrder
+	size := len(x) >> partitionOrder
+	if size<<partitionOrder != len(x) || size < order {
+		return ErrCorrupt
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * size
+
+		if k := b.read(paramBits); k == escape {
+			bits := uint(b.read(5))
+			for ; i < end; i++ {
+				if bits == 0 {
+					x[i] = 0
+				} else {
+					x[i] = int32(b.readSigned(bits))
+				}
+			}
+		} else {
+			for ; i < end; i++ {
+				u := b.readUnary()<<k | b.read(uint(k))
+				x[i] = int32(u>>1) ^ -int32(u&1)
+			}
+		}
+
+		if b.err != nil {
+			return ErrCorrupt
+		}
+	}
+
+	return nil
+}
+
+// restoreFixed adds the prediction of a fixed polynomial of the given order to the residual in x.
+func restoreFixed(x []int32, order int) {
+	for i := order; i < len(x); i++ {
+		switch order {
+		case 1:
+			x[i] += x[i-1]
+		case 2:
+			x[i] += 2*x[i-1] - x[i-2]
+		case 3:
+			x[i] += 3*x[i-1] - 3*x[i-2] + x[i-3]
+		case 4:
+			x[i] += 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+		}
+	}
+}
+
+// frameReader reads big-endian bit fields, and records the bytes of the current frame for its checksums.
+type frameReader struct {
+	r    io.ByteReader
+	bits uint64 // the low n bits are unread
+	n    uint
+	data []byte
+	err  error
+}
+
+func (b *frameReader) start() {
+	b.data = b.data[:0]
+}
+
+func (b *frameReader) recorded() []byte {
+	return b.data
+}
+
+func (b *frameReader) fill() bool {
+	c, err := b.r.ReadByte()
+	if err != nil {
+		if b.err == nil {
+			if err == io.EOF && len(b.data) != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			b.err = err
+		}
+		return false
+	}
+
+	b.data = append(b.data, c)
+	b.bits = b.bits<<8 | uint64(c)
+	b.n += 8
+	return true
+}
+
+// read returns the next n bits, for n up to 56.
+func (b *frameReader) read(n uint) uint64 {
+	for b.n < n {
+		if !b.fill() {
+			return 0
+		}
+	}
+
+	b.n -= n
+	return b.bits >> b.n & (1<<n - 1)
+}
+
+func (b *frameReader) readSigned(n uint) int64 {
+	v := b.read(n)
+	return int64(v<<(64-n)) >> (64 - n)
+}
+
+// readUnary returns the number of 0 bits before the next 1 bit.
+func (b *frameReader) readUnary() uint64 {
+	var q uint64
+	for b.read(1) == 0 {
+		if b.err != nil {
+			return 0
+		}
+		q++
+	}
+	return q
+}
+
+func (b *frameReader) align() {
+	b.n -= b.n % 8
+}
+
+// readUTF8 reads a frame or sample number in the extended UTF-8 coding used by frame headers.
+func (b *frameReader) readUTF8() uint64 {
+	first := b.read(8)
+
+	n := 0
+	for first&(0x80>>uint(n)) != 0 {
+		n++
+	}
+	if n == 0 {
+		return first
+	}
+
+	v := first & (0xFF >> uint(n+1))
+	for i := 1; i < n; i++ {
+		v = v<<6 | b.read(8)&0x3F
+	}
+	return v
+}
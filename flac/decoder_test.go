@@ -0,0 +1,149 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	mono := speechLike(20000)
+	stereo := make([]int16, 0, 2*len(mono))
+	for i, s := range mono {
+		stereo = append(stereo, s, mono[len(mono)-1-i]/2)
+	}
+
+	for _, test := range []struct {
+		channels int
+		samples  []int16
+	}{
+		{1, mono},
+		{2, stereo},
+	} {
+		for level := 0; level < len(levels); level++ {
+			h := &Header{SampleRate: 16000, Channels: test.channels, Level: level, Comments: []string{"TITLE=test"}}
+
+			// A stream that is not seekable does not know its length.
+			for _, seekable := range []bool{true, false} {
+				var data []byte
+				if seekable {
+					var b seekBuffer
+					encode(t, &b, h, test.samples, 1000)
+					data = b.buf
+				} else {
+					var b bytes.Buffer
+					encode(t, &b, h, test.samples, 1000)
+					data = b.Bytes()
+				}
+
+				got, samples, err := Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Errorf("%d channels, level %d: %v", test.channels, level, err)
+					continue
+				}
+				if !reflect.DeepEqual(samples, test.samples) {
+					t.Errorf("%d channels, level %d: decoded samples differ", test.channels, level)
+				}
+				if got.SampleRate != 16000 || got.Channels != test.channels || got.Vendor != Vendor || !reflect.DeepEqual(got.Comments, h.Comments) {
+					t.Errorf("%d channels, level %d: header %+v", test.channels, level, got)
+				}
+				if seekable && got.TotalSamples != uint64(len(test.samples)/test.channels) {
+					t.Errorf("%d channels, level %d: %d total samples", test.channels, level, got.TotalSamples)
+				}
+			}
+		}
+	}
+}
+
+// TestDecodeMidSide decodes a stream with features that Encoder does not use: 24-bit samples, mid-side
+// stereo, wasted bits, and an escaped Rice partition.
+func TestDecodeMidSide(t *testing.T) {
+	left := []int32{100 << 8, -200 << 8, 300 << 8, 32767 << 8, -32768 << 8, 0, 5 << 8, -7 << 8}
+	right := []int32{50 << 8, 70 << 8, -300 << 8, -32768 << 8, 32767 << 8, 1 << 8, 5 << 8, 9 << 8}
+	n := len(left)
+
+	var b bitWriter
+	b.write(0xFFF8, 16)
+	b.write(6, 4)  // block size in 8 bits
+	b.write(0, 4)  // sample rate from STREAMINFO
+	b.write(10, 4) // mid-side
+	b.write(6, 3)  // 24 bits
+	b.write(0, 1)
+	b.write(0, 8) // frame 0
+	b.write(uint64(n-1), 8)
+	b.write(uint64(crc8(b.buf)), 8)
+
+	mid := make([]int32, n)
+	side := make([]int32, n)
+	for i := range mid {
+		mid[i] = (left[i] + right[i]) >> 1
+		side[i] = left[i] - right[i]
+	}
+
+	// The mid channel is verbatim, with 7 wasted bits.
+	b.write(0x01<<1|1, 8)
+	b.writeUnary(6)
+	for _, v := range mid {
+		b.writeSigned(int64(v>>7), 17)
+	}
+
+	// The side channel is a first-order fixed predictor with one escaped partition of 26-bit residuals.
+	b.write(0x09<<1, 8)
+	b.writeSigned(int64(side[0]), 25)
+	b.write(0, 2)  // Rice coding
+	b.write(0, 4)  // one partition
+	b.write(15, 4) // escape
+	b.write(26, 5)
+	for i := 1; i < n; i++ {
+		b.writeSigned(int64(side[i]-side[i-1]), 26)
+	}
+
+	b.align()
+	b.write(uint64(crc16(b.buf)), 16)
+
+	var stream bytes.Buffer
+	stream.WriteString("fLaC")
+	stream.Write(blockHeader(blockStreamInfo, true, 34))
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info, uint16(n))
+	binary.BigEndian.PutUint16(info[2:], uint16(n))
+	binary.BigEndian.PutUint64(info[10:], 44100<<44|1<<41|23<<36|uint64(n))
+	stream.Write(info)
+	stream.Write(b.buf)
+
+	h, samples, err := Decode(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.SampleRate != 44100 || h.Channels != 2 || h.TotalSamples != uint64(n) {
+		t.Errorf("header %+v", h)
+	}
+
+	want := make([]int16, 0, 2*n)
+	for i := range left {
+		want = append(want, int16(left[i]>>8), int16(right[i]>>8))
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("decoded %v, want %v", samples, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var b seekBuffer
+	encode(t, &b, &Header{SampleRate: 16000}, speechLike(5000), 1000)
+
+	if _, _, err := Decode(bytes.NewReader([]byte("RIFF....WAVE"))); err != ErrFormat {
+		t.Errorf("not a flac stream: %v", err)
+	}
+
+	corrupt := append([]byte(nil), b.buf...)
+	corrupt[len(corrupt)-100] ^= 0x10
+	if _, _, err := Decode(bytes.NewReader(corrupt)); err != ErrCorrupt {
+		t.Errorf("corrupt frame: %v", err)
+	}
+
+	if _, _, err := Decode(bytes.NewReader(b.buf[:len(b.buf)-10])); err != ErrCorrupt {
+		t.Errorf("truncated stream: %v", err)
+	}
+}
@@ -0,0 +1,457 @@
+// Package flac encodes 16-bit audio from package espeak in the FLAC lossless compression format, and
+// decodes FLAC streams so that recorded audio can be combined with speech.
+//
+// The encoder and decoder are written in pure Go, so they work with every backend of package espeak,
+// including GopherJS. Speech typically compresses to less than half the size of a WAV file.
+package flac // import "gopkg.in/BenLubar/espeak.v2/flac"
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+)
+
+// Vendor is the default Header.Vendor.
+const Vendor = "gopkg.in/BenLubar/espeak.v2/flac"
+
+// Header describes a FLAC stream and the metadata written before its audio.
+type Header struct {
+	SampleRate int // samples per second, per channel
+	Channels   int // number of interleaved channels; 0 is the same as 1
+
+	// TotalSamples is the number of samples per channel, and MD5 is the MD5 sum of the samples as
+	// interleaved 16-bit little-endian integers. If they are zero, they are unknown. The Encoder fills
+	// them in when the destination is seekable.
+	TotalSamples uint64
+	MD5          [16]byte
+
+	// Level is the compression level from 0 (fastest) to 8 (smallest), as in the flac command.
+	Level int
+
+	// SeekTable holds the seek points to write. See SeekPoint for points that the Encoder fills in.
+	SeekTable []SeekPoint
+
+	// Vendor and Comments are written as a Vorbis comment block. Comments have the form "NAME=value".
+	// If Vendor is empty, the Vendor constant is used.
+	Vendor   string
+	Comments []string
+
+	// CueSheet is written if it is not nil. It requires TotalSamples.
+	CueSheet *CueSheet
+}
+
+// level holds the encoder settings for a compression level.
+type level struct {
+	blockSize         int
+	maxLPCOrder       int
+	exhaustive        bool // try every LPC order, instead of only the highest
+	maxPartitionOrder uint
+}
+
+var levels = [...]level{
+	{1152, 0, false, 2},
+	{1152, 0, false, 3},
+	{1152, 0, false, 4},
+	{4096, 6, false, 4},
+	{4096, 8, false, 4},
+	{4096, 8, false, 5},
+	{4096, 8, true, 6},
+	{4096, 12, false, 6},
+	{4096, 12, true, 6},
+}
+
+// Encoder writes a FLAC stream.
+//
+// If the destination is an io.WriteSeeker, Close goes back and fills in the header fields that were not
+// known in advance, like wav.Writer. Otherwise, they are written as given in the Header.
+type Encoder struct {
+	w      io.Writer
+	header Header
+	level  level
+
+	pending []int16 // interleaved samples that do not fill a frame yet
+	frame   uint64  // number of the next frame
+	samples uint64  // samples per channel written so far
+	md5     hash.Hash
+
+	n                  int64 // bytes written
+	start              int64 // offset of the stream in a seekable destination, or -1
+	seekTableOffset    int64 // offset of the seek table from the start of the stream
+	firstFrame         int64 // offset of the first frame from the start of the stream
+	minFrame, maxFrame int
+
+	frameOffsets []uint64 // offset of each frame, if there are seek points to fill in
+	seekTable    []SeekPoint
+
+	err error
+}
+
+// NewEncoder writes the FLAC signature and the metadata blocks described by h to w, and returns an
+// Encoder that appends audio to it.
+func NewEncoder(w io.Writer, h *Header) (*Encoder, error) {
+	e := &Encoder{
+		w:      w,
+		header: *h,
+		md5:    md5.New(),
+		start:  -1,
+	}
+
+	if e.header.Channels == 0 {
+		e.header.Channels = 1
+	}
+	if e.header.Vendor == "" {
+		e.header.Vendor = Vendor
+	}
+
+	if e.header.SampleRate <= 0 || e.header.SampleRate >= 1<<20 {
+		return nil, errors.New("flac: invalid sample rate")
+	}
+	if e.header.Channels < 1 || e.header.Channels > 8 {
+		return nil, errors.New("flac: invalid number of channels")
+	}
+	if e.header.Level < 0 || e.header.Level >= len(levels) {
+		return nil, errors.New("flac: invalid compression level")
+	}
+	if e.header.TotalSamples >= 1<<36 {
+		return nil, errors.New("flac: too many samples")
+	}
+	e.level = levels[e.header.Level]
+
+	if s, ok := w.(io.WriteSeeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			e.start = start
+		}
+	}
+
+	var requested []SeekPoint
+	for _, p := range e.header.SeekTable {
+		if p.Samples != 0 {
+			e.seekTable = append(e.seekTable, p)
+		} else {
+			requested = append(requested, p)
+		}
+	}
+	if len(requested) != 0 {
+		e.frameOffsets = []uint64{}
+	}
+
+	type block struct {
+		typ  byte
+		body []byte
+	}
+
+	blocks := []block{
+		{blockStreamInfo, streamInfo(&e.header, e.level.blockSize, 0, 0, e.header.TotalSamples, e.header.MD5)},
+	}
+	if len(e.header.SeekTable) != 0 {
+		blocks = append(blocks, block{blockSeekTable, seekTable(sortSeekPoints(append([]SeekPoint(nil), e.seekTable...), len(e.header.SeekTable)))})
+	}
+	blocks = append(blocks, block{blockVorbisComment, vorbisComment(e.header.Vendor, e.header.Comments)})
+	if e.header.CueSheet != nil {
+		if e.header.TotalSamples == 0 {
+			return nil, errors.New("flac: a cue sheet requires TotalSamples")
+		}
+
+		body, err := cueSheet(e.header.CueSheet, e.header.TotalSamples)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block{blockCueSheet, body})
+	}
+
+	e.write([]byte("fLaC"))
+	for i, b := range blocks {
+		if len(b.body) >= 1<<24 {
+			return nil, errors.New("flac: metadata block too large")
+		}
+
+		e.write(blockHeader(b.typ, i == len(blocks)-1, len(b.body)))
+		if b.typ == blockSeekTable {
+			e.seekTableOffset = e.n
+		}
+		e.write(b.body)
+	}
+	e.firstFrame = e.n
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return e, nil
+}
+
+func (e *Encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	e.err = err
+}
+
+// WriteSamples encodes interleaved samples. The number of samples must be a multiple of the number of
+// channels. Once an error has occurred, WriteSamples and Close return that error without writing
+// anything.
+func (e *Encoder) WriteSamples(samples []int16) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if len(samples)%e.header.Channels != 0 {
+		return errors.New("flac: partial frame of samples")
+	}
+
+	var buf [4096]byte
+	for rest := samples; len(rest) != 0; {
+		n := len(rest)
+		if n > len(buf)/2 {
+			n = len(buf) / 2
+		}
+		for i, s := range rest[:n] {
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+		}
+		e.md5.Write(buf[:n*2])
+		rest = rest[n:]
+	}
+
+	frameLen := e.level.blockSize * e.header.Channels
+	for len(samples) != 0 && e.err == nil {
+		if len(e.pending) == 0 && len(samples) >= frameLen {
+			e.writeFrame(samples[:frameLen])
+			samples = samples[frameLen:]
+			continue
+		}
+
+		n := frameLen - len(e.pending)
+		if n > len(samples) {
+			n = len(samples)
+		}
+		e.pending = append(e.pending, samples[:n]...)
+		samples = samples[n:]
+
+		if len(e.pending) == frameLen {
+			e.writeFrame(e.pending)
+			e.pending = e.pending[:0]
+		}
+	}
+
+	return e.err
+}
+
+// Close encodes the last frame and finishes the stream. Close does not close the destination.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if len(e.pending) != 0 {
+		e.writeFrame(e.pending)
+		e.pending = nil
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	e.err = errors.New("flac: Encoder is closed")
+
+	for _, p := range e.header.SeekTable {
+		if p.Samples != 0 {
+			continue
+		}
+
+		frame := p.Sample / uint64(e.level.blockSize)
+		if frame >= uint64(len(e.frameOffsets)) {
+			continue
+		}
+
+		samples := uint64(e.level.blockSize)
+		if rest := e.samples - frame*samples; rest < samples {
+			samples = rest
+		}
+
+		e.seekTable = append(e.seekTable, SeekPoint{
+			Sample:  frame * uint64(e.level.blockSize),
+			Offset:  e.frameOffsets[frame],
+			Samples: uint16(samples),
+		})
+	}
+	e.seekTable = sortSeekPoints(e.seekTable, len(e.header.SeekTable))
+
+	var sum [16]byte
+	e.md5.Sum(sum[:0])
+
+	if e.start == -1 {
+		if e.header.TotalSamples != 0 && e.header.TotalSamples != e.samples {
+			return errors.New("flac: number of samples written does not match Header.TotalSamples")
+		}
+
+		return nil
+	}
+
+	s := e.w.(io.WriteSeeker)
+	end := e.start + e.n
+
+	if err := writeAt(s, e.start+8, streamInfo(&e.header, e.level.blockSize, e.minFrame, e.maxFrame, e.samples, sum)); err != nil {
+		return err
+	}
+
+	if len(e.seekTable) != 0 {
+		if err := writeAt(s, e.start+e.seekTableOffset, seekTable(e.seekTable)); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.Seek(end, io.SeekStart)
+	return err
+}
+
+// SeekTable returns the seek table of the stream, including the seek points filled in by the Encoder.
+// It is only complete after Close.
+func (e *Encoder) SeekTable() []SeekPoint {
+	return e.seekTable
+}
+
+func writeAt(s io.WriteSeeker, offset int64, p []byte) error {
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := s.Write(p)
+	return err
+}
+
+// writeFrame encodes one frame of interleaved samples.
+func (e *Encoder) writeFrame(samples []int16) {
+	channels := e.header.Channels
+	n := len(samples) / channels
+
+	var b bitWriter
+
+	b.write(0xFFF8, 16) // sync code, with a fixed block size
+	bsCode, bsExtra, bsBits := blockSizeCode(n)
+	srCode, srExtra, srBits := sampleRateCode(e.header.SampleRate)
+	b.write(bsCode, 4)
+	b.write(srCode, 4)
+	b.write(uint64(channels-1), 4) // independent channels
+	b.write(0x4, 3)                // 16 bits per sample
+	b.write(0, 1)
+	writeUTF8(&b, e.frame)
+	b.write(bsExtra, bsBits)
+	b.write(srExtra, srBits)
+	b.write(uint64(crc8(b.buf)), 8)
+
+	x := make([]int32, n)
+	for c := 0; c < channels; c++ {
+		for i := range x {
+			x[i] = int32(samples[i*channels+c])
+		}
+		encodeSubframe(x, &e.level).encode(&b)
+	}
+
+	b.align()
+	b.write(uint64(crc16(b.buf)), 16)
+
+	if e.frameOffsets != nil {
+		e.frameOffsets = append(e.frameOffsets, uint64(e.n-e.firstFrame))
+	}
+	if size := len(b.buf); e.frame == 0 {
+		e.minFrame, e.maxFrame = size, size
+	} else if size < e.minFrame {
+		e.minFrame = size
+	} else if size > e.maxFrame {
+		e.maxFrame = size
+	}
+
+	e.write(b.buf)
+	e.frame++
+	e.samples += uint64(n)
+}
+
+// blockSizeCode returns the 4-bit code for a block size in a frame header, and the value and length of
+// the field at the end of the header that holds it if the code does not.
+func blockSizeCode(n int) (code, extra uint64, bits uint) {
+	switch n {
+	case 192:
+		return 1, 0, 0
+	case 576, 1152, 2304, 4608:
+		return 2 + uint64(log2(n/576)), 0, 0
+	case 256, 512, 1024, 2048, 4096, 8192, 16384, 32768:
+		return 8 + uint64(log2(n/256)), 0, 0
+	}
+
+	if n <= 256 {
+		return 6, uint64(n - 1), 8
+	}
+
+	return 7, uint64(n - 1), 16
+}
+
+func log2(n int) int {
+	i := 0
+	for n > 1 {
+		n >>= 1
+		i++
+	}
+
+	return i
+}
+
+// sampleRateCode is like blockSizeCode, for the sample rate.
+func sampleRateCode(rate int) (code, extra uint64, bits uint) {
+	switch rate {
+	case 88200:
+		return 1, 0, 0
+	case 176400:
+		return 2, 0, 0
+	case 192000:
+		return 3, 0, 0
+	case 8000:
+		return 4, 0, 0
+	case 16000:
+		return 5, 0, 0
+	case 22050:
+		return 6, 0, 0
+	case 24000:
+		return 7, 0, 0
+	case 32000:
+		return 8, 0, 0
+	case 44100:
+		return 9, 0, 0
+	case 48000:
+		return 10, 0, 0
+	case 96000:
+		return 11, 0, 0
+	}
+
+	switch {
+	case rate%1000 == 0 && rate/1000 < 256:
+		return 12, uint64(rate / 1000), 8
+	case rate < 1<<16:
+		return 13, uint64(rate), 16
+	case rate%10 == 0 && rate/10 < 1<<16:
+		return 14, uint64(rate / 10), 16
+	default:
+		return 0, 0, 0 // from STREAMINFO
+	}
+}
+
+// writeUTF8 writes a frame number in the extended UTF-8 coding used by frame headers.
+func writeUTF8(b *bitWriter, v uint64) {
+	if v < 0x80 {
+		b.write(v, 8)
+		return
+	}
+
+	n := uint(2)
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+
+	b.write(0xFF<<(8-n)&0xFF|v>>(6*(n-1)), 8)
+	for i := n - 1; i > 0; i-- {
+		b.write(0x80|v>>(6*(i-1))&0x3F, 8)
+	}
+}
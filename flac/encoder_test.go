@@ -0,0 +1,502 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+
+	n := copy(b.buf[b.pos:], p)
+	b.pos += n
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+
+	b.pos = int(offset)
+	return offset, nil
+}
+
+// bitReader is the inverse of bitWriter.
+type bitReader struct {
+	buf []byte
+	pos uint // in bits
+}
+
+func (r *bitReader) read(n uint) uint64 {
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		if r.pos/8 >= uint(len(r.buf)) {
+			panic(io.ErrUnexpectedEOF)
+		}
+		bit := r.buf[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) readSigned(n uint) int64 {
+	v := r.read(n)
+	return int64(v<<(64-n)) >> (64 - n)
+}
+
+func (r *bitReader) readUTF8() uint64 {
+	first := r.read(8)
+	n := uint(0)
+	for first&(0x80>>n) != 0 {
+		n++
+	}
+	if n == 0 {
+		return first
+	}
+
+	v := first & (0xFF >> (n + 1))
+	for i := uint(1); i < n; i++ {
+		v = v<<6 | r.read(8)&0x3F
+	}
+	return v
+}
+
+// decoded is the content of a FLAC stream.
+type decoded struct {
+	blockSize          int
+	minFrame, maxFrame int
+	sampleRate         int
+	channels           int
+	total              uint64
+	md5                [16]byte
+
+	seekTable []SeekPoint
+	vendor    string
+	comments  []string
+	tracks    []uint64 // including the lead-out
+
+	frameOffsets []int
+	samples      []int16 // interleaved
+}
+
+// decode is a minimal FLAC decoder for the subset written by Encoder.
+func decode(data []byte) (d *decoded, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if string(data[:4]) != "fLaC" {
+		return nil, errors.New("missing signature")
+	}
+	data = data[4:]
+
+	d = &decoded{}
+	for last := false; !last; {
+		last = data[0]&0x80 != 0
+		typ := data[0] & 0x7F
+		size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		body := data[4 : 4+size]
+		data = data[4+size:]
+
+		switch typ {
+		case blockStreamInfo:
+			d.blockSize = int(binary.BigEndian.Uint16(body))
+			d.minFrame = int(body[4])<<16 | int(body[5])<<8 | int(body[6])
+			d.maxFrame = int(body[7])<<16 | int(body[8])<<8 | int(body[9])
+			v := binary.BigEndian.Uint64(body[10:])
+			d.sampleRate = int(v >> 44)
+			d.channels = int(v>>41&7) + 1
+			if bps := v>>36&31 + 1; bps != 16 {
+				return nil, fmt.Errorf("%d bits per sample", bps)
+			}
+			d.total = v & (1<<36 - 1)
+			copy(d.md5[:], body[18:])
+		case blockSeekTable:
+			for ; len(body) >= seekPointSize; body = body[seekPointSize:] {
+				d.seekTable = append(d.seekTable, SeekPoint{
+					Sample:  binary.BigEndian.Uint64(body),
+					Offset:  binary.BigEndian.Uint64(body[8:]),
+					Samples: binary.BigEndian.Uint16(body[16:]),
+				})
+			}
+		case blockVorbisComment:
+			n := binary.LittleEndian.Uint32(body)
+			d.vendor = string(body[4 : 4+n])
+			body = body[4+n:]
+			count := binary.LittleEndian.Uint32(body)
+			body = body[4:]
+			for i := uint32(0); i < count; i++ {
+				n := binary.LittleEndian.Uint32(body)
+				d.comments = append(d.comments, string(body[4:4+n]))
+				body = body[4+n:]
+			}
+		case blockCueSheet:
+			count := int(body[395])
+			body = body[396:]
+			for i := 0; i < count; i++ {
+				d.tracks = append(d.tracks, binary.BigEndian.Uint64(body))
+				indices := int(body[35])
+				body = body[36+12*indices:]
+			}
+		}
+	}
+
+	frames := data
+	for len(data) != 0 {
+		d.frameOffsets = append(d.frameOffsets, len(frames)-len(data))
+		n, err := d.decodeFrame(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+
+	return d, nil
+}
+
+func (d *decoded) decodeFrame(data []byte) (int, error) {
+	r := &bitReader{buf: data}
+
+	if sync := r.read(16); sync != 0xFFF8 {
+		return 0, fmt.Errorf("bad sync code %#x", sync)
+	}
+
+	bsCode, srCode := r.read(4), r.read(4)
+	channels := int(r.read(4)) + 1
+	if r.read(3) != 4 || r.read(1) != 0 || channels != d.channels {
+		return 0, errors.New("bad frame header")
+	}
+	r.readUTF8()
+
+	var n int
+	switch {
+	case bsCode == 1:
+		n = 192
+	case bsCode >= 2 && bsCode <= 5:
+		n = 576 << (bsCode - 2)
+	case bsCode == 6:
+		n = int(r.read(8)) + 1
+	case bsCode == 7:
+		n = int(r.read(16)) + 1
+	default:
+		n = 256 << (bsCode - 8)
+	}
+
+	switch srCode {
+	case 12:
+		r.read(8)
+	case 13, 14:
+		r.read(16)
+	}
+
+	if crc := byte(r.read(8)); crc != crc8(data[:r.pos/8-1]) {
+		return 0, errors.New("bad frame header CRC")
+	}
+
+	frame := make([][]int32, channels)
+	for c := range frame {
+		x, err := decodeSubframe(r, n)
+		if err != nil {
+			return 0, err
+		}
+		frame[c] = x
+	}
+
+	if r.pos%8 != 0 {
+		r.read(8 - r.pos%8)
+	}
+	end := r.pos / 8
+	if crc := uint16(r.read(16)); crc != crc16(data[:end]) {
+		return 0, errors.New("bad frame CRC")
+	}
+
+	for i := 0; i < n; i++ {
+		for c := range frame {
+			d.samples = append(d.samples, int16(frame[c][i]))
+		}
+	}
+
+	return int(end) + 2, nil
+}
+
+func decodeSubframe(r *bitReader, n int) ([]int32, error) {
+	typ := r.read(8)
+	if typ&0x81 != 0 {
+		return nil, errors.New("bad subframe header")
+	}
+	typ >>= 1
+
+	x := make([]int32, n)
+
+	switch {
+	case typ == 0:
+		v := int32(r.readSigned(16))
+		for i := range x {
+			x[i] = v
+		}
+	case typ == 1:
+		for i := range x {
+			x[i] = int32(r.readSigned(16))
+		}
+	case typ&0x38 == 0x08:
+		order := int(typ & 7)
+		for i := 0; i < order; i++ {
+			x[i] = int32(r.readSigned(16))
+		}
+		residual := decodeResidual(r, n, order)
+		coefs := [][]int32{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}[order]
+		predict(x, residual, coefs, 0)
+	case typ&0x20 != 0:
+		order := int(typ&0x1F) + 1
+		for i := 0; i < order; i++ {
+			x[i] = int32(r.readSigned(16))
+		}
+		precision := uint(r.read(4)) + 1
+		shift := uint(r.readSigned(5))
+		coefs := make([]int32, order)
+		for i := range coefs {
+			coefs[i] = int32(r.readSigned(precision))
+		}
+		residual := decodeResidual(r, n, order)
+		predict(x, residual, coefs, shift)
+	default:
+		return nil, fmt.Errorf("unknown subframe type %#x", typ)
+	}
+
+	return x, nil
+}
+
+func decodeResidual(r *bitReader, n, order int) []int32 {
+	if method := r.read(2); method != 0 {
+		panic("unsupported residual coding method")
+	}
+
+	partitionOrder := uint(r.read(4))
+	var residual []int32
+	for p := 0; p < 1<<partitionOrder; p++ {
+		count := n >> partitionOrder
+		if p == 0 {
+			count -= order
+		}
+
+		k := uint(r.read(4))
+		for i := 0; i < count; i++ {
+			q := uint64(0)
+			for r.read(1) == 0 {
+				q++
+			}
+			u := uint32(q<<k | r.read(k))
+			residual = append(residual, int32(u>>1)^-int32(u&1))
+		}
+	}
+
+	return residual
+}
+
+func predict(x, residual, coefs []int32, shift uint) {
+	order := len(coefs)
+	for i := order; i < len(x); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += int64(c) * int64(x[i-j-1])
+		}
+		x[i] = residual[i-order] + int32(sum>>shift)
+	}
+}
+
+// speechLike returns a test signal with voiced and unvoiced parts and silence.
+func speechLike(n int) []int16 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int16, n)
+
+	for i := range samples {
+		t := float64(i) / 16000
+		switch (i / 3000) % 3 {
+		case 0:
+			v := 6000*math.Sin(2*math.Pi*140*t) + 3000*math.Sin(2*math.Pi*280*t) + 1500*math.Sin(2*math.Pi*700*t)
+			samples[i] = int16(v)
+		case 1:
+			samples[i] = int16(rng.NormFloat64() * 800)
+		}
+	}
+
+	return samples
+}
+
+func encode(t *testing.T, w io.Writer, h *Header, samples []int16, chunk int) *Encoder {
+	e, err := NewEncoder(w, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for len(samples) != 0 {
+		n := chunk
+		if n > len(samples) {
+			n = len(samples)
+		}
+		if err := e.WriteSamples(samples[:n]); err != nil {
+			t.Fatal(err)
+		}
+		samples = samples[n:]
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestRoundTrip(t *testing.T) {
+	samples := speechLike(40000)
+	sum := md5.New()
+	binary.Write(sum, binary.LittleEndian, samples)
+
+	for level := 0; level < len(levels); level++ {
+		var b seekBuffer
+		encode(t, &b, &Header{SampleRate: 16000, Level: level}, samples, 1000)
+
+		d, err := decode(b.buf)
+		if err != nil {
+			t.Errorf("level %d: %v", level, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(d.samples, samples) {
+			t.Errorf("level %d: decoded samples differ", level)
+		}
+		if d.total != uint64(len(samples)) || d.sampleRate != 16000 || d.channels != 1 {
+			t.Errorf("level %d: wrong STREAMINFO: %+v", level, d)
+		}
+		if !bytes.Equal(d.md5[:], sum.Sum(nil)) {
+			t.Errorf("level %d: wrong MD5", level)
+		}
+		if d.minFrame == 0 || d.maxFrame < d.minFrame {
+			t.Errorf("level %d: frame sizes %d to %d", level, d.minFrame, d.maxFrame)
+		}
+		if len(b.buf) >= len(samples)*2*3/4 {
+			t.Errorf("level %d: compressed to %d bytes from %d", level, len(b.buf), len(samples)*2)
+		}
+	}
+}
+
+func TestStereo(t *testing.T) {
+	mono := speechLike(10000)
+	samples := make([]int16, 0, 2*len(mono))
+	for i, s := range mono {
+		samples = append(samples, s, mono[len(mono)-1-i]/2)
+	}
+
+	var b bytes.Buffer
+	encode(t, &b, &Header{SampleRate: 22050, Channels: 2, Level: 5}, samples, 333*2)
+
+	d, err := decode(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.samples, samples) {
+		t.Error("decoded samples differ")
+	}
+	if d.total != 0 || d.md5 != [16]byte{} {
+		t.Error("length and MD5 should be unknown in a stream")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	samples := speechLike(20000)
+	h := &Header{
+		SampleRate:   16000,
+		TotalSamples: uint64(len(samples)),
+		Level:        5,
+		SeekTable:    []SeekPoint{{Sample: 9000}, {Sample: 100}, {Sample: 8200}},
+		Comments:     []string{"TITLE=test"},
+		CueSheet:     &CueSheet{Tracks: []uint64{0, 12345}},
+	}
+
+	// Both destinations must give the same file: the stream because every field is known up front,
+	// and the seekable file because Close fills in the seek table.
+	var b seekBuffer
+	e := encode(t, &b, h, samples, len(samples))
+
+	want := []SeekPoint{
+		{Sample: 0, Offset: 0, Samples: 4096},
+		{Sample: 8192, Offset: e.frameOffsets[2], Samples: 4096},
+		{Sample: placeholder},
+	}
+	if !reflect.DeepEqual(e.SeekTable(), want) {
+		t.Errorf("seek table is %+v, want %+v", e.SeekTable(), want)
+	}
+
+	d, err := decode(b.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.seekTable, want) {
+		t.Errorf("written seek table is %+v, want %+v", d.seekTable, want)
+	}
+	if uint64(d.frameOffsets[2]) != want[1].Offset {
+		t.Errorf("frame 2 is at %d, but the seek table says %d", d.frameOffsets[2], want[1].Offset)
+	}
+	if d.vendor != Vendor || !reflect.DeepEqual(d.comments, h.Comments) {
+		t.Errorf("wrong comments: %q %q", d.vendor, d.comments)
+	}
+	if !reflect.DeepEqual(d.tracks, []uint64{0, 12345, 20000}) {
+		t.Errorf("wrong tracks: %v", d.tracks)
+	}
+
+	sum := md5.New()
+	binary.Write(sum, binary.LittleEndian, samples)
+	h.SeekTable = e.SeekTable()
+	copy(h.MD5[:], sum.Sum(nil))
+
+	var stream bytes.Buffer
+	encode(t, &stream, h, samples, 777)
+
+	// The stream does not know the frame sizes.
+	copy(b.buf[8+4:], []byte{0, 0, 0, 0, 0, 0})
+	if !bytes.Equal(stream.Bytes(), b.buf) {
+		t.Error("stream and seekable file differ")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := NewEncoder(io.Discard, &Header{SampleRate: 16000, Level: 9}); err == nil {
+		t.Error("no error for level 9")
+	}
+
+	if _, err := NewEncoder(io.Discard, &Header{SampleRate: 16000, CueSheet: &CueSheet{}}); err == nil {
+		t.Error("no error for a cue sheet without a length")
+	}
+
+	e, err := NewEncoder(io.Discard, &Header{SampleRate: 16000, TotalSamples: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.WriteSamples(make([]int16, 9))
+	if err := e.Close(); err == nil {
+		t.Error("no error for the wrong number of samples")
+	}
+}
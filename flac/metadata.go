@@ -0,0 +1,168 @@
+package flac
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// metadata block types
+const (
+	blockStreamInfo    = 0
+	blockSeekTable     = 3
+	blockVorbisComment = 4
+	blockCueSheet      = 5
+)
+
+const (
+	streamInfoSize = 34
+	seekPointSize  = 18
+
+	// placeholder is the sample number of an unused seek point.
+	placeholder = 1<<64 - 1
+)
+
+// A SeekPoint lets a decoder jump to a frame without reading the frames before it.
+//
+// A SeekPoint with Samples set to 0 is a request for a seek point at the frame containing Sample. The
+// Encoder fills in the rest of it once the frame has been written.
+type SeekPoint struct {
+	Sample  uint64 // number of the first sample in the frame, counting from 0
+	Offset  uint64 // byte offset of the frame from the first frame
+	Samples uint16 // number of samples in the frame
+}
+
+// A CueSheet divides the stream into tracks, which players show like the tracks of a CD.
+type CueSheet struct {
+	// Tracks holds the sample number where each track starts, in increasing order. Tracks are numbered
+	// from 1, and there can be at most 254 of them.
+	Tracks []uint64
+}
+
+// blockHeader returns the 4-byte header of a metadata block.
+func blockHeader(typ byte, last bool, size int) []byte {
+	if last {
+		typ |= 0x80
+	}
+
+	return []byte{typ, byte(size >> 16), byte(size >> 8), byte(size)}
+}
+
+// streamInfo returns the body of the STREAMINFO block. Frame sizes of 0 mean that they are unknown.
+func streamInfo(h *Header, blockSize, minFrame, maxFrame int, total uint64, md5 [16]byte) []byte {
+	buf := make([]byte, streamInfoSize)
+
+	binary.BigEndian.PutUint16(buf[0:], uint16(blockSize))
+	binary.BigEndian.PutUint16(buf[2:], uint16(blockSize))
+	put24(buf[4:], minFrame)
+	put24(buf[7:], maxFrame)
+
+	// 20 bits of sample rate, 3 bits of channels - 1, 5 bits of bits per sample - 1, and 36 bits of
+	// total samples
+	v := uint64(h.SampleRate)<<44 | uint64(h.Channels-1)<<41 | uint64(bitsPerSample-1)<<36 | total&(1<<36-1)
+	binary.BigEndian.PutUint64(buf[10:], v)
+
+	copy(buf[18:], md5[:])
+
+	return buf
+}
+
+func put24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+// seekTable returns the body of the SEEKTABLE block.
+func seekTable(points []SeekPoint) []byte {
+	buf := make([]byte, len(points)*seekPointSize)
+
+	for i, p := range points {
+		b := buf[i*seekPointSize:]
+		binary.BigEndian.PutUint64(b, p.Sample)
+		binary.BigEndian.PutUint64(b[8:], p.Offset)
+		binary.BigEndian.PutUint16(b[16:], p.Samples)
+	}
+
+	return buf
+}
+
+// sortSeekPoints sorts points by sample number, removes duplicates, and pads the table with placeholders
+// to size points, as required by the format.
+func sortSeekPoints(points []SeekPoint, size int) []SeekPoint {
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Sample < points[j].Sample
+	})
+
+	table := make([]SeekPoint, 0, size)
+	for _, p := range points {
+		if len(table) != 0 && table[len(table)-1].Sample == p.Sample {
+			continue
+		}
+		table = append(table, p)
+	}
+
+	for len(table) < size {
+		table = append(table, SeekPoint{Sample: placeholder})
+	}
+
+	return table
+}
+
+// vorbisComment returns the body of the VORBIS_COMMENT block. Unlike the rest of FLAC, it is
+// little-endian.
+func vorbisComment(vendor string, comments []string) []byte {
+	buf := make([]byte, 0, 8+len(vendor))
+
+	buf = appendUint32LE(buf, uint32(len(vendor)))
+	buf = append(buf, vendor...)
+	buf = appendUint32LE(buf, uint32(len(comments)))
+
+	for _, c := range comments {
+		buf = appendUint32LE(buf, uint32(len(c)))
+		buf = append(buf, c...)
+	}
+
+	return buf
+}
+
+func appendUint32LE(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// cueSheet returns the body of the CUESHEET block for a stream that is not from a CD.
+func cueSheet(c *CueSheet, total uint64) ([]byte, error) {
+	if len(c.Tracks) > 254 {
+		return nil, errors.New("flac: too many tracks in cue sheet")
+	}
+
+	// 128 bytes of media catalog number, 8 bytes of lead-in, 259 bytes of flags and reserved space, and
+	// the number of tracks
+	buf := make([]byte, 128+8+259+1)
+	buf[len(buf)-1] = byte(len(c.Tracks) + 1)
+
+	track := func(offset uint64, number byte, indices int) {
+		// 12 bytes of ISRC, then 14 bytes of flags and reserved space
+		var t [8 + 1 + 12 + 14 + 1]byte
+		binary.BigEndian.PutUint64(t[:], offset)
+		t[8] = number
+		t[len(t)-1] = byte(indices)
+		buf = append(buf, t[:]...)
+	}
+
+	for i, offset := range c.Tracks {
+		if offset >= total || (i != 0 && offset <= c.Tracks[i-1]) {
+			return nil, errors.New("flac: cue sheet tracks out of order")
+		}
+
+		track(offset, byte(i+1), 1)
+
+		// index point 1, at the start of the track
+		var index [8 + 1 + 3]byte
+		index[8] = 1
+		buf = append(buf, index[:]...)
+	}
+
+	// lead-out track
+	track(total, 255, 0)
+
+	return buf, nil
+}
@@ -0,0 +1,354 @@
+package flac
+
+import (
+	"math"
+)
+
+const (
+	bitsPerSample = 16
+
+	maxRiceParameter = 14 // 15 is the escape code, which is never written
+	maxFixedOrder    = 4
+	lpcPrecision     = 14 // bits in each quantized LPC coefficient
+)
+
+// subframe is an encoded channel of a frame.
+type subframe struct {
+	bits   int // size of the encoded subframe
+	encode func(b *bitWriter)
+}
+
+// encodeSubframe finds the smallest encoding of one channel of a frame.
+func encodeSubframe(x []int32, level *level) subframe {
+	n := len(x)
+
+	constant := true
+	for _, v := range x[1:] {
+		if v != x[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		return subframe{
+			bits: 8 + bitsPerSample,
+			encode: func(b *bitWriter) {
+				b.write(0x00, 8)
+				b.writeSigned(int64(x[0]), bitsPerSample)
+			},
+		}
+	}
+
+	best := subframe{
+		bits: 8 + n*bitsPerSample,
+		encode: func(b *bitWriter) {
+			b.write(0x02, 8)
+			for _, v := range x {
+				b.writeSigned(int64(v), bitsPerSample)
+			}
+		},
+	}
+
+	for order := 0; order <= maxFixedOrder && order < n; order++ {
+		residual := fixedResidual(x, order)
+		r := chooseRice(residual, order, n, level.maxPartitionOrder)
+		if bits := 8 + order*bitsPerSample + r.bits; bits < best.bits {
+			order := order
+			best = subframe{
+				bits: bits,
+				encode: func(b *bitWriter) {
+					b.write(uint64(0x08|order)<<1, 8)
+					for _, v := range x[:order] {
+						b.writeSigned(int64(v), bitsPerSample)
+					}
+					r.encode(b, residual)
+				},
+			}
+		}
+	}
+
+	if level.maxLPCOrder == 0 {
+		return best
+	}
+
+	for _, coefs := range lpcCoefficients(x, level.maxLPCOrder, level.exhaustive) {
+		order := len(coefs)
+		if order >= n {
+			continue
+		}
+
+		q, shift := quantize(coefs)
+		residual, ok := lpcResidual(x, q, shift)
+		if !ok {
+			continue
+		}
+
+		r := chooseRice(residual, order, n, level.maxPartitionOrder)
+		if bits := 8 + order*bitsPerSample + 4 + 5 + order*lpcPrecision + r.bits; bits < best.bits {
+			best = subframe{
+				bits: bits,
+				encode: func(b *bitWriter) {
+					b.write(uint64(0x20|(order-1))<<1, 8)
+					for _, v := range x[:order] {
+						b.writeSigned(int64(v), bitsPerSample)
+					}
+					b.write(lpcPrecision-1, 4)
+					b.writeSigned(int64(shift), 5)
+					for _, c := range q {
+						b.writeSigned(int64(c), lpcPrecision)
+					}
+					r.encode(b, residual)
+				},
+			}
+		}
+	}
+
+	return best
+}
+
+// fixedResidual applies one of the fixed polynomial predictors. The first order samples are warm-up
+// samples, so the residual is shorter than x by order.
+func fixedResidual(x []int32, order int) []int32 {
+	residual := make([]int32, len(x)-order)
+
+	for i := order; i < len(x); i++ {
+		var r int32
+		switch order {
+		case 0:
+			r = x[i]
+		case 1:
+			r = x[i] - x[i-1]
+		case 2:
+			r = x[i] - 2*x[i-1] + x[i-2]
+		case 3:
+			r = x[i] - 3*x[i-1] + 3*x[i-2] - x[i-3]
+		case 4:
+			r = x[i] - 4*x[i-1] + 6*x[i-2] - 4*x[i-3] + x[i-4]
+		}
+		residual[i-order] = r
+	}
+
+	return residual
+}
+
+// lpcCoefficients returns linear prediction coefficients computed from the windowed autocorrelation of x
+// with the Levinson-Durbin recursion. If exhaustive is false, only the highest order is returned;
+// otherwise, every order up to maxOrder is.
+func lpcCoefficients(x []int32, maxOrder int, exhaustive bool) [][]float64 {
+	if maxOrder >= len(x) {
+		maxOrder = len(x) - 1
+	}
+
+	w := make([]float64, len(x))
+	for i, v := range x {
+		w[i] = float64(v) * tukey(i, len(x))
+	}
+
+	r := make([]float64, maxOrder+1)
+	for lag := range r {
+		for i := lag; i < len(w); i++ {
+			r[lag] += w[i] * w[i-lag]
+		}
+	}
+
+	if r[0] == 0 {
+		return nil
+	}
+
+	var (
+		all [][]float64
+		a   []float64
+		e   = r[0]
+	)
+
+	for m := 1; m <= maxOrder; m++ {
+		k := r[m]
+		for j := 1; j < m; j++ {
+			k -= a[j-1] * r[m-j]
+		}
+		k /= e
+
+		next := make([]float64, m)
+		for j := 1; j < m; j++ {
+			next[j-1] = a[j-1] - k*a[m-j-1]
+		}
+		next[m-1] = k
+		a = next
+
+		e *= 1 - k*k
+		if e <= 0 {
+			break
+		}
+
+		if exhaustive || m == maxOrder {
+			all = append(all, a)
+		}
+	}
+
+	return all
+}
+
+// tukey is a Tukey window with half of its length tapered.
+func tukey(i, n int) float64 {
+	const alpha = 0.5
+
+	edge := alpha * float64(n-1) / 2
+	switch x := float64(i); {
+	case x < edge:
+		return 0.5 * (1 - math.Cos(math.Pi*x/edge))
+	case x > float64(n-1)-edge:
+		return 0.5 * (1 - math.Cos(math.Pi*(float64(n-1)-x)/edge))
+	default:
+		return 1
+	}
+}
+
+// quantize converts coefficients to integers of lpcPrecision bits and the shift that scales them back.
+// Rounding errors are carried to the next coefficient.
+func quantize(coefs []float64) ([]int32, int) {
+	var cmax float64
+	for _, c := range coefs {
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+
+	_, exp := math.Frexp(cmax)
+	shift := lpcPrecision - 1 - exp
+	if shift > 15 {
+		shift = 15
+	}
+	if shift < 0 {
+		shift = 0
+	}
+
+	const qmax = 1<<(lpcPrecision-1) - 1
+
+	q := make([]int32, len(coefs))
+	var carry float64
+	for i, c := range coefs {
+		v := c*float64(int(1)<<uint(shift)) + carry
+		r := math.Floor(v + 0.5)
+		if r > qmax {
+			r = qmax
+		}
+		if r < -qmax-1 {
+			r = -qmax - 1
+		}
+		carry = v - r
+		q[i] = int32(r)
+	}
+
+	return q, shift
+}
+
+// lpcResidual applies a quantized linear predictor. It returns false if a residual does not fit in 32
+// bits, which FLAC does not allow.
+func lpcResidual(x []int32, q []int32, shift int) ([]int32, bool) {
+	order := len(q)
+	residual := make([]int32, len(x)-order)
+
+	for i := order; i < len(x); i++ {
+		var sum int64
+		for j, c := range q {
+			sum += int64(c) * int64(x[i-j-1])
+		}
+
+		r := int64(x[i]) - sum>>uint(shift)
+		if r > math.MaxInt32 || r < math.MinInt32 {
+			return nil, false
+		}
+		residual[i-order] = int32(r)
+	}
+
+	return residual, true
+}
+
+// riceCoding is the partitioning and the Rice parameters chosen for a residual.
+type riceCoding struct {
+	bits   int
+	order  uint
+	params []uint
+
+	predictorOrder, blockSize int
+}
+
+// chooseRice finds the partition order and Rice parameters that make the residual smallest. The
+// residual is preceded by predictorOrder warm-up samples in a block of blockSize samples.
+func chooseRice(residual []int32, predictorOrder, blockSize int, maxOrder uint) riceCoding {
+	u := make([]uint64, len(residual))
+	for i, r := range residual {
+		u[i] = uint64(zigzag(r))
+	}
+
+	best := riceCoding{bits: math.MaxInt32}
+
+	for order := uint(0); order <= maxOrder; order++ {
+		partitions := 1 << order
+		if blockSize%partitions != 0 || blockSize>>order <= predictorOrder {
+			break
+		}
+
+		c := riceCoding{
+			bits:   2 + 4,
+			order:  order,
+			params: make([]uint, partitions),
+
+			predictorOrder: predictorOrder,
+			blockSize:      blockSize,
+		}
+		start := 0
+		for p := range c.params {
+			end := start + blockSize>>order
+			if p == 0 {
+				end -= predictorOrder
+			}
+
+			k, bits := bestParameter(u[start:end])
+			c.params[p] = k
+			c.bits += 4 + bits
+			start = end
+		}
+
+		if c.bits < best.bits {
+			best = c
+		}
+	}
+
+	return best
+}
+
+// bestParameter returns the Rice parameter that codes u in the fewest bits, and that number of bits.
+func bestParameter(u []uint64) (uint, int) {
+	bestK, bestBits := uint(0), math.MaxInt32
+
+	for k := uint(0); k <= maxRiceParameter; k++ {
+		bits := len(u) * int(k+1)
+		for _, v := range u {
+			bits += int(v >> k)
+		}
+
+		if bits < bestBits {
+			bestK, bestBits = k, bits
+		}
+	}
+
+	return bestK, bestBits
+}
+
+func (c riceCoding) encode(b *bitWriter, residual []int32) {
+	b.write(0, 2) // 4-bit Rice parameters
+	b.write(uint64(c.order), 4)
+
+	start := 0
+	for p, k := range c.params {
+		end := start + c.blockSize>>c.order
+		if p == 0 {
+			end -= c.predictorOrder
+		}
+
+		b.write(uint64(k), 4)
+		for _, r := range residual[start:end] {
+			b.writeRice(r, k)
+		}
+		start = end
+	}
+}
@@ -0,0 +1,135 @@
+package espeak_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+
+	n := copy(b.buf[b.pos:], p)
+	b.pos += n
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+
+	b.pos = int(offset)
+	return offset, nil
+}
+
+func TestWriteFLAC(t *testing.T) {
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := ctx.SynthesizeText(`Hello, world. <mark name="question"/>How are you? I am fine.`); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &espeak.FLACOptions{Info: &espeak.WAVInfo{Title: "greeting"}}
+
+	var stream bytes.Buffer
+	n, err := ctx.WriteFLAC(&stream, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(stream.Len()) {
+		t.Errorf("WriteFLAC returned %d, but wrote %d bytes", n, stream.Len())
+	}
+
+	data := stream.Bytes()
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		t.Fatal("missing FLAC signature")
+	}
+	if size := len(ctx.Samples) * 2; len(data) >= size {
+		t.Errorf("%d bytes of FLAC for %d bytes of samples", len(data), size)
+	}
+	for _, comment := range []string{"TITLE=greeting", "ENCODER=" + espeak.Software, "CHAPTER001NAME=question", "CHAPTER001=00:00:00."} {
+		if !bytes.Contains(data, []byte(comment)) {
+			t.Errorf("missing comment %q", comment)
+		}
+	}
+
+	// The seek table is computed differently for seekable destinations, but it must come out the same.
+	var file seekBuffer
+	file.Write([]byte("prefix"))
+	n, err = ctx.WriteFLAC(&file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("WriteFLAC returned %d for a seekable destination, want %d", n, len(data))
+	}
+
+	// Only a seekable destination records the range of frame sizes.
+	seekable := file.buf[len("prefix"):]
+	copy(seekable[4+4+4:], make([]byte, 6))
+	if !bytes.Equal(seekable, data) {
+		t.Error("seekable destination got a different file")
+	}
+}
+
+func TestWriteFLACLevel(t *testing.T) {
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := ctx.SynthesizeText("Hello, world."); err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(opts *espeak.FLACOptions) []byte {
+		var buf bytes.Buffer
+		if _, err := ctx.WriteFLAC(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		dst, err := espeak.ReadAudio(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dst.Samples, ctx.Samples) {
+			t.Errorf("level %d changed the samples", opts.Level)
+		}
+
+		return buf.Bytes()
+	}
+
+	fastest := encode(&espeak.FLACOptions{Level: 0})
+	standard := encode(&espeak.FLACOptions{Level: espeak.DefaultFLACLevel})
+	if !bytes.Equal(encode(&espeak.FLACOptions{Level: 5}), standard) {
+		t.Error("DefaultFLACLevel is not level 5")
+	}
+	if bytes.Equal(fastest, standard) {
+		t.Error("level 0 was encoded at the default level")
+	}
+
+	var buf bytes.Buffer
+	if _, err := ctx.WriteFLAC(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), standard) {
+		t.Error("nil options did not use the default level")
+	}
+
+	for _, level := range []int{-2, 9} {
+		if _, err := ctx.WriteFLAC(io.Discard, &espeak.FLACOptions{Level: level}); err == nil {
+			t.Errorf("expected an error for level %d", level)
+		}
+	}
+}
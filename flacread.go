@@ -0,0 +1,139 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/flac"
+)
+
+// ReadAudio decodes a WAV or FLAC file into a new Context, such as a sound to play between sentences.
+// Unlike ReadWAV, the audio is kept at the sample rate of the file, which becomes the sample rate of the
+// Context as if SetSampleRate had been called. Audio with more than one channel is mixed down to mono.
+//
+// Events and Text are restored from the cue points of a WAV file, as described for ReadFrom, and marks
+// from the CHAPTER comments of a FLAC stream written by WriteFLAC.
+func ReadAudio(r io.Reader) (*Context, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	switch string(magic) {
+	case "RIFF", "RF64":
+		d, err := decodeWAV(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Context{
+			Samples:    d.samples,
+			Events:     d.events(),
+			Text:       d.text,
+			sampleRate: d.sampleRate,
+		}, nil
+	case "fLaC":
+		return readFLAC(br)
+	}
+
+	if string(magic[:3]) == "ID3" {
+		return readFLAC(br)
+	}
+
+	return nil, ErrFormat
+}
+
+func readFLAC(r io.Reader) (*Context, error) {
+	h, samples, err := flac.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.SampleRate == 0 {
+		return nil, ErrFormat
+	}
+
+	ctx := &Context{
+		Samples:    samples,
+		Events:     flacChapters(h.Comments),
+		sampleRate: h.SampleRate,
+	}
+
+	if h.Channels > 1 {
+		ctx.Samples = make([]int16, len(samples)/h.Channels)
+		for i := range ctx.Samples {
+			var sum float64
+			for _, v := range samples[i*h.Channels : (i+1)*h.Channels] {
+				sum += float64(v)
+			}
+			ctx.Samples[i] = clip16(sum / float64(h.Channels))
+		}
+	}
+
+	return ctx, nil
+}
+
+// flacChapters returns a mark event for each chapter named in CHAPTERnnn and CHAPTERnnnNAME comments.
+func flacChapters(comments []string) []*SynthEvent {
+	chapters := make(map[string]*SynthEvent)
+	for _, comment := range comments {
+		eq := strings.IndexByte(comment, '=')
+		if eq == -1 || len(comment) < len("CHAPTER000") || !strings.EqualFold(comment[:len("CHAPTER")], "CHAPTER") {
+			continue
+		}
+		key, value := strings.ToUpper(comment[:eq]), comment[eq+1:]
+
+		number := key[len("CHAPTER"):]
+		name := strings.HasSuffix(number, "NAME")
+		number = strings.TrimSuffix(number, "NAME")
+		if _, err := strconv.Atoi(number); err != nil {
+			continue
+		}
+
+		e := chapters[number]
+		if e == nil {
+			e = &SynthEvent{Type: EventMark, AudioPosition: -1}
+			chapters[number] = e
+		}
+
+		if name {
+			e.Name = value
+		} else if d, ok := parseChapterTime(value); ok {
+			e.AudioPosition = d
+		}
+	}
+
+	var events []*SynthEvent
+	for _, e := range chapters {
+		if e.AudioPosition >= 0 {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].AudioPosition < events[j].AudioPosition
+	})
+
+	return events
+}
+
+// parseChapterTime parses a time written by formatChapterTime.
+func parseChapterTime(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)+0.5), true
+}
@@ -0,0 +1,95 @@
+// Package g711 converts 16-bit audio to and from the companded 8-bit encodings of ITU-T G.711, which
+// are used by telephone networks: μ-law in North America and Japan, and A-law elsewhere.
+//
+// Both encodings keep about 13 bits of precision for quiet sounds and fewer for loud ones, so they
+// sound much better than 8-bit linear audio at the same size.
+package g711 // import "gopkg.in/BenLubar/espeak.v2/g711"
+
+import (
+	"math/bits"
+)
+
+const (
+	ulawBias = 0x84 // moves the first segment so that all segments have the same shape
+	ulawClip = 32635
+)
+
+// EncodeULaw returns the μ-law encoding of s.
+func EncodeULaw(s int16) byte {
+	v := int(s)
+
+	var sign byte
+	if v < 0 {
+		sign = 0x80
+		v = -v
+	}
+	if v > ulawClip {
+		v = ulawClip
+	}
+	v += ulawBias
+
+	// The segment is the position of the highest bit above bit 7.
+	segment := bits.Len(uint(v)) - 8
+	mantissa := byte(v>>(uint(segment)+3)) & 0x0f
+
+	return ^(sign | byte(segment)<<4 | mantissa)
+}
+
+// DecodeULaw returns the sample encoded by u.
+func DecodeULaw(u byte) int16 {
+	u = ^u
+
+	v := (int(u&0x0f)<<3 + ulawBias) << (u & 0x70 >> 4)
+	if u&0x80 != 0 {
+		return int16(ulawBias - v)
+	}
+
+	return int16(v - ulawBias)
+}
+
+// EncodeALaw returns the A-law encoding of s.
+func EncodeALaw(s int16) byte {
+	// A-law has 13 bits of precision, and every other bit of the code is inverted.
+	v := int(s) >> 3
+
+	mask := byte(0xd5)
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+
+	segment := bits.Len(uint(v)) - 5
+	if segment < 0 {
+		segment = 0
+	}
+
+	var a byte
+	if segment < 2 {
+		a = byte(segment<<4) | byte(v>>1)&0x0f
+	} else {
+		a = byte(segment<<4) | byte(v>>uint(segment))&0x0f
+	}
+
+	return a ^ mask
+}
+
+// DecodeALaw returns the sample encoded by a.
+func DecodeALaw(a byte) int16 {
+	a ^= 0x55
+
+	v := int(a&0x0f) << 4
+	switch segment := a & 0x70 >> 4; segment {
+	case 0:
+		v += 8
+	case 1:
+		v += 0x108
+	default:
+		v = (v + 0x108) << (segment - 1)
+	}
+
+	if a&0x80 == 0 {
+		return int16(-v)
+	}
+
+	return int16(v)
+}
@@ -0,0 +1,73 @@
+package g711
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKnownValues(t *testing.T) {
+	for _, tt := range []struct {
+		s    int16
+		u, a byte
+	}{
+		{0, 0xff, 0xd5},
+		{-1, 0x7f, 0x55},
+		{math.MaxInt16, 0x80, 0xaa},
+		{math.MinInt16, 0x00, 0x2a},
+		{1000, 0xce, 0xfa},
+		{-1000, 0x4e, 0x7a},
+	} {
+		if u := EncodeULaw(tt.s); u != tt.u {
+			t.Errorf("EncodeULaw(%d) = %#02x, want %#02x", tt.s, u, tt.u)
+		}
+		if a := EncodeALaw(tt.s); a != tt.a {
+			t.Errorf("EncodeALaw(%d) = %#02x, want %#02x", tt.s, a, tt.a)
+		}
+	}
+
+	if s := DecodeULaw(0x80); s != 32124 {
+		t.Errorf("DecodeULaw(0x80) = %d, want 32124", s)
+	}
+	if s := DecodeALaw(0xaa); s != 32256 {
+		t.Errorf("DecodeALaw(0xaa) = %d, want 32256", s)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+
+		// 0x7f is negative zero, which encodes as positive zero.
+		if u := EncodeULaw(DecodeULaw(b)); u != b && b != 0x7f {
+			t.Errorf("μ-law %#02x decodes to %d, which encodes to %#02x", b, DecodeULaw(b), u)
+		}
+		if a := EncodeALaw(DecodeALaw(b)); a != b {
+			t.Errorf("A-law %#02x decodes to %d, which encodes to %#02x", b, DecodeALaw(b), a)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	// The error is at most half of a step, and steps are at most 1/16 of the value, plus the size of
+	// the smallest step.
+	for s := math.MinInt16; s <= math.MaxInt16; s++ {
+		limit := math.Abs(float64(s))/32 + 16
+		if s > 32124 || s < -32124 {
+			limit += float64(abs(s) - 32124)
+		}
+
+		if d := int(DecodeULaw(EncodeULaw(int16(s)))) - s; math.Abs(float64(d)) > limit {
+			t.Fatalf("μ-law error for %d is %d", s, d)
+		}
+		if d := int(DecodeALaw(EncodeALaw(int16(s)))) - s; math.Abs(float64(d)) > limit+32 {
+			t.Fatalf("A-law error for %d is %d", s, d)
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
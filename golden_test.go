@@ -0,0 +1,52 @@
+package espeak_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestSSML synthesizes the document from Example_ssml and compares it with golden files. The fake
+// engine's golden files check the handling of the document in this package. The golden files of the
+// built-in backend catch changes in espeak-ng, such as a word that is pronounced differently after an
+// upgrade; they are recorded with -update on a machine that has espeak-ng, and the test is skipped
+// until they are.
+func TestSSML(t *testing.T) {
+	ssml, err := os.ReadFile(filepath.Join("testdata", "ssml.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		engine espeak.Engine
+	}{
+		{"ssml-espeaktest", espeaktest.New(8000)},
+		{"ssml-espeak-ng", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.engine == nil {
+				if len(espeak.ListVoices()) == 0 {
+					t.Skip("no espeak-ng backend is built in")
+				}
+
+				if _, err := os.Stat(filepath.Join("testdata", test.name+".wav")); os.IsNotExist(err) && !*update {
+					t.Skip("no golden files for espeak-ng; record them with -update")
+				}
+			}
+
+			ctx := espeak.Context{Engine: test.engine}
+			if err := ctx.SynthesizeText(string(ssml)); err != nil {
+				t.Fatal(err)
+			}
+
+			espeaktest.Golden(t, &ctx, test.name, espeaktest.Tolerance{}, *update)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package gsm
+
+import (
+	"math/bits"
+)
+
+// The codec is defined in terms of 16-bit and 32-bit fixed point arithmetic that saturates instead of
+// overflowing. Following the standard exactly keeps the encoder in step with every decoder.
+
+const (
+	minWord = -32768
+	maxWord = 32767
+)
+
+func saturate(v int32) int16 {
+	if v > maxWord {
+		return maxWord
+	}
+	if v < minWord {
+		return minWord
+	}
+	return int16(v)
+}
+
+func add(a, b int16) int16 {
+	return saturate(int32(a) + int32(b))
+}
+
+func sub(a, b int16) int16 {
+	return saturate(int32(a) - int32(b))
+}
+
+// mult multiplies two fractions in Q15.
+func mult(a, b int16) int16 {
+	if a == minWord && b == minWord {
+		return maxWord
+	}
+	return int16(int32(a) * int32(b) >> 15)
+}
+
+// multR is mult with rounding.
+func multR(a, b int16) int16 {
+	if a == minWord && b == minWord {
+		return maxWord
+	}
+	return int16((int32(a)*int32(b) + 16384) >> 15)
+}
+
+func abs(a int16) int16 {
+	if a < 0 {
+		if a == minWord {
+			return maxWord
+		}
+		return -a
+	}
+	return a
+}
+
+func lAdd(a, b int32) int32 {
+	s := int64(a) + int64(b)
+	if s > 1<<31-1 {
+		return 1<<31 - 1
+	}
+	if s < -1<<31 {
+		return -1 << 31
+	}
+	return int32(s)
+}
+
+// norm returns the number of left shifts needed to normalize a, so that its highest bit (other than
+// the sign) is bit 30.
+func norm(a int32) int {
+	if a < 0 {
+		if a <= -1073741824 {
+			return 0
+		}
+		a = ^a
+	}
+
+	return bits.LeadingZeros32(uint32(a)) - 1
+}
+
+// div divides num by denum, where 0 <= num <= denum, giving a fraction in Q15.
+func div(num, denum int16) int16 {
+	if num == 0 {
+		return 0
+	}
+
+	lnum, ldenum := int32(num), int32(denum)
+	var d int16
+	for k := 0; k < 15; k++ {
+		d <<= 1
+		lnum <<= 1
+		if lnum >= ldenum {
+			lnum -= ldenum
+			d++
+		}
+	}
+
+	return d
+}
+
+// asl and asr are shifts that allow negative and large shift counts.
+func asl(a int16, n int) int16 {
+	switch {
+	case n >= 16:
+		return 0
+	case n <= -16:
+		if a < 0 {
+			return -1
+		}
+		return 0
+	case n < 0:
+		return asr(a, -n)
+	default:
+		return a << uint(n)
+	}
+}
+
+func asr(a int16, n int) int16 {
+	switch {
+	case n >= 16:
+		if a < 0 {
+			return -1
+		}
+		return 0
+	case n <= -16:
+		return 0
+	case n < 0:
+		return a << uint(-n)
+	default:
+		return a >> uint(n)
+	}
+}
@@ -0,0 +1,46 @@
+package gsm
+
+// bitWriter packs values most significant bit first, as libgsm frames require.
+type bitWriter struct {
+	buf   []byte
+	acc   uint32 // bits that do not fill a byte yet, in the low n bits
+	nbits uint
+}
+
+// write appends the low n bits of v, where n is at most 8.
+func (b *bitWriter) write(v uint32, n uint) {
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.nbits += n
+
+	for b.nbits >= 8 {
+		b.nbits -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.nbits))
+	}
+}
+
+// lsbWriter packs values least significant bit first, as WAV49 blocks require.
+type lsbWriter struct {
+	buf   []byte
+	acc   uint32 // bits that do not fill a byte yet, in the low n bits
+	nbits uint
+}
+
+// write appends the low n bits of v, where n is at most 8.
+func (b *lsbWriter) write(v uint32, n uint) {
+	b.acc |= (v & (1<<n - 1)) << b.nbits
+	b.nbits += n
+
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// flush writes any remaining bits, padded with zeros to a whole byte.
+func (b *lsbWriter) flush() {
+	if b.nbits != 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+}
@@ -0,0 +1,141 @@
+package gsm
+
+import (
+	"errors"
+)
+
+// decoder is the decoder of section 4.3 of GSM 06.10, which shares the tables and the interpolation of
+// the short-term filter with the encoder.
+type decoder struct {
+	short shortTerm
+	v     [9]int16
+	drp   [160]int16 // reconstructed long-term residual, of which the first 120 samples are history
+	nrp   int16
+	msr   int16
+}
+
+// bitReader reads values most significant bit first, or least significant bit first if lsb is set.
+type bitReader struct {
+	buf []byte
+	pos uint
+	lsb bool
+}
+
+func (r *bitReader) read(n uint) int16 {
+	var v int16
+	for i := uint(0); i < n; i++ {
+		bit := int16(r.buf[r.pos/8]>>(7-r.pos%8)) & 1
+		if r.lsb {
+			bit = int16(r.buf[r.pos/8]>>(r.pos%8)) & 1
+			v |= bit << i
+		} else {
+			v = v<<1 | bit
+		}
+		r.pos++
+	}
+	return v
+}
+
+func unpack(r *bitReader) *frame {
+	f := &frame{}
+	for i := range f.larc {
+		f.larc[i] = r.read(larBits[i])
+	}
+	for k := 0; k < 4; k++ {
+		f.nc[k] = r.read(7)
+		f.bc[k] = r.read(2)
+		f.mc[k] = r.read(2)
+		f.xmaxc[k] = r.read(6)
+		for i := range f.xmc[k] {
+			f.xmc[k][i] = r.read(3)
+		}
+	}
+	return f
+}
+
+// decodeFrame decodes a frame of FrameSize bytes.
+func (d *decoder) decodeFrame(b []byte) ([]int16, error) {
+	if len(b) != FrameSize {
+		return nil, errors.New("wrong frame size")
+	}
+
+	r := &bitReader{buf: b}
+	if r.read(4) != 0xd {
+		return nil, errors.New("missing frame signature")
+	}
+
+	return d.decode(unpack(r)), nil
+}
+
+// decodeWAV49 decodes a block of WAV49Size bytes.
+func (d *decoder) decodeWAV49(b []byte) ([]int16, error) {
+	if len(b) != WAV49Size {
+		return nil, errors.New("wrong block size")
+	}
+
+	r := &bitReader{buf: b, lsb: true}
+	f1, f2 := unpack(r), unpack(r)
+
+	return append(d.decode(f1), d.decode(f2)...), nil
+}
+
+func (d *decoder) decode(f *frame) []int16 {
+	if d.nrp == 0 {
+		d.nrp = 40
+	}
+
+	var wt [FrameSamples]int16
+	for k := 0; k < 4; k++ {
+		// RPE decoding
+		exp, mant := expMant(f.xmaxc[k])
+		var xmp [13]int16
+		dequantizeRPE(&f.xmc[k], exp, mant, &xmp)
+
+		var erp [40]int16
+		for i, v := range xmp {
+			erp[int(f.mc[k])+3*i] = v
+		}
+
+		// long-term synthesis
+		nr := f.nc[k]
+		if nr < 40 || nr > 120 {
+			nr = d.nrp
+		}
+		d.nrp = nr
+
+		var drp [160]int16
+		copy(drp[:120], d.drp[:120])
+		brp := qlb[f.bc[k]]
+		for i := 0; i < 40; i++ {
+			drpp := multR(brp, drp[120+i-int(nr)])
+			drp[120+i] = add(erp[i], drpp)
+		}
+		copy(wt[k*40:], drp[120:])
+		copy(d.drp[:120], drp[40:])
+	}
+
+	// short-term synthesis
+	prev, cur := d.short.next(&f.larc)
+	var s [FrameSamples]int16
+	for i, seg := range segments {
+		rrp := coefficients(i, prev, cur)
+
+		for k := seg.start; k < seg.end; k++ {
+			sri := wt[k]
+			for j := 7; j >= 0; j-- {
+				sri = sub(sri, multR(rrp[j], d.v[j]))
+				d.v[j+1] = add(d.v[j], multR(rrp[j], sri))
+			}
+			s[k] = sri
+			d.v[0] = sri
+		}
+	}
+
+	// de-emphasis and upscaling
+	for k, v := range s {
+		d.msr = add(v, multR(d.msr, 28180))
+		s[k] = int16(uint16(add(d.msr, d.msr)) & 0xfff8)
+	}
+
+	return s[:]
+}
@@ -0,0 +1,428 @@
+// Package gsm encodes 8 kHz audio with the GSM 06.10 full rate speech codec, which telephone systems
+// like Asterisk use for compact voice prompts. Each frame of 20 milliseconds takes 33 bytes, so a second
+// of audio takes 1650 bytes, less than a tenth of the size of 16-bit PCM.
+//
+// Frames are written in the format of libgsm and .gsm files, or in pairs in the format used by WAV
+// files with format tag 0x0031 (WAVE_FORMAT_GSM610), which Asterisk calls WAV49.
+package gsm // import "gopkg.in/BenLubar/espeak.v2/gsm"
+
+const (
+	// FrameSamples is the number of samples in a frame.
+	FrameSamples = 160
+
+	// FrameSize is the number of bytes in a frame in the libgsm format.
+	FrameSize = 33
+
+	// WAV49Samples is the number of samples in a block of two frames in the WAV format.
+	WAV49Samples = 2 * FrameSamples
+
+	// WAV49Size is the number of bytes in a block of two frames in the WAV format.
+	WAV49Size = 65
+)
+
+// frame holds the parameters of a coded frame.
+type frame struct {
+	larc  [8]int16
+	nc    [4]int16 // LTP lag
+	bc    [4]int16 // LTP gain
+	mc    [4]int16 // RPE grid position
+	xmaxc [4]int16 // RPE block amplitude
+	xmc   [4][13]int16
+}
+
+// Encoder encodes audio one frame at a time. The filters carry state from one frame to the next, so
+// frames must be encoded in order.
+type Encoder struct {
+	// preprocessing
+	z1  int16
+	lz2 int32
+	mp  int16
+
+	short shortTerm
+	u     [8]int16
+
+	// reconstructed short-term residual, of which the last 120 samples of the previous frame are
+	// kept for the long-term predictor
+	dp [280]int16
+}
+
+// EncodeFrame encodes FrameSamples samples into a frame of FrameSize bytes in dst. If there are fewer
+// samples, the rest of the frame is silence.
+func (e *Encoder) EncodeFrame(dst []byte, samples []int16) {
+	f := e.encode(samples)
+
+	b := bitWriter{buf: dst[:0]}
+	b.write(0xd, 4) // signature
+	f.pack(b.write)
+}
+
+// EncodeWAV49 encodes WAV49Samples samples into a block of WAV49Size bytes in dst. If there are fewer
+// samples, the rest of the block is silence.
+func (e *Encoder) EncodeWAV49(dst []byte, samples []int16) {
+	f1 := e.encode(samples)
+	if len(samples) > FrameSamples {
+		samples = samples[FrameSamples:]
+	} else {
+		samples = nil
+	}
+	f2 := e.encode(samples)
+
+	b := lsbWriter{buf: dst[:0]}
+	f1.pack(b.write)
+	f2.pack(b.write)
+	b.flush()
+}
+
+// pack writes the parameters of f in the order of the bitstream.
+func (f *frame) pack(write func(v uint32, n uint)) {
+	for i, c := range f.larc {
+		write(uint32(c), larBits[i])
+	}
+
+	for k := 0; k < 4; k++ {
+		write(uint32(f.nc[k]), 7)
+		write(uint32(f.bc[k]), 2)
+		write(uint32(f.mc[k]), 2)
+		write(uint32(f.xmaxc[k]), 6)
+		for _, c := range f.xmc[k] {
+			write(uint32(c), 3)
+		}
+	}
+}
+
+// encode codes one frame of audio (section 4.2 of GSM 06.10).
+func (e *Encoder) encode(samples []int16) *frame {
+	var s [FrameSamples]int16
+	copy(s[:], samples)
+
+	f := &frame{}
+
+	e.preprocess(&s)
+	f.larc = lpcAnalysis(&s)
+	e.shortTermAnalysis(&f.larc, &s)
+
+	// res holds the residual with five samples of padding on each side for the weighting filter.
+	var res [50]int16
+	dp := e.dp[120:]
+	for k := 0; k < 4; k++ {
+		d := s[k*40 : k*40+40]
+
+		var dpp [40]int16
+		f.nc[k], f.bc[k] = ltpParameters(d, e.dp[k*40:k*40+120])
+		bp := qlb[f.bc[k]]
+		for i := range dpp {
+			dpp[i] = multR(bp, e.dp[120+k*40+i-int(f.nc[k])])
+			res[5+i] = sub(d[i], dpp[i])
+		}
+
+		f.xmaxc[k], f.mc[k] = rpeEncode(&res, &f.xmc[k])
+
+		for i := range dpp {
+			dp[k*40+i] = add(res[5+i], dpp[i])
+		}
+	}
+
+	copy(e.dp[:120], e.dp[160:])
+
+	return f
+}
+
+// preprocess removes the DC offset and applies pre-emphasis (section 4.2.1 to 4.2.3).
+func (e *Encoder) preprocess(s *[FrameSamples]int16) {
+	for k, v := range s {
+		so := v >> 3 << 2
+
+		// offset compensation
+		s1 := int32(so) - int32(e.z1)
+		e.z1 = so
+
+		ls2 := s1 << 15
+		msp := int16(e.lz2 >> 15)
+		lsp := int16(e.lz2 - int32(msp)<<15)
+		ls2 += int32(multR(lsp, 32735))
+		e.lz2 = lAdd(int32(msp)*32735, ls2)
+
+		// pre-emphasis
+		ltemp := lAdd(e.lz2, 16384)
+		msp = multR(e.mp, -28180)
+		e.mp = int16(ltemp >> 15)
+		s[k] = add(e.mp, msp)
+	}
+}
+
+// lpcAnalysis finds and codes the log area ratios of the frame (sections 4.2.4 to 4.2.7).
+func lpcAnalysis(s *[FrameSamples]int16) [8]int16 {
+	// autocorrelation, with the samples scaled down to avoid overflow
+	var smax int16
+	for _, v := range s {
+		if a := abs(v); a > smax {
+			smax = a
+		}
+	}
+
+	scalauto := 0
+	if smax != 0 {
+		scalauto = 4 - norm(int32(smax)<<16)
+	}
+
+	var scaled [FrameSamples]int16
+	copy(scaled[:], s[:])
+	if scalauto > 0 {
+		factor := int16(16384 >> uint(scalauto-1))
+		for i, v := range scaled {
+			scaled[i] = multR(v, factor)
+		}
+	}
+
+	var lacf [9]int32
+	for k := range lacf {
+		for i := k; i < FrameSamples; i++ {
+			lacf[k] += int32(scaled[i]) * int32(scaled[i-k])
+		}
+		lacf[k] <<= 1
+	}
+
+	// The standard scales the samples back up, losing the bits that were shifted out, and the
+	// short-term filter uses the result.
+	if scalauto > 0 {
+		for i, v := range scaled {
+			s[i] = v << uint(scalauto)
+		}
+	}
+
+	r := reflection(&lacf)
+
+	// transformation to log area ratios, then quantization
+	var larc [8]int16
+	for i, v := range r {
+		temp := abs(v)
+		switch {
+		case temp < 22118:
+			temp >>= 1
+		case temp < 31130:
+			temp -= 11059
+		default:
+			temp = (temp - 26112) << 2
+		}
+		if v < 0 {
+			temp = -temp
+		}
+
+		t := &larTable[i]
+		temp = mult(t.a, temp)
+		temp = add(temp, t.b)
+		temp = add(temp, 256)
+		temp >>= 9
+
+		switch {
+		case temp > t.mac:
+			larc[i] = t.mac - t.mic
+		case temp < t.mic:
+			larc[i] = 0
+		default:
+			larc[i] = temp - t.mic
+		}
+	}
+
+	return larc
+}
+
+// reflection computes the reflection coefficients with the Schur recursion (section 4.2.5).
+func reflection(lacf *[9]int32) [8]int16 {
+	var r [8]int16
+	if lacf[0] == 0 {
+		return r
+	}
+
+	shift := uint(norm(lacf[0]))
+	var p, k [9]int16
+	for i := range p {
+		p[i] = int16(lacf[i] << shift >> 16)
+	}
+	copy(k[1:8], p[1:8])
+
+	for n := 1; n <= 8; n++ {
+		temp := abs(p[1])
+		if p[0] < temp {
+			return r
+		}
+
+		rn := div(temp, p[0])
+		if p[1] > 0 {
+			rn = -rn
+		}
+		r[n-1] = rn
+		if n == 8 {
+			break
+		}
+
+		p[0] = add(p[0], multR(p[1], rn))
+		for m := 1; m <= 8-n; m++ {
+			p[m] = add(p[m+1], multR(k[m], rn))
+			k[m] = add(k[m], multR(p[m+1], rn))
+		}
+	}
+
+	return r
+}
+
+// shortTermAnalysis replaces s with its short-term residual (section 4.2.10).
+func (e *Encoder) shortTermAnalysis(larc *[8]int16, s *[FrameSamples]int16) {
+	prev, cur := e.short.next(larc)
+
+	for i, seg := range segments {
+		rp := coefficients(i, prev, cur)
+
+		for k := seg.start; k < seg.end; k++ {
+			di := s[k]
+			sav := di
+			for j := range rp {
+				ui := e.u[j]
+				e.u[j] = sav
+				sav = add(ui, multR(rp[j], di))
+				di = add(di, multR(rp[j], ui))
+			}
+			s[k] = di
+		}
+	}
+}
+
+// ltpParameters finds the lag and gain of the long-term predictor for the subframe d, given the 120
+// previous samples of the reconstructed residual (section 4.2.11).
+func ltpParameters(d []int16, prev []int16) (nc, bc int16) {
+	var dmax int16
+	for _, v := range d {
+		if a := abs(v); a > dmax {
+			dmax = a
+		}
+	}
+
+	temp := 0
+	if dmax != 0 {
+		temp = norm(int32(dmax) << 16)
+	}
+	scal := uint(0)
+	if temp <= 6 {
+		scal = uint(6 - temp)
+	}
+
+	var wt [40]int16
+	for k, v := range d {
+		wt[k] = v >> scal
+	}
+
+	// prev[120-lambda+k] is the sample lambda samples before d[k].
+	var lmax int32
+	nc = 40
+	for lambda := 40; lambda <= 120; lambda++ {
+		var l int32
+		for k, w := range wt {
+			l += int32(w) * int32(prev[120-lambda+k])
+		}
+		if l > lmax {
+			nc, lmax = int16(lambda), l
+		}
+	}
+
+	lmax <<= 1
+	lmax >>= 6 - scal
+
+	var power int32
+	for k := 0; k < 40; k++ {
+		v := int32(prev[120-int(nc)+k] >> 3)
+		power += v * v
+	}
+	power <<= 1
+
+	if lmax <= 0 {
+		return nc, 0
+	}
+	if lmax >= power {
+		return nc, 3
+	}
+
+	shift := uint(norm(power))
+	r := int16(lmax << shift >> 16)
+	s := int16(power << shift >> 16)
+	for bc = 0; bc <= 2; bc++ {
+		if r <= mult(s, dlb[bc]) {
+			break
+		}
+	}
+
+	return nc, bc
+}
+
+// rpeEncode codes the long-term residual in res[5:45] with regular pulse excitation, and replaces it
+// with the decoded excitation (sections 4.2.13 to 4.2.17).
+func rpeEncode(res *[50]int16, xmc *[13]int16) (xmaxc, mc int16) {
+	// weighting filter
+	var x [40]int16
+	for k := range x {
+		l := int32(4096)
+		for i, h := range filterH {
+			l += int32(res[k+i]) * int32(h)
+		}
+		x[k] = saturate(l >> 13)
+	}
+
+	// grid selection
+	var em int32
+	for m := 0; m < 4; m++ {
+		var l int32
+		for i := 0; m+3*i < 40; i++ {
+			v := int32(x[m+3*i] >> 2)
+			l += v * v
+		}
+		l <<= 1
+		if m == 0 || l > em {
+			mc, em = int16(m), l
+		}
+	}
+
+	var xm [13]int16
+	for i := range xm {
+		xm[i] = x[int(mc)+3*i]
+	}
+
+	// APCM quantization of the maximum, then of the sequence normalized by it
+	var xmax int16
+	for _, v := range xm {
+		if a := abs(v); a > xmax {
+			xmax = a
+		}
+	}
+
+	exp := int16(0)
+	temp := xmax >> 9
+	itest := false
+	for i := 0; i <= 5; i++ {
+		itest = itest || temp <= 0
+		temp >>= 1
+		if !itest {
+			exp++
+		}
+	}
+	xmaxc = add(xmax>>uint(exp+5), exp<<3)
+
+	exp, mant := expMant(xmaxc)
+	temp1 := uint(6 - exp)
+	temp2 := nrfac[mant]
+	for i, v := range xm {
+		t := v << temp1
+		t = mult(t, temp2)
+		xmc[i] = t>>12 + 4
+	}
+
+	var xmp [13]int16
+	dequantizeRPE(xmc, exp, mant, &xmp)
+
+	for i := range res {
+		res[i] = 0
+	}
+	for i, v := range xmp {
+		res[5+int(mc)+3*i] = v
+	}
+
+	return xmaxc, mc
+}
@@ -0,0 +1,144 @@
+package gsm
+
+import (
+	"math"
+	"testing"
+)
+
+// vowel returns a second of a synthetic vowel at 8 kHz: a pulse train at a varying pitch through two
+// resonances, which is the kind of signal the codec models.
+func vowel() []int16 {
+	out := make([]int16, 8000)
+	var phase, y1, y2, z1, z2 float64
+	for i := range out {
+		f0 := 120 + 30*math.Sin(float64(i)/1200)
+		phase += f0 / 8000
+		var x float64
+		if phase >= 1 {
+			phase--
+			x = 1
+		}
+
+		// resonances at 700 Hz and 1200 Hz
+		y := x + 2*0.97*math.Cos(2*math.Pi*700/8000)*y1 - 0.97*0.97*y2
+		y2, y1 = y1, y
+		z := y + 2*0.95*math.Cos(2*math.Pi*1200/8000)*z1 - 0.95*0.95*z2
+		z2, z1 = z1, z
+
+		out[i] = int16(math.Max(-32768, math.Min(32767, z*300)))
+	}
+	return out
+}
+
+func snr(in, out []int16) float64 {
+	var signal, noise float64
+	for i, s := range in {
+		d := float64(out[i]) - float64(s)
+		signal += float64(s) * float64(s)
+		noise += d * d
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestEncodeFrame(t *testing.T) {
+	in := vowel()
+
+	var e Encoder
+	var d decoder
+	var out []int16
+	buf := make([]byte, FrameSize)
+	for i := 0; i < len(in); i += FrameSamples {
+		e.EncodeFrame(buf, in[i:])
+		s, err := d.decodeFrame(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, s...)
+	}
+
+	if got := snr(in, out); got < 8 {
+		t.Errorf("SNR is %.1f dB", got)
+	} else {
+		t.Logf("SNR is %.1f dB", got)
+	}
+}
+
+func TestEncodeWAV49(t *testing.T) {
+	in := vowel()
+
+	// The two formats hold the same frames.
+	var e1, e2 Encoder
+	var d1, d2 decoder
+	frame := make([]byte, FrameSize)
+	block := make([]byte, WAV49Size)
+	for i := 0; i < len(in); i += WAV49Samples {
+		var want []int16
+		for j := 0; j < 2; j++ {
+			e1.EncodeFrame(frame, in[i+j*FrameSamples:])
+			s, err := d1.decodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, s...)
+		}
+
+		e2.EncodeWAV49(block, in[i:])
+		got, err := d2.decodeWAV49(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("sample %d is %d, want %d", i+j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestSilence(t *testing.T) {
+	// The smallest pulses the codec can code are a few steps from zero.
+	var e Encoder
+	var d decoder
+	buf := make([]byte, FrameSize)
+	for i := 0; i < 10; i++ {
+		e.EncodeFrame(buf, nil)
+		s, err := d.decodeFrame(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, v := range s {
+			if v > 64 || v < -64 {
+				t.Fatalf("frame %d, sample %d is %d", i, j, v)
+			}
+		}
+	}
+}
+
+func TestLoud(t *testing.T) {
+	// full scale square wave, which saturates the fixed point arithmetic
+	in := make([]int16, 1600)
+	for i := range in {
+		in[i] = math.MaxInt16
+		if i/20%2 == 1 {
+			in[i] = math.MinInt16
+		}
+	}
+
+	var e Encoder
+	var d decoder
+	var out []int16
+	buf := make([]byte, FrameSize)
+	for i := 0; i < len(in); i += FrameSamples {
+		e.EncodeFrame(buf, in[i:])
+		s, err := d.decodeFrame(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, s...)
+	}
+
+	if got := snr(in[800:], out[800:]); got < 3 {
+		t.Errorf("SNR is %.1f dB", got)
+	}
+}
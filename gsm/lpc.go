@@ -0,0 +1,146 @@
+package gsm
+
+// Tables from section 5 of GSM 06.10.
+var (
+	// weighting filter impulse response
+	filterH = [11]int16{-134, -374, 0, 2054, 5741, 8192, 5741, 2054, 0, -374, -134}
+
+	// normalized inverse mantissa for RPE quantization
+	nrfac = [8]int16{29128, 26215, 23832, 21846, 20165, 18725, 17476, 16384}
+
+	// normalized mantissa for RPE dequantization
+	fac = [8]int16{18431, 20479, 22527, 24575, 26623, 28671, 30719, 32767}
+
+	// decision levels and quantization levels of the LTP gain
+	dlb = [4]int16{6554, 16384, 26214, 32767}
+	qlb = [4]int16{3277, 11469, 21299, 32767}
+)
+
+// larTable holds the coefficients that code each log area ratio, and the range of the code.
+var larTable = [8]struct {
+	a, b, inva int16
+	mic, mac   int16
+}{
+	{20480, 0, 13107, -32, 31},
+	{20480, 0, 13107, -32, 31},
+	{20480, 2048, 13107, -16, 15},
+	{20480, -2560, 13107, -16, 15},
+	{13964, 94, 19223, -8, 7},
+	{15360, -1792, 17476, -8, 7},
+	{8534, -341, 31454, -4, 3},
+	{9036, -1144, 29708, -4, 3},
+}
+
+// larBits is the number of bits in each coded log area ratio.
+var larBits = [8]uint{6, 6, 5, 5, 4, 4, 3, 3}
+
+// shortTerm holds the coded log area ratios of the previous frame, which the short-term filters of both
+// the encoder and the decoder interpolate with those of the current frame.
+type shortTerm struct {
+	larpp [2][8]int16
+	j     int
+}
+
+// decodeLAR converts coded log area ratios back to their values (section 4.2.8).
+func decodeLAR(larc *[8]int16, larpp *[8]int16) {
+	for i, c := range larc {
+		t := &larTable[i]
+
+		temp := add(c, t.mic) << 10
+		temp = sub(temp, t.b<<1)
+		temp = multR(t.inva, temp)
+		larpp[i] = add(temp, temp)
+	}
+}
+
+// segment is a range of samples of a frame in which the short-term filter uses the same coefficients,
+// which are interpolated from the previous and the current frame.
+type segment struct {
+	start, end int
+}
+
+var segments = [4]segment{{0, 13}, {13, 27}, {27, 40}, {40, 160}}
+
+// coefficients returns the reflection coefficients for a segment of the frame (sections 4.2.9.1 and
+// 4.2.9.2).
+func coefficients(seg int, prev, cur *[8]int16) [8]int16 {
+	var larp [8]int16
+	for i := range larp {
+		switch seg {
+		case 0:
+			larp[i] = add(prev[i]>>2, cur[i]>>2)
+			larp[i] = add(larp[i], prev[i]>>1)
+		case 1:
+			larp[i] = add(prev[i]>>1, cur[i]>>1)
+		case 2:
+			larp[i] = add(prev[i]>>2, cur[i]>>2)
+			larp[i] = add(larp[i], cur[i]>>1)
+		default:
+			larp[i] = cur[i]
+		}
+	}
+
+	for i, v := range larp {
+		temp := abs(v)
+		switch {
+		case temp < 11059:
+			temp <<= 1
+		case temp < 20070:
+			temp += 11059
+		default:
+			temp = add(temp>>2, 26112)
+		}
+
+		if v < 0 {
+			temp = -temp
+		}
+		larp[i] = temp
+	}
+
+	return larp
+}
+
+// next decodes the log area ratios of a new frame and returns them with those of the previous frame.
+func (st *shortTerm) next(larc *[8]int16) (prev, cur *[8]int16) {
+	cur = &st.larpp[st.j]
+	st.j ^= 1
+	prev = &st.larpp[st.j]
+
+	decodeLAR(larc, cur)
+
+	return prev, cur
+}
+
+// expMant splits the coded maximum of an RPE sequence into an exponent and a mantissa (section
+// 4.2.15).
+func expMant(xmaxc int16) (exp, mant int16) {
+	if xmaxc > 15 {
+		exp = xmaxc>>3 - 1
+	}
+	mant = xmaxc - exp<<3
+
+	if mant == 0 {
+		return -4, 7
+	}
+
+	for mant <= 7 {
+		mant = mant<<1 | 1
+		exp--
+	}
+
+	return exp, mant - 8
+}
+
+// dequantizeRPE decodes an RPE sequence (section 4.2.16).
+func dequantizeRPE(xmc *[13]int16, exp, mant int16, xmp *[13]int16) {
+	temp1 := fac[mant]
+	temp2 := sub(6, exp)
+	temp3 := asl(1, int(sub(temp2, 1)))
+
+	for i, c := range xmc {
+		temp := (c<<1 - 7) << 12 // restore the sign
+		temp = multR(temp1, temp)
+		temp = add(temp, temp3)
+		xmp[i] = asr(temp, int(temp2))
+	}
+}
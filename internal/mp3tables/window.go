@@ -0,0 +1,98 @@
+package mp3tables
+
+import (
+	"math"
+)
+
+// The analysis filterbank splits audio into 32 subbands with a cosine-modulated prototype lowpass
+// filter, as described in ISO/IEC 11172-3. The standard gives the filter as a table of 512 window
+// coefficients. The encoder designs an equivalent Kaiser-windowed sinc instead, which decoders cannot
+// tell apart from the standard filter at the accuracy that matters for lossy coding.
+var (
+	// Window is the analysis window. Every other block of 64 coefficients is negated, which moves the
+	// modulation of the filter into the analysis matrix.
+	Window [512]float64
+
+	// coefficients of the alias reduction butterflies
+	AliasCS, AliasCA [8]float64
+)
+
+const (
+	kaiserBeta = 9
+
+	// windowGain is the DC gain of the prototype filter. Decoders use a synthesis window 32 times the
+	// analysis window, and with this gain the two filterbanks pass audio through at its original level.
+	windowGain = 2
+)
+
+func init() {
+	// The prototype is power complementary at the edge of the first subband, so the cutoff of the sinc
+	// is chosen to put the response at that frequency at 1/sqrt(2) of the response at DC.
+	lo, hi := 0.5/64, 1.5/64
+	for i := 0; i < 50; i++ {
+		fc := (lo + hi) / 2
+		p := prototype(fc)
+		if response(p, 1.0/128)/response(p, 0) < math.Sqrt(0.5) {
+			lo = fc
+		} else {
+			hi = fc
+		}
+	}
+
+	p := prototype((lo + hi) / 2)
+	dc := response(p, 0)
+	for i := range Window {
+		sign := 1.0
+		if (i/64)%2 == 1 {
+			sign = -1
+		}
+		Window[i] = sign * p[i] / dc * windowGain
+	}
+
+	for i, c := range [8]float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037} {
+		sq := math.Sqrt(1 + c*c)
+		AliasCS[i] = 1 / sq
+		AliasCA[i] = c / sq
+	}
+}
+
+// prototype returns a lowpass filter of 512 taps, symmetric around tap 256, with the given cutoff in
+// cycles per sample.
+func prototype(fc float64) [512]float64 {
+	var p [512]float64
+
+	for i := 1; i < len(p); i++ {
+		t := float64(i - 256)
+
+		h := 2 * fc
+		if t != 0 {
+			h = math.Sin(2*math.Pi*fc*t) / (math.Pi * t)
+		}
+
+		p[i] = h * bessel0(kaiserBeta*math.Sqrt(1-(t/256)*(t/256))) / bessel0(kaiserBeta)
+	}
+
+	return p
+}
+
+// response returns the magnitude of the frequency response of p at f cycles per sample.
+func response(p [512]float64, f float64) float64 {
+	var re, im float64
+	for i, v := range p {
+		re += v * math.Cos(2*math.Pi*f*float64(i))
+		im -= v * math.Sin(2*math.Pi*f*float64(i))
+	}
+
+	return math.Hypot(re, im)
+}
+
+// bessel0 is the zeroth order modified Bessel function of the first kind.
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+
+	return sum
+}
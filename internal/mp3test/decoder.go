@@ -0,0 +1,371 @@
+// Package mp3test decodes the streams written by package mp3, so that tests can check what a player
+// would hear, such as tests of a watermark that must survive encoding. It is not a general MP3 decoder.
+package mp3test // import "gopkg.in/BenLubar/espeak.v2/internal/mp3test"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3tables"
+)
+
+// bitReader reads the bits of a frame in the order that the encoder writes them.
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (r *bitReader) read(n uint) uint64 {
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		if r.pos/8 >= len(r.buf) {
+			panic(errors.New("read past end of frame"))
+		}
+		bit := r.buf[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+// Frame is the part of a frame header that Decoder needs, and that the tests check.
+type Frame struct {
+	Version    int // as stored in the frame header
+	Bitrate    int // in kbit/s
+	SampleRate int
+	Channels   int
+	Size       int // in bytes, including the header
+}
+
+// parseHeader reads a frame header from the start of b.
+func parseHeader(b []byte) (Frame, error) {
+	var f Frame
+	if len(b) < 4 {
+		return f, errors.New("short frame header")
+	}
+
+	r := &bitReader{buf: b}
+	if r.read(11) != 0x7ff {
+		return f, errors.New("missing frame sync")
+	}
+	f.Version = int(r.read(2))
+	if r.read(2) != 1 {
+		return f, errors.New("not Layer III")
+	}
+	if r.read(1) != 1 {
+		return f, errors.New("unexpected CRC")
+	}
+	brIndex := int(r.read(4))
+	srIndex := int(r.read(2))
+	padding := int(r.read(1))
+	r.read(1)
+	mode := r.read(2)
+	if brIndex == 0 || brIndex == 15 || srIndex == 3 || f.Version == 1 {
+		return f, errors.New("invalid frame header")
+	}
+
+	f.Bitrate = mp3tables.Bitrates[f.Version][brIndex]
+	f.SampleRate = mp3tables.SampleRates[f.Version][srIndex]
+	f.Channels = 2
+	if mode == 3 {
+		f.Channels = 1
+	}
+
+	slot := 144
+	if f.Version != mp3tables.MPEG1 {
+		slot = 72
+	}
+	f.Size = slot*f.Bitrate*1000/f.SampleRate + padding
+
+	return f, nil
+}
+
+// sideInfo is the side information of one channel of a granule.
+type sideInfo struct {
+	part23, bigValues, globalGain int
+	tables                        [3]int
+	region0, region1              int
+	count1B                       bool
+}
+
+// Decoder decodes streams written by mp3.Encoder. It supports only the features that the encoder uses,
+// and returns an error for anything else. The zero Decoder is ready to use.
+type Decoder struct {
+	synthesis [2]synthesis
+
+	// Frames holds the header of each frame decoded so far.
+	Frames []Frame
+}
+
+// Decode decodes a stream of frames, without an ID3v2 tag, into interleaved samples from -1 to 1. A
+// Decoder keeps the state of its filterbank from one call to the next, so a stream may be decoded a few
+// frames at a time.
+func (d *Decoder) Decode(b []byte) (out []float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	for len(b) != 0 {
+		f, err := parseHeader(b)
+		if err != nil {
+			return out, err
+		}
+		if f.Size > len(b) {
+			return out, errors.New("truncated frame")
+		}
+		d.Frames = append(d.Frames, f)
+
+		samples, err := d.frame(f, b[:f.Size])
+		if err != nil {
+			return out, err
+		}
+		out = append(out, samples...)
+		b = b[f.Size:]
+	}
+
+	return out, nil
+}
+
+func (d *Decoder) frame(f Frame, b []byte) ([]float64, error) {
+	r := &bitReader{buf: b, pos: 32}
+
+	granules := 2
+	if f.Version == mp3tables.MPEG1 {
+		if r.read(9) != 0 {
+			return nil, errors.New("unexpected bit reservoir")
+		}
+		r.read(uint(7 - 2*f.Channels))
+		if r.read(uint(4*f.Channels)) != 0 {
+			return nil, errors.New("unexpected scale factor sharing")
+		}
+	} else {
+		granules = 1
+		if r.read(8) != 0 {
+			return nil, errors.New("unexpected bit reservoir")
+		}
+		r.read(uint(f.Channels))
+	}
+
+	var si [2][2]sideInfo
+	for gr := 0; gr < granules; gr++ {
+		for ch := 0; ch < f.Channels; ch++ {
+			s := &si[gr][ch]
+			s.part23 = int(r.read(12))
+			s.bigValues = int(r.read(9))
+			s.globalGain = int(r.read(8))
+			sfc := 4
+			if f.Version != mp3tables.MPEG1 {
+				sfc = 9
+			}
+			if r.read(uint(sfc)) != 0 {
+				return nil, errors.New("unexpected scale factors")
+			}
+			if r.read(1) != 0 {
+				return nil, errors.New("unexpected window switching")
+			}
+			for i := range s.tables {
+				s.tables[i] = int(r.read(5))
+				if s.tables[i] != 0 && mp3tables.HuffTables[s.tables[i]] == nil {
+					return nil, fmt.Errorf("unexpected Huffman table %d", s.tables[i])
+				}
+			}
+			s.region0 = int(r.read(4))
+			s.region1 = int(r.read(3))
+			if f.Version == mp3tables.MPEG1 && r.read(1) != 0 {
+				return nil, errors.New("unexpected preflag")
+			}
+			if r.read(1) != 0 {
+				return nil, errors.New("unexpected scalefac_scale")
+			}
+			s.count1B = r.read(1) == 1
+		}
+	}
+
+	sfb := mp3tables.SFBLong[f.SampleRate]
+	out := make([]float64, 576*granules*f.Channels)
+	for gr := 0; gr < granules; gr++ {
+		for ch := 0; ch < f.Channels; ch++ {
+			s := &si[gr][ch]
+			start := r.pos
+
+			ix, err := s.huffman(r, &sfb, start+s.part23)
+			if err != nil {
+				return nil, err
+			}
+			if r.pos != start+s.part23 {
+				return nil, fmt.Errorf("part2_3_length is %d, but read %d bits", s.part23, r.pos-start)
+			}
+
+			var xr [576]float64
+			step := math.Pow(2, float64(s.globalGain-210)/4)
+			for i, v := range ix {
+				xr[i] = math.Copysign(math.Pow(math.Abs(float64(v)), 4.0/3), float64(v)) * step
+			}
+
+			for i, v := range d.synthesis[ch].granule(xr) {
+				out[(gr*576+i)*f.Channels+ch] = v
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// huffman reads the quantized values of a granule, which end at bit end.
+func (s *sideInfo) huffman(r *bitReader, sfb *[23]int, end int) ([576]int, error) {
+	var ix [576]int
+
+	if s.bigValues > 288 {
+		return ix, errors.New("big_values out of range")
+	}
+	a1, a2 := sfb[s.region0+1], sfb[s.region0+s.region1+2]
+
+	i := 0
+	for ; i < s.bigValues*2; i += 2 {
+		t := s.tables[2]
+		if i < a1 {
+			t = s.tables[0]
+		} else if i < a2 {
+			t = s.tables[1]
+		}
+		if t == 0 {
+			continue
+		}
+
+		h := mp3tables.HuffTables[t]
+		idx := readCode(r, h.Codes, h.Lens)
+		x, y := idx/h.XLen, idx%h.XLen
+		if h.Linbits != 0 && x == 15 {
+			x += int(r.read(h.Linbits))
+		}
+		if x != 0 && r.read(1) == 1 {
+			x = -x
+		}
+		if h.Linbits != 0 && y == 15 {
+			y += int(r.read(h.Linbits))
+		}
+		if y != 0 && r.read(1) == 1 {
+			y = -y
+		}
+		ix[i], ix[i+1] = x, y
+	}
+
+	var codesB [16]uint16
+	var lensB [16]uint8
+	for j := range codesB {
+		codesB[j], lensB[j] = uint16(15-j), 4
+	}
+
+	for ; r.pos < end && i < 576; i += 4 {
+		var v int
+		if s.count1B {
+			v = readCode(r, codesB[:], lensB[:])
+		} else {
+			v = readCode(r, mp3tables.Count1CodesA[:], mp3tables.Count1LensA[:])
+		}
+
+		for j := 0; j < 4; j++ {
+			if v>>(3-uint(j))&1 == 0 {
+				continue
+			}
+			ix[i+j] = 1
+			if r.read(1) == 1 {
+				ix[i+j] = -1
+			}
+		}
+	}
+
+	return ix, nil
+}
+
+// readCode reads a Huffman code and returns its index in the table.
+func readCode(r *bitReader, codes []uint16, lens []uint8) int {
+	var code uint64
+	for n := uint8(1); n <= 19; n++ {
+		code = code<<1 | r.read(1)
+		for i, c := range codes {
+			if lens[i] == n && uint64(c) == code {
+				return i
+			}
+		}
+	}
+
+	panic(errors.New("invalid Huffman code"))
+}
+
+// synthesis is the decoder half of the filterbank, written from the equations of ISO/IEC 11172-3
+// rather than as the inverse of the encoder, so that Decoder checks the encoder against the standard.
+type synthesis struct {
+	overlap [32][18]float64
+	v       [1024]float64
+}
+
+// granule converts 576 frequency lines to 576 samples.
+func (s *synthesis) granule(xr [576]float64) []float64 {
+	for sb := 1; sb < 32; sb++ {
+		for i := 0; i < 8; i++ {
+			bu, bd := xr[18*sb-1-i], xr[18*sb+i]
+			xr[18*sb-1-i] = bu*mp3tables.AliasCS[i] - bd*mp3tables.AliasCA[i]
+			xr[18*sb+i] = bd*mp3tables.AliasCS[i] + bu*mp3tables.AliasCA[i]
+		}
+	}
+
+	var ts [18][32]float64
+	for sb := 0; sb < 32; sb++ {
+		var y [36]float64
+		for i := range y {
+			for k := 0; k < 18; k++ {
+				y[i] += xr[sb*18+k] * math.Cos(math.Pi/72*float64((2*i+1+18)*(2*k+1)))
+			}
+			y[i] *= math.Sin(math.Pi / 36 * (float64(i) + 0.5))
+		}
+
+		for i := 0; i < 18; i++ {
+			ts[i][sb] = y[i] + s.overlap[sb][i]
+			s.overlap[sb][i] = y[18+i]
+
+			if sb%2 == 1 && i%2 == 1 {
+				ts[i][sb] = -ts[i][sb]
+			}
+		}
+	}
+
+	out := make([]float64, 0, 576)
+	for i := range ts {
+		out = append(out, s.subbands(ts[i])...)
+	}
+
+	return out
+}
+
+// subbands combines one sample of each subband into 32 samples.
+func (s *synthesis) subbands(in [32]float64) []float64 {
+	copy(s.v[64:], s.v[:960])
+	for i := 0; i < 64; i++ {
+		var sum float64
+		for k := 0; k < 32; k++ {
+			sum += math.Cos(float64((16+i)*(2*k+1))*math.Pi/64) * in[k]
+		}
+		s.v[i] = sum
+	}
+
+	var u [512]float64
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 32; j++ {
+			u[i*64+j] = s.v[i*128+j]
+			u[i*64+32+j] = s.v[i*128+96+j]
+		}
+	}
+
+	out := make([]float64, 32)
+	for j := range out {
+		for i := 0; i < 16; i++ {
+			out[j] += u[j+32*i] * 32 * mp3tables.Window[j+32*i]
+		}
+	}
+
+	return out
+}
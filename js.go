@@ -1,4 +1,4 @@
-// +build js
+// +build js,!wasm
 
 package espeak // import "gopkg.in/BenLubar/espeak.v2"
 
@@ -1,4 +1,4 @@
-// +build js
+// +build js !cgo espeak_wazero
 // Code generated by cmd/cgo -godefs; DO NOT EDIT.
 // cgo -godefs js_defs.go
 
@@ -0,0 +1,171 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"math"
+	"sort"
+)
+
+// Layout is a set of speakers, as in the channel mask of a WAVE_FORMAT_EXTENSIBLE file. Audio with a
+// Layout has a channel for each speaker in the set, in the order of the speakers below.
+type Layout uint32
+
+// Speakers, which are combined to make a Layout.
+const (
+	SpeakerFrontLeft Layout = 1 << iota
+	SpeakerFrontRight
+	SpeakerFrontCenter
+	SpeakerLowFrequency
+	SpeakerBackLeft
+	SpeakerBackRight
+	SpeakerFrontLeftOfCenter
+	SpeakerFrontRightOfCenter
+	SpeakerBackCenter
+	SpeakerSideLeft
+	SpeakerSideRight
+	SpeakerTopCenter
+	SpeakerTopFrontLeft
+	SpeakerTopFrontCenter
+	SpeakerTopFrontRight
+	SpeakerTopBackLeft
+	SpeakerTopBackCenter
+	SpeakerTopBackRight
+
+	speakerCount = iota
+)
+
+// Common layouts.
+const (
+	Mono       = SpeakerFrontCenter
+	Stereo     = SpeakerFrontLeft | SpeakerFrontRight
+	Quad       = SpeakerFrontLeft | SpeakerFrontRight | SpeakerBackLeft | SpeakerBackRight
+	Surround51 = SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter | SpeakerLowFrequency | SpeakerBackLeft | SpeakerBackRight
+	Surround71 = Surround51 | SpeakerSideLeft | SpeakerSideRight
+
+	speakersTop = SpeakerTopCenter | SpeakerTopFrontLeft | SpeakerTopFrontCenter | SpeakerTopFrontRight |
+		SpeakerTopBackLeft | SpeakerTopBackCenter | SpeakerTopBackRight
+)
+
+// speakerAzimuth is the direction of each speaker in degrees clockwise from straight ahead, following
+// ITU-R BS.775 for the surround speakers. The low frequency speaker has no direction.
+var speakerAzimuth = [speakerCount]float64{
+	-30, 30, 0, math.NaN(), -110, 110, -15, 15, 180, -90, 90,
+	0, -30, 0, 30, -110, 180, 110,
+}
+
+// Channels returns the number of channels in the layout.
+func (l Layout) Channels() int {
+	n := 0
+	for ; l != 0; l &= l - 1 {
+		n++
+	}
+	return n
+}
+
+// Speakers returns the speaker of each channel in the layout, in order.
+func (l Layout) Speakers() []Layout {
+	var speakers []Layout
+	for s := Layout(1); s != 0 && s <= l; s <<= 1 {
+		if l&s != 0 {
+			speakers = append(speakers, s)
+		}
+	}
+	return speakers
+}
+
+func (l Layout) valid() bool {
+	return l != 0 && l < 1<<speakerCount
+}
+
+// azimuth returns the direction of speaker s, which must be a single speaker.
+func (s Layout) azimuth() float64 {
+	for i := 0; i < speakerCount; i++ {
+		if s == 1<<uint(i) {
+			return speakerAzimuth[i]
+		}
+	}
+	return math.NaN()
+}
+
+// panGains returns the gain of each channel for a sound at pan, from -1 for the left of the front
+// speakers to 1 for the right. The sound is placed between the two nearest speakers with constant-power
+// panning, so that it is equally loud in every position. The low frequency and height channels are not
+// used unless there are no others.
+func (l Layout) panGains(pan float64) []float64 {
+	if pan < -1 {
+		pan = -1
+	}
+	if pan > 1 {
+		pan = 1
+	}
+	angle := pan * 30
+
+	speakers := l.Speakers()
+	gains := make([]float64, len(speakers))
+
+	type direction struct {
+		channel int
+		azimuth float64
+	}
+	var dirs []direction
+	for i, s := range speakers {
+		if az := s.azimuth(); !math.IsNaN(az) && s&speakersTop == 0 {
+			dirs = append(dirs, direction{i, az})
+		}
+	}
+	if len(dirs) == 0 {
+		// Only the low frequency or height speakers are present, so the sound goes to all of them.
+		for i := range gains {
+			gains[i] = 1 / math.Sqrt(float64(len(gains)))
+		}
+		return gains
+	}
+
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i].azimuth < dirs[j].azimuth
+	})
+
+	switch {
+	case angle <= dirs[0].azimuth:
+		gains[dirs[0].channel] = 1
+	case angle >= dirs[len(dirs)-1].azimuth:
+		gains[dirs[len(dirs)-1].channel] = 1
+	default:
+		i := sort.Search(len(dirs), func(i int) bool {
+			return dirs[i].azimuth >= angle
+		})
+		a, b := dirs[i-1], dirs[i]
+		x := (angle - a.azimuth) / (b.azimuth - a.azimuth) * math.Pi / 2
+		gains[a.channel] = math.Cos(x)
+		gains[b.channel] = math.Sin(x)
+	}
+
+	return gains
+}
+
+// downmixGains returns the weight of each channel when the layout is mixed down to mono. The channels
+// are first mixed to stereo as in ITU-R BS.775, with the center and surround channels 3 dB quieter and
+// the low frequency channel left out, and the two stereo channels are then averaged.
+func (l Layout) downmixGains() []float64 {
+	speakers := l.Speakers()
+	gains := make([]float64, len(speakers))
+	if len(speakers) == 1 {
+		gains[0] = 1
+		return gains
+	}
+
+	for i, s := range speakers {
+		az := s.azimuth()
+		switch {
+		case math.IsNaN(az):
+			gains[i] = 0
+		case az == 0 || az == 180:
+			gains[i] = math.Sqrt2 / 2
+		case math.Abs(az) <= 30:
+			gains[i] = 0.5
+		default:
+			gains[i] = math.Sqrt2 / 4
+		}
+	}
+
+	return gains
+}
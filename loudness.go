@@ -0,0 +1,26 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"gopkg.in/BenLubar/espeak.v2/loudness"
+)
+
+// Loudness measures the Samples in this Context as specified by ITU-R BS.1770 and EBU R 128.
+func (ctx *Context) Loudness() loudness.Measurement {
+	return loudness.Measure(ctx.Samples, ctx.SampleRate())
+}
+
+// Normalize changes the level of the Samples in this Context to the target loudness in opts, limiting
+// peaks above its maximum true peak. A nil opts targets -23 LUFS and -1 dBTP, as EBU R 128 requires. The
+// returned report holds the measurements before and after, for logging.
+//
+// Prompts made with different voices and volumes sound equally loud once they are normalized to the
+// same target. If the Samples are silent, loudness.ErrTooQuiet is returned and they are not changed.
+func (ctx *Context) Normalize(opts *loudness.Options) (*loudness.Report, error) {
+	samples, report, err := loudness.Normalize(ctx.Samples, ctx.SampleRate(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Samples = samples
+	return report, nil
+}
@@ -0,0 +1,300 @@
+// Package loudness measures the perceived loudness of 16-bit mono audio from package espeak as specified
+// by ITU-R BS.1770-4 and EBU R 128, and normalizes audio to a target loudness.
+//
+// Integrated loudness is measured in LUFS (loudness units relative to full scale) over 400 millisecond
+// blocks with the two-stage gate of BS.1770. Loudness range follows EBU Tech 3342, and true peak is found
+// by oversampling as in Annex 2 of BS.1770.
+package loudness // import "gopkg.in/BenLubar/espeak.v2/loudness"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// absoluteGate is the level below which blocks are ignored, in LUFS.
+	absoluteGate = -70
+
+	// relativeGate is the level below the ungated loudness at which blocks are ignored by integrated
+	// loudness, in LU.
+	relativeGate = -10
+
+	// rangeGate is the relative gate used by loudness range, in LU.
+	rangeGate = -20
+
+	// Blocks are made of segments of 100 milliseconds, which is the step between them.
+	segmentsPerSecond   = 10
+	momentarySegments   = 4  // 400 milliseconds
+	shortTermSegments   = 30 // 3 seconds
+	rangeLowPercentile  = 0.10
+	rangeHighPercentile = 0.95
+)
+
+// Measurement is the loudness of a recording.
+type Measurement struct {
+	// Integrated is the gated loudness of the whole recording in LUFS. It is negative infinity if the
+	// whole recording is below the absolute gate of -70 LUFS, such as for silence.
+	Integrated float64
+
+	// Range is the loudness range in LU, the spread between quiet and loud parts of the recording. It is
+	// 0 for recordings shorter than 3 seconds.
+	Range float64
+
+	// TruePeak is the highest level of the signal between samples, in dBTP.
+	TruePeak float64
+
+	// SamplePeak is the highest level of the samples themselves, in dBFS.
+	SamplePeak float64
+
+	// MomentaryMax and ShortTermMax are the loudest 400 millisecond and 3 second blocks in LUFS.
+	MomentaryMax, ShortTermMax float64
+}
+
+// String formats m for logging.
+func (m Measurement) String() string {
+	return fmt.Sprintf("I: %.1f LUFS, LRA: %.1f LU, TP: %.1f dBTP, M max: %.1f LUFS, S max: %.1f LUFS",
+		m.Integrated, m.Range, m.TruePeak, m.MomentaryMax, m.ShortTermMax)
+}
+
+// Measure returns the loudness of samples at the given sample rate. Audio shorter than a block is
+// measured as if it were a single block. Measure panics if the sample rate is not positive.
+func Measure(samples []int16, sampleRate int) Measurement {
+	return measure(toFloat(samples), sampleRate)
+}
+
+func measure(x []float64, sampleRate int) Measurement {
+	if sampleRate <= 0 {
+		panic("loudness: sample rate must be positive")
+	}
+
+	m := Measurement{
+		TruePeak:   toDB(truePeak(x, sampleRate)),
+		SamplePeak: toDB(samplePeak(x)),
+	}
+
+	segments := segmentEnergy(x, sampleRate)
+
+	momentary := blocks(segments, momentarySegments, true)
+	m.Integrated = integrated(momentary)
+	m.MomentaryMax = maxLoudness(momentary)
+
+	shortTerm := blocks(segments, shortTermSegments, false)
+	m.Range = loudnessRange(shortTerm)
+	m.ShortTermMax = maxLoudness(shortTerm)
+	if len(shortTerm) == 0 {
+		// The only short-term block is the whole recording.
+		m.ShortTermMax = maxLoudness(blocks(segments, shortTermSegments, true))
+	}
+
+	return m
+}
+
+// segmentEnergy returns the mean square of the K-weighted samples in each complete segment.
+func segmentEnergy(x []float64, sampleRate int) []float64 {
+	size := sampleRate / segmentsPerSecond
+	if size == 0 {
+		size = 1
+	}
+
+	k := newKWeighting(sampleRate)
+
+	var segments []float64
+	var sum float64
+	for i, v := range x {
+		y := k.next(v)
+		sum += y * y
+
+		if (i+1)%size == 0 {
+			segments = append(segments, sum/float64(size))
+			sum = 0
+		}
+	}
+
+	// Audio too short for a whole segment is treated as a segment of its own.
+	if len(segments) == 0 && len(x) != 0 {
+		segments = append(segments, sum/float64(len(x)))
+	}
+
+	return segments
+}
+
+// blocks returns the mean square of each block of n segments, stepping by one segment. If there are
+// fewer than n segments and whole is true, the segments are treated as a single block.
+func blocks(segments []float64, n int, whole bool) []float64 {
+	if len(segments) < n {
+		if !whole || len(segments) == 0 {
+			return nil
+		}
+		n = len(segments)
+	}
+
+	out := make([]float64, 0, len(segments)-n+1)
+	for i := 0; i+n <= len(segments); i++ {
+		var sum float64
+		for _, s := range segments[i : i+n] {
+			sum += s
+		}
+		out = append(out, sum/float64(n))
+	}
+
+	return out
+}
+
+// loudness converts a mean square of K-weighted samples to LUFS.
+func loudness(ms float64) float64 {
+	return -0.691 + 10*math.Log10(ms)
+}
+
+func maxLoudness(blocks []float64) float64 {
+	max := math.Inf(-1)
+	for _, b := range blocks {
+		max = math.Max(max, loudness(b))
+	}
+	return max
+}
+
+// gate returns the blocks louder than threshold LUFS and their mean square.
+func gate(blocks []float64, threshold float64) ([]float64, float64) {
+	var kept []float64
+	var sum float64
+	for _, b := range blocks {
+		if loudness(b) > threshold {
+			kept = append(kept, b)
+			sum += b
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil, 0
+	}
+	return kept, sum / float64(len(kept))
+}
+
+func integrated(blocks []float64) float64 {
+	kept, mean := gate(blocks, absoluteGate)
+	if len(kept) == 0 {
+		return math.Inf(-1)
+	}
+
+	_, mean = gate(kept, loudness(mean)+relativeGate)
+	return loudness(mean)
+}
+
+func loudnessRange(blocks []float64) float64 {
+	kept, mean := gate(blocks, absoluteGate)
+	if len(kept) == 0 {
+		return 0
+	}
+
+	kept, _ = gate(kept, loudness(mean)+rangeGate)
+	if len(kept) == 0 {
+		return 0
+	}
+
+	levels := make([]float64, len(kept))
+	for i, b := range kept {
+		levels[i] = loudness(b)
+	}
+	sort.Float64s(levels)
+
+	return percentile(levels, rangeHighPercentile) - percentile(levels, rangeLowPercentile)
+}
+
+// percentile returns the value at fraction p of the way through the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[int(math.Floor(float64(len(sorted)-1)*p+0.5))]
+}
+
+func samplePeak(x []float64) float64 {
+	var peak float64
+	for _, v := range x {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	return peak
+}
+
+func toFloat(samples []int16) []float64 {
+	x := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s) / 32768
+	}
+	return x
+}
+
+func toDB(v float64) float64 {
+	return 20 * math.Log10(v)
+}
+
+func fromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// kWeighting is the two-stage filter of BS.1770: a high shelf that models the acoustic effect of the
+// head, followed by a high-pass filter. The coefficients in the standard are for 48 kHz, so they are
+// derived from the analog filters for other sample rates, as libebur128 does.
+type kWeighting struct {
+	shelf, highPass biquad
+}
+
+func newKWeighting(sampleRate int) *kWeighting {
+	k := &kWeighting{}
+	fs := float64(sampleRate)
+
+	{
+		const (
+			f0 = 1681.974450955533
+			g  = 3.999843853973347
+			q  = 0.7071752369554196
+		)
+
+		K := math.Tan(math.Pi * f0 / fs)
+		vh := math.Pow(10, g/20)
+		vb := math.Pow(vh, 0.4996667741545416)
+		a0 := 1 + K/q + K*K
+
+		k.shelf = biquad{
+			b0: (vh + vb*K/q + K*K) / a0,
+			b1: 2 * (K*K - vh) / a0,
+			b2: (vh - vb*K/q + K*K) / a0,
+			a1: 2 * (K*K - 1) / a0,
+			a2: (1 - K/q + K*K) / a0,
+		}
+	}
+
+	{
+		const (
+			f0 = 38.13547087602444
+			q  = 0.5003270373238773
+		)
+
+		K := math.Tan(math.Pi * f0 / fs)
+		a0 := 1 + K/q + K*K
+
+		k.highPass = biquad{
+			b0: 1,
+			b1: -2,
+			b2: 1,
+			a1: 2 * (K*K - 1) / a0,
+			a2: (1 - K/q + K*K) / a0,
+		}
+	}
+
+	return k
+}
+
+func (k *kWeighting) next(x float64) float64 {
+	return k.highPass.next(k.shelf.next(x))
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) next(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2 = x, f.x1
+	f.y1, f.y2 = y, f.y1
+	return y
+}
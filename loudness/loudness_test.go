@@ -0,0 +1,148 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(freq, amplitude, phase float64, rate int, seconds float64) []int16 {
+	samples := make([]int16, int(seconds*float64(rate)))
+	for i := range samples {
+		samples[i] = int16(math.Floor(amplitude*32768*math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+phase) + 0.5))
+	}
+	return samples
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestMeasureSine(t *testing.T) {
+	// A 1 kHz sine wave in one channel is 3 dB quieter than its peak, and K-weighting has almost no
+	// effect at 1 kHz.
+	for _, rate := range []int{8000, 16000, 22050, 44100, 48000} {
+		for _, db := range []float64{-6, -20, -40} {
+			m := Measure(sine(997, fromDB(db), 0, rate, 5), rate)
+
+			if want := db - 3.01; !near(m.Integrated, want, 0.1) {
+				t.Errorf("%d Hz, %v dBFS: integrated loudness %.2f LUFS, want %.2f", rate, db, m.Integrated, want)
+			}
+			if !near(m.MomentaryMax, m.Integrated, 0.1) || !near(m.ShortTermMax, m.Integrated, 0.1) {
+				t.Errorf("%d Hz, %v dBFS: maximum loudness %.2f and %.2f LUFS", rate, db, m.MomentaryMax, m.ShortTermMax)
+			}
+			if m.Range > 0.1 {
+				t.Errorf("%d Hz, %v dBFS: loudness range %.2f LU", rate, db, m.Range)
+			}
+			if !near(m.TruePeak, db, 0.1) {
+				t.Errorf("%d Hz, %v dBFS: true peak %.2f dBTP", rate, db, m.TruePeak)
+			}
+		}
+	}
+}
+
+func TestMeasureGating(t *testing.T) {
+	const rate = 16000
+
+	tone := sine(997, 0.1, 0, rate, 10)
+	m := Measure(tone, rate)
+
+	// Silence is below the absolute gate, and a much quieter tone is below the relative gate.
+	withSilence := append(append([]int16(nil), tone...), make([]int16, 5*rate)...)
+	withQuiet := append(append([]int16(nil), tone...), sine(997, 0.001, 0, rate, 3)...)
+	for name, samples := range map[string][]int16{"silence": withSilence, "quiet": withQuiet} {
+		if got := Measure(samples, rate).Integrated; !near(got, m.Integrated, 0.1) {
+			t.Errorf("%s: integrated loudness %.2f LUFS, want %.2f", name, got, m.Integrated)
+		}
+	}
+
+	if got := Measure(make([]int16, rate), rate).Integrated; !math.IsInf(got, -1) {
+		t.Errorf("silence has integrated loudness %v LUFS", got)
+	}
+
+	// Audio shorter than a block is still measured.
+	short := sine(997, 0.1, 0, rate, 0.25)
+	if got := Measure(short, rate).Integrated; !near(got, m.Integrated, 0.2) {
+		t.Errorf("short tone: integrated loudness %.2f LUFS, want %.2f", got, m.Integrated)
+	}
+}
+
+func TestMeasureRange(t *testing.T) {
+	// EBU Tech 3343 test case 1: 20 seconds of tone at two levels 10 dB apart has a range of 10 LU.
+	const rate = 48000
+
+	samples := append(sine(1000, fromDB(-20), 0, rate, 20), sine(1000, fromDB(-30), 0, rate, 20)...)
+	if m := Measure(samples, rate); !near(m.Range, 10, 1) {
+		t.Errorf("loudness range %.2f LU, want 10", m.Range)
+	}
+}
+
+func TestTruePeak(t *testing.T) {
+	// A sine wave at a quarter of the sample rate, sampled halfway between its peaks, has samples 3 dB
+	// below its true peak.
+	const rate = 48000
+
+	m := Measure(sine(rate/4, 0.5, math.Pi/4, rate, 1), rate)
+	if !near(m.SamplePeak, toDB(0.5)-3.01, 0.05) {
+		t.Errorf("sample peak %.2f dBFS", m.SamplePeak)
+	}
+	if !near(m.TruePeak, toDB(0.5), 0.3) {
+		t.Errorf("true peak %.2f dBTP, want %.2f", m.TruePeak, toDB(0.5))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	const rate = 16000
+
+	for _, test := range []struct {
+		name    string
+		samples []int16
+		opts    *Options
+		limited bool
+	}{
+		{"quiet tone", sine(440, 0.01, 0, rate, 3), nil, false},
+		{"loud tone", sine(440, 0.9, 0, rate, 3), &Options{Target: Streaming}, false},
+		{"bursts", bursts(rate, 3), &Options{Target: Streaming, MaxTruePeak: -2}, true},
+	} {
+		out, r, err := Normalize(test.samples, rate, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		target, maxTruePeak := float64(EBUR128), -1.0
+		if test.opts != nil {
+			target, maxTruePeak = test.opts.Target, test.opts.MaxTruePeak
+		}
+
+		if len(out) != len(test.samples) {
+			t.Errorf("%s: %d samples, want %d", test.name, len(out), len(test.samples))
+		}
+		if m := Measure(out, rate); m != r.After {
+			t.Errorf("%s: report says %v, but result is %v", test.name, r.After, m)
+		}
+		if !near(r.After.Integrated, target, 0.5) {
+			t.Errorf("%s: integrated loudness %.2f LUFS, want %v (%v)", test.name, r.After.Integrated, target, r)
+		}
+		if r.After.TruePeak > maxTruePeak {
+			t.Errorf("%s: true peak %.2f dBTP, want at most %v (%v)", test.name, r.After.TruePeak, maxTruePeak, r)
+		}
+		if r.Limited != test.limited {
+			t.Errorf("%s: limited is %v (%v)", test.name, r.Limited, r)
+		}
+	}
+
+	if _, _, err := Normalize(make([]int16, rate), rate, nil); err != ErrTooQuiet {
+		t.Errorf("normalizing silence: %v", err)
+	}
+}
+
+// bursts returns a quiet tone with short loud bursts four times a second, which cannot be made much
+// louder without limiting.
+func bursts(rate int, seconds float64) []int16 {
+	samples := sine(440, 0.05, 0, rate, seconds)
+	burst := sine(440, 0.9, 0, rate, 0.005)
+	for i := 0; i < len(samples); i += rate / 4 {
+		copy(samples[i:], burst)
+	}
+	return samples
+}
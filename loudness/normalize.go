@@ -0,0 +1,231 @@
+package loudness
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Common targets for Options.Target, in LUFS.
+const (
+	EBUR128   = -23 // EBU R 128 broadcast
+	Streaming = -16 // podcasts and streaming services, and the AES recommendation for mobile listening
+)
+
+const (
+	// defaultMaxTruePeak is the highest true peak allowed by EBU R 128, in dBTP.
+	defaultMaxTruePeak = -1
+
+	// limiterAttack is how far ahead the limiter starts to reduce the gain before a peak, and
+	// limiterRelease is how quickly the gain recovers afterwards, in seconds.
+	limiterAttack  = 0.002
+	limiterRelease = 0.05
+
+	// normalizeTolerance is how close the loudness of the result must be to the target before Normalize
+	// stops adjusting the gain, in LU.
+	normalizeTolerance = 0.1
+
+	// truePeakMargin is how far below the maximum true peak the ceiling of the limiter is lowered when
+	// the result is too loud, in dB.
+	truePeakMargin = 0.01
+
+	// normalizeAttempts limits the number of times Normalize adjusts the gain.
+	normalizeAttempts = 5
+)
+
+// ErrTooQuiet is returned by Normalize for audio that has no integrated loudness, such as silence.
+var ErrTooQuiet = errors.New("loudness: audio is too quiet to measure")
+
+// Options controls the audio produced by Normalize.
+type Options struct {
+	// Target is the integrated loudness to reach, in LUFS. If it is 0, EBUR128 is used.
+	Target float64
+
+	// MaxTruePeak is the highest true peak allowed in the result, in dBTP. Peaks that the gain would
+	// push above it are limited. If it is 0, -1 dBTP is used, as EBU R 128 requires.
+	MaxTruePeak float64
+}
+
+// Report describes the changes made by Normalize, for logging.
+type Report struct {
+	Before, After Measurement
+
+	// Gain is the change in level in dB, before limiting.
+	Gain float64
+
+	// Limited is true if peaks were limited to keep them below the maximum true peak. Limiting can
+	// leave the result slightly quieter than the target.
+	Limited bool
+}
+
+// String formats r for logging.
+func (r *Report) String() string {
+	limited := ""
+	if r.Limited {
+		limited = ", limited"
+	}
+
+	return fmt.Sprintf("gain %+.1f dB%s; before: %v; after: %v", r.Gain, limited, r.Before, r.After)
+}
+
+// Normalize changes the level of samples so that their integrated loudness is the target, limiting
+// peaks that would exceed the maximum true peak. A nil opts targets -23 LUFS and -1 dBTP, as EBU R 128
+// requires. The result is not shared with the input.
+func Normalize(samples []int16, sampleRate int, opts *Options) ([]int16, *Report, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	target, maxTruePeak := opts.Target, opts.MaxTruePeak
+	if target == 0 {
+		target = EBUR128
+	}
+	if maxTruePeak == 0 {
+		maxTruePeak = defaultMaxTruePeak
+	}
+	if maxTruePeak > 0 {
+		return nil, nil, fmt.Errorf("loudness: maximum true peak %v dBTP is above full scale", maxTruePeak)
+	}
+
+	x := toFloat(samples)
+	r := &Report{Before: measure(x, sampleRate)}
+	if math.IsInf(r.Before.Integrated, -1) {
+		return nil, nil, ErrTooQuiet
+	}
+
+	// Limiting lowers the loudness, and rounding to 16 bits can raise the true peak, so the gain and the
+	// ceiling of the limiter are corrected until the result is within tolerance.
+	r.Gain = target - r.Before.Integrated
+	ceiling := maxTruePeak
+
+	var out []int16
+	for attempt := 0; attempt < normalizeAttempts; attempt++ {
+		y := make([]float64, len(x))
+		factor := fromDB(r.Gain)
+		for i, v := range x {
+			y[i] = v * factor
+		}
+
+		limited := false
+		if toDB(truePeak(y, sampleRate)) > ceiling {
+			limitTruePeak(y, sampleRate, fromDB(ceiling))
+			limited = true
+		}
+
+		out = toInt16(y)
+		r.After = Measure(out, sampleRate)
+		r.Limited = r.Limited || limited
+
+		switch {
+		case r.After.TruePeak > maxTruePeak:
+			ceiling -= r.After.TruePeak - maxTruePeak + truePeakMargin
+		case limited && r.After.Integrated < target-normalizeTolerance:
+			r.Gain += target - r.After.Integrated
+		default:
+			return out, r, nil
+		}
+	}
+
+	return out, r, nil
+}
+
+// limitTruePeak reduces the gain of x around peaks so that the signal between samples stays at or below
+// the ceiling. The gain falls smoothly before each peak and recovers slowly afterwards, which avoids the
+// distortion of clipping.
+func limitTruePeak(x []float64, sampleRate int, ceiling float64) {
+	peaks := newInterpolator(sampleRate).peaks(x)
+
+	// The gain needed at each sample, taking the minimum over the attack time on both sides so that the
+	// average below is never above the gain needed at any sample.
+	attack := int(limiterAttack * float64(sampleRate))
+	if attack < 1 {
+		attack = 1
+	}
+
+	need := make([]float64, len(x))
+	for i, p := range peaks {
+		need[i] = 1
+		if p > ceiling {
+			need[i] = ceiling / p
+		}
+	}
+	gain := minFilter(need, attack)
+
+	// The gain recovers exponentially after each peak.
+	release := 1 - math.Exp(-1/(limiterRelease*float64(sampleRate)))
+	for i := 1; i < len(gain); i++ {
+		gain[i] = math.Min(gain[i], gain[i-1]+(1-gain[i-1])*release)
+	}
+
+	// Averaging over the attack time turns sudden drops in gain into smooth ramps.
+	gain = boxFilter(gain, attack)
+
+	for i := range x {
+		x[i] *= gain[i]
+	}
+}
+
+// minFilter returns the minimum of x over a window of radius r around each sample.
+func minFilter(x []float64, r int) []float64 {
+	out := make([]float64, len(x))
+
+	// A monotonic queue of indexes whose values increase from front to back.
+	var queue []int
+	next := 0
+	for i := range x {
+		for ; next < len(x) && next <= i+r; next++ {
+			for len(queue) != 0 && x[queue[len(queue)-1]] >= x[next] {
+				queue = queue[:len(queue)-1]
+			}
+			queue = append(queue, next)
+		}
+		for queue[0] < i-r {
+			queue = queue[1:]
+		}
+
+		out[i] = x[queue[0]]
+	}
+
+	return out
+}
+
+// boxFilter returns the mean of x over a window of radius r/2 around each sample.
+func boxFilter(x []float64, r int) []float64 {
+	h := r / 2
+	out := make([]float64, len(x))
+
+	var sum float64
+	n := 0
+	lo, hi := 0, 0 // the window is x[lo:hi]
+	for i := range x {
+		for ; hi < len(x) && hi <= i+h; hi++ {
+			sum += x[hi]
+			n++
+		}
+		for ; lo < i-h; lo++ {
+			sum -= x[lo]
+			n--
+		}
+
+		out[i] = sum / float64(n)
+	}
+
+	return out
+}
+
+func toInt16(x []float64) []int16 {
+	out := make([]int16, len(x))
+	for i, v := range x {
+		v = math.Floor(v*32768 + 0.5)
+		switch {
+		case v > math.MaxInt16:
+			out[i] = math.MaxInt16
+		case v < math.MinInt16:
+			out[i] = math.MinInt16
+		default:
+			out[i] = int16(v)
+		}
+	}
+
+	return out
+}
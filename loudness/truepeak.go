@@ -0,0 +1,80 @@
+package loudness
+
+import (
+	"math"
+)
+
+// truePeakHalf is the number of samples on each side of the interpolated point that the oversampling
+// filter uses.
+const truePeakHalf = 8
+
+// oversampling returns the oversampling factor that BS.1770 requires at a sample rate, so that the
+// oversampled rate is at least 192 kHz.
+func oversampling(sampleRate int) int {
+	switch {
+	case sampleRate < 96000:
+		return 4
+	case sampleRate < 192000:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// interpolator computes the signal between samples with a Hann-windowed sinc filter.
+type interpolator struct {
+	factor int
+	phases [][2 * truePeakHalf]float64
+}
+
+func newInterpolator(sampleRate int) *interpolator {
+	it := &interpolator{factor: oversampling(sampleRate)}
+	it.phases = make([][2 * truePeakHalf]float64, it.factor)
+
+	for p := range it.phases {
+		for k := range it.phases[p] {
+			// distance in samples from the interpolated point to the sample that this tap uses
+			d := float64(k-truePeakHalf+1) - float64(p)/float64(it.factor)
+			it.phases[p][k] = sinc(d) * (0.5 + 0.5*math.Cos(math.Pi*d/truePeakHalf))
+		}
+	}
+
+	return it
+}
+
+// peaks returns, for each sample, the highest absolute value of the signal from that sample up to the
+// next one.
+func (it *interpolator) peaks(x []float64) []float64 {
+	peaks := make([]float64, len(x))
+
+	for n := range x {
+		peak := math.Abs(x[n])
+
+		for p := 1; p < it.factor; p++ {
+			var sum float64
+			for k, c := range it.phases[p] {
+				if i := n + k - truePeakHalf + 1; i >= 0 && i < len(x) {
+					sum += c * x[i]
+				}
+			}
+			peak = math.Max(peak, math.Abs(sum))
+		}
+
+		peaks[n] = peak
+	}
+
+	return peaks
+}
+
+// truePeak returns the highest absolute value of the signal, including between samples.
+func truePeak(x []float64, sampleRate int) float64 {
+	return samplePeak(newInterpolator(sampleRate).peaks(x))
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
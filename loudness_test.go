@@ -0,0 +1,51 @@
+package espeak_test
+
+import (
+	"math"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+	"gopkg.in/BenLubar/espeak.v2/loudness"
+)
+
+func TestNormalize(t *testing.T) {
+	// The same text at two volumes ends up at the same loudness.
+	var results []float64
+	for _, volume := range []int{30, 200} {
+		ctx := espeak.Context{Engine: espeaktest.New(22050)}
+		ctx.SetVolume(volume)
+		if err := ctx.SynthesizeText("Hello, world. How are you today?"); err != nil {
+			t.Fatal(err)
+		}
+		length := len(ctx.Samples)
+
+		report, err := ctx.Normalize(&loudness.Options{Target: loudness.Streaming})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ctx.Samples) != length {
+			t.Errorf("volume %d: %d samples after normalizing %d", volume, len(ctx.Samples), length)
+		}
+		if m := ctx.Loudness(); m != report.After {
+			t.Errorf("volume %d: report says %v, but Loudness returns %v", volume, report.After, m)
+		}
+		if report.After.TruePeak > -1 {
+			t.Errorf("volume %d: true peak %.2f dBTP", volume, report.After.TruePeak)
+		}
+
+		results = append(results, report.After.Integrated)
+	}
+
+	if math.Abs(results[0]-results[1]) > 0.5 || math.Abs(results[0]-loudness.Streaming) > 0.5 {
+		t.Errorf("normalized to %.2f and %.2f LUFS", results[0], results[1])
+	}
+
+	var silent espeak.Context
+	silent.Engine = espeaktest.New(22050)
+	silent.Samples = make([]int16, 22050)
+	if _, err := silent.Normalize(nil); err != loudness.ErrTooQuiet {
+		t.Errorf("normalizing silence: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/effects"
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+const (
+	// defaultDuck is the gain of a ducked track that does not set Duck, in dB.
+	defaultDuck = -12
+
+	// duckThreshold is the level in dBFS above which a track that others duck under counts as playing.
+	duckThreshold = -40
+
+	// A ducked track starts to get quieter duckAttack before the track it ducks under starts playing,
+	// stays quiet for duckHold after it stops, and then recovers over about duckRelease.
+	duckAttack  = 50 * time.Millisecond
+	duckHold    = 200 * time.Millisecond
+	duckRelease = 250 * time.Millisecond
+)
+
+// Timeline places audio from several Contexts on tracks, which play at the same time, and mixes them
+// into a single Context. This allows lines of dialogue to overlap and to play over background sound.
+type Timeline struct {
+	sampleRate int
+	tracks     []*Track
+}
+
+// Track is a sequence of audio on a Timeline. Audio placed on the same track may overlap.
+type Track struct {
+	// Name identifies the track, such as the name of a speaker. It is not used by the Timeline.
+	Name string
+
+	// Gain changes the level of the track, in dB.
+	Gain float64
+
+	// Pan places the track in the layout of RenderLayout, from -1 for the left of the front speakers to 1
+	// for the right, as for Context.Pan. It has no effect on Render.
+	Pan float64
+
+	// Effects are applied to the track before it is mixed, such as effects.Reverb for a speaker in a
+	// large room or effects.Telephone for one on the phone. They see the sum of the overlapping audio on
+	// the track before it is clipped, so an effects.Limiter can bring it back below full scale.
+	Effects []effects.Effect
+
+	// DuckUnder lists the tracks that this track becomes quieter under while they are playing, such as
+	// dialogue over a background track. Duck is the gain in dB applied to this track while they play. If
+	// Duck is 0, -12 dB is used.
+	DuckUnder []*Track
+	Duck      float64
+
+	timeline *Timeline
+	clips    []*placement
+}
+
+// placement is audio placed on a track, converted to the sample rate of the timeline.
+type placement struct {
+	start   int // index of the first sample on the timeline
+	samples []int16
+	events  []*SynthEvent
+	text    string
+}
+
+// NewTimeline returns an empty Timeline that mixes audio at the given sample rate. It panics if the
+// sample rate is not positive.
+func NewTimeline(sampleRate int) *Timeline {
+	if sampleRate <= 0 {
+		panic("espeak: NewTimeline: sample rate must be positive")
+	}
+
+	return &Timeline{sampleRate: sampleRate}
+}
+
+// AddTrack adds a new track to the Timeline and returns it.
+func (tl *Timeline) AddTrack(name string) *Track {
+	t := &Track{Name: name, timeline: tl}
+	tl.tracks = append(tl.tracks, t)
+	return t
+}
+
+// Place adds the audio, text, and events of ctx to the track, starting at time at. ctx may be
+// synthesized speech or audio read by ReadWAV, and it is resampled if its sample rate
+// differs from that of the Timeline. The Timeline keeps its own copy, so ctx may be changed afterwards.
+// Place panics if at is negative.
+func (t *Track) Place(at time.Duration, ctx *Context) {
+	if at < 0 {
+		panic("espeak: Track.Place: time must not be negative")
+	}
+
+	rate := t.timeline.sampleRate
+	p := &placement{
+		start:   int(at * time.Duration(rate) / time.Second),
+		samples: append([]int16(nil), ctx.Samples...),
+		events:  make([]*SynthEvent, len(ctx.Events)),
+		text:    ctx.Text,
+	}
+	if from := ctx.SampleRate(); len(p.samples) != 0 && from != rate {
+		p.samples = resample.Resample(p.samples, from, rate)
+	}
+	for i, e := range ctx.Events {
+		copied := *e
+		p.events[i] = &copied
+	}
+
+	t.clips = append(t.clips, p)
+}
+
+// Render mixes the tracks into a new Context at the sample rate of the Timeline.
+//
+// The events of the placed audio are copied, with their AudioPosition moved to match where the audio
+// was placed and sorted by it. Text is the text of each placed Context in the order they start, and
+// each TextPosition is moved to match, as with Append. Only the finished mix is clipped, so the Gain or
+// Effects of each track, or effects.Limiter applied to the result, should keep it below full scale.
+func (tl *Timeline) Render() *Context {
+	m := tl.RenderLayout(Mono)
+
+	return &Context{
+		Samples:    m.Samples,
+		Events:     m.Events,
+		Text:       m.Text,
+		sampleRate: tl.sampleRate,
+	}
+}
+
+// RenderLayout is like Render, but mixes the tracks into the given layout, with each track placed by
+// its Pan. RenderLayout panics if the layout is empty.
+func (tl *Timeline) RenderLayout(layout Layout) *MultiChannel {
+	if !layout.valid() {
+		panic("espeak: Timeline.RenderLayout: invalid layout")
+	}
+
+	out := &Context{sampleRate: tl.sampleRate}
+
+	type clip struct {
+		*placement
+		track int
+	}
+	var clips []clip
+	for i, t := range tl.tracks {
+		for _, p := range t.clips {
+			clips = append(clips, clip{p, i})
+		}
+	}
+	sort.SliceStable(clips, func(i, j int) bool {
+		return clips[i].start < clips[j].start
+	})
+
+	// Each track is mixed on its own, so that its effects can move its events.
+	tracks := make([]*Context, len(tl.tracks))
+	for i := range tracks {
+		tracks[i] = &Context{sampleRate: tl.sampleRate}
+	}
+	sums := make([][]float64, len(tl.tracks))
+	for _, c := range clips {
+		sum := sums[c.track]
+		if end := c.start + len(c.samples); end > len(sum) {
+			sum = append(sum, make([]float64, end-len(sum))...)
+			sums[c.track] = sum
+		}
+		for i, v := range c.samples {
+			sum[c.start+i] += float64(v) / 32768
+		}
+
+		// Render may be called more than once, so the events are copied again.
+		track := tracks[c.track]
+		events := make([]*SynthEvent, len(c.events))
+		for i, e := range c.events {
+			copied := *e
+			events[i] = &copied
+		}
+		rebaseEvents(events, out.timeAt(c.start), out.textLength())
+		track.Events = append(track.Events, events...)
+		out.Text += c.text
+	}
+
+	// Overlapping clips are not clipped until the whole mix is, so that the effects and gain of a track
+	// can bring a sum that is too loud back below full scale.
+	levels := make([][]float64, len(tl.tracks))
+	for i, t := range tl.tracks {
+		levels[i] = sums[i]
+		if len(t.Effects) != 0 {
+			levels[i] = tracks[i].applyEffectsFloat(sums[i], t.Effects)
+		}
+
+		gain := math.Pow(10, t.Gain/20) * 32768
+		for j := range levels[i] {
+			levels[i][j] *= gain
+		}
+	}
+
+	// The tracks that others duck under are measured before any of them are ducked.
+	gains := make([][]float64, len(tl.tracks))
+	for i, t := range tl.tracks {
+		if len(t.DuckUnder) != 0 {
+			gains[i] = tl.duck(t, len(levels[i]), levels)
+		}
+	}
+
+	var length int
+	for i := range tl.tracks {
+		for j, g := range gains[i] {
+			levels[i][j] *= g
+		}
+		if len(levels[i]) > length {
+			length = len(levels[i])
+		}
+		out.Events = append(out.Events, tracks[i].Events...)
+	}
+
+	channels := layout.Channels()
+	mix := make([]float64, length*channels)
+	for i, t := range tl.tracks {
+		gains := layout.panGains(t.Pan)
+		for j, v := range levels[i] {
+			for c, g := range gains {
+				mix[j*channels+c] += v * g
+			}
+		}
+	}
+
+	m := &MultiChannel{
+		Layout:     layout,
+		Samples:    make([]int16, len(mix)),
+		SampleRate: tl.sampleRate,
+		Events:     out.Events,
+		Text:       out.Text,
+	}
+	for i, v := range mix {
+		m.Samples[i] = clip16(v)
+	}
+
+	sort.SliceStable(m.Events, func(i, j int) bool {
+		return m.Events[i].AudioPosition < m.Events[j].AudioPosition
+	})
+
+	return m
+}
+
+// duck returns the gain of each of the first n samples of t, which is lower while any of the tracks it
+// ducks under are playing.
+func (tl *Timeline) duck(t *Track, n int, levels [][]float64) []float64 {
+	duck := t.Duck
+	if duck == 0 {
+		duck = defaultDuck
+	}
+	duck = math.Pow(10, duck/20)
+
+	var keys [][]float64
+	for i, k := range tl.tracks {
+		for _, key := range t.DuckUnder {
+			if k == key {
+				keys = append(keys, levels[i])
+				break
+			}
+		}
+	}
+
+	// playing[i] counts the loud samples before index i in the tracks that t ducks under.
+	threshold := 32768 * math.Pow(10, duckThreshold/20.0)
+	playing := make([]int, n+1)
+	for i := 0; i < n; i++ {
+		playing[i+1] = playing[i]
+		for _, key := range keys {
+			if i < len(key) && math.Abs(key[i]) >= threshold {
+				playing[i+1]++
+			}
+		}
+	}
+
+	samples := func(d time.Duration) int {
+		return int(d * time.Duration(tl.sampleRate) / time.Second)
+	}
+	attack, hold := samples(duckAttack), samples(duckHold)
+	attackRate := 1 - math.Exp(-3/float64(attack+1))
+	releaseRate := 1 - math.Exp(-3/float64(samples(duckRelease)+1))
+
+	gains := make([]float64, n)
+	gain := 1.0
+	for i := range gains {
+		from, to := i-hold, i+attack+1
+		if from < 0 {
+			from = 0
+		}
+		if to > n {
+			to = n
+		}
+
+		target, rate := 1.0, releaseRate
+		if playing[to] != playing[from] {
+			target, rate = duck, attackRate
+		}
+		gain += (target - gain) * rate
+		gains[i] = gain
+	}
+
+	return gains
+}
+
+// clip16 rounds v to the nearest sample, clipping it to the range of a 16-bit sample.
+func clip16(v float64) int16 {
+	v = math.Floor(v + 0.5)
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	default:
+		return int16(v)
+	}
+}
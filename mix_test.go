@@ -0,0 +1,153 @@
+package espeak_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/effects"
+)
+
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestTimelineOverlap(t *testing.T) {
+	const rate = 22050
+
+	first := synthesize(t, rate, "Hello there, how are you?")
+	second := synthesize(t, 16000, "I am fine.")
+	at := first.Duration() / 2
+
+	tl := espeak.NewTimeline(rate)
+	tl.AddTrack("first").Place(0, first)
+	tl.AddTrack("second").Place(at, second)
+	out := tl.Render()
+
+	if out.SampleRate() != rate {
+		t.Errorf("sample rate %d", out.SampleRate())
+	}
+	if got, want := out.Duration(), at+second.Duration(); got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Errorf("duration %v, want %v", got, want)
+	}
+	if out.Text != first.Text+second.Text {
+		t.Errorf("text is %q", out.Text)
+	}
+	if len(out.Events) != len(first.Events)+len(second.Events) {
+		t.Fatalf("%d events, want %d", len(out.Events), len(first.Events)+len(second.Events))
+	}
+
+	var words []string
+	for i, e := range out.Events {
+		if i != 0 && e.AudioPosition < out.Events[i-1].AudioPosition {
+			t.Errorf("%+v is out of order", *e)
+		}
+		if e.Type == espeak.EventWord {
+			words = append(words, string([]rune(out.Text)[e.TextPosition-1:e.TextPosition-1+e.Length]))
+		}
+	}
+	// The lines overlap, so their words are interleaved.
+	if got := strings.Join(words, " "); got == "Hello there how are you I am fine" || len(words) != 8 {
+		t.Errorf("words are %q", got)
+	}
+
+	// Placing copies the audio.
+	first.Samples[0] = math.MaxInt16
+	if tl.Render().Samples[0] == math.MaxInt16 {
+		t.Error("timeline shares samples with a placed Context")
+	}
+}
+
+func TestTimelineGain(t *testing.T) {
+	ctx := synthesize(t, 22050, "Hello there.")
+
+	tl := espeak.NewTimeline(22050)
+	track := tl.AddTrack("voice")
+	track.Place(0, ctx)
+	track.Gain = -6
+	track.Effects = []effects.Effect{effects.HighPass{Frequency: 20}}
+	out := tl.Render()
+
+	if ratio := rms(out.Samples) / rms(ctx.Samples); math.Abs(ratio-0.5) > 0.02 {
+		t.Errorf("level changed by %.3f, want 0.5", ratio)
+	}
+}
+
+func TestTimelineDuck(t *testing.T) {
+	const rate = 16000
+
+	bed := &espeak.Context{Engine: synthesize(t, rate).Engine}
+	bed.Samples = make([]int16, 6*rate)
+	for i := range bed.Samples {
+		bed.Samples[i] = int16(4000 * math.Sin(2*math.Pi*220*float64(i)/rate))
+	}
+	voice := synthesize(t, rate, "Hello there, how are you?")
+
+	tl := espeak.NewTimeline(rate)
+	music := tl.AddTrack("music")
+	dialogue := tl.AddTrack("dialogue")
+	music.Place(0, bed)
+	music.DuckUnder = []*espeak.Track{dialogue}
+	dialogue.Place(2*time.Second, voice)
+
+	// The music is what is left after taking away the dialogue.
+	alone := espeak.NewTimeline(rate)
+	alone.AddTrack("dialogue").Place(2*time.Second, voice)
+	speech := alone.Render().Samples
+
+	out := tl.Render()
+	for i, v := range speech {
+		out.Samples[i] -= v
+	}
+	before := rms(out.Samples[:rate])
+	during := rms(out.Samples[2*rate+rate/4 : 2*rate+rate/2])
+	after := rms(out.Samples[5*rate:])
+
+	if db := 20 * math.Log10(during/before); math.Abs(db-(-12)) > 1 {
+		t.Errorf("music is %.1f dB quieter during dialogue, want 12", -db)
+	}
+	if math.Abs(after-before) > before*0.01 {
+		t.Errorf("music did not recover after dialogue: %.0f, want %.0f", after, before)
+	}
+}
+
+// TestTimelineOverlapHeadroom places two loud clips over each other on one track. Their sum is above
+// full scale, but the gain or effects of the track bring it back down, so it is not clipped.
+func TestTimelineOverlapHeadroom(t *testing.T) {
+	const rate = 8000
+
+	loud := synthesize(t, rate, "Hello.")
+	loud.Samples = make([]int16, rate/10)
+	for i := range loud.Samples {
+		loud.Samples[i] = 24000
+	}
+
+	for _, test := range []struct {
+		name   string
+		gain   float64
+		effect []effects.Effect
+	}{
+		{"gain", -20 * math.Log10(2), nil},
+		{"effects", 0, []effects.Effect{effects.Gain{DB: -20 * math.Log10(2)}}},
+	} {
+		tl := espeak.NewTimeline(rate)
+		track := tl.AddTrack("loud")
+		track.Gain = test.gain
+		track.Effects = test.effect
+		track.Place(0, loud)
+		track.Place(0, loud)
+
+		for i, v := range tl.Render().Samples {
+			if v < 23999 || v > 24001 {
+				t.Errorf("%s: sample %d is %d, want 24000", test.name, i, v)
+				break
+			}
+		}
+	}
+}
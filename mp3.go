@@ -0,0 +1,162 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/mp3"
+)
+
+// MP3Options controls the stream written by Context.WriteMP3.
+type MP3Options struct {
+	// Bitrate is the constant bitrate in kbit/s. If it is 0, mp3.DefaultBitrate is used, which is 48
+	// kbit/s at the usual sample rate of 22050 Hz.
+	Bitrate int
+
+	// Info is written in the ID3v2 tag. The defaults are the same as for WriteWAV, except that Artist
+	// defaults to the name of the voice. A nil Info uses all of the defaults.
+	Info *WAVInfo
+}
+
+// WriteMP3 writes the Samples in this Context to an io.Writer as an MP3 file with an ID3v2 tag, for
+// web browsers and podcast players. A nil opts uses the default bitrate. If the sample rate is not
+// supported by MP3, the audio is resampled to the nearest rate that is.
+//
+// Each sentence event starts a chapter, so that players can jump to the start of a sentence. Chapters
+// are titled with their sentence from Text, or with their number if Text does not hold it. Their times
+// are later than the events by mp3.Delay, as the audio that players decode is.
+func (ctx *Context) WriteMP3(w io.Writer, opts *MP3Options) (int64, error) {
+	return ctx.writeMP3(w, opts, ctx.Samples, Mono)
+}
+
+// writeMP3 writes interleaved samples with the given layout, which must be Mono or Stereo, using the
+// events and settings of ctx for the tag.
+func (ctx *Context) writeMP3(w io.Writer, opts *MP3Options, samples []int16, layout Layout) (int64, error) {
+	if layout != Mono && layout != Stereo {
+		return 0, fmt.Errorf("espeak: layout %#x cannot be stored in an mp3 stream", uint32(layout))
+	}
+	channels := layout.Channels()
+
+	if opts == nil {
+		opts = &MP3Options{}
+	}
+
+	info := WAVInfo{}
+	if opts.Info != nil {
+		info = *opts.Info
+	}
+	if info.Artist == "" {
+		info.Artist = ctx.Settings().Voice.Name
+	}
+	if info.Software == "" {
+		info.Software = Software
+	}
+	if info.Comment == "" {
+		info.Comment = ctx.describeSettings()
+	}
+
+	sampleRate := ctx.SampleRate()
+	if rate := mp3.NearestSampleRate(sampleRate); rate != sampleRate {
+		samples = resampleFrames(samples, channels, sampleRate, rate)
+		sampleRate = rate
+	}
+	frames := len(samples) / channels
+
+	tag := &mp3.Tag{
+		Title:    info.Title,
+		Artist:   info.Artist,
+		Encoder:  info.Software,
+		Comment:  info.Comment,
+		Chapters: ctx.mp3Chapters(
+			time.Duration(frames)*time.Second/time.Duration(sampleRate),
+			time.Duration(mp3.Delay)*time.Second/time.Duration(sampleRate),
+		),
+	}
+
+	cw := countWriter{w: w}
+	if _, err := tag.WriteTo(&cw); err != nil {
+		return cw.n, err
+	}
+
+	e, err := mp3.NewEncoder(&cw, &mp3.Options{
+		SampleRate: sampleRate,
+		Channels:   channels,
+		Bitrate:    opts.Bitrate,
+	})
+	if err != nil {
+		return cw.n, err
+	}
+
+	if err := e.WriteSamples(samples); err != nil {
+		return cw.n, err
+	}
+
+	err = e.Close()
+	return cw.n, err
+}
+
+// maxMP3Chapters is the largest number of chapters in an ID3v2 table of contents.
+const maxMP3Chapters = 255
+
+// mp3Chapters returns a chapter for each sentence event, ending at the next sentence or at the end of
+// the audio, with the times moved later by delay.
+func (ctx *Context) mp3Chapters(duration, delay time.Duration) []mp3.Chapter {
+	var sentences []*SynthEvent
+	for _, e := range ctx.Events {
+		if e.Type == EventSentence && e.AudioPosition < duration && len(sentences) < maxMP3Chapters {
+			sentences = append(sentences, e)
+		}
+	}
+
+	chapters := make([]mp3.Chapter, len(sentences))
+	for i, e := range sentences {
+		end, next := duration, 0
+		if i+1 < len(sentences) {
+			end, next = sentences[i+1].AudioPosition, sentences[i+1].TextPosition
+		}
+
+		title := sentenceText(ctx.Text, e.TextPosition, next)
+		if title == "" {
+			title = "sentence " + strconv.Itoa(e.Number)
+		}
+
+		chapters[i] = mp3.Chapter{Start: e.AudioPosition + delay, End: end + delay, Title: title}
+	}
+
+	return chapters
+}
+
+// sentenceText returns the text from the 1-based character position start up to the position next,
+// or to the end of the text if next is 0, without markup or extra space.
+func sentenceText(text string, start, next int) string {
+	if start < 1 {
+		return ""
+	}
+
+	var b strings.Builder
+	pos, inTag := 0, false
+	for _, r := range text {
+		pos++
+		if pos < start {
+			continue
+		}
+		if next != 0 && pos >= next {
+			break
+		}
+
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteByte(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
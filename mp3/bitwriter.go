@@ -0,0 +1,40 @@
+package mp3
+
+// bitWriter packs values most significant bit first, as MPEG audio frames require.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64 // bits that do not fill a byte yet, in the low n bits
+	nbits uint
+}
+
+// write appends the low n bits of v, where n is at most 32.
+func (b *bitWriter) write(v uint64, n uint) {
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.nbits += n
+
+	for b.nbits >= 8 {
+		b.nbits -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.nbits))
+	}
+}
+
+// writeBool appends a single bit, which is set if v is true.
+func (b *bitWriter) writeBool(v bool) {
+	if v {
+		b.write(1, 1)
+	} else {
+		b.write(0, 1)
+	}
+}
+
+// bits returns the number of bits written so far.
+func (b *bitWriter) bits() int {
+	return len(b.buf)*8 + int(b.nbits)
+}
+
+// align pads the output with zero bits to a whole number of bytes.
+func (b *bitWriter) align() {
+	if b.nbits != 0 {
+		b.write(0, 8-b.nbits)
+	}
+}
@@ -0,0 +1,350 @@
+// Package mp3 encodes 16-bit audio from package espeak as MPEG-1 and MPEG-2 Audio Layer III.
+//
+// The encoder is written in pure Go, so it works with every backend of package espeak, including
+// GopherJS. It is meant for speech rather than music: it writes constant bitrate streams of long
+// blocks without a psychoacoustic model or bit reservoir, which keeps it small and fast at the low
+// bitrates that suit synthesized speech.
+package mp3 // import "gopkg.in/BenLubar/espeak.v2/mp3"
+
+import (
+	"errors"
+	"io"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3tables"
+)
+
+// Options describes the audio given to an Encoder and the stream it writes.
+type Options struct {
+	SampleRate int // samples per second, per channel; see SampleRates
+	Channels   int // 1 or 2 interleaved channels; 0 is the same as 1
+
+	// Bitrate is the constant bitrate in kbit/s. See Bitrates for the choices at each sample rate. If
+	// it is 0, DefaultBitrate is used.
+	Bitrate int
+}
+
+// Delay is the number of samples by which decoded audio lags the input, from the filterbanks in the
+// encoder and the decoder. Players do not skip them, so times in the audio, such as the chapters of a
+// Tag, are later by this much than in the input.
+const Delay = 1057
+
+// SampleRates returns the sample rates that an Encoder accepts, in ascending order.
+func SampleRates() []int {
+	return []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000}
+}
+
+// NearestSampleRate returns the supported sample rate closest to rate, preferring the higher rate
+// when two are equally close, so audio at other rates can be resampled before encoding.
+func NearestSampleRate(rate int) int {
+	best := 0
+	for _, r := range SampleRates() {
+		if best == 0 || abs(r-rate) <= abs(best-rate) {
+			best = r
+		}
+	}
+
+	return best
+}
+
+// Bitrates returns the bitrates in kbit/s that an Encoder accepts at the given sample rate, in
+// ascending order, or nil if the sample rate is not supported.
+func Bitrates(sampleRate int) []int {
+	version, _, ok := findSampleRate(sampleRate)
+	if !ok {
+		return nil
+	}
+
+	table := mp3tables.Bitrates[version]
+	return append([]int(nil), table[1:]...)
+}
+
+// DefaultBitrate returns a bitrate in kbit/s that gives clear speech at the given sample rate and
+// number of channels, or 0 if the sample rate is not supported.
+func DefaultBitrate(sampleRate, channels int) int {
+	version, _, ok := findSampleRate(sampleRate)
+	if !ok {
+		return 0
+	}
+
+	if channels < 1 {
+		channels = 1
+	}
+
+	switch version {
+	case mp3tables.MPEG1:
+		return 64 * channels
+	case mp3tables.MPEG2:
+		return 48 * channels
+	default:
+		return 24 * channels
+	}
+}
+
+// findSampleRate returns the version and sample rate index for rate.
+func findSampleRate(rate int) (version, index int, ok bool) {
+	for _, v := range []int{mp3tables.MPEG1, mp3tables.MPEG2, mp3tables.MPEG25} {
+		for i, r := range mp3tables.SampleRates[v] {
+			if r == rate {
+				return v, i, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// Encoder writes an MP3 stream.
+type Encoder struct {
+	w    io.Writer
+	opts Options
+
+	version      int
+	sampleIndex  int
+	bitrateIndex int
+	granules     int // granules per frame
+	sideInfo     int // bytes of side information per frame
+	slotBytes    int // frame size in bytes is slotBytes * Bitrate / SampleRate
+	padding      int // accumulated fraction of a byte of padding, in units of 1/SampleRate
+	sfb          *[23]int
+
+	channels [2]channel
+	pending  []int16 // interleaved samples that do not fill a frame yet
+	samples  int64   // samples per channel written so far
+
+	err error
+}
+
+// NewEncoder returns an Encoder that writes to w. MP3 streams have no header, so nothing is written
+// until the first frame is full.
+func NewEncoder(w io.Writer, opts *Options) (*Encoder, error) {
+	e := &Encoder{
+		w:    w,
+		opts: *opts,
+	}
+
+	if e.opts.Channels == 0 {
+		e.opts.Channels = 1
+	}
+	if e.opts.Channels < 1 || e.opts.Channels > 2 {
+		return nil, errors.New("mp3: invalid number of channels")
+	}
+
+	var ok bool
+	e.version, e.sampleIndex, ok = findSampleRate(e.opts.SampleRate)
+	if !ok {
+		return nil, errors.New("mp3: unsupported sample rate")
+	}
+
+	if e.opts.Bitrate == 0 {
+		e.opts.Bitrate = DefaultBitrate(e.opts.SampleRate, e.opts.Channels)
+	}
+	for i, br := range mp3tables.Bitrates[e.version] {
+		if i != 0 && br == e.opts.Bitrate {
+			e.bitrateIndex = i
+		}
+	}
+	if e.bitrateIndex == 0 {
+		return nil, errors.New("mp3: unsupported bitrate")
+	}
+
+	sfb := mp3tables.SFBLong[e.opts.SampleRate]
+	e.sfb = &sfb
+
+	if e.version == mp3tables.MPEG1 {
+		e.granules = 2
+		e.sideInfo = 17
+		if e.opts.Channels == 2 {
+			e.sideInfo = 32
+		}
+	} else {
+		e.granules = 1
+		e.sideInfo = 9
+		if e.opts.Channels == 2 {
+			e.sideInfo = 17
+		}
+	}
+	e.slotBytes = 576 * e.granules / 8 * 1000
+
+	return e, nil
+}
+
+// WriteSamples encodes interleaved samples. The number of samples must be a multiple of the number of
+// channels. Once an error has occurred, WriteSamples and Close return that error without writing
+// anything.
+func (e *Encoder) WriteSamples(samples []int16) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if len(samples)%e.opts.Channels != 0 {
+		return errors.New("mp3: partial frame of samples")
+	}
+	e.samples += int64(len(samples) / e.opts.Channels)
+
+	frameLen := 576 * e.granules * e.opts.Channels
+	for len(samples) != 0 && e.err == nil {
+		if len(e.pending) == 0 && len(samples) >= frameLen {
+			e.writeFrame(samples[:frameLen])
+			samples = samples[frameLen:]
+			continue
+		}
+
+		n := frameLen - len(e.pending)
+		if n > len(samples) {
+			n = len(samples)
+		}
+		e.pending = append(e.pending, samples[:n]...)
+		samples = samples[n:]
+
+		if len(e.pending) == frameLen {
+			e.writeFrame(e.pending)
+			e.pending = e.pending[:0]
+		}
+	}
+
+	return e.err
+}
+
+// Close pads the audio with silence until the decoder has output every sample, and encodes the last
+// frames. Close does not close the destination.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	frameSamples := int64(576 * e.granules)
+	frames := (e.samples + Delay + frameSamples - 1) / frameSamples
+	silence := make([]int16, (frames*frameSamples-e.samples)*int64(e.opts.Channels))
+	e.WriteSamples(silence)
+	if e.err != nil {
+		return e.err
+	}
+
+	e.err = errors.New("mp3: Encoder is closed")
+
+	return nil
+}
+
+// writeFrame encodes one frame of interleaved samples.
+func (e *Encoder) writeFrame(samples []int16) {
+	channels := e.opts.Channels
+
+	var in [576]float64
+	var gr [2][2]*granule
+
+	size := e.slotBytes * e.opts.Bitrate / e.opts.SampleRate
+	e.padding += e.slotBytes * e.opts.Bitrate % e.opts.SampleRate
+	padded := e.padding >= e.opts.SampleRate
+	if padded {
+		e.padding -= e.opts.SampleRate
+		size++
+	}
+
+	budget := (size - 4 - e.sideInfo) * 8
+	parts := e.granules * channels
+	for g := 0; g < e.granules; g++ {
+		for ch := 0; ch < channels; ch++ {
+			for i := range in {
+				in[i] = float64(samples[(g*576+i)*channels+ch]) / 32768
+			}
+
+			var xr [576]float64
+			e.channels[ch].granule(in[:], &xr)
+
+			gr[g][ch] = quantize(&xr, budget/parts, e.sfb)
+			budget -= gr[g][ch].part23
+			parts--
+		}
+	}
+
+	b := &bitWriter{buf: make([]byte, 0, size)}
+	e.writeHeader(b, padded)
+	e.writeSideInfo(b, &gr)
+	for g := 0; g < e.granules; g++ {
+		for ch := 0; ch < channels; ch++ {
+			gr[g][ch].encode(b, e.sfb)
+		}
+	}
+	b.align()
+
+	// The rest of the frame is ancillary data, which decoders ignore.
+	frame := append(b.buf, make([]byte, size-len(b.buf))...)
+	if n, err := e.w.Write(frame); err != nil {
+		e.err = err
+	} else if n != len(frame) {
+		e.err = io.ErrShortWrite
+	}
+}
+
+// writeHeader writes the 4-byte frame header.
+func (e *Encoder) writeHeader(b *bitWriter, padded bool) {
+	b.write(0x7ff, 11) // sync
+	b.write(uint64(e.version), 2)
+	b.write(1, 2) // Layer III
+	b.write(1, 1) // no CRC
+	b.write(uint64(e.bitrateIndex), 4)
+	b.write(uint64(e.sampleIndex), 2)
+	b.writeBool(padded)
+	b.write(0, 1) // private
+	if e.opts.Channels == 1 {
+		b.write(3, 2) // single channel
+	} else {
+		b.write(0, 2) // stereo
+	}
+	b.write(0, 2) // mode extension
+	b.write(0, 1) // copyright
+	b.write(1, 1) // original
+	b.write(0, 2) // emphasis
+}
+
+// writeSideInfo writes the side information, which tells the decoder how to read the main data.
+func (e *Encoder) writeSideInfo(b *bitWriter, gr *[2][2]*granule) {
+	channels := e.opts.Channels
+
+	if e.version == mp3tables.MPEG1 {
+		b.write(0, 9) // main_data_begin
+		if channels == 1 {
+			b.write(0, 5)
+		} else {
+			b.write(0, 3)
+		}
+		b.write(0, uint(4*channels)) // scfsi
+	} else {
+		b.write(0, 8) // main_data_begin
+		b.write(0, uint(channels))
+	}
+
+	for g := 0; g < e.granules; g++ {
+		for ch := 0; ch < channels; ch++ {
+			info := gr[g][ch]
+
+			b.write(uint64(info.part23), 12)
+			b.write(uint64(info.bigValues), 9)
+			b.write(uint64(info.globalGain), 8)
+			if e.version == mp3tables.MPEG1 {
+				b.write(0, 4) // scalefac_compress
+			} else {
+				b.write(0, 9)
+			}
+			b.write(0, 1) // window_switching_flag
+			for _, t := range info.tables {
+				b.write(uint64(t), 5)
+			}
+			b.write(uint64(info.region0), 4)
+			b.write(uint64(info.region1), 3)
+			if e.version == mp3tables.MPEG1 {
+				b.write(0, 1) // preflag
+			}
+			b.write(0, 1) // scalefac_scale
+			b.writeBool(info.count1B)
+		}
+	}
+}
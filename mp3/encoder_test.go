@@ -0,0 +1,211 @@
+package mp3
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3test"
+)
+
+// testSignal returns interleaved samples of a few tones with a slowly changing level, with a different
+// tone in each channel.
+func testSignal(sampleRate, channels, n int) []int16 {
+	samples := make([]int16, n*channels)
+	for i := 0; i < n; i++ {
+		t := float64(i) / float64(sampleRate)
+		level := 0.3 + 0.2*math.Sin(2*math.Pi*3*t)
+		for ch := 0; ch < channels; ch++ {
+			f := 220 * float64(ch+1)
+			v := math.Sin(2*math.Pi*f*t) + 0.5*math.Sin(2*math.Pi*3*f*t+1) + 0.25*math.Sin(2*math.Pi*7*f*t+2)
+			samples[i*channels+ch] = int16(v / 1.75 * level * 32767)
+		}
+	}
+
+	return samples
+}
+
+func encode(t *testing.T, opts *Options, samples []int16) []byte {
+	var buf bytes.Buffer
+	e, err := NewEncoder(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels := opts.Channels
+	if channels == 0 {
+		channels = 1
+	}
+
+	// Write in uneven pieces to exercise the buffering.
+	for len(samples) != 0 {
+		n := 1000 * channels
+		if n > len(samples) {
+			n = len(samples)
+		}
+		if err := e.WriteSamples(samples[:n]); err != nil {
+			t.Fatal(err)
+		}
+		samples = samples[n:]
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestEncoder(t *testing.T) {
+	for _, tt := range []struct {
+		opts   Options
+		minSNR float64
+	}{
+		{Options{SampleRate: 8000, Bitrate: 16}, 30},
+		{Options{SampleRate: 16000, Bitrate: 32}, 30},
+		{Options{SampleRate: 22050}, 35},
+		{Options{SampleRate: 22050, Channels: 2, Bitrate: 96}, 35},
+		{Options{SampleRate: 44100, Bitrate: 64}, 35},
+		{Options{SampleRate: 48000, Channels: 2, Bitrate: 128}, 35},
+	} {
+		tt := tt
+		channels := tt.opts.Channels
+		if channels == 0 {
+			channels = 1
+		}
+		n := tt.opts.SampleRate / 2
+		in := testSignal(tt.opts.SampleRate, channels, n)
+
+		data := encode(t, &tt.opts, in)
+
+		var d mp3test.Decoder
+		out, err := d.Decode(data)
+		if err != nil {
+			t.Errorf("%+v: decoding: %v", tt.opts, err)
+			continue
+		}
+
+		bitrate := tt.opts.Bitrate
+		if bitrate == 0 {
+			bitrate = DefaultBitrate(tt.opts.SampleRate, channels)
+		}
+		for i, f := range d.Frames {
+			if f.SampleRate != tt.opts.SampleRate || f.Channels != channels || f.Bitrate != bitrate {
+				t.Errorf("%+v: frame %d: header %+v", tt.opts, i, f)
+				break
+			}
+		}
+
+		if len(out)/channels < n+Delay {
+			t.Errorf("%+v: decoded %d samples per channel, want at least %d", tt.opts, len(out)/channels, n+Delay)
+			continue
+		}
+
+		duration := float64(len(out)/channels) / float64(tt.opts.SampleRate)
+		if got := float64(len(data)) * 8 / duration / 1000; math.Abs(got-float64(bitrate)) > 0.5 {
+			t.Errorf("%+v: average bitrate is %.2f kbit/s", tt.opts, got)
+		}
+
+		var signal, noise float64
+		for i := range in {
+			x := float64(in[i]) / 32768
+			e := out[i+Delay*channels] - x
+			signal += x * x
+			noise += e * e
+		}
+		if snr := 10 * math.Log10(signal/noise); snr < tt.minSNR {
+			t.Errorf("%+v: SNR is %.1f dB, want at least %.1f dB", tt.opts, snr, tt.minSNR)
+		} else {
+			t.Logf("%+v: SNR is %.1f dB", tt.opts, snr)
+		}
+	}
+}
+
+func TestEncoderSilence(t *testing.T) {
+	data := encode(t, &Options{SampleRate: 22050}, make([]int16, 22050))
+
+	var d mp3test.Decoder
+	out, err := d.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range out {
+		if v != 0 {
+			t.Fatalf("sample %d is %v", i, v)
+		}
+	}
+}
+
+func TestEncoderLoud(t *testing.T) {
+	// A full scale square wave needs the largest quantized values.
+	in := make([]int16, 8820)
+	for i := range in {
+		in[i] = math.MaxInt16
+		if i/50%2 == 1 {
+			in[i] = math.MinInt16
+		}
+	}
+
+	data := encode(t, &Options{SampleRate: 44100, Bitrate: 320}, in)
+
+	var d mp3test.Decoder
+	if _, err := d.Decode(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncoderNoise(t *testing.T) {
+	// White noise at the lowest bitrate needs large steps to fit in each frame.
+	r := rand.New(rand.NewSource(1))
+	in := make([]int16, 8000)
+	for i := range in {
+		in[i] = int16(r.Intn(1<<16) - 1<<15)
+	}
+
+	data := encode(t, &Options{SampleRate: 8000, Bitrate: 8}, in)
+
+	var d mp3test.Decoder
+	if _, err := d.Decode(data); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(data), len(d.Frames)*72; got != want {
+		t.Errorf("%d bytes in %d frames, want %d", got, len(d.Frames), want)
+	}
+}
+
+func TestNewEncoderErrors(t *testing.T) {
+	for _, opts := range []Options{
+		{SampleRate: 22050, Channels: 3},
+		{SampleRate: 22000},
+		{SampleRate: 22050, Bitrate: 320},
+		{SampleRate: 44100, Bitrate: 8},
+	} {
+		if _, err := NewEncoder(new(bytes.Buffer), &opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestNearestSampleRate(t *testing.T) {
+	for rate, want := range map[int]int{
+		1:      8000,
+		8000:   8000,
+		10000:  11025,
+		22050:  22050,
+		23024:  22050,
+		23025:  24000,
+		96000:  48000,
+		192000: 48000,
+	} {
+		if got := NearestSampleRate(rate); got != want {
+			t.Errorf("NearestSampleRate(%d) = %d, want %d", rate, got, want)
+		}
+	}
+
+	for _, rate := range SampleRates() {
+		if len(Bitrates(rate)) != 14 || DefaultBitrate(rate, 1) == 0 {
+			t.Errorf("sample rate %d is not fully supported", rate)
+		}
+	}
+}
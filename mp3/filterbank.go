@@ -0,0 +1,106 @@
+package mp3
+
+import (
+	"math"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3tables"
+)
+
+// The window of the analysis filterbank and the alias reduction coefficients are in
+// internal/mp3tables, since the decoder in the tests needs them too.
+var (
+	analysisMatrix [32][64]float64
+
+	mdctWindow [36]float64
+	mdctMatrix [18][36]float64
+)
+
+// mdctScale undoes the gain of the inverse MDCT in decoders, which is not normalized.
+const mdctScale = 1.0 / 9
+
+func init() {
+	for i := range analysisMatrix {
+		for k := range analysisMatrix[i] {
+			analysisMatrix[i][k] = math.Cos(float64((2*i+1)*(k-16)) * math.Pi / 64)
+		}
+	}
+
+	for n := range mdctWindow {
+		mdctWindow[n] = math.Sin(math.Pi / 36 * (float64(n) + 0.5))
+	}
+	for k := range mdctMatrix {
+		for n := range mdctMatrix[k] {
+			mdctMatrix[k][n] = mdctScale * mdctWindow[n] * math.Cos(math.Pi/72*float64((2*n+1+18)*(2*k+1)))
+		}
+	}
+}
+
+// channel holds the state of the filterbank for one channel.
+type channel struct {
+	x    [512]float64 // most recent input samples, newest first
+	prev [32][18]float64
+}
+
+// analyze shifts 32 samples into the filterbank and returns one sample of each subband.
+func (c *channel) analyze(in []float64, out *[32]float64) {
+	copy(c.x[32:], c.x[:480])
+	for i, v := range in {
+		c.x[31-i] = v
+	}
+
+	var y [64]float64
+	for k := range y {
+		for j := 0; j < 8; j++ {
+			y[k] += mp3tables.Window[k+64*j] * c.x[k+64*j]
+		}
+	}
+
+	for i := range out {
+		var s float64
+		for k, m := range analysisMatrix[i] {
+			s += m * y[k]
+		}
+		out[i] = s
+	}
+}
+
+// granule converts 576 samples to 576 frequency lines.
+func (c *channel) granule(in []float64, xr *[576]float64) {
+	var sb [18][32]float64
+	for t := range sb {
+		c.analyze(in[t*32:t*32+32], &sb[t])
+	}
+
+	for band := 0; band < 32; band++ {
+		var z [36]float64
+		copy(z[:18], c.prev[band][:])
+		for t := 0; t < 18; t++ {
+			v := sb[t][band]
+			if band%2 == 1 && t%2 == 1 {
+				// frequency inversion, which the decoder undoes
+				v = -v
+			}
+			z[18+t] = v
+			c.prev[band][t] = v
+		}
+
+		for k := 0; k < 18; k++ {
+			var s float64
+			for n, m := range mdctMatrix[k] {
+				s += m * z[n]
+			}
+			xr[band*18+k] = s
+		}
+	}
+
+	// The decoder rotates pairs of lines on either side of each subband boundary to reduce aliasing,
+	// so the encoder applies the opposite rotation.
+	for band := 0; band < 31; band++ {
+		for i := 0; i < 8; i++ {
+			lo, hi := band*18+17-i, (band+1)*18+i
+			a, b := xr[lo], xr[hi]
+			xr[lo] = a*mp3tables.AliasCS[i] + b*mp3tables.AliasCA[i]
+			xr[hi] = b*mp3tables.AliasCS[i] - a*mp3tables.AliasCA[i]
+		}
+	}
+}
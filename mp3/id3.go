@@ -0,0 +1,155 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// Tag is an ID3v2.3 tag, which players read from the start of an MP3 file. Empty fields are left out.
+type Tag struct {
+	Title   string // TIT2
+	Artist  string // TPE1
+	Encoder string // TSSE, the software and settings used for encoding
+	Comment string // COMM
+
+	// Chapters are written as CHAP frames with a table of contents, as used by podcast players.
+	Chapters []Chapter
+}
+
+// Chapter is a section of the audio with a title.
+type Chapter struct {
+	Start, End time.Duration
+	Title      string
+}
+
+// Text encodings of ID3v2.3 frames.
+const (
+	latin1Encoding = 0
+	utf16Encoding  = 1
+)
+
+// maxChapters is the largest number of entries in a table of contents.
+const maxChapters = 255
+
+// WriteTo writes the tag to w. It is written before the first frame of audio.
+func (t *Tag) WriteTo(w io.Writer) (int64, error) {
+	if len(t.Chapters) > maxChapters {
+		return 0, errors.New("mp3: too many chapters")
+	}
+
+	var frames bytes.Buffer
+	for _, f := range []struct {
+		id, text string
+	}{
+		{"TIT2", t.Title},
+		{"TPE1", t.Artist},
+		{"TSSE", t.Encoder},
+	} {
+		if f.text != "" {
+			writeFrame(&frames, f.id, textFrame(f.text))
+		}
+	}
+
+	if t.Comment != "" {
+		// The empty description and the text share one encoding.
+		enc, text := encodeText(t.Comment)
+		body := []byte{enc, 'e', 'n', 'g', 0}
+		if enc == utf16Encoding {
+			body = append(body[:4], 0xff, 0xfe, 0, 0)
+		}
+
+		writeFrame(&frames, "COMM", append(body, text...))
+	}
+
+	if len(t.Chapters) != 0 {
+		toc := []byte("toc\x00")
+		toc = append(toc, 0x03, byte(len(t.Chapters))) // top-level and ordered
+
+		for i, c := range t.Chapters {
+			id := "chp" + strconv.Itoa(i)
+			toc = append(toc, id...)
+			toc = append(toc, 0)
+
+			body := append([]byte(id), 0)
+			for _, v := range []uint32{
+				uint32(c.Start / time.Millisecond),
+				uint32(c.End / time.Millisecond),
+				0xffffffff, // byte offsets are unknown
+				0xffffffff,
+			} {
+				body = append(body, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			}
+
+			if c.Title != "" {
+				var sub bytes.Buffer
+				writeFrame(&sub, "TIT2", textFrame(c.Title))
+				body = append(body, sub.Bytes()...)
+			}
+
+			writeFrame(&frames, "CHAP", body)
+		}
+
+		writeFrame(&frames, "CTOC", toc)
+	}
+
+	size := frames.Len()
+	if size >= 1<<28 {
+		return 0, errors.New("mp3: tag too large")
+	}
+
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(frames.Bytes())
+	return int64(n + m), err
+}
+
+// writeFrame writes an ID3v2.3 frame, whose size is not syncsafe, unlike the size of the tag.
+func writeFrame(buf *bytes.Buffer, id string, body []byte) {
+	buf.WriteString(id)
+	binary.Write(buf, binary.BigEndian, uint32(len(body)))
+	buf.Write([]byte{0, 0}) // flags
+	buf.Write(body)
+}
+
+// textFrame returns the body of a text information frame.
+func textFrame(s string) []byte {
+	enc, text := encodeText(s)
+	return append([]byte{enc}, text...)
+}
+
+// encodeText returns the encoding byte and the encoded form of s. Text is written in ISO-8859-1 if
+// possible, and otherwise in UTF-16 with a byte order mark, since ID3v2.3 has no UTF-8 encoding.
+func encodeText(s string) (byte, []byte) {
+	latin1 := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return encodeUTF16(s)
+		}
+		latin1 = append(latin1, byte(r))
+	}
+
+	return latin1Encoding, latin1
+}
+
+func encodeUTF16(s string) (byte, []byte) {
+	units := utf16.Encode([]rune(s))
+
+	text := make([]byte, 2, 2+2*len(units))
+	binary.LittleEndian.PutUint16(text, 0xfeff)
+	for _, u := range units {
+		text = append(text, byte(u), byte(u>>8))
+	}
+
+	return utf16Encoding, text
+}
@@ -0,0 +1,104 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// parseFrames splits the frames of an ID3v2.3 tag or of a CHAP frame.
+func parseFrames(t *testing.T, b []byte) []id3Frame {
+	var frames []id3Frame
+	for len(b) != 0 {
+		if len(b) < 10 {
+			t.Fatalf("short frame header: %q", b)
+		}
+		size := int(binary.BigEndian.Uint32(b[4:]))
+		if len(b) < 10+size {
+			t.Fatalf("frame %q is truncated", b[:4])
+		}
+		frames = append(frames, id3Frame{string(b[:4]), b[10 : 10+size]})
+		b = b[10+size:]
+	}
+	return frames
+}
+
+func TestTag(t *testing.T) {
+	tag := &Tag{
+		Title:   "Café",
+		Artist:  "en-us",
+		Encoder: "test",
+		Comment: "日本語",
+		Chapters: []Chapter{
+			{0, 1500 * time.Millisecond, "One"},
+			{1500 * time.Millisecond, 2 * time.Second, ""},
+		},
+	}
+
+	var buf bytes.Buffer
+	n, err := tag.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if n != int64(len(b)) {
+		t.Errorf("WriteTo returned %d, but wrote %d bytes", n, len(b))
+	}
+
+	if !bytes.Equal(b[:6], []byte{'I', 'D', '3', 3, 0, 0}) {
+		t.Fatalf("header is %q", b[:6])
+	}
+	size := int(b[6])<<21 | int(b[7])<<14 | int(b[8])<<7 | int(b[9])
+	if size != len(b)-10 {
+		t.Fatalf("tag size is %d, want %d", size, len(b)-10)
+	}
+
+	frames := parseFrames(t, b[10:])
+	var ids []string
+	for _, f := range frames {
+		ids = append(ids, f.id)
+	}
+	if want := []string{"TIT2", "TPE1", "TSSE", "COMM", "CHAP", "CHAP", "CTOC"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("frames are %q, want %q", ids, want)
+	}
+
+	if got, want := frames[0].body, []byte("\x00Caf\xe9"); !bytes.Equal(got, want) {
+		t.Errorf("TIT2 is %q, want %q", got, want)
+	}
+	if got, want := frames[3].body, []byte("\x01eng\xff\xfe\x00\x00\xff\xfe\xe5\x65\x2c\x67\x9e\x8a"); !bytes.Equal(got, want) {
+		t.Errorf("COMM is %q, want %q", got, want)
+	}
+
+	chap := frames[4].body
+	if !bytes.HasPrefix(chap, []byte("chp0\x00")) {
+		t.Fatalf("CHAP is %q", chap)
+	}
+	times := chap[5:21]
+	if got, want := times, []byte{0, 0, 0, 0, 0, 0, 5, 220, 255, 255, 255, 255, 255, 255, 255, 255}; !bytes.Equal(got, want) {
+		t.Errorf("CHAP times are %v, want %v", got, want)
+	}
+	if sub := parseFrames(t, chap[21:]); len(sub) != 1 || sub[0].id != "TIT2" || string(sub[0].body) != "\x00One" {
+		t.Errorf("CHAP subframes are %q", sub)
+	}
+	if len(frames[5].body) != 21 {
+		t.Errorf("untitled CHAP is %q", frames[5].body)
+	}
+
+	if got, want := frames[6].body, []byte("toc\x00\x03\x02chp0\x00chp1\x00"); !bytes.Equal(got, want) {
+		t.Errorf("CTOC is %q, want %q", got, want)
+	}
+}
+
+func TestTagTooManyChapters(t *testing.T) {
+	tag := &Tag{Chapters: make([]Chapter, maxChapters+1)}
+	if _, err := tag.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,290 @@
+package mp3
+
+import (
+	"math"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3tables"
+)
+
+const (
+	// maxValue is the largest quantized value that can be coded, with 13 linbits in table 23.
+	maxValue = 15 + 1<<13 - 1
+
+	// maxPart23 is the largest number of bits of main data in a granule.
+	maxPart23 = 1<<12 - 1
+)
+
+// granule is a quantized channel of a granule, with the side information needed to decode it.
+type granule struct {
+	ix   [576]int
+	sign [576]bool
+
+	part23     int // number of bits of Huffman coded data
+	bigValues  int // number of pairs coded with the big value tables
+	count1     int // number of quadruples coded with a count1 table
+	globalGain int
+	tables     [3]int
+	region0    int // region0_count
+	region1    int // region1_count
+	count1B    bool
+}
+
+// quantize codes a channel of a granule in at most budget bits. The step size is the same for every
+// line, since this encoder has no psychoacoustic model and leaves the scale factors at zero.
+func quantize(xr *[576]float64, budget int, sfb *[23]int) *granule {
+	g := &granule{}
+	if budget > maxPart23 {
+		budget = maxPart23
+	}
+
+	var xr34 [576]float64
+	var peak float64
+	for i, v := range xr {
+		g.sign[i] = v < 0
+		xr34[i] = math.Pow(math.Abs(v), 0.75)
+		peak = math.Max(peak, xr34[i])
+	}
+
+	if peak == 0 {
+		g.globalGain = 210
+		return g
+	}
+
+	// Larger gains mean larger steps and fewer bits, so find the smallest gain that fits.
+	lo, hi := 0, 255
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if g.try(&xr34, mid, sfb) <= budget {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	g.try(&xr34, lo, sfb)
+	return g
+}
+
+// try quantizes with the given global gain and returns the number of bits needed, or a number larger
+// than any budget if some value is too large to code.
+func (g *granule) try(xr34 *[576]float64, gain int, sfb *[23]int) int {
+	g.globalGain = gain
+
+	// The decoder computes |ix|^(4/3) * 2^((gain-210)/4). The rounding offset of 0.4054 instead of
+	// 0.5 accounts for the curve of the power function.
+	scale := math.Pow(2, -float64(gain-210)*3/16)
+	for i, v := range xr34 {
+		q := v*scale + 0.4054
+		if q > maxValue {
+			return math.MaxInt32
+		}
+		g.ix[i] = int(q)
+	}
+
+	g.part23 = g.countBits(sfb)
+	return g.part23
+}
+
+// countBits divides the lines into regions, chooses Huffman tables, and returns the number of bits.
+func (g *granule) countBits(sfb *[23]int) int {
+	// Trailing zeros are not coded, then values of at most 1 are coded in quadruples, and the rest in
+	// pairs.
+	i := 576
+	for i > 1 && g.ix[i-1] == 0 && g.ix[i-2] == 0 {
+		i -= 2
+	}
+
+	g.count1 = 0
+	for i > 3 && g.ix[i-1] <= 1 && g.ix[i-2] <= 1 && g.ix[i-3] <= 1 && g.ix[i-4] <= 1 {
+		g.count1++
+		i -= 4
+	}
+	g.bigValues = i / 2
+
+	bits := 0
+
+	countA, countB := 0, 0
+	for q := 0; q < g.count1; q++ {
+		v := g.ix[i+4*q : i+4*q+4]
+		idx := v[0]<<3 | v[1]<<2 | v[2]<<1 | v[3]
+		nonzero := v[0] + v[1] + v[2] + v[3]
+		countA += int(mp3tables.Count1LensA[idx]) + nonzero
+		countB += 4 + nonzero
+	}
+	g.count1B = countB < countA
+	if g.count1B {
+		bits += countB
+	} else {
+		bits += countA
+	}
+
+	end := g.bigValues * 2
+	band := 0
+	for band < 22 && sfb[band+1] < end {
+		band++
+	}
+
+	g.region0, g.region1 = subdivision[band][0], subdivision[band][1]
+	for g.region0 > 0 && sfb[g.region0+1] > end {
+		g.region0--
+	}
+	for g.region1 > 0 && sfb[g.region0+g.region1+2] > end {
+		g.region1--
+	}
+
+	a1, a2 := g.regionBounds(sfb)
+	for r, bounds := range [3][2]int{{0, a1}, {a1, a2}, {a2, end}} {
+		t, n := chooseTable(g.ix[bounds[0]:bounds[1]])
+		g.tables[r] = t
+		bits += n
+	}
+
+	return bits
+}
+
+// regionBounds returns the indices of the first lines of region1 and region2, as a decoder computes
+// them.
+func (g *granule) regionBounds(sfb *[23]int) (int, int) {
+	end := g.bigValues * 2
+
+	a1, a2 := sfb[g.region0+1], sfb[g.region0+g.region1+2]
+	if a1 > end {
+		a1 = end
+	}
+	if a2 > end {
+		a2 = end
+	}
+
+	return a1, a2
+}
+
+// chooseTable returns the table that codes ix in the fewest bits, and that number of bits.
+func chooseTable(ix []int) (int, int) {
+	max := 0
+	for _, v := range ix {
+		if v > max {
+			max = v
+		}
+	}
+
+	if max == 0 {
+		return 0, 0
+	}
+
+	best, bestBits := 0, math.MaxInt32
+	for t, h := range mp3tables.HuffTables {
+		if h == nil {
+			continue
+		}
+
+		if h.Linbits == 0 && max >= h.XLen {
+			continue
+		}
+		if h.Linbits != 0 && max-15 >= 1<<h.Linbits {
+			continue
+		}
+		if h.Linbits != 0 && t != 16 && max-15 < 1<<mp3tables.HuffTables[t-1].Linbits {
+			// A table with fewer linbits is enough.
+			continue
+		}
+
+		if bits := countPairs(h, ix); bits < bestBits {
+			best, bestBits = t, bits
+		}
+	}
+
+	return best, bestBits
+}
+
+// countPairs returns the number of bits needed to code the pairs in ix with table h.
+func countPairs(h *mp3tables.HuffTable, ix []int) int {
+	bits := 0
+
+	for i := 0; i+1 < len(ix); i += 2 {
+		x, y := ix[i], ix[i+1]
+		if x >= 15 && h.Linbits != 0 {
+			bits += int(h.Linbits)
+			x = 15
+		}
+		if y >= 15 && h.Linbits != 0 {
+			bits += int(h.Linbits)
+			y = 15
+		}
+		if x != 0 {
+			bits++
+		}
+		if y != 0 {
+			bits++
+		}
+
+		bits += int(h.Lens[x*h.XLen+y])
+	}
+
+	return bits
+}
+
+// encode writes the Huffman coded lines of the granule.
+func (g *granule) encode(b *bitWriter, sfb *[23]int) {
+	a1, a2 := g.regionBounds(sfb)
+	end := g.bigValues * 2
+
+	for i := 0; i < end; i += 2 {
+		var t int
+		switch {
+		case i < a1:
+			t = g.tables[0]
+		case i < a2:
+			t = g.tables[1]
+		default:
+			t = g.tables[2]
+		}
+		if t == 0 {
+			continue
+		}
+
+		h := mp3tables.HuffTables[t]
+		x, y := g.ix[i], g.ix[i+1]
+		cx, cy := x, y
+		if h.Linbits != 0 {
+			if cx > 15 {
+				cx = 15
+			}
+			if cy > 15 {
+				cy = 15
+			}
+		}
+
+		idx := cx*h.XLen + cy
+		b.write(uint64(h.Codes[idx]), uint(h.Lens[idx]))
+
+		if cx == 15 && h.Linbits != 0 {
+			b.write(uint64(x-15), h.Linbits)
+		}
+		if x != 0 {
+			b.writeBool(g.sign[i])
+		}
+		if cy == 15 && h.Linbits != 0 {
+			b.write(uint64(y-15), h.Linbits)
+		}
+		if y != 0 {
+			b.writeBool(g.sign[i+1])
+		}
+	}
+
+	for q := 0; q < g.count1; q++ {
+		v := g.ix[end+4*q : end+4*q+4]
+		idx := v[0]<<3 | v[1]<<2 | v[2]<<1 | v[3]
+
+		if g.count1B {
+			b.write(uint64(15-idx), 4)
+		} else {
+			b.write(uint64(mp3tables.Count1CodesA[idx]), uint(mp3tables.Count1LensA[idx]))
+		}
+
+		for j, x := range v {
+			if x != 0 {
+				b.writeBool(g.sign[end+4*q+j])
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3test"
+)
+
+func TestWriteMP3(t *testing.T) {
+	// 20000 Hz is not an MP3 sample rate, so the audio is resampled to 22050 Hz.
+	ctx := espeak.Context{Engine: espeaktest.New(20000)}
+	text := `Hello, world. <mark name="question"/>How are you? I am fine.`
+	if err := ctx.SynthesizeText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := ctx.WriteMP3(&buf, &espeak.MP3Options{
+		Info: &espeak.WAVInfo{Title: "greeting"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteMP3 returned %d, but wrote %d bytes", n, buf.Len())
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("ID3\x03")) {
+		t.Fatal("missing ID3v2.3 tag")
+	}
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	tag, audio := data[:10+size], data[10+size:]
+
+	for _, s := range []string{"TIT2", "greeting", espeak.Software, "CHAP", "CTOC", "Hello, world.", "How are you?", "I am fine."} {
+		if !bytes.Contains(tag, []byte(s)) {
+			t.Errorf("tag does not contain %q", s)
+		}
+	}
+	if bytes.Contains(tag, []byte("mark")) {
+		t.Error("chapter title contains markup")
+	}
+
+	// MPEG-2, Layer III, no CRC, 48 kbit/s, 22050 Hz, mono
+	if len(audio) < 4 || audio[0] != 0xff || audio[1] != 0xf3 || audio[2]&0xfc != 0x60 || audio[3]&0xc0 != 0xc0 {
+		t.Fatalf("first frame header is % x", audio[:4])
+	}
+
+	// Each frame holds 576 samples in at least 156 bytes.
+	duration := float64(len(ctx.Samples)) / 20000
+	if min := int(duration*22050/576) * 156; len(audio) < min {
+		t.Errorf("%d bytes of audio for %.2f seconds, want at least %d", len(audio), duration, min)
+	}
+}
+
+func TestWriteMP3ChapterDelay(t *testing.T) {
+	ctx := synthesize(t, 22050, `<break time="1s"/>Hello.`)
+
+	var buf bytes.Buffer
+	if _, err := ctx.WriteMP3(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	tag, audio := data[:10+size], data[10+size:]
+
+	// The CHAP frame header is followed by the element ID and the start time in milliseconds.
+	i := bytes.Index(tag, []byte("CHAP\x00"))
+	if i == -1 {
+		t.Fatal("missing chapter")
+	}
+	body := tag[i+10:]
+	body = body[bytes.IndexByte(body, 0)+1:]
+	start := time.Duration(binary.BigEndian.Uint32(body)) * time.Millisecond
+
+	var d mp3test.Decoder
+	samples, err := d.Decode(audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sentence starts where the tone first reaches half of its level.
+	var peak float64
+	for _, v := range samples {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	onset := -1
+	for i, v := range samples {
+		if math.Abs(v) >= peak/2 {
+			onset = i
+			break
+		}
+	}
+	heard := time.Duration(onset) * time.Second / 22050
+
+	if diff := start - heard; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+		t.Errorf("chapter starts at %v, but the sentence is heard at %v", start, heard)
+	}
+}
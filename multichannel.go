@@ -0,0 +1,393 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// MultiChannel is audio with more than one channel, such as a stereo mix made by Timeline.RenderLayout,
+// Context.Pan, or Context.PanVoices. Most of this package works with mono audio in a Context, so MultiChannel only holds
+// the finished audio for writing, and Downmix turns it back into a Context.
+type MultiChannel struct {
+	// Layout is the speaker of each channel.
+	Layout Layout
+
+	// Samples holds a frame for each point in time, one after another. Each frame has a sample for each
+	// channel, in the order of the speakers in Layout.
+	Samples []int16
+
+	// SampleRate is the number of frames per second.
+	SampleRate int
+
+	// Events and Text are the same as in a Context, with AudioPosition measured from the first frame.
+	Events []*SynthEvent
+	Text   string
+}
+
+// Pan places the audio of this Context in a layout, as a sound coming from pan, which goes from -1 for
+// the left of the front speakers to 1 for the right. Each channel gets a share of the audio chosen so
+// that the sound is equally loud at every position. Pan panics if the layout is empty.
+func (ctx *Context) Pan(layout Layout, pan float64) *MultiChannel {
+	if !layout.valid() {
+		panic("espeak: Context.Pan: invalid layout")
+	}
+
+	gains := layout.panGains(pan)
+	m := &MultiChannel{
+		Layout:     layout,
+		Samples:    make([]int16, len(ctx.Samples)*len(gains)),
+		SampleRate: ctx.SampleRate(),
+		Events:     make([]*SynthEvent, len(ctx.Events)),
+		Text:       ctx.Text,
+	}
+
+	for i, v := range ctx.Samples {
+		for c, g := range gains {
+			m.Samples[i*len(gains)+c] = clip16(float64(v) * g)
+		}
+	}
+	for i, e := range ctx.Events {
+		copied := *e
+		m.Events[i] = &copied
+	}
+
+	return m
+}
+
+// PanVoices is like Pan, but places the audio of each SSML <voice> element in the Text of this Context
+// on its own, at the position that pan returns for the properties in the attributes of the element, so
+// that the speakers of a dialogue can stand apart. Nested <voice> elements keep the properties of the
+// element around them that they do not set, and text outside of any <voice> element uses the voice of
+// the Context.
+//
+// The voice of the audio changes at the first word, sentence, or <audio> element that is inside the new
+// voice, crossfading over 10ms. pan is called once for each change. PanVoices panics if the layout is
+// empty.
+func (ctx *Context) PanVoices(layout Layout, pan func(voice VoiceProperties) float64) *MultiChannel {
+	if !layout.valid() {
+		panic("espeak: Context.PanVoices: invalid layout")
+	}
+
+	// Find the sample at which each voice starts speaking.
+	type change struct {
+		sample int
+		gains  []float64
+	}
+	var changes []change
+
+	spans := ssmlVoices(ctx.Text, ctx.Settings().Voice)
+	current := -1
+	for _, e := range ctx.Events {
+		if e.Type != EventWord && e.Type != EventSentence && e.Type != EventPlay {
+			continue
+		}
+
+		i := sort.Search(len(spans), func(i int) bool {
+			return spans[i].start > e.TextPosition
+		}) - 1
+		if i < 0 {
+			i = 0
+		}
+		if current != -1 && spans[i].voice == spans[current].voice {
+			continue
+		}
+
+		sample := ctx.sampleAt(e.AudioPosition)
+		if current == -1 {
+			sample = 0
+		}
+		current = i
+		changes = append(changes, change{sample, layout.panGains(pan(spans[i].voice))})
+	}
+	if len(changes) == 0 {
+		changes = append(changes, change{0, layout.panGains(pan(spans[0].voice))})
+	}
+
+	channels := layout.Channels()
+	m := &MultiChannel{
+		Layout:     layout,
+		Samples:    make([]int16, len(ctx.Samples)*channels),
+		SampleRate: ctx.SampleRate(),
+		Events:     make([]*SynthEvent, len(ctx.Events)),
+		Text:       ctx.Text,
+	}
+
+	fade := m.SampleRate / 100
+	gains := make([]float64, channels)
+	for i, v := range ctx.Samples {
+		// The voice crossfades to the next one over the samples before it starts.
+		next := sort.Search(len(changes), func(j int) bool {
+			return changes[j].sample > i
+		})
+		from := changes[next-1].gains
+		copy(gains, from)
+		if next < len(changes) && changes[next].sample-i <= fade {
+			x := float64(fade-(changes[next].sample-i)) / float64(fade)
+			for c, g := range changes[next].gains {
+				gains[c] = from[c]*(1-x) + g*x
+			}
+		}
+
+		for c, g := range gains {
+			m.Samples[i*channels+c] = clip16(float64(v) * g)
+		}
+	}
+	for i, e := range ctx.Events {
+		copied := *e
+		m.Events[i] = &copied
+	}
+
+	return m
+}
+
+// voiceSpan is the voice of the text from the 1-based character position start to the next span.
+type voiceSpan struct {
+	start int
+	voice VoiceProperties
+}
+
+// ssmlVoices returns the voice of each part of text, following the <voice> elements in it. Text outside
+// of any <voice> element is spoken by base.
+func ssmlVoices(text string, base VoiceProperties) []voiceSpan {
+	spans := []voiceSpan{{1, base}}
+	stack := []VoiceProperties{base}
+
+	chars := 0 // characters in text[:i]
+	for i := 0; i < len(text); {
+		start := strings.Index(text[i:], "<")
+		if start == -1 {
+			break
+		}
+		chars += utf8.RuneCountInString(text[i : i+start])
+		i += start
+
+		n := tagLength(text[i:])
+		if n == -1 {
+			i++
+			chars++
+			continue
+		}
+		tag := text[i : i+n]
+		i += n
+		chars += utf8.RuneCountInString(tag)
+
+		switch {
+		case strings.HasPrefix(tag, "</voice") && len(stack) > 1:
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(tag, "<voice") && strings.ContainsRune(" \t\r\n>", rune(tag[len("<voice")])) &&
+			!strings.HasSuffix(tag, "/>"):
+			stack = append(stack, voiceAttrs(tag, stack[len(stack)-1]))
+		default:
+			continue
+		}
+
+		if top := stack[len(stack)-1]; top != spans[len(spans)-1].voice {
+			spans = append(spans, voiceSpan{chars + 1, top})
+		}
+	}
+
+	return spans
+}
+
+// voiceAttrs returns the voice selected by the attributes of an SSML <voice> tag, keeping the properties
+// of outer that the tag does not set.
+func voiceAttrs(tag string, outer VoiceProperties) VoiceProperties {
+	v := outer
+
+	if _, name, ok := tagAttr(tag, "name"); ok {
+		v.Name = html.UnescapeString(name)
+	}
+	if _, lang, ok := tagAttr(tag, "xml:lang"); ok {
+		v.Language = lang
+	}
+	if _, langs, ok := tagAttr(tag, "languages"); ok {
+		// Each language may be followed by the accent to speak it with, as in "en:en-GB".
+		if fields := strings.Fields(langs); len(fields) != 0 {
+			v.Language = strings.SplitN(fields[0], ":", 2)[0]
+		}
+	}
+	if _, gender, ok := tagAttr(tag, "gender"); ok {
+		switch gender {
+		case "male":
+			v.Gender = Male
+		case "female":
+			v.Gender = Female
+		case "neutral":
+			v.Gender = Neutral
+		}
+	}
+	if _, age, ok := tagAttr(tag, "age"); ok {
+		if n, err := strconv.ParseUint(age, 10, 8); err == nil {
+			v.Age = uint8(n)
+		}
+	}
+	if _, variant, ok := tagAttr(tag, "variant"); ok {
+		if n, err := strconv.ParseUint(variant, 10, 8); err == nil {
+			v.Variant = uint8(n)
+		}
+	}
+
+	return v
+}
+
+// Frames returns the number of frames in Samples.
+func (m *MultiChannel) Frames() int {
+	return len(m.Samples) / m.Layout.Channels()
+}
+
+// Duration returns the length of the audio.
+func (m *MultiChannel) Duration() time.Duration {
+	return time.Duration(m.Frames()) * time.Second / time.Duration(m.SampleRate)
+}
+
+// Channel returns a copy of the samples of channel i, which is counted from 0 in the order of the
+// speakers in Layout.
+func (m *MultiChannel) Channel(i int) []int16 {
+	channels := m.Layout.Channels()
+	if i < 0 || i >= channels {
+		panic("espeak: MultiChannel.Channel: channel out of range")
+	}
+
+	samples := make([]int16, m.Frames())
+	for j := range samples {
+		samples[j] = m.Samples[j*channels+i]
+	}
+	return samples
+}
+
+// Downmix mixes the audio down to mono as in ITU-R BS.775: the left and right channels are averaged, the
+// center and surround channels are 3 dB quieter, and the low frequency channel is left out. The result
+// is a new Context that uses DefaultEngine at the sample rate of the audio.
+func (m *MultiChannel) Downmix() *Context {
+	gains := m.Layout.downmixGains()
+
+	ctx := m.context()
+	ctx.Samples = make([]int16, m.Frames())
+	for i := range ctx.Samples {
+		var sum float64
+		for c, g := range gains {
+			sum += float64(m.Samples[i*len(gains)+c]) * g
+		}
+		ctx.Samples[i] = clip16(sum)
+	}
+	for i, e := range ctx.Events {
+		copied := *e
+		ctx.Events[i] = &copied
+	}
+
+	return ctx
+}
+
+// resampleFrames converts interleaved samples with the given number of channels from one sample rate
+// to another, resampling each channel on its own.
+func resampleFrames(samples []int16, channels, from, to int) []int16 {
+	if channels == 1 || from == to {
+		return resample.Resample(samples, from, to)
+	}
+
+	var out []int16
+	frames := len(samples) / channels
+	channel := make([]int16, frames)
+	for c := 0; c < channels; c++ {
+		for i := range channel {
+			channel[i] = samples[i*channels+c]
+		}
+
+		converted := resample.Resample(channel, from, to)
+		if out == nil {
+			out = make([]int16, len(converted)*channels)
+		}
+		for i, v := range converted {
+			out[i*channels+c] = v
+		}
+	}
+
+	return out
+}
+
+// context returns a Context without samples that shares the events and text of m, for metadata.
+func (m *MultiChannel) context() *Context {
+	return &Context{
+		Events:     append([]*SynthEvent(nil), m.Events...),
+		Text:       m.Text,
+		sampleRate: m.SampleRate,
+	}
+}
+
+func (m *MultiChannel) check() error {
+	if !m.Layout.valid() {
+		return fmt.Errorf("espeak: invalid layout %#x", uint32(m.Layout))
+	}
+	if len(m.Samples)%m.Layout.Channels() != 0 {
+		return fmt.Errorf("espeak: %d samples do not fill frames of %d channels", len(m.Samples), m.Layout.Channels())
+	}
+	if m.SampleRate <= 0 {
+		return fmt.Errorf("espeak: invalid sample rate %d", m.SampleRate)
+	}
+
+	return nil
+}
+
+// WriteTo writes the audio to w in WAV format, as Context.WriteTo does. Layouts other than Mono and
+// Stereo are written as WAVE_FORMAT_EXTENSIBLE with their channel mask.
+func (m *MultiChannel) WriteTo(w io.Writer) (int64, error) {
+	return m.WriteWAV(w, nil)
+}
+
+// WriteWAV is like WriteTo, but opts can add metadata to the file, as for Context.WriteWAV.
+func (m *MultiChannel) WriteWAV(w io.Writer, opts *WAVOptions) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+
+	return m.context().writeWAV(w, opts, m.Samples, m.Layout)
+}
+
+// WriteFLAC writes the audio to w in the FLAC format, as Context.WriteFLAC does. FLAC supports up to 8
+// channels. Layouts that FLAC does not assume for their number of channels are recorded in a
+// WAVEFORMATEXTENSIBLE_CHANNEL_MASK comment.
+func (m *MultiChannel) WriteFLAC(w io.Writer, opts *FLACOptions) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+
+	return m.context().writeFLAC(w, opts, m.Samples, m.Layout)
+}
+
+// WriteMP3 writes the audio to w in the MP3 format, as Context.WriteMP3 does. MP3 only holds Mono and
+// Stereo audio, so other layouts return an error; use Downmix or a Stereo mix for them.
+func (m *MultiChannel) WriteMP3(w io.Writer, opts *MP3Options) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+
+	return m.context().writeMP3(w, opts, m.Samples, m.Layout)
+}
+
+// WriteAIFF writes the audio to w in the AIFF format, as Context.WriteAIFF does. Layouts other than
+// Mono and Stereo are recorded in a CHAN chunk, which Apple's software reads.
+func (m *MultiChannel) WriteAIFF(w io.Writer, opts *ContainerOptions) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+
+	return m.context().writeAIFF(w, opts, m.Samples, m.Layout)
+}
+
+// WriteCAF writes the audio to w in Apple's Core Audio Format, as Context.WriteCAF does. Layouts other
+// than Mono and Stereo are recorded in a chan chunk.
+func (m *MultiChannel) WriteCAF(w io.Writer, opts *ContainerOptions) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+
+	return m.context().writeCAF(w, opts, m.Samples, m.Layout)
+}
@@ -0,0 +1,323 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+func TestLayout(t *testing.T) {
+	for _, test := range []struct {
+		layout   espeak.Layout
+		channels int
+	}{
+		{espeak.Mono, 1},
+		{espeak.Stereo, 2},
+		{espeak.Quad, 4},
+		{espeak.Surround51, 6},
+		{espeak.Surround71, 8},
+	} {
+		if got := test.layout.Channels(); got != test.channels {
+			t.Errorf("layout %#x has %d channels, want %d", uint32(test.layout), got, test.channels)
+		}
+		if got := len(test.layout.Speakers()); got != test.channels {
+			t.Errorf("layout %#x has %d speakers, want %d", uint32(test.layout), got, test.channels)
+		}
+	}
+
+	if got := espeak.Surround51.Speakers()[3]; got != espeak.SpeakerLowFrequency {
+		t.Errorf("fourth channel of 5.1 is %#x", uint32(got))
+	}
+}
+
+func TestPan(t *testing.T) {
+	ctx := synthesize(t, 16000, "Hello there.")
+	level := rms(ctx.Samples)
+
+	for _, pan := range []float64{-1, -0.5, 0, 0.25, 1} {
+		m := ctx.Pan(espeak.Stereo, pan)
+		if m.Frames() != len(ctx.Samples) || m.Duration() != ctx.Duration() || len(m.Events) != len(ctx.Events) {
+			t.Errorf("pan %v: %d frames and %d events", pan, m.Frames(), len(m.Events))
+		}
+
+		left, right := rms(m.Channel(0)), rms(m.Channel(1))
+		if power := math.Hypot(left, right); math.Abs(power/level-1) > 0.01 {
+			t.Errorf("pan %v: level %.0f, want %.0f", pan, power, level)
+		}
+		if pan < 0 && left <= right || pan > 0 && left >= right || pan == 0 && math.Abs(left-right) > 1 {
+			t.Errorf("pan %v: left %.0f, right %.0f", pan, left, right)
+		}
+		if pan == -1 && right != 0 || pan == 1 && left != 0 {
+			t.Errorf("pan %v: left %.0f, right %.0f", pan, left, right)
+		}
+	}
+
+	// The center of a surround layout is the center speaker.
+	m := ctx.Pan(espeak.Surround51, 0)
+	for c := range espeak.Surround51.Speakers() {
+		if got := rms(m.Channel(c)); (c == 2) != (got != 0) {
+			t.Errorf("channel %d has level %.0f", c, got)
+		}
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	ctx := synthesize(t, 16000, "Hello there.")
+
+	mono := ctx.Pan(espeak.Stereo, -1).Downmix()
+	if mono.SampleRate() != 16000 || len(mono.Samples) != len(ctx.Samples) || mono.Text != ctx.Text {
+		t.Fatalf("downmix has %d samples at %d Hz", len(mono.Samples), mono.SampleRate())
+	}
+	if ratio := rms(mono.Samples) / rms(ctx.Samples); math.Abs(ratio-0.5) > 0.01 {
+		t.Errorf("hard left is %.3f of the level after downmixing, want 0.5", ratio)
+	}
+
+	if same := ctx.Pan(espeak.Mono, 0).Downmix(); !bytes.Equal(samplesBytes(same.Samples), samplesBytes(ctx.Samples)) {
+		t.Error("mono downmix changed the audio")
+	}
+}
+
+func samplesBytes(samples []int16) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+func TestMultiChannelWAV(t *testing.T) {
+	ctx := synthesize(t, 16000, "Hello there.")
+
+	for _, test := range []struct {
+		layout  espeak.Layout
+		format  espeak.SampleFormat
+		fmtSize int
+	}{
+		{espeak.Stereo, espeak.PCM16, 16},
+		{espeak.Stereo, espeak.Float32, 18},
+		{espeak.Surround51, espeak.PCM16, 40},
+		{espeak.Surround51, espeak.Float32, 40},
+	} {
+		m := ctx.Pan(test.layout, 0.5)
+
+		var buf bytes.Buffer
+		if _, err := m.WriteWAV(&buf, &espeak.WAVOptions{Format: test.format}); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		c, _ := chunks(t, data, 12, riffFormat)
+		fmtChunk := c["fmt "]
+		channels := test.layout.Channels()
+		if len(fmtChunk) != test.fmtSize {
+			t.Errorf("%#x %v: fmt chunk is %d bytes, want %d", uint32(test.layout), test.format, len(fmtChunk), test.fmtSize)
+			continue
+		}
+		if got := int(binary.LittleEndian.Uint16(fmtChunk[2:])); got != channels {
+			t.Errorf("%#x %v: %d channels", uint32(test.layout), test.format, got)
+		}
+		if got, want := int(binary.LittleEndian.Uint16(fmtChunk[12:])), channels*test.format.Size(); got != want {
+			t.Errorf("%#x %v: block align %d, want %d", uint32(test.layout), test.format, got, want)
+		}
+		if test.fmtSize == 40 {
+			if tag := binary.LittleEndian.Uint16(fmtChunk); tag != 0xFFFE {
+				t.Errorf("%#x %v: format tag %#x", uint32(test.layout), test.format, tag)
+			}
+			if mask := binary.LittleEndian.Uint32(fmtChunk[20:]); mask != uint32(test.layout) {
+				t.Errorf("%#x %v: channel mask %#x", uint32(test.layout), test.format, mask)
+			}
+		}
+
+		// Reading the file mixes it down to mono.
+		back := &espeak.Context{Engine: ctx.Engine}
+		if _, err := back.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Errorf("%#x %v: %v", uint32(test.layout), test.format, err)
+		} else if len(back.Samples) != m.Frames() {
+			t.Errorf("%#x %v: read %d samples, want %d", uint32(test.layout), test.format, len(back.Samples), m.Frames())
+		}
+	}
+
+	if _, err := (&espeak.MultiChannel{Layout: espeak.Stereo, Samples: make([]int16, 3), SampleRate: 16000}).WriteTo(&bytes.Buffer{}); err == nil {
+		t.Error("no error for a partial frame")
+	}
+}
+
+func TestMultiChannelFLAC(t *testing.T) {
+	ctx := synthesize(t, 16000, "Hello there.")
+
+	for _, test := range []struct {
+		layout espeak.Layout
+		mask   bool
+	}{
+		{espeak.Stereo, false},
+		{espeak.Surround51, false},
+		{espeak.SpeakerFrontLeft | espeak.SpeakerFrontRight | espeak.SpeakerLowFrequency, true},
+	} {
+		var buf bytes.Buffer
+		if _, err := ctx.Pan(test.layout, 0).WriteFLAC(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		// STREAMINFO starts after the signature and a block header, and has the number of channels
+		// minus one in bits 1 to 3 of its thirteenth byte.
+		if got := int(data[8+12]>>1&7) + 1; got != test.layout.Channels() {
+			t.Errorf("%#x: %d channels", uint32(test.layout), got)
+		}
+		if got := bytes.Contains(data, []byte("WAVEFORMATEXTENSIBLE_CHANNEL_MASK=0xB")); got != test.mask {
+			t.Errorf("%#x: channel mask comment is %v", uint32(test.layout), got)
+		}
+	}
+}
+
+func TestTimelineLayout(t *testing.T) {
+	left := synthesize(t, 16000, "Hello there.")
+	right := synthesize(t, 16000, "General Kenobi.")
+
+	tl := espeak.NewTimeline(16000)
+	a := tl.AddTrack("left")
+	a.Pan = -1
+	a.Place(0, left)
+	b := tl.AddTrack("right")
+	b.Pan = 1
+	b.Place(500*time.Millisecond, right)
+
+	m := tl.RenderLayout(espeak.Stereo)
+	if m.Layout != espeak.Stereo || m.SampleRate != 16000 || len(m.Events) != len(left.Events)+len(right.Events) {
+		t.Fatalf("rendered %#x at %d Hz with %d events", uint32(m.Layout), m.SampleRate, len(m.Events))
+	}
+
+	l, r := m.Channel(0), m.Channel(1)
+	if !bytes.Equal(samplesBytes(l[:len(left.Samples)]), samplesBytes(left.Samples)) {
+		t.Error("left channel is not the left track")
+	}
+	start := int(500 * time.Millisecond * 16000 / time.Second)
+	if !bytes.Equal(samplesBytes(r[start:start+len(right.Samples)]), samplesBytes(right.Samples)) {
+		t.Error("right channel is not the right track")
+	}
+}
+
+func TestPanVoices(t *testing.T) {
+	const text = `<speak>Narrator. <voice name="alice" gender="female">Hello there. <voice age="30">Nested.</voice></voice>` +
+		`<voice name="bob" languages="en:en-GB" variant="2">General Kenobi.</voice></speak>`
+	ctx := synthesize(t, 16000, text)
+
+	var voices []espeak.VoiceProperties
+	m := ctx.PanVoices(espeak.Stereo, func(voice espeak.VoiceProperties) float64 {
+		voices = append(voices, voice)
+		switch voice.Name {
+		case "alice":
+			return -1
+		case "bob":
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	narrator := ctx.Settings().Voice
+	alice, bob := narrator, narrator
+	alice.Name, alice.Gender = "alice", espeak.Female
+	nested := alice
+	nested.Age = 30
+	bob.Name, bob.Language, bob.Variant = "bob", "en", 2
+
+	if want := []espeak.VoiceProperties{narrator, alice, nested, bob}; !reflect.DeepEqual(voices, want) {
+		t.Errorf("voices are %+v, want %+v", voices, want)
+	}
+
+	// Each word is only in the channels of its voice, away from the crossfades between voices.
+	words := map[string]func(left, right float64) bool{
+		"Narrator": func(left, right float64) bool { return math.Abs(left-right) < 1 },
+		"Hello":    func(left, right float64) bool { return right == 0 && left != 0 },
+		"Nested":   func(left, right float64) bool { return right == 0 && left != 0 },
+		"General":  func(left, right float64) bool { return left == 0 && right != 0 },
+	}
+	checked := 0
+	for i, e := range m.Events {
+		if e.Type != espeak.EventWord {
+			continue
+		}
+		word := string([]rune(m.Text)[e.TextPosition-1 : e.TextPosition-1+e.Length])
+		check, ok := words[word]
+		if !ok {
+			continue
+		}
+		checked++
+
+		start := int(e.AudioPosition * 16000 / time.Second)
+		end := int(m.Events[i+1].AudioPosition * 16000 / time.Second)
+		var left, right float64
+		for j := start + 160; j < end-160; j++ {
+			left += math.Abs(float64(m.Samples[2*j]))
+			right += math.Abs(float64(m.Samples[2*j+1]))
+		}
+		if !check(left, right) {
+			t.Errorf("%q: left %.0f, right %.0f", word, left, right)
+		}
+	}
+	if checked != len(words) {
+		t.Errorf("found %d of the %d words", checked, len(words))
+	}
+}
+
+func TestMultiChannelContainers(t *testing.T) {
+	ctx := synthesize(t, 16000, "Hello there.")
+
+	var buf bytes.Buffer
+	if _, err := ctx.Pan(espeak.Stereo, 0.5).WriteMP3(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	if audio := data[10+size:]; len(audio) < 4 || audio[0] != 0xff || audio[3]&0xc0 == 0xc0 {
+		t.Errorf("first frame header is % x, want stereo", audio[:4])
+	}
+	if _, err := ctx.Pan(espeak.Surround51, 0).WriteMP3(&buf, nil); err == nil {
+		t.Error("no error for 5.1 audio in an mp3 stream")
+	}
+
+	for _, layout := range []espeak.Layout{espeak.Stereo, espeak.Surround51} {
+		m := ctx.Pan(layout, 0)
+		opts := &espeak.ContainerOptions{Markers: []espeak.SynthEventType{espeak.EventWord}}
+
+		buf.Reset()
+		if _, err := m.WriteAIFF(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		aiff, _ := chunks(t, buf.Bytes(), 12, aiffFormat)
+		if n := binary.BigEndian.Uint16(aiff["COMM"]); int(n) != layout.Channels() {
+			t.Errorf("%#x: AIFF has %d channels", uint32(layout), n)
+		}
+		if n := binary.BigEndian.Uint32(aiff["COMM"][2:]); int(n) != m.Frames() {
+			t.Errorf("%#x: AIFF has %d frames, want %d", uint32(layout), n, m.Frames())
+		}
+		if chunk, ok := aiff["CHAN"]; ok != (layout != espeak.Stereo) || ok && binary.BigEndian.Uint32(chunk[4:]) != uint32(layout) {
+			t.Errorf("%#x: AIFF CHAN chunk is % x", uint32(layout), chunk)
+		}
+		if _, ok := aiff["MARK"]; !ok {
+			t.Errorf("%#x: AIFF has no markers", uint32(layout))
+		}
+
+		buf.Reset()
+		if _, err := m.WriteCAF(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		caf, _ := chunks(t, buf.Bytes(), 8, cafFormat)
+		if n := binary.BigEndian.Uint32(caf["desc"][24:]); int(n) != layout.Channels() {
+			t.Errorf("%#x: CAF has %d channels", uint32(layout), n)
+		}
+		if n := uint64(len(caf["data"]) - 4); n != uint64(len(m.Samples)*2) {
+			t.Errorf("%#x: CAF has %d bytes of audio, want %d", uint32(layout), n, len(m.Samples)*2)
+		}
+		if chunk, ok := caf["chan"]; ok != (layout != espeak.Stereo) || ok && binary.BigEndian.Uint32(chunk[4:]) != uint32(layout) {
+			t.Errorf("%#x: CAF chan chunk is % x", uint32(layout), chunk)
+		}
+		if _, ok := caf["mark"]; !ok {
+			t.Errorf("%#x: CAF has no markers", uint32(layout))
+		}
+	}
+}
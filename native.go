@@ -1,4 +1,4 @@
-// +build !js
+// +build !js,cgo,!espeak_cli,!espeak_wazero
 
 package espeak // import "gopkg.in/BenLubar/espeak.v2"
 
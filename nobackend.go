@@ -0,0 +1,47 @@
+// +build !js,!cgo,!espeak_cli,!espeak_wazero
+
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+// Without cgo or a backend build tag, no copy of espeak-ng is built into the program. The package can
+// still be used with another Engine, such as a CommandEngine or the fake in package espeaktest, but
+// DefaultEngine has no voices and every call to it that can fail returns errNoBackend.
+
+import "errors"
+
+var errNoBackend = errors.New("espeak: no espeak-ng backend is built into this program (build with cgo, or with the espeak_wazero or espeak_cli tag)")
+
+// noBackendSampleRate is the sample rate reported without a backend. It is the rate of every voice
+// that comes with espeak-ng.
+const noBackendSampleRate = 22050
+
+func getSampleRate() int {
+	return noBackendSampleRate
+}
+
+func listVoices() []*Voice {
+	return nil
+}
+
+func setRate(int) error {
+	return errNoBackend
+}
+
+func setVolume(int) error {
+	return errNoBackend
+}
+
+func setPitch(int) error {
+	return errNoBackend
+}
+
+func setTone(int) error {
+	return errNoBackend
+}
+
+func setVoice(string, string, Gender, uint8, uint8) error {
+	return errNoBackend
+}
+
+func synthesize(string, *Context) error {
+	return errNoBackend
+}
@@ -0,0 +1,181 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"gopkg.in/BenLubar/espeak.v2/g711"
+)
+
+// SampleFormat is the encoding of each sample in PCM audio written by this package. Samples are always
+// synthesized as signed 16-bit integers and converted when they are written.
+type SampleFormat int
+
+// The zero SampleFormat is PCM16, the format of Samples.
+const (
+	PCM16   SampleFormat = iota // signed 16-bit integer
+	PCM8                        // unsigned 8-bit integer, centered on 128
+	PCM24                       // signed 24-bit integer
+	PCM32                       // signed 32-bit integer
+	Float32                     // 32-bit IEEE floating point in the range [-1, 1)
+	ULaw                        // 8-bit G.711 μ-law, as used by telephones in North America and Japan
+	ALaw                        // 8-bit G.711 A-law, as used by telephones elsewhere
+)
+
+// Size returns the number of bytes in each sample, or 0 if the format is not valid.
+func (f SampleFormat) Size() int {
+	switch f {
+	case PCM8, ULaw, ALaw:
+		return 1
+	case PCM16:
+		return 2
+	case PCM24:
+		return 3
+	case PCM32, Float32:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// String returns the name of the constant for f.
+func (f SampleFormat) String() string {
+	switch f {
+	case PCM8:
+		return "PCM8"
+	case PCM16:
+		return "PCM16"
+	case PCM24:
+		return "PCM24"
+	case PCM32:
+		return "PCM32"
+	case Float32:
+		return "Float32"
+	case ULaw:
+		return "ULaw"
+	case ALaw:
+		return "ALaw"
+	default:
+		return "SampleFormat(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// RawOptions controls the encoding of headerless audio written by Context.WriteRaw.
+type RawOptions struct {
+	// Format is the encoding of each sample.
+	Format SampleFormat
+
+	// ByteOrder is the order of the bytes in each sample. If it is nil, binary.LittleEndian is used.
+	ByteOrder binary.ByteOrder
+
+	// Dither adds triangular (TPDF) noise of one least significant bit when Format has fewer bits than
+	// Samples, which turns the distortion caused by rounding into a constant low noise floor. It has no
+	// effect on formats of 16 bits or more, or on ULaw and ALaw, which keep more precision for quiet
+	// sounds.
+	Dither bool
+}
+
+// WriteRaw writes the Samples in this Context to w as headerless PCM, for tools that are told the sample
+// rate and format separately. A nil opts writes 16-bit little-endian samples.
+func (ctx *Context) WriteRaw(w io.Writer, opts *RawOptions) (int64, error) {
+	if opts == nil {
+		opts = &RawOptions{}
+	}
+
+	enc, err := newSampleEncoder(opts.Format, opts.ByteOrder, opts.Dither)
+	if err != nil {
+		return 0, err
+	}
+
+	cw := countWriter{w: w}
+	cw.writeSamples(ctx.Samples, enc)
+
+	return cw.n, cw.err
+}
+
+// sampleEncoder converts 16-bit samples to a SampleFormat.
+type sampleEncoder struct {
+	format SampleFormat
+	order  binary.ByteOrder
+	dither bool
+	signed bool   // PCM8 is signed, as in AIFF, AU, and CAF files
+	seed   uint32 // state of the dither noise generator
+}
+
+func newSampleEncoder(format SampleFormat, order binary.ByteOrder, dither bool) (*sampleEncoder, error) {
+	if format.Size() == 0 {
+		return nil, errors.New("espeak: invalid sample format " + format.String())
+	}
+
+	if order == nil {
+		order = binary.LittleEndian
+	}
+
+	// The noise is the same every time, so that writing the same audio twice gives the same file.
+	return &sampleEncoder{format: format, order: order, dither: dither, seed: 1}, nil
+}
+
+// put encodes s into the first format.Size() bytes of b.
+func (e *sampleEncoder) put(b []byte, s int16) {
+	switch e.format {
+	case PCM8:
+		if e.signed {
+			b[0] = byte(e.reduce(s, 8))
+		} else {
+			b[0] = byte(e.reduce(s, 8) + 128)
+		}
+	case PCM16:
+		e.order.PutUint16(b, uint16(s))
+	case PCM24:
+		v := uint32(int32(s) << 8)
+		if e.order == binary.BigEndian {
+			b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+		} else {
+			b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+		}
+	case PCM32:
+		e.order.PutUint32(b, uint32(int32(s)<<16))
+	case Float32:
+		e.order.PutUint32(b, math.Float32bits(float32(s)/32768))
+	case ULaw:
+		b[0] = g711.EncodeULaw(s)
+	case ALaw:
+		b[0] = g711.EncodeALaw(s)
+	}
+}
+
+// reduce converts s to a signed integer of the given number of bits, dithering if requested.
+func (e *sampleEncoder) reduce(s int16, bits uint) int {
+	shift := 16 - bits
+
+	if !e.dither {
+		return int(s) >> shift
+	}
+
+	v := float64(s)/float64(int(1)<<shift) + e.noise() - e.noise()
+	v = math.Floor(v + 0.5)
+
+	max := float64(int(1)<<(bits-1)) - 1
+	if v > max {
+		v = max
+	}
+	if v < -max-1 {
+		v = -max - 1
+	}
+
+	return int(v)
+}
+
+// noise returns a uniformly distributed number in [0, 1). The difference of two of these has the
+// triangular distribution used for dithering.
+func (e *sampleEncoder) noise() float64 {
+	// xorshift32
+	e.seed ^= e.seed << 13
+	e.seed ^= e.seed >> 17
+	e.seed ^= e.seed << 5
+
+	return float64(e.seed) / (1 << 32)
+}
@@ -0,0 +1,97 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestWriteWAVFormats(t *testing.T) {
+	src := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := src.SynthesizeText("Hello, world."); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		format    espeak.SampleFormat
+		dither    bool
+		tolerance int
+	}{
+		{espeak.PCM16, false, 0},
+		{espeak.PCM24, false, 0},
+		{espeak.PCM32, false, 0},
+		{espeak.Float32, false, 0},
+		{espeak.PCM8, false, 256},
+		{espeak.PCM8, true, 512},
+		{espeak.ULaw, false, 512},
+		{espeak.ALaw, false, 512},
+	} {
+		var buf bytes.Buffer
+		if _, err := src.WriteWAV(&buf, &espeak.WAVOptions{Format: tt.format, Dither: tt.dither}); err != nil {
+			t.Errorf("%v: %v", tt.format, err)
+			continue
+		}
+
+		needsFact := tt.format == espeak.Float32 || tt.format == espeak.ULaw || tt.format == espeak.ALaw
+		if needsFact && !bytes.Contains(buf.Bytes(), []byte("fact")) {
+			t.Errorf("%v: missing fact chunk", tt.format)
+		}
+
+		dst := espeak.Context{Engine: espeaktest.New(16000)}
+		if _, err := dst.ReadFrom(&buf); err != nil {
+			t.Errorf("%v: %v", tt.format, err)
+			continue
+		}
+
+		if len(dst.Samples) != len(src.Samples) {
+			t.Errorf("%v: read %d samples, want %d", tt.format, len(dst.Samples), len(src.Samples))
+			continue
+		}
+
+		for i, s := range src.Samples {
+			if d := int(dst.Samples[i]) - int(s); d < -tt.tolerance || d > tt.tolerance {
+				t.Errorf("%v (dither %v): sample %d is %d, want %d", tt.format, tt.dither, i, dst.Samples[i], s)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteRaw(t *testing.T) {
+	ctx := espeak.Context{Samples: []int16{0, 1, -2, math.MaxInt16}}
+
+	for _, tt := range []struct {
+		opts *espeak.RawOptions
+		want []byte
+	}{
+		{nil, []byte{0, 0, 1, 0, 0xfe, 0xff, 0xff, 0x7f}},
+		{&espeak.RawOptions{ByteOrder: binary.BigEndian}, []byte{0, 0, 0, 1, 0xff, 0xfe, 0x7f, 0xff}},
+		{&espeak.RawOptions{Format: espeak.PCM8}, []byte{128, 128, 127, 255}},
+		{&espeak.RawOptions{Format: espeak.PCM24, ByteOrder: binary.BigEndian}, []byte{0, 0, 0, 0, 1, 0, 0xff, 0xfe, 0, 0x7f, 0xff, 0}},
+	} {
+		var buf bytes.Buffer
+		n, err := ctx.WriteRaw(&buf, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(tt.want)) || !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("%+v: wrote %x, want %x", tt.opts, buf.Bytes(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := ctx.WriteRaw(&buf, &espeak.RawOptions{Format: espeak.Float32, ByteOrder: binary.BigEndian}); err != nil {
+		t.Fatal(err)
+	}
+	if got := math.Float32frombits(binary.BigEndian.Uint32(buf.Bytes()[8:])); got != -2.0/32768 {
+		t.Errorf("third float32 sample = %v", got)
+	}
+
+	if _, err := ctx.WriteRaw(&buf, &espeak.RawOptions{Format: espeak.SampleFormat(-1)}); err == nil {
+		t.Error("no error for an invalid format")
+	}
+}
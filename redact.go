@@ -0,0 +1,175 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/BenLubar/espeak.v2/earcon"
+)
+
+// defaultRedactThreshold is the Threshold used by Redact when RedactOptions does not set one, in dBFS.
+const defaultRedactThreshold = -50
+
+// RedactOptions chooses the words that Redact replaces and what they are replaced with.
+type RedactOptions struct {
+	// Words lists words to redact, such as profanity. A word matches if it is the same apart from case,
+	// ignoring punctuation at either end of the spoken word.
+	Words []string
+
+	// Patterns are searched for in Text, and each word that overlaps a match is redacted, such as each
+	// part of a phone number or an email address.
+	Patterns []*regexp.Regexp
+
+	// Tone replaces the audio of the redacted words, with its Duration set to the length of each word,
+	// such as &earcon.Tone{Freq: 1000, Gain: -12} for a bleep. If Tone is nil, the words are silenced.
+	Tone *earcon.Tone
+
+	// Audio quieter than Threshold, in dBFS, at the end of a word is the pause before the next word, and
+	// is left as it is. If Threshold is 0, -50 dBFS is used.
+	Threshold float64
+}
+
+// Redaction is a word whose audio was replaced by Redact.
+type Redaction struct {
+	// TextPosition and Length are those of the word's EventWord, in characters of Text.
+	TextPosition int
+	Length       int
+
+	// Start and End are the times of the audio that was replaced.
+	Start, End time.Duration
+
+	// Rule is the entry of Words or the pattern in Patterns that the word matched. The redacted word
+	// itself is not in the report, so that the report can be logged.
+	Rule string
+}
+
+// Redact replaces the audio of each spoken word that matches opts with a tone or silence, and returns a
+// report of the words that were replaced, in order. Words are found by their EventWord events in Text,
+// so the text is synthesized as it is and the timing of the speech around the redacted words does not
+// change. Samples are changed, but Text and Events are not.
+//
+// Each word runs from its EventWord to the next event, other than EventPhoneme, that comes after it,
+// without the quiet audio at its end. A nil opts redacts nothing.
+func (ctx *Context) Redact(opts *RedactOptions) []Redaction {
+	if opts == nil {
+		opts = &RedactOptions{}
+	}
+	text := []rune(ctx.Text)
+
+	// matches holds the character ranges in Text matched by each pattern.
+	matches := make([][][2]int, len(opts.Patterns))
+	for i, re := range opts.Patterns {
+		for _, m := range re.FindAllStringIndex(ctx.Text, -1) {
+			start := utf8.RuneCountInString(ctx.Text[:m[0]])
+			end := start + utf8.RuneCountInString(ctx.Text[m[0]:m[1]])
+			matches[i] = append(matches[i], [2]int{start, end})
+		}
+	}
+
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = defaultRedactThreshold
+	}
+	quiet := 32768 * math.Pow(10, threshold/20)
+
+	var report []Redaction
+	for i, e := range ctx.Events {
+		if e.Type != EventWord || e.TextPosition <= 0 || e.Length <= 0 || e.TextPosition > len(text) {
+			continue
+		}
+
+		start, end := e.TextPosition-1, e.TextPosition-1+e.Length
+		if end > len(text) {
+			end = len(text)
+		}
+
+		rule, ok := redactRule(string(text[start:end]), start, end, opts, matches)
+		if !ok {
+			continue
+		}
+
+		to := ctx.Duration()
+		for _, next := range ctx.Events[i+1:] {
+			if next.Type != EventPhoneme && next.AudioPosition > e.AudioPosition {
+				to = next.AudioPosition
+				break
+			}
+		}
+
+		first, last := ctx.sampleAt(e.AudioPosition), ctx.sampleAt(to)
+		for last > first && math.Abs(float64(ctx.Samples[last-1])) < quiet {
+			last--
+		}
+
+		report = append(report, Redaction{
+			TextPosition: e.TextPosition,
+			Length:       e.Length,
+			Start:        ctx.timeAt(first),
+			End:          ctx.timeAt(last),
+			Rule:         rule,
+		})
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Start < report[j].Start
+	})
+
+	// Words that overlap are replaced together, so that the tone does not restart.
+	for i := 0; i < len(report); {
+		first, last := ctx.sampleAt(report[i].Start), ctx.sampleAt(report[i].End)
+		for i++; i < len(report) && ctx.sampleAt(report[i].Start) < last; i++ {
+			if end := ctx.sampleAt(report[i].End); end > last {
+				last = end
+			}
+		}
+
+		ctx.replaceSamples(first, last, opts.Tone)
+	}
+
+	return report
+}
+
+// redactRule returns the rule that a word at the given range of characters matches, if any.
+func redactRule(word string, start, end int, opts *RedactOptions, matches [][][2]int) (string, bool) {
+	word = strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range opts.Words {
+		if strings.EqualFold(word, w) {
+			return w, true
+		}
+	}
+
+	for i, ranges := range matches {
+		for _, m := range ranges {
+			if m[0] < end && m[1] > start {
+				return opts.Patterns[i].String(), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// replaceSamples replaces the samples from first up to last with tone, or silence if tone is nil.
+func (ctx *Context) replaceSamples(first, last int, tone *earcon.Tone) {
+	var replacement []int16
+	if tone != nil {
+		t := *tone
+		t.Duration = ctx.timeAt(last - first)
+		replacement = earcon.Render(t, ctx.SampleRate())
+	}
+
+	for i := first; i < last; i++ {
+		if j := i - first; j < len(replacement) {
+			ctx.Samples[i] = replacement[j]
+		} else {
+			ctx.Samples[i] = 0
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package espeak_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/earcon"
+)
+
+func TestRedact(t *testing.T) {
+	text := "Call me on 555-1234 or write to bob@example.com, you Darn fool."
+	ctx := synthesize(t, 16000, text)
+	original := synthesize(t, 16000, text)
+
+	report := ctx.Redact(&espeak.RedactOptions{
+		Words: []string{"darn"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\d{3}-\d{4}`),
+			regexp.MustCompile(`[\w.]+@[\w.]+\w`),
+		},
+	})
+
+	words := []string{"555-1234", "bob@example.com", "Darn"}
+	rules := []string{`\d{3}-\d{4}`, `[\w.]+@[\w.]+\w`, "darn"}
+	if len(report) != len(words) {
+		t.Fatalf("redacted %d words: %+v", len(report), report)
+	}
+
+	silenced := make([]bool, len(ctx.Samples))
+	for i, r := range report {
+		if got := string([]rune(text)[r.TextPosition-1:][:r.Length]); got != words[i] || r.Rule != rules[i] {
+			t.Errorf("redaction %d is %q for %q, want %q for %q", i, got, r.Rule, words[i], rules[i])
+		}
+		if r.End <= r.Start {
+			t.Errorf("redaction %d is from %v to %v", i, r.Start, r.End)
+		}
+
+		from, to := int(r.Start*16000/1e9), int(r.End*16000/1e9)
+		for j := from; j < to; j++ {
+			silenced[j] = true
+			if ctx.Samples[j] != 0 {
+				t.Fatalf("redaction %d: sample %d is not silent", i, j)
+			}
+		}
+	}
+
+	for i, v := range ctx.Samples {
+		if !silenced[i] && v != original.Samples[i] {
+			t.Fatalf("sample %d outside of the redactions changed", i)
+		}
+	}
+	if ctx.Text != text || !reflect.DeepEqual(ctx.Events, original.Events) {
+		t.Error("text or events changed")
+	}
+
+	bleeped := synthesize(t, 16000, text)
+	bleeped.Redact(&espeak.RedactOptions{
+		Words: []string{"FOOL"},
+		Tone:  &earcon.Tone{Freq: 1000, Gain: -12},
+	})
+	var changed int
+	for i, v := range bleeped.Samples {
+		if v != original.Samples[i] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("the bleep did not change the audio")
+	}
+
+	if report := ctx.Redact(nil); len(report) != 0 {
+		t.Errorf("nil options redacted %+v", report)
+	}
+}
@@ -0,0 +1,190 @@
+// Package resample converts 16-bit audio between sample rates using a band-limited polyphase filter.
+//
+// The filter is a Kaiser-windowed sinc. When converting to a lower sample rate, its cutoff is lowered to
+// just below the new Nyquist frequency so that high frequencies do not alias into the audible range.
+package resample // import "gopkg.in/BenLubar/espeak.v2/resample"
+
+import (
+	"math"
+)
+
+const (
+	// zeroCrossings is the number of zero crossings of the sinc function on each side of the filter.
+	zeroCrossings = 16
+
+	// rolloff places the cutoff frequency slightly below the Nyquist frequency to leave room for the
+	// transition band of the filter.
+	rolloff = 0.95
+
+	// kaiserBeta trades transition band width for stopband attenuation (about 90dB).
+	kaiserBeta = 9
+)
+
+// Resample converts samples from one sample rate to another. The result has ceil(len(samples) * to / from)
+// samples and is not shared with the input, except that samples is returned unchanged if from == to.
+func Resample(samples []int16, from, to int) []int16 {
+	if from == to {
+		return samples
+	}
+
+	r := New(from, to)
+	out := r.Process(samples)
+	return append(out, r.Flush()...)
+}
+
+// A Resampler converts a stream of samples from one sample rate to another. Samples are passed to Process
+// as they become available, and Flush returns the rest of the output once the stream has ended.
+type Resampler struct {
+	up, down int // the conversion ratio in lowest terms
+	half     int // number of filter taps on each side of the center
+	phases   [][]float64
+
+	buf      []float64 // input samples, starting at input index base
+	base     int64
+	received int64 // number of input samples so far
+	n        int64 // index of the next output sample
+}
+
+// New returns a Resampler that converts audio at sample rate from to sample rate to. New panics if either
+// rate is not positive.
+func New(from, to int) *Resampler {
+	if from <= 0 || to <= 0 {
+		panic("resample: sample rates must be positive")
+	}
+
+	g := gcd(from, to)
+	r := &Resampler{
+		up:   to / g,
+		down: from / g,
+	}
+
+	// cutoff is relative to the input Nyquist frequency.
+	cutoff := rolloff
+	if to < from {
+		cutoff *= float64(to) / float64(from)
+	}
+
+	r.half = int(math.Ceil(zeroCrossings / cutoff))
+	r.phases = make([][]float64, r.up)
+
+	for p := range r.phases {
+		taps := make([]float64, 2*r.half)
+		for k := range taps {
+			// distance in input samples from the output sample to this tap
+			d := float64(k-r.half+1) - float64(p)/float64(r.up)
+			taps[k] = cutoff * sinc(cutoff*d) * kaiser(d/float64(r.half))
+		}
+		r.phases[p] = taps
+	}
+
+	return r
+}
+
+// Process adds input samples to the stream and returns as many output samples as can be computed so far.
+// The filter needs to look ahead, so the output lags a little behind the input until Flush is called.
+func (r *Resampler) Process(samples []int16) []int16 {
+	for _, s := range samples {
+		r.buf = append(r.buf, float64(s))
+	}
+	r.received += int64(len(samples))
+
+	return r.run(false)
+}
+
+// Flush returns the remaining output samples after the end of the input. The Resampler must not be used
+// after Flush.
+func (r *Resampler) Flush() []int16 {
+	return r.run(true)
+}
+
+func (r *Resampler) run(final bool) []int16 {
+	var out []int16
+
+	// total is the number of output samples for the whole input, which is only known at the end.
+	total := (r.received*int64(r.up) + int64(r.down) - 1) / int64(r.down)
+
+	for {
+		pos := r.n * int64(r.down)
+		i, p := pos/int64(r.up), pos%int64(r.up)
+
+		if final && r.n >= total {
+			break
+		}
+		if !final && i+int64(r.half) >= r.received {
+			break
+		}
+
+		var sum float64
+		start := i - int64(r.half) + 1
+		for k, c := range r.phases[p] {
+			if j := start + int64(k); j >= r.base && j < r.received {
+				sum += c * r.buf[j-r.base]
+			}
+		}
+
+		out = append(out, clip(sum))
+		r.n++
+	}
+
+	// Keep only the input that is needed for the next output sample.
+	next := r.n*int64(r.down)/int64(r.up) - int64(r.half) + 1
+	if drop := next - r.base; drop > 0 {
+		if drop > int64(len(r.buf)) {
+			drop = int64(len(r.buf))
+		}
+		r.buf = append(r.buf[:0], r.buf[drop:]...)
+		r.base += drop
+	}
+
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser returns the Kaiser window at x, where x ranges from -1 to 1.
+func kaiser(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+
+	return bessel0(kaiserBeta*math.Sqrt(1-x*x)) / bessel0(kaiserBeta)
+}
+
+// bessel0 is the zeroth order modified Bessel function of the first kind.
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+
+	return sum
+}
+
+func clip(v float64) int16 {
+	v = math.Floor(v + 0.5)
+
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return int16(v)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,75 @@
+package resample
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func sine(freq float64, rate, n int) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return samples
+}
+
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestResampleSine(t *testing.T) {
+	for _, to := range []int{8000, 16000, 44100, 48000} {
+		in := sine(1000, 22050, 22050)
+		out := Resample(in, 22050, to)
+
+		if want := (len(in)*to + 22050 - 1) / 22050; len(out) != want {
+			t.Errorf("%d Hz: got %d samples, want %d", to, len(out), want)
+		}
+
+		// Ignore the edges, where the filter sees silence before and after the input.
+		want := sine(1000, to, len(out))
+		var maxErr float64
+		for i := to / 100; i < len(out)-to/100; i++ {
+			maxErr = math.Max(maxErr, math.Abs(float64(out[i])-float64(want[i])))
+		}
+
+		if maxErr > 20 {
+			t.Errorf("%d Hz: maximum error %v", to, maxErr)
+		}
+	}
+}
+
+func TestResampleAliasing(t *testing.T) {
+	// 6 kHz is above the Nyquist frequency of 8 kHz audio, so it must be filtered out.
+	out := Resample(sine(6000, 22050, 22050), 22050, 8000)
+
+	if level := rms(out[80 : len(out)-80]); level > 10 {
+		t.Errorf("6 kHz tone leaked through with RMS %v", level)
+	}
+}
+
+func TestResamplerStreaming(t *testing.T) {
+	in := sine(440, 22050, 5000)
+	want := Resample(in, 22050, 48000)
+
+	r := New(22050, 48000)
+	var got []int16
+	for len(in) != 0 {
+		n := 333
+		if n > len(in) {
+			n = len(in)
+		}
+		got = append(got, r.Process(in[:n])...)
+		in = in[n:]
+	}
+	got = append(got, r.Flush()...)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streaming output (%d samples) differs from batch output (%d samples)", len(got), len(want))
+	}
+}
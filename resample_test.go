@@ -0,0 +1,37 @@
+package espeak_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestSetSampleRate(t *testing.T) {
+	native := espeak.Context{Engine: espeaktest.New(16000)}
+	if err := native.SynthesizeText("Hello, world."); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := espeak.Context{Engine: espeaktest.New(16000)}
+	ctx.SetSampleRate(48000)
+	if rate := ctx.SampleRate(); rate != 48000 {
+		t.Fatalf("SampleRate() = %d after SetSampleRate(48000)", rate)
+	}
+
+	if err := ctx.SynthesizeText("Hello, world."); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(native.Samples) * 3; len(ctx.Samples) != want {
+		t.Errorf("synthesized %d samples, want %d", len(ctx.Samples), want)
+	}
+	if !reflect.DeepEqual(ctx.Events, native.Events) {
+		t.Error("events changed when synthesizing at a different sample rate")
+	}
+
+	ctx.SetSampleRate(16000)
+	if len(ctx.Samples) != len(native.Samples) {
+		t.Errorf("converted back to %d samples, want %d", len(ctx.Samples), len(native.Samples))
+	}
+}
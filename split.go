@@ -0,0 +1,140 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/effects"
+)
+
+// zeroCrossingSearch is how far before an event SplitBy looks for a zero crossing to cut at, so that
+// clips do not start or end with a click.
+const zeroCrossingSearch = 5 * time.Millisecond
+
+// SplitOptions controls the clips returned by SplitBy.
+type SplitOptions struct {
+	// Prefix and Extension are the start and end of the name of each clip. If they are empty, "clip" and
+	// ".wav" are used.
+	Prefix, Extension string
+
+	// Trim removes the silence from both ends of each clip, such as the pause after each sentence.
+	// Audio quieter than Threshold, in dBFS, is silence. If Threshold is 0, -50 dBFS is used.
+	Trim      bool
+	Threshold float64
+
+	// Pad adds silence to both ends of each clip, after trimming.
+	Pad time.Duration
+}
+
+// Clip is one part of the audio divided by SplitBy. Its Context holds the audio, text, and events of
+// that part, with the same settings and Engine as the Context that was divided.
+type Clip struct {
+	*Context
+
+	// Name is a file name for the clip, made of the prefix, the 1-based number of the clip, the name of
+	// the mark for EventMark, and the extension, such as "clip-03-intro.wav".
+	Name string
+
+	// Event is the event that starts the clip, as it was in the Context that was divided.
+	Event *SynthEvent
+}
+
+// SplitBy divides the audio into a clip for each event of the given type, such as EventSentence for a
+// clip per sentence or EventMark for a clip per SSML <mark> region. Each clip runs from its event up to
+// the next one, or to the end of the audio for the last clip, and audio before the first event is not
+// in any clip. Cuts are moved back to the nearest zero crossing within 5 milliseconds so that the clips
+// do not click. A nil opts uses the defaults and does not trim or pad.
+//
+// The clips are made by Slice, so the AudioPosition and TextPosition of their events are measured from
+// the start of each clip, and their Text is the text that they were synthesized from. This Context is
+// not changed.
+func (ctx *Context) SplitBy(typ SynthEventType, opts *SplitOptions) []*Clip {
+	if opts == nil {
+		opts = &SplitOptions{}
+	}
+	prefix, ext := opts.Prefix, opts.Extension
+	if prefix == "" {
+		prefix = "clip"
+	}
+	if ext == "" {
+		ext = ".wav"
+	}
+
+	var starts []*SynthEvent
+	for _, e := range ctx.Events {
+		if e.Type == typ {
+			starts = append(starts, e)
+		}
+	}
+
+	cuts := make([]int, len(starts)+1)
+	for i, e := range starts {
+		cuts[i] = ctx.zeroCrossing(ctx.sampleAt(e.AudioPosition))
+		if i != 0 && cuts[i] < cuts[i-1] {
+			cuts[i] = cuts[i-1]
+		}
+	}
+	cuts[len(starts)] = len(ctx.Samples)
+
+	digits := len(fmt.Sprint(len(starts)))
+	if digits < 2 {
+		digits = 2
+	}
+
+	clips := make([]*Clip, len(starts))
+	for i, e := range starts {
+		c := &Clip{
+			Context: ctx.slice(cuts[i], cuts[i+1]),
+			Name:    fmt.Sprintf("%s-%0*d", prefix, digits, i+1),
+			Event:   e,
+		}
+		if typ == EventMark && e.Name != "" {
+			c.Name += "-" + fileName(e.Name)
+		}
+		c.Name += ext
+
+		if opts.Trim {
+			c.ApplyEffects(effects.TrimSilence{Threshold: opts.Threshold})
+		}
+		if opts.Pad > 0 {
+			// Events at the end of the clip stay with the end of the audio rather than moving past the
+			// padding.
+			c.InsertSilence(0, opts.Pad)
+			c.Samples = append(c.Samples, make([]int16, int(opts.Pad*time.Duration(c.SampleRate())/time.Second))...)
+		}
+
+		clips[i] = c
+	}
+
+	return clips
+}
+
+// zeroCrossing returns the index of the nearest sample at or before index n, within zeroCrossingSearch,
+// that is silent or has the opposite sign to the sample before it, or n if there is none.
+func (ctx *Context) zeroCrossing(n int) int {
+	if n >= len(ctx.Samples) {
+		return n
+	}
+
+	limit := n - int(zeroCrossingSearch*time.Duration(ctx.SampleRate())/time.Second)
+	for i := n; i > 0 && i >= limit; i-- {
+		if ctx.Samples[i] == 0 || (ctx.Samples[i] < 0) != (ctx.Samples[i-1] < 0) {
+			return i
+		}
+	}
+
+	return n
+}
+
+// fileName replaces the characters of name that are not safe in file names.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
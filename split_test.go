@@ -0,0 +1,98 @@
+package espeak_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+func TestSplitBySentence(t *testing.T) {
+	ctx := synthesize(t, 22050, "Hello, world. How are you? I am fine.")
+	clips := ctx.SplitBy(espeak.EventSentence, nil)
+
+	texts := []string{"Hello, world. ", "How are you? ", "I am fine."}
+	if len(clips) != len(texts) {
+		t.Fatalf("%d clips, want %d", len(clips), len(texts))
+	}
+
+	total := 0
+	for i, c := range clips {
+		if want := "clip-0" + string(rune('1'+i)) + ".wav"; c.Name != want {
+			t.Errorf("clip %d is named %q, want %q", i, c.Name, want)
+		}
+		if c.Text != texts[i] {
+			t.Errorf("clip %d has text %q, want %q", i, c.Text, texts[i])
+		}
+		if c.Event.Type != espeak.EventSentence || c.Event.Number != i+1 {
+			t.Errorf("clip %d starts with %+v", i, *c.Event)
+		}
+		if len(c.Events) == 0 || c.Events[0].Type != espeak.EventSentence || c.Events[0].TextPosition != 1 {
+			t.Errorf("clip %d: first event is not its sentence", i)
+		}
+		for _, e := range c.Events {
+			if e.AudioPosition < 0 || e.AudioPosition > c.Duration() {
+				t.Errorf("clip %d: %+v is outside the clip", i, *e)
+			}
+		}
+		total += len(c.Samples)
+	}
+
+	if total > len(ctx.Samples) {
+		t.Errorf("clips have %d samples, but the audio has %d", total, len(ctx.Samples))
+	}
+}
+
+func TestSplitByMark(t *testing.T) {
+	ctx := synthesize(t, 16000, `<speak>Intro. <mark name="first line"/>One two. <mark name="second"/>Three.</speak>`)
+	clips := ctx.SplitBy(espeak.EventMark, &espeak.SplitOptions{Prefix: "line", Extension: ".flac"})
+
+	names := []string{"line-01-first_line.flac", "line-02-second.flac"}
+	if len(clips) != len(names) {
+		t.Fatalf("%d clips, want %d", len(clips), len(names))
+	}
+	for i, c := range clips {
+		if c.Name != names[i] {
+			t.Errorf("clip %d is named %q, want %q", i, c.Name, names[i])
+		}
+	}
+
+	if want := `<mark name="first line"/>One two. `; clips[0].Text != want {
+		t.Errorf("first clip has text %q, want %q", clips[0].Text, want)
+	}
+	if want := `<mark name="second"/>Three.</speak>`; clips[1].Text != want {
+		t.Errorf("second clip has text %q, want %q", clips[1].Text, want)
+	}
+}
+
+func TestSplitByTrimAndPad(t *testing.T) {
+	const pad = 100 * time.Millisecond
+
+	ctx := synthesize(t, 22050, "Hello, world. How are you?")
+	plain := ctx.SplitBy(espeak.EventSentence, nil)
+	clips := ctx.SplitBy(espeak.EventSentence, &espeak.SplitOptions{Trim: true, Pad: pad})
+
+	n := int(pad * 22050 / time.Second)
+	threshold := 32768 * math.Pow(10, -50.0/20)
+	for i, c := range clips {
+		if len(c.Samples) >= len(plain[i].Samples)+2*n {
+			t.Errorf("clip %d was not trimmed", i)
+		}
+
+		for _, run := range [][]int16{c.Samples[:n], c.Samples[len(c.Samples)-n:]} {
+			for _, v := range run {
+				if v != 0 {
+					t.Fatalf("clip %d is not padded with silence", i)
+				}
+			}
+		}
+		if math.Abs(float64(c.Samples[n])) < threshold && math.Abs(float64(c.Samples[n+1])) < threshold {
+			t.Errorf("clip %d has silence after its padding", i)
+		}
+
+		if d := c.Events[0].AudioPosition - pad; d < 0 || d >= time.Second/22050 {
+			t.Errorf("clip %d: first event is at %v, want %v", i, c.Events[0].AudioPosition, pad)
+		}
+	}
+}
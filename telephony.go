@@ -0,0 +1,304 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/BenLubar/espeak.v2/adpcm"
+	"gopkg.in/BenLubar/espeak.v2/gsm"
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// TelephonyCodec is an encoding of voice prompts for telephone systems such as IVR menus.
+type TelephonyCodec int
+
+// The zero TelephonyCodec is CodecSLIN.
+const (
+	CodecSLIN     TelephonyCodec = iota // signed linear: 16-bit little-endian PCM
+	CodecULaw                           // G.711 μ-law, 8 bits per sample
+	CodecALaw                           // G.711 A-law, 8 bits per sample
+	CodecGSM                            // GSM 06.10 full rate, 33 bytes per 20 milliseconds
+	CodecIMAADPCM                       // IMA ADPCM, 4 bits per sample, only in WAV files
+)
+
+// String returns the name of the constant for c.
+func (c TelephonyCodec) String() string {
+	switch c {
+	case CodecSLIN:
+		return "CodecSLIN"
+	case CodecULaw:
+		return "CodecULaw"
+	case CodecALaw:
+		return "CodecALaw"
+	case CodecGSM:
+		return "CodecGSM"
+	case CodecIMAADPCM:
+		return "CodecIMAADPCM"
+	default:
+		return "TelephonyCodec(" + strconv.Itoa(int(c)) + ")"
+	}
+}
+
+// WAV format tags of the block-based telephony codecs.
+const (
+	wavFormatIMAADPCM = 0x0011
+	wavFormatGSM610   = 0x0031
+)
+
+// telephonyRates are the sample rates that telephone systems accept for wideband audio.
+var telephonyRates = []int{8000, 16000, 24000, 32000, 48000}
+
+// TelephonyOptions controls the audio written by Context.WriteTelephony.
+type TelephonyOptions struct {
+	Codec TelephonyCodec
+
+	// SampleRate is the sample rate of CodecSLIN and CodecIMAADPCM audio, which can be 8000, 16000,
+	// 24000, 32000, or 48000. The other codecs are always 8000 Hz. If it is 0, 8000 is used.
+	SampleRate int
+
+	// WAV wraps the audio in a WAV file instead of writing it without a header. CodecIMAADPCM is always
+	// written in a WAV file, since it has no headerless format.
+	WAV bool
+}
+
+func (opts *TelephonyOptions) rate() (int, error) {
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = 8000
+	}
+
+	switch opts.Codec {
+	case CodecSLIN, CodecIMAADPCM:
+		for _, r := range telephonyRates {
+			if r == rate {
+				return rate, nil
+			}
+		}
+		return 0, fmt.Errorf("espeak: unsupported sample rate %d for %v", rate, opts.Codec)
+	case CodecULaw, CodecALaw, CodecGSM:
+		if rate != 8000 {
+			return 0, fmt.Errorf("espeak: %v is always 8000 Hz", opts.Codec)
+		}
+		return rate, nil
+	default:
+		return 0, errors.New("espeak: invalid telephony codec " + opts.Codec.String())
+	}
+}
+
+func (opts *TelephonyOptions) wav() bool {
+	return opts.WAV || opts.Codec == CodecIMAADPCM
+}
+
+// WriteTelephony writes the Samples in this Context to w in a format for telephone systems, resampling
+// them to the sample rate of the codec. A nil opts writes 8 kHz signed linear audio.
+func (ctx *Context) WriteTelephony(w io.Writer, opts *TelephonyOptions) (int64, error) {
+	if opts == nil {
+		opts = &TelephonyOptions{}
+	}
+
+	rate, err := opts.rate()
+	if err != nil {
+		return 0, err
+	}
+
+	samples := ctx.Samples
+	if from := ctx.SampleRate(); from != rate {
+		samples = resample.Resample(samples, from, rate)
+	}
+
+	tmp := &Context{Samples: samples, sampleRate: rate}
+
+	switch opts.Codec {
+	case CodecGSM:
+		if !opts.WAV {
+			data := make([]byte, (len(samples)+gsm.FrameSamples-1)/gsm.FrameSamples*gsm.FrameSize)
+
+			var e gsm.Encoder
+			for i := 0; i*gsm.FrameSamples < len(samples); i++ {
+				e.EncodeFrame(data[i*gsm.FrameSize:], samples[i*gsm.FrameSamples:])
+			}
+
+			n, err := w.Write(data)
+			return int64(n), err
+		}
+
+		data := make([]byte, (len(samples)+gsm.WAV49Samples-1)/gsm.WAV49Samples*gsm.WAV49Size)
+
+		var e gsm.Encoder
+		for i := 0; i*gsm.WAV49Samples < len(samples); i++ {
+			e.EncodeWAV49(data[i*gsm.WAV49Size:], samples[i*gsm.WAV49Samples:])
+		}
+
+		return writeBlockWAV(w, wavFormatGSM610, rate, 0, gsm.WAV49Size, gsm.WAV49Samples, len(samples), data)
+
+	case CodecIMAADPCM:
+		// Blocks hold the same length of audio at every sample rate.
+		blockSize := adpcm.BlockSize * rate / 8000
+		perBlock := adpcm.SamplesPerBlock(blockSize)
+		data := make([]byte, (len(samples)+perBlock-1)/perBlock*blockSize)
+
+		var e adpcm.Encoder
+		for i := 0; i*perBlock < len(samples); i++ {
+			e.EncodeBlock(data[i*blockSize:(i+1)*blockSize], samples[i*perBlock:])
+		}
+
+		return writeBlockWAV(w, wavFormatIMAADPCM, rate, 4, blockSize, perBlock, len(samples), data)
+	}
+
+	format := PCM16
+	switch opts.Codec {
+	case CodecULaw:
+		format = ULaw
+	case CodecALaw:
+		format = ALaw
+	}
+
+	if opts.WAV {
+		return tmp.WriteWAV(w, &WAVOptions{Format: format})
+	}
+
+	return tmp.WriteRaw(w, &RawOptions{Format: format})
+}
+
+// writeBlockWAV writes a WAV file holding audio in a codec that codes blocks of samples, which needs
+// the number of samples in each block at the end of the fmt chunk.
+func writeBlockWAV(w io.Writer, tag uint16, sampleRate, bitDepth, blockSize, perBlock, samples int, data []byte) (int64, error) {
+	var pad []byte
+	if len(data)%2 == 1 {
+		pad = []byte{0}
+	}
+
+	format := fmtChunk{
+		FmtHeader:       [...]byte{'f', 'm', 't', ' '},
+		FmtChunkSize:    20,
+		AudioFormat:     tag,
+		NumChannels:     1,
+		SampleRate:      uint32(sampleRate),
+		ByteRate:        uint32(sampleRate * blockSize / perBlock),
+		SampleAlignment: uint16(blockSize),
+		BitDepth:        uint16(bitDepth),
+	}
+	extra := []byte{2, 0, byte(perBlock), byte(perBlock >> 8)}
+
+	fact := make([]byte, 12)
+	copy(fact, "fact")
+	binary.LittleEndian.PutUint32(fact[4:], 4)
+	binary.LittleEndian.PutUint32(fact[8:], uint32(samples))
+
+	riffSize := uint64(4 + binary.Size(format) + len(extra) + len(fact) + binary.Size(chunkHeader{}) + len(data) + len(pad))
+	if riffSize > riffSizeLimit {
+		return 0, errors.New("espeak: audio is too long for a wav file")
+	}
+
+	cw := countWriter{w: w}
+	cw.check(binary.Write(&cw, binary.LittleEndian, &riffHeader{
+		RiffHeader: [...]byte{'R', 'I', 'F', 'F'},
+		WavSize:    uint32(riffSize),
+		WaveHeader: [...]byte{'W', 'A', 'V', 'E'},
+	}))
+	cw.check(binary.Write(&cw, binary.LittleEndian, &format))
+	cw.Write(extra)
+	cw.Write(fact)
+	cw.check(binary.Write(&cw, binary.LittleEndian, &chunkHeader{
+		ID:   [...]byte{'d', 'a', 't', 'a'},
+		Size: uint32(len(data)),
+	}))
+	cw.Write(data)
+	cw.Write(pad)
+
+	return cw.n, cw.err
+}
+
+// SoundLayout is the way a telephone system arranges the files in its directory of voice prompts.
+type SoundLayout int
+
+const (
+	// AsteriskLayout keeps every format of a prompt side by side, as in sounds/en/hello-world.ulaw,
+	// and chooses the file by its extension.
+	AsteriskLayout SoundLayout = iota
+
+	// FreeSWITCHLayout keeps each sample rate in its own directory, as in
+	// sounds/en/us/callie/ivr/8000/ivr-welcome.wav, where the prompt is named ivr/ivr-welcome.
+	// Headerless G.711 and GSM files use the extensions of mod_native_file, which plays them without
+	// transcoding.
+	FreeSWITCHLayout
+)
+
+// Extension returns the file extension, including the dot, that the given telephone system expects for
+// audio written with these options. It returns an error if the options are not valid or the telephone
+// system cannot play the audio: Asterisk only reads WAV files that hold 16-bit PCM at 8000 Hz (.wav)
+// or 16000 Hz (.wav16), or GSM (.WAV). For Asterisk, μ-law, A-law, and other sample rates must be
+// written without a WAV header, and IMA ADPCM cannot be used.
+func (opts *TelephonyOptions) Extension(layout SoundLayout) (string, error) {
+	rate, err := opts.rate()
+	if err != nil {
+		return "", err
+	}
+
+	if layout == FreeSWITCHLayout {
+		if opts.wav() {
+			return ".wav", nil
+		}
+
+		switch opts.Codec {
+		case CodecULaw:
+			return ".PCMU", nil
+		case CodecALaw:
+			return ".PCMA", nil
+		case CodecGSM:
+			return ".GSM", nil
+		default:
+			return ".r" + strconv.Itoa(rate/1000), nil
+		}
+	}
+
+	if opts.wav() {
+		switch {
+		case opts.Codec == CodecGSM:
+			return ".WAV", nil // WAV49
+		case opts.Codec != CodecSLIN:
+			return "", fmt.Errorf("espeak: Asterisk cannot play %v in a wav file", opts.Codec)
+		case rate == 8000:
+			return ".wav", nil
+		case rate == 16000:
+			return ".wav16", nil
+		default:
+			return "", fmt.Errorf("espeak: Asterisk cannot play %d Hz wav files", rate)
+		}
+	}
+
+	switch opts.Codec {
+	case CodecULaw:
+		return ".ulaw", nil
+	case CodecALaw:
+		return ".alaw", nil
+	case CodecGSM:
+		return ".gsm", nil
+	default:
+		if rate == 8000 {
+			return ".sln", nil
+		}
+		return ".sln" + strconv.Itoa(rate/1000), nil
+	}
+}
+
+// Path returns the path of the file for the prompt name in the sound directory dir, such as
+// sounds/en for Asterisk or sounds/en/us/callie for FreeSWITCH. The name is what the dialplan plays,
+// without an extension, and may include subdirectories. It returns the same errors as Extension.
+func (opts *TelephonyOptions) Path(layout SoundLayout, dir, name string) (string, error) {
+	ext, err := opts.Extension(layout)
+	if err != nil {
+		return "", err
+	}
+
+	if layout == FreeSWITCHLayout {
+		rate, _ := opts.rate()
+		return filepath.Join(dir, filepath.Dir(name), strconv.Itoa(rate), filepath.Base(name)+ext), nil
+	}
+
+	return filepath.Join(dir, name+ext), nil
+}
@@ -0,0 +1,168 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestWriteTelephony(t *testing.T) {
+	ctx := espeak.Context{Engine: espeaktest.New(22050)}
+	if err := ctx.SynthesizeText("Hello, world."); err != nil {
+		t.Fatal(err)
+	}
+
+	// number of samples after resampling to 8 kHz
+	n := (len(ctx.Samples)*8000 + 22049) / 22050
+
+	for _, tt := range []struct {
+		opts espeak.TelephonyOptions
+		size int // of the audio without a header
+	}{
+		{espeak.TelephonyOptions{}, n * 2},
+		{espeak.TelephonyOptions{Codec: espeak.CodecSLIN, SampleRate: 16000}, -1},
+		{espeak.TelephonyOptions{Codec: espeak.CodecULaw}, n},
+		{espeak.TelephonyOptions{Codec: espeak.CodecALaw}, n},
+		{espeak.TelephonyOptions{Codec: espeak.CodecGSM}, (n + 159) / 160 * 33},
+	} {
+		var buf bytes.Buffer
+		written, err := ctx.WriteTelephony(&buf, &tt.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.opts, err)
+			continue
+		}
+		if written != int64(buf.Len()) {
+			t.Errorf("%+v: WriteTelephony returned %d, but wrote %d bytes", tt.opts, written, buf.Len())
+		}
+		if tt.size != -1 && buf.Len() != tt.size {
+			t.Errorf("%+v: wrote %d bytes, want %d", tt.opts, buf.Len(), tt.size)
+		}
+	}
+
+	// WAV files of linear and G.711 audio can be read back.
+	for _, codec := range []espeak.TelephonyCodec{espeak.CodecSLIN, espeak.CodecULaw, espeak.CodecALaw} {
+		var buf bytes.Buffer
+		if _, err := ctx.WriteTelephony(&buf, &espeak.TelephonyOptions{Codec: codec, WAV: true}); err != nil {
+			t.Errorf("%v: %v", codec, err)
+			continue
+		}
+
+		dst := espeak.Context{Engine: espeaktest.New(8000)}
+		if _, err := dst.ReadFrom(&buf); err != nil {
+			t.Errorf("%v: %v", codec, err)
+			continue
+		}
+		if dst.SampleRate() != 8000 || len(dst.Samples) != n {
+			t.Errorf("%v: read %d samples at %d Hz, want %d at 8000 Hz", codec, len(dst.Samples), dst.SampleRate(), n)
+		}
+	}
+
+	for _, tt := range []struct {
+		opts       espeak.TelephonyOptions
+		tag        uint16
+		blockAlign uint16
+		perBlock   uint16
+	}{
+		{espeak.TelephonyOptions{Codec: espeak.CodecGSM, WAV: true}, 0x31, 65, 320},
+		{espeak.TelephonyOptions{Codec: espeak.CodecIMAADPCM}, 0x11, 256, 505},
+	} {
+		var buf bytes.Buffer
+		if _, err := ctx.WriteTelephony(&buf, &tt.opts); err != nil {
+			t.Errorf("%v: %v", tt.opts.Codec, err)
+			continue
+		}
+
+		b := buf.Bytes()
+		if string(b[:4]) != "RIFF" || string(b[8:16]) != "WAVEfmt " || binary.LittleEndian.Uint32(b[4:]) != uint32(len(b)-8) {
+			t.Errorf("%v: bad RIFF header %q", tt.opts.Codec, b[:16])
+			continue
+		}
+		if tag := binary.LittleEndian.Uint16(b[20:]); tag != tt.tag {
+			t.Errorf("%v: format tag %#04x, want %#04x", tt.opts.Codec, tag, tt.tag)
+		}
+		if rate := binary.LittleEndian.Uint32(b[24:]); rate != 8000 {
+			t.Errorf("%v: sample rate %d", tt.opts.Codec, rate)
+		}
+		if align := binary.LittleEndian.Uint16(b[32:]); align != tt.blockAlign {
+			t.Errorf("%v: block align %d, want %d", tt.opts.Codec, align, tt.blockAlign)
+		}
+		if per := binary.LittleEndian.Uint16(b[38:]); per != tt.perBlock {
+			t.Errorf("%v: %d samples per block, want %d", tt.opts.Codec, per, tt.perBlock)
+		}
+		if string(b[40:44]) != "fact" || binary.LittleEndian.Uint32(b[48:]) != uint32(n) {
+			t.Errorf("%v: bad fact chunk % x", tt.opts.Codec, b[40:52])
+		}
+
+		blocks := (n + int(tt.perBlock) - 1) / int(tt.perBlock)
+		if size := binary.LittleEndian.Uint32(b[56:]); string(b[52:56]) != "data" || size != uint32(blocks)*uint32(tt.blockAlign) {
+			t.Errorf("%v: data chunk %q of %d bytes, want %d blocks", tt.opts.Codec, b[52:56], size, blocks)
+		}
+	}
+
+	for _, opts := range []espeak.TelephonyOptions{
+		{Codec: espeak.CodecULaw, SampleRate: 16000},
+		{Codec: espeak.CodecSLIN, SampleRate: 22050},
+		{Codec: espeak.TelephonyCodec(100)},
+	} {
+		if _, err := ctx.WriteTelephony(new(bytes.Buffer), &opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestTelephonyPath(t *testing.T) {
+	for _, tt := range []struct {
+		opts   espeak.TelephonyOptions
+		layout espeak.SoundLayout
+		want   string
+	}{
+		{espeak.TelephonyOptions{Codec: espeak.CodecULaw}, espeak.AsteriskLayout, "sounds/en/hello.ulaw"},
+		{espeak.TelephonyOptions{Codec: espeak.CodecALaw}, espeak.AsteriskLayout, "sounds/en/hello.alaw"},
+		{espeak.TelephonyOptions{Codec: espeak.CodecGSM}, espeak.AsteriskLayout, "sounds/en/hello.gsm"},
+		{espeak.TelephonyOptions{Codec: espeak.CodecGSM, WAV: true}, espeak.AsteriskLayout, "sounds/en/hello.WAV"},
+		{espeak.TelephonyOptions{}, espeak.AsteriskLayout, "sounds/en/hello.sln"},
+		{espeak.TelephonyOptions{SampleRate: 16000}, espeak.AsteriskLayout, "sounds/en/hello.sln16"},
+		{espeak.TelephonyOptions{WAV: true}, espeak.AsteriskLayout, "sounds/en/hello.wav"},
+		{espeak.TelephonyOptions{SampleRate: 16000, WAV: true}, espeak.AsteriskLayout, "sounds/en/hello.wav16"},
+		{espeak.TelephonyOptions{SampleRate: 48000}, espeak.AsteriskLayout, "sounds/en/hello.sln48"},
+		{espeak.TelephonyOptions{WAV: true}, espeak.FreeSWITCHLayout, "sounds/en/ivr/8000/hello.wav"},
+		{espeak.TelephonyOptions{SampleRate: 16000, WAV: true}, espeak.FreeSWITCHLayout, "sounds/en/ivr/16000/hello.wav"},
+		{espeak.TelephonyOptions{Codec: espeak.CodecIMAADPCM}, espeak.FreeSWITCHLayout, "sounds/en/ivr/8000/hello.wav"},
+		{espeak.TelephonyOptions{Codec: espeak.CodecULaw}, espeak.FreeSWITCHLayout, "sounds/en/ivr/8000/hello.PCMU"},
+		{espeak.TelephonyOptions{}, espeak.FreeSWITCHLayout, "sounds/en/ivr/8000/hello.r8"},
+	} {
+		name := "hello"
+		if tt.layout == espeak.FreeSWITCHLayout {
+			name = "ivr/hello"
+		}
+
+		got, err := tt.opts.Path(tt.layout, "sounds/en", name)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.opts, err)
+		} else if got != filepath.FromSlash(tt.want) {
+			t.Errorf("%+v: Path = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+
+	// Asterisk's format_wav only plays 16-bit PCM at 8000 and 16000 Hz.
+	for _, opts := range []espeak.TelephonyOptions{
+		{Codec: espeak.CodecULaw, WAV: true},
+		{Codec: espeak.CodecALaw, WAV: true},
+		{Codec: espeak.CodecIMAADPCM},
+		{Codec: espeak.CodecIMAADPCM, SampleRate: 16000},
+		{SampleRate: 24000, WAV: true},
+		{SampleRate: 48000, WAV: true},
+		{SampleRate: 22050},
+	} {
+		if ext, err := opts.Extension(espeak.AsteriskLayout); err == nil {
+			t.Errorf("%+v: Extension = %q, want an error", opts, ext)
+		}
+		if _, err := opts.Path(espeak.AsteriskLayout, "sounds/en", "hello"); err == nil {
+			t.Errorf("%+v: expected an error from Path", opts)
+		}
+	}
+}
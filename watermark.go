@@ -0,0 +1,26 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"io"
+
+	"gopkg.in/BenLubar/espeak.v2/watermark"
+)
+
+// Watermark adds a watermark carrying p to the Samples in this Context, below the masking threshold of
+// the speech, so that the audio can be recognized as synthesized speech by DetectWatermark, even after
+// it has been resampled or encoded as MP3. It should be the last change made to the audio. A nil opts
+// uses the default key and strength.
+func (ctx *Context) Watermark(p watermark.Payload, opts *watermark.Options) {
+	ctx.Samples = watermark.Embed(ctx.Samples, ctx.SampleRate(), p, opts)
+}
+
+// DetectWatermark reads a WAV or FLAC file with ReadAudio and searches it for a watermark added by
+// Watermark with the same key.
+func DetectWatermark(r io.Reader, opts *watermark.Options) (*watermark.Detection, error) {
+	ctx, err := ReadAudio(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return watermark.Detect(ctx.Samples, ctx.SampleRate(), opts), nil
+}
@@ -0,0 +1,97 @@
+package watermark
+
+// The payload is protected by the rate 1/2, constraint length 7 convolutional code used by many radio
+// systems, with generator polynomials 171 and 133 in octal, and decoded with a soft-decision Viterbi
+// decoder. Its coded bits are interleaved, so that a pause in the speech, which carries no watermark,
+// erases coded bits that are far apart in the code.
+const (
+	codeStates = 64
+	codePoly0  = 0171
+	codePoly1  = 0133
+
+	// tailBits zeros are added to the end of the data to return the encoder to state 0.
+	tailBits = 6
+
+	// interleaveStep is the distance in the message between coded bits that are next to each other. It
+	// must have no factor in common with codedBits.
+	interleaveStep = 25
+)
+
+// parity returns the number of set bits in v, modulo 2.
+func parity(v uint) int {
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return int(v & 1)
+}
+
+// codeOutput returns the two coded bits sent when bit b enters the encoder in the given state.
+func codeOutput(state uint, b int) (int, int) {
+	reg := uint(b)<<6 | state
+	return parity(reg & codePoly0), parity(reg & codePoly1)
+}
+
+// encode returns the coded bits for bits, which must end with tailBits zeros.
+func encode(bits []int) []int {
+	coded := make([]int, 0, 2*len(bits))
+	var state uint
+	for _, b := range bits {
+		o0, o1 := codeOutput(state, b)
+		coded = append(coded, o0, o1)
+		state = (uint(b)<<6 | state) >> 1
+	}
+	return coded
+}
+
+// decode returns the most likely bits for the soft coded bits, where a positive value is a 1, a negative
+// value is a 0, and 0 is unknown. The bits must have ended with tailBits zeros.
+func decode(soft []float64) []int {
+	n := len(soft) / 2
+
+	const unreachable = -1e300
+	var metric, next [codeStates]float64
+	for i := range metric {
+		metric[i] = unreachable
+	}
+	metric[0] = 0
+
+	from := make([][codeStates]uint8, n)
+	for t := 0; t < n; t++ {
+		for i := range next {
+			next[i] = unreachable
+		}
+
+		for state := uint(0); state < codeStates; state++ {
+			if metric[state] == unreachable {
+				continue
+			}
+
+			for b := 0; b < 2; b++ {
+				o0, o1 := codeOutput(state, b)
+				m := metric[state] + float64(2*o0-1)*soft[2*t] + float64(2*o1-1)*soft[2*t+1]
+
+				ns := (uint(b)<<6 | state) >> 1
+				if m > next[ns] {
+					next[ns] = m
+					from[t][ns] = uint8(state)
+				}
+			}
+		}
+
+		metric = next
+	}
+
+	bits := make([]int, n)
+	state := uint(0)
+	for t := n - 1; t >= 0; t-- {
+		bits[t] = int(state >> 5)
+		state = uint(from[t][state])
+	}
+
+	return bits
+}
+
+// interleave returns the position in the coded part of the message of coded bit i.
+func interleave(i int) int {
+	return i * interleaveStep % codedBits
+}
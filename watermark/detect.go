@@ -0,0 +1,296 @@
+package watermark
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+const (
+	// whitenFrame and whitenHop are the length and spacing of the frames that whiten divides the audio
+	// into.
+	whitenFrame = 512
+	whitenHop   = whitenFrame / 4
+
+	// payloadTries is the number of possible starts of the message that Detect tries to read the payload
+	// at.
+	payloadTries = 3
+
+	// validConfidence is the Confidence of a watermark whose payload passed its checksum, which a
+	// random payload does once in 1<<crcBits tries.
+	validConfidence = 1 - float64(payloadTries)/(1<<crcBits)
+)
+
+// Detection is the result of searching audio for a watermark.
+type Detection struct {
+	// Confidence is how sure Detect is that the audio holds a watermark with the key, from 0 to 1. It is
+	// one minus the chance that audio without a watermark would look at least as much like one anywhere
+	// that Detect looked, so for such audio it is spread evenly from 0 to 1, or a little towards 0, and a
+	// threshold such as 0.999 wrongly finds a watermark in at most one recording in a thousand. Audio
+	// with a watermark that is long enough scores close to 1.
+	Confidence float64
+
+	// Payload is the payload of the watermark, or nil if it could not be read. At the default strength,
+	// reading it takes several times MessageDuration of speech, or more if the audio has been degraded,
+	// and its checksum must be correct.
+	Payload *Payload
+}
+
+// Detect searches audio for a watermark made by Embed with the same key. The audio may have been
+// resampled, encoded lossily, or cut, as long as it has not been sped up or slowed down. Detect panics
+// if the sample rate is not positive.
+func Detect(samples []int16, sampleRate int, opts *Options) *Detection {
+	if sampleRate <= 0 {
+		panic("watermark: sample rate must be positive")
+	}
+
+	if sampleRate != rate {
+		samples = resample.Resample(samples, sampleRate, rate)
+	}
+
+	if len(samples) < (syncBits+1)*symbolLength {
+		return &Detection{}
+	}
+
+	s := opts.sequences()
+	res := whiten(samples)
+
+	sums := make([]float64, len(res)+1)
+	for i, v := range res {
+		sums[i+1] = sums[i] + v*v
+	}
+
+	// Each possible offset of the symbols and start of the message is scored by how well the symbols
+	// agree with the sync word, and by the chance of audio without a watermark, or with a watermark with
+	// another key, agreeing as well. The repeats of the message are added up first, so that every start
+	// can be scored quickly.
+	type candidate struct {
+		offset, first int
+		score, chance float64
+	}
+	var (
+		symbols    [symbolLength][]float64
+		candidates []candidate
+	)
+	for offset := range symbols {
+		var (
+			repeats, energies [messageLength]float64
+			counts            [messageLength]int
+		)
+		for start := offset; start+symbolLength <= len(res); start += symbolLength {
+			z, ok := correlate(res, sums, start, &s.chips)
+			k := len(symbols[offset]) % messageLength
+			if ok {
+				repeats[k] += z
+				energies[k] += z * z
+				counts[k]++
+			}
+			symbols[offset] = append(symbols[offset], z)
+		}
+
+		for m := 0; m < messageLength; m++ {
+			var sum, energy float64
+			var count int
+			for i := 0; i < syncBits; i++ {
+				k := (i - m + messageLength) % messageLength
+				sum += repeats[k] * s.scramble[i] * s.sync[i]
+				energy += energies[k]
+				count += counts[k]
+			}
+
+			c := candidate{offset: offset, first: m, chance: 1}
+			if energy > 0 {
+				c.score = sum / math.Sqrt(energy)
+				c.chance = scoreChance(c.score, count)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].chance < candidates[j].chance
+	})
+
+	// The best start is the best of many, so the chance of one doing as well by accident is counted once
+	// for each of them. Neighbouring offsets share half of their chips, which makes this slightly
+	// cautious.
+	d := &Detection{}
+	d.Confidence = math.Exp(float64(len(candidates)) * math.Log1p(-candidates[0].chance))
+
+	// The payload is decoded for the best starts until one has the right checksum. The soft value of each
+	// coded bit is the sum of its symbols in every repeat of the message. Starts that only differ in
+	// their offset from one already tried are skipped, since the offsets next to the right one score
+	// almost as well.
+	tried := make(map[int]bool)
+	for _, c := range candidates {
+		if len(tried) == payloadTries {
+			break
+		}
+		if tried[c.first] {
+			continue
+		}
+		tried[c.first] = true
+
+		sign := math.Copysign(1, c.score)
+
+		var soft [codedBits]float64
+		for k, z := range symbols[c.offset] {
+			if i := (k + c.first) % messageLength; i >= syncBits {
+				soft[i-syncBits] += z * s.scramble[i] * sign
+			}
+		}
+		var coded [codedBits]float64
+		for i := range coded {
+			coded[i] = soft[interleave(i)]
+		}
+
+		bits := decode(coded[:])
+		b := make([]byte, dataBits/8)
+		for i, v := range bits[:dataBits] {
+			b[i/8] |= byte(v) << (7 - uint(i%8))
+		}
+		if crc16(b[:payloadBits/8]) == uint16(b[payloadBits/8])<<8|uint16(b[payloadBits/8+1]) {
+			d.Payload = parsePayload(b)
+			if d.Confidence < validConfidence {
+				d.Confidence = validConfidence
+			}
+			break
+		}
+	}
+
+	return d
+}
+
+// scoreChance returns the chance that audio without a watermark gives a score at least as far from 0 as
+// score from count symbols. A score divided by the size of its symbols is bounded by the square root of
+// count, so its distribution has shorter tails than a normal distribution when there are few symbols:
+// score²/count has a beta distribution with parameters 1/2 and (count-1)/2, as for Student's t.
+func scoreChance(score float64, count int) float64 {
+	x := 1 - score*score/float64(count)
+	if count < 2 || x <= 0 {
+		return 0
+	}
+	return betaInc(float64(count-1)/2, 0.5, x)
+}
+
+// betaInc returns the regularized incomplete beta function I_x(a, b), from the continued fraction in
+// Numerical Recipes.
+func betaInc(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+
+	// The continued fraction converges quickly for x below (a+1)/(a+b+2), and the rest follows from
+	// I_x(a, b) = 1 - I_(1-x)(b, a).
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+	return front * betaFraction(a, b, x) / a
+}
+
+// betaFraction evaluates the continued fraction for betaInc by the modified Lentz method.
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return h
+}
+
+// correlate returns the correlation of the symbol at start with the spreading sequence, scaled so that
+// it has a standard deviation of 1 in audio without a watermark. It reports false for silence.
+func correlate(res, sums []float64, start int, chips *[symbolLength]float64) (float64, bool) {
+	energy := sums[start+symbolLength] - sums[start]
+	if energy < 1e-6 {
+		return 0, false
+	}
+
+	var c float64
+	for i, v := range res[start : start+symbolLength] {
+		c += v * chips[i]
+	}
+
+	return c / math.Sqrt(energy), true
+}
+
+// whiten removes the predictable part of the audio, such as the harmonics of a voice, leaving the
+// watermark and the part of the audio that is like noise. Each frequency of each short frame of the
+// audio is scaled to the same level, so the frequencies between the harmonics, where the watermark is
+// strongest, count as much as the harmonics themselves.
+func whiten(samples []int16) []float64 {
+	res := make([]float64, len(samples)+whitenFrame)
+
+	var window [whitenFrame]float64
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/whitenFrame))
+	}
+
+	frame := make([]complex128, whitenFrame)
+	for start := -whitenFrame; start < len(samples); start += whitenHop {
+		for i := range frame {
+			var v float64
+			if j := start + i; j >= 0 && j < len(samples) {
+				v = float64(samples[j])
+			}
+			frame[i] = complex(v*window[i], 0)
+		}
+		fft(frame, false)
+
+		for i, v := range frame {
+			frame[i] = v / complex(cmplx.Abs(v)+1, 0)
+		}
+		fft(frame, true)
+
+		// The windows overlap by three quarters, so their squares add up to 2.
+		for i, v := range frame {
+			if j := start + i; j >= 0 {
+				res[j] += real(v) * window[i] / (2 * whitenFrame)
+			}
+		}
+	}
+
+	return res[:len(samples)]
+}
@@ -0,0 +1,219 @@
+package watermark
+
+import (
+	"math"
+	"time"
+)
+
+// The watermark is kept below the masking threshold of the audio, as estimated by a psychoacoustic model
+// like the first model of ISO/IEC 11172-3 and Johnston's model for transform coding (IEEE JSAC, 1988).
+// The power of each critical band of a short frame is spread to the bands around it, and lowered by an
+// offset that is larger for tonal sounds such as vowels than for noise-like sounds such as fricatives.
+// The threshold of hearing is left out, since the level the audio is played at is not known, so the
+// threshold is only ever lower than a model that includes it would give.
+
+const (
+	// maskDuration is the shortest frame that the model divides the audio into.
+	maskDuration = 20 * time.Millisecond
+
+	// maskSpread is the number of bins on either side of a bin that its window spreads it into.
+	maskSpread = 2
+)
+
+// maskModel holds what the model needs for one sample rate.
+type maskModel struct {
+	frame  int       // length of a frame, a power of two
+	window []float64 // square root of a Hann window, so the frames add back up to the audio
+	band   []int     // critical band of each frequency bin from 0 to frame/2
+	bins   []int     // number of bins in each band
+	spread [][]float64
+	gain   []float64 // sum of spread[b], by which the spread power of band b is renormalized
+	limit  int       // number of bins below 4 kHz, where the watermark is
+
+	// rounding is the power in each band of the noise of rounding to 16 bits, which has a variance of
+	// 1/12 in each sample.
+	rounding []float64
+}
+
+func newMaskModel(sampleRate int) *maskModel {
+	n := 1
+	for n < int(maskDuration*time.Duration(sampleRate)/time.Second) {
+		n <<= 1
+	}
+
+	m := &maskModel{
+		frame:  n,
+		window: make([]float64, n),
+		band:   make([]int, n/2+1),
+	}
+	for i := range m.window {
+		m.window[i] = math.Sin(math.Pi * float64(i) / float64(n))
+	}
+
+	for k := range m.band {
+		if k*sampleRate < n*rate/2 {
+			m.limit = k + 1
+		}
+		b := int(bark(float64(k) * float64(sampleRate) / float64(n)))
+		for len(m.bins) <= b {
+			m.bins = append(m.bins, 0)
+		}
+		m.band[k] = b
+		m.bins[b]++
+	}
+
+	m.spread = make([][]float64, len(m.bins))
+	m.gain = make([]float64, len(m.bins))
+	m.rounding = make([]float64, len(m.bins))
+	for b := range m.spread {
+		m.rounding[b] = float64(m.bins[b]) / 12 * float64(n) / 2
+		m.spread[b] = make([]float64, len(m.bins))
+		for j := range m.spread[b] {
+			m.spread[b][j] = spreading(float64(b - j))
+			m.gain[b] += m.spread[b][j]
+		}
+	}
+
+	return m
+}
+
+// bark returns the critical band rate of a frequency in Hz, in Bark.
+func bark(f float64) float64 {
+	return 13*math.Atan(0.00076*f) + 3.5*math.Atan(f/7500*f/7500)
+}
+
+// spreading returns the fraction of the power of a masker that masks a sound dz Bark above it, from the
+// spreading function of Schroeder, Atal and Hall (JASA, 1979).
+func spreading(dz float64) float64 {
+	dz += 0.474
+	return math.Pow(10, (15.81+7.5*dz-17.5*math.Sqrt(1+dz*dz))/10)
+}
+
+// threshold returns, for each critical band, the power of noise that the frame with spectrum x masks,
+// summed over the bins of the band. x is the transform of a frame multiplied by the window.
+func (m *maskModel) threshold(x []complex128) []float64 {
+	power := make([]float64, len(m.bins))
+
+	// The spectral flatness measure says how tonal the frame is, from 0 dB for white noise down to -60
+	// dB or less for a pure tone.
+	var logSum, sum float64
+	var count int
+	for k, b := range m.band {
+		p := real(x[k])*real(x[k]) + imag(x[k])*imag(x[k])
+		power[b] += p
+		if p > 0 {
+			logSum += math.Log(p)
+			sum += p
+			count++
+		}
+	}
+	if count == 0 {
+		return power
+	}
+	flatness := 10 * math.Log10(math.Exp(logSum/float64(count))/(sum/float64(count)))
+	tonality := math.Min(flatness/-60, 1)
+
+	t := make([]float64, len(m.bins))
+	for b := range t {
+		var spread float64
+		for j, p := range power {
+			spread += p * m.spread[b][j]
+		}
+		offset := tonality*(14.5+float64(b+1)) + (1-tonality)*5.5
+		t[b] = spread / m.gain[b] * math.Pow(10, -offset/10)
+	}
+
+	return t
+}
+
+// shape returns mark filtered so that, in each frame and critical band, its power is strength times the
+// masking threshold of samples, or nothing where that is below the noise of rounding to 16 bits.
+// Frequencies that are not below 4 kHz are removed. The threshold of each frame is the lowest of it and
+// the frames on either side, because each frame overlaps those, so the watermark does not spread from
+// loud audio into the quiet audio just before or after it.
+func (m *maskModel) shape(samples []int16, mark []float64, strength float64) []float64 {
+	n, hop := m.frame, m.frame/2
+	frame := make([]complex128, n)
+
+	var starts []int
+	var thresholds [][]float64
+	for start := -hop; start < len(samples); start += hop {
+		for i := range frame {
+			var v float64
+			if j := start + i; j >= 0 && j < len(samples) {
+				v = float64(samples[j])
+			}
+			frame[i] = complex(v*m.window[i], 0)
+		}
+		fft(frame, false)
+
+		starts = append(starts, start)
+		thresholds = append(thresholds, m.threshold(frame))
+	}
+
+	out := make([]float64, len(samples))
+	power := make([]float64, len(m.bins))
+	for f, start := range starts {
+		for i := range frame {
+			var v float64
+			if j := start + i; j >= 0 && j < len(mark) {
+				v = mark[j]
+			}
+			frame[i] = complex(v*m.window[i], 0)
+		}
+		fft(frame, false)
+
+		for b := range power {
+			power[b] = 0
+		}
+		for k := 0; k < m.limit; k++ {
+			power[m.band[k]] += real(frame[k])*real(frame[k]) + imag(frame[k])*imag(frame[k])
+		}
+
+		gains := make([]float64, len(power))
+		for b := range gains {
+			if power[b] == 0 {
+				continue
+			}
+			t := thresholds[f][b]
+			if f > 0 {
+				t = math.Min(t, thresholds[f-1][b])
+			}
+			if f+1 < len(thresholds) {
+				t = math.Min(t, thresholds[f+1][b])
+			}
+			// A watermark below the noise of rounding the result to 16 bits would be lost in it, and
+			// rounding a watermark that small makes it louder.
+			if t *= strength; t > m.rounding[b] {
+				gains[b] = math.Sqrt(t / power[b])
+			}
+		}
+
+		// The windows spread each bin into the bins near it, so a bin near another band takes the lower
+		// gain of the two.
+		for k := 0; k <= n/2; k++ {
+			var g float64
+			if k < m.limit {
+				g = gains[m.band[k]]
+				for j := k - maskSpread; j <= k+maskSpread; j++ {
+					if j >= 0 && j < m.limit {
+						g = math.Min(g, gains[m.band[j]])
+					}
+				}
+			}
+			frame[k] *= complex(g, 0)
+			if k != 0 && k != n/2 {
+				frame[n-k] *= complex(g, 0)
+			}
+		}
+		fft(frame, true)
+
+		for i, v := range frame {
+			if j := start + i; j >= 0 && j < len(out) {
+				out[j] += real(v) * m.window[i] / float64(n)
+			}
+		}
+	}
+
+	return out
+}
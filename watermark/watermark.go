@@ -0,0 +1,246 @@
+// Package watermark hides a payload in 16-bit mono audio from package espeak, so that synthesized
+// speech can be recognized as synthetic later on, and detects it again.
+//
+// The watermark is spread-spectrum noise below 4 kHz, shaped in each short frame to stay below the
+// masking threshold of the audio that a psychoacoustic model estimates, so it is hidden under the speech
+// and absent from silence. The model is the kind that lossy encoders use to hide their own noise; it is
+// not a listening test, and a listener may still hear a watermark made stronger than the default. The
+// watermark is made at a fixed rate of 8000 samples per second, so it survives resampling to any common
+// rate, and it is spread thinly over a wide band, so it survives lossy encoding such as MP3. The payload
+// repeats every few seconds; Detect can read it from any part of the audio that is long enough, and
+// combines the repeats in longer audio.
+//
+// The watermark is keyed: only a detector with the same Key finds it.
+package watermark // import "gopkg.in/BenLubar/espeak.v2/watermark"
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+const (
+	// rate is the sample rate of the watermark.
+	rate = 8000
+
+	// chipLength is the number of samples in each chip of the spreading sequence.
+	chipLength = 2
+
+	// symbolLength is the number of samples that carry each bit of the message.
+	symbolLength = 128
+
+	// A message is a sync word followed by the payload and its CRC, protected by an error correcting code,
+	// with one symbol for each bit.
+	syncBits      = 32
+	payloadBits   = 80
+	crcBits       = 16
+	dataBits      = payloadBits + crcBits
+	codedBits     = 2 * (dataBits + tailBits)
+	messageLength = syncBits + codedBits
+
+	// defaultStrength is the Strength used when Options does not set one, in dB.
+	defaultStrength = -6
+)
+
+// MessageDuration is the length of audio that holds the payload once. Detect needs at least this much
+// watermarked audio to read the payload, and usually several times as much.
+const MessageDuration = time.Duration(messageLength*symbolLength) * time.Second / rate
+
+// Payload is the information carried by a watermark.
+type Payload struct {
+	// Generator identifies the program or voice that made the audio.
+	Generator uint16
+
+	// Time is when the audio was made. It is stored to the second, from 1970 to 2106.
+	Time time.Time
+
+	// Hash identifies the request that the audio was made for, such as the result of HashRequest.
+	Hash uint32
+}
+
+// HashRequest returns a Hash for a request, made from the first four bytes of its SHA-256 hash.
+func HashRequest(request []byte) uint32 {
+	sum := sha256.Sum256(request)
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// bytes returns the payload as it is stored in a message.
+func (p *Payload) bytes() []byte {
+	b := make([]byte, payloadBits/8)
+	binary.BigEndian.PutUint16(b[0:], p.Generator)
+	binary.BigEndian.PutUint32(b[2:], uint32(p.Time.Unix()))
+	binary.BigEndian.PutUint32(b[6:], p.Hash)
+	return b
+}
+
+// parsePayload is the inverse of Payload.bytes.
+func parsePayload(b []byte) *Payload {
+	return &Payload{
+		Generator: binary.BigEndian.Uint16(b[0:]),
+		Time:      time.Unix(int64(binary.BigEndian.Uint32(b[2:])), 0).UTC(),
+		Hash:      binary.BigEndian.Uint32(b[6:]),
+	}
+}
+
+// crc16 returns the CRC-16/CCITT-FALSE checksum of b.
+func crc16(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Options controls how a watermark is made and found. A nil *Options uses the defaults.
+type Options struct {
+	// Key selects the pseudo-random sequences that the watermark is made of. A watermark made with one
+	// Key is not found by a detector with another.
+	Key string
+
+	// Strength is the level of the watermark relative to the masking threshold of the audio, in dB. If it
+	// is 0, -6 dB is used, which leaves room for the error of the model. A weaker watermark is harder to
+	// hear but needs more audio to be found, and a watermark above the threshold may be heard.
+	Strength float64
+}
+
+// sequences are the pseudo-random parts of a watermark with a given key.
+type sequences struct {
+	chips    [symbolLength]float64 // spreading sequence, one value per sample
+	scramble [messageLength]float64
+	sync     [syncBits]float64
+}
+
+func (o *Options) sequences() *sequences {
+	h := fnv.New64a()
+	h.Write([]byte("espeak watermark\x00"))
+	if o != nil {
+		h.Write([]byte(o.Key))
+	}
+	state := h.Sum64()
+
+	// sign returns 1 or -1 from a splitmix64 generator.
+	sign := func() float64 {
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+		z = (z ^ z>>27) * 0x94D049BB133111EB
+		z ^= z >> 31
+		if z&1 == 0 {
+			return -1
+		}
+		return 1
+	}
+
+	s := &sequences{}
+	for i := 0; i < symbolLength; i += chipLength {
+		c := sign()
+		for j := 0; j < chipLength; j++ {
+			s.chips[i+j] = c
+		}
+	}
+	for i := range s.scramble {
+		s.scramble[i] = sign()
+	}
+	for i := range s.sync {
+		s.sync[i] = sign()
+	}
+
+	return s
+}
+
+func (o *Options) strength() float64 {
+	if o == nil || o.Strength == 0 {
+		return defaultStrength
+	}
+	return o.Strength
+}
+
+// message returns the sign of each symbol of the message that carries p.
+func (s *sequences) message(p *Payload) []float64 {
+	b := p.bytes()
+	crc := crc16(b)
+	b = append(b, byte(crc>>8), byte(crc))
+
+	bits := make([]int, dataBits+tailBits)
+	for i := 0; i < dataBits; i++ {
+		bits[i] = int(b[i/8] >> (7 - uint(i%8)) & 1)
+	}
+
+	m := make([]float64, messageLength)
+	copy(m, s.sync[:])
+	for i, c := range encode(bits) {
+		m[syncBits+interleave(i)] = float64(2*c - 1)
+	}
+	for i := range m {
+		m[i] *= s.scramble[i]
+	}
+
+	return m
+}
+
+// Embed returns a copy of samples with a watermark carrying p added below their masking threshold.
+// Samples that become too loud are clipped. Embed panics if the sample rate is not positive.
+func Embed(samples []int16, sampleRate int, p Payload, opts *Options) []int16 {
+	if sampleRate <= 0 {
+		panic("watermark: sample rate must be positive")
+	}
+
+	mark := shapedMark(samples, sampleRate, &p, opts)
+
+	out := make([]int16, len(samples))
+	for i, v := range samples {
+		out[i] = clip16(float64(v) + mark[i])
+	}
+
+	return out
+}
+
+// shapedMark returns the watermark that Embed adds to samples, before it is rounded to 16 bits.
+func shapedMark(samples []int16, sampleRate int, p *Payload, opts *Options) []float64 {
+	s := opts.sequences()
+	message := s.message(p)
+
+	// The watermark is made at 8000 Hz with room to spare, at a level that survives the conversion to
+	// 16 bits, and then converted to the sample rate of the audio.
+	const level = 8192
+	n := int((int64(len(samples))*rate+int64(sampleRate)-1)/int64(sampleRate)) + symbolLength
+	mark := make([]int16, n)
+	for i := range mark {
+		symbol := i / symbolLength
+		mark[i] = int16(level * message[symbol%messageLength] * s.chips[i%symbolLength])
+	}
+	if sampleRate != rate {
+		mark = resample.Resample(mark, rate, sampleRate)
+	}
+
+	// It is then shaped to the masking threshold of the audio, frame by frame and band by band.
+	unshaped := make([]float64, len(samples))
+	for i := range unshaped {
+		unshaped[i] = float64(mark[i])
+	}
+	return newMaskModel(sampleRate).shape(samples, unshaped, math.Pow(10, opts.strength()/10))
+}
+
+// clip16 rounds v to the nearest sample, clipping it to the range of a 16-bit sample.
+func clip16(v float64) int16 {
+	v = math.Floor(v + 0.5)
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	default:
+		return int16(v)
+	}
+}
@@ -0,0 +1,312 @@
+package watermark
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/internal/mp3test"
+	"gopkg.in/BenLubar/espeak.v2/mp3"
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+var payload = Payload{
+	Generator: 7,
+	Time:      time.Date(2026, 10, 19, 12, 30, 45, 0, time.UTC),
+	Hash:      HashRequest([]byte("Hello, world.")),
+}
+
+// speech returns audio that is like speech: a voice with harmonics and a changing pitch that is heard in
+// syllables, with a pause every two seconds.
+func speech(d time.Duration, sampleRate int) []int16 {
+	samples := make([]int16, int(d*time.Duration(sampleRate)/time.Second))
+	noise := uint32(1)
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+
+		level := math.Max(0, math.Sin(2*math.Pi*4*t))
+		if math.Mod(t, 2) > 1.6 {
+			level = 0
+		}
+
+		pitch := 120 + 20*math.Sin(2*math.Pi*0.7*t)
+		var v float64
+		for h := 1; h <= 20; h++ {
+			v += math.Sin(2*math.Pi*pitch*float64(h)*t) / float64(h)
+		}
+
+		noise ^= noise << 13
+		noise ^= noise >> 17
+		noise ^= noise << 5
+		v += 0.05 * (float64(noise)/(1<<31) - 1)
+
+		samples[i] = int16(6000 * level * v)
+	}
+	return samples
+}
+
+func TestCode(t *testing.T) {
+	bits := make([]int, dataBits+tailBits)
+	for i := 0; i < dataBits; i++ {
+		bits[i] = i * 7 % 3 & 1
+	}
+
+	soft := make([]float64, codedBits)
+	for i, c := range encode(bits) {
+		soft[i] = float64(2*c - 1)
+	}
+
+	// A run of coded bits is unknown, and some others are wrong.
+	for i := 40; i < 50; i++ {
+		soft[i] = 0
+	}
+	for _, i := range []int{3, 100, 150} {
+		soft[i] = -soft[i]
+	}
+
+	if got := decode(soft); !reflect.DeepEqual(got, bits) {
+		t.Errorf("decoded\n%v\nwant\n%v", got, bits)
+	}
+}
+
+// noiseToMask returns how far mark rises above the masking threshold of in, in dB, in the frame and
+// critical band where it rises the most.
+func noiseToMask(in []int16, mark []float64, sampleRate int) float64 {
+	m := newMaskModel(sampleRate)
+	n := m.frame
+	x := make([]complex128, n)
+	e := make([]complex128, n)
+
+	worst := math.Inf(-1)
+	for start := 0; start+n <= len(in); start += n / 2 {
+		for i := range x {
+			x[i] = complex(float64(in[start+i])*m.window[i], 0)
+			e[i] = complex(mark[start+i]*m.window[i], 0)
+		}
+		fft(x, false)
+		fft(e, false)
+
+		power := make([]float64, len(m.bins))
+		for k, b := range m.band {
+			power[b] += real(e[k])*real(e[k]) + imag(e[k])*imag(e[k])
+		}
+		for b, t := range m.threshold(x) {
+			if power[b] > 0 {
+				worst = math.Max(worst, 10*math.Log10(power[b]/t))
+			}
+		}
+	}
+
+	return worst
+}
+
+func TestMaskModel(t *testing.T) {
+	const sampleRate = 16000
+	m := newMaskModel(sampleRate)
+
+	spectrum := func(f func(i int) float64) (power, threshold []float64) {
+		x := make([]complex128, m.frame)
+		for i := range x {
+			x[i] = complex(f(i)*m.window[i], 0)
+		}
+		fft(x, false)
+
+		power = make([]float64, len(m.bins))
+		for k, b := range m.band {
+			power[b] += real(x[k])*real(x[k]) + imag(x[k])*imag(x[k])
+		}
+		return power, m.threshold(x)
+	}
+
+	// A tone masks noise about 14.5+z dB below it in its own band z, and noise masks noise about 5.5 dB
+	// below it, less what spreads to the bands around it.
+	const freq = 1000.5
+	band := m.band[int(freq*float64(m.frame)/sampleRate)]
+	power, threshold := spectrum(func(i int) float64 {
+		return 10000 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate)
+	})
+	if below := 10 * math.Log10(power[band]/threshold[band]); below < 14.5+float64(band) || below > 30+float64(band) {
+		t.Errorf("tone masks noise %.1f dB below it in band %d", below, band)
+	}
+
+	noise := uint32(1)
+	power, threshold = spectrum(func(int) float64 {
+		noise ^= noise << 13
+		noise ^= noise >> 17
+		noise ^= noise << 5
+		return 10000 * (float64(noise)/(1<<31) - 1)
+	})
+	for _, band := range []int{5, 10, 15} {
+		if below := 10 * math.Log10(power[band]/threshold[band]); below < 5.5 || below > 14 {
+			t.Errorf("noise masks noise %.1f dB below it in band %d", below, band)
+		}
+	}
+
+	// Silence masks nothing.
+	_, threshold = spectrum(func(int) float64 { return 0 })
+	for b, v := range threshold {
+		if v != 0 {
+			t.Errorf("silence masks %v in band %d", v, b)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	in := speech(30*time.Second, 22050)
+	out := Embed(in, 22050, payload, nil)
+
+	// The watermark stays below the masking threshold in every frame and band. Rounding to 16 bits adds
+	// the same noise as any other change to the audio would.
+	mark := shapedMark(in, 22050, &payload, nil)
+	if nmr := noiseToMask(in, mark, 22050); nmr > 0 {
+		t.Errorf("watermark rises %.1f dB above the masking threshold", nmr)
+	}
+	for i, v := range in {
+		if want := clip16(float64(v) + mark[i]); out[i] != want {
+			t.Fatalf("sample %d is %d, want %d", i, out[i], want)
+		}
+	}
+
+	// The pauses are still silent.
+	for i := 22050 * 165 / 100; i < 22050*195/100; i++ {
+		if out[i] != 0 {
+			t.Fatalf("sample %d in a pause is %d", i, out[i])
+		}
+	}
+
+	d := Detect(out, 22050, nil)
+	if d.Payload == nil || !reflect.DeepEqual(*d.Payload, payload) {
+		t.Errorf("payload is %+v, want %+v", d.Payload, payload)
+	}
+	if d.Confidence < 0.999 {
+		t.Errorf("confidence is %v", d.Confidence)
+	}
+
+	for name, opts := range map[string]*Options{"no watermark": nil, "another key": {Key: "another key"}} {
+		audio := in
+		if opts != nil {
+			audio = out
+		}
+		if d := Detect(audio, 22050, opts); d.Payload != nil || d.Confidence > 0.999 {
+			t.Errorf("%s: found %+v with confidence %v", name, d.Payload, d.Confidence)
+		}
+	}
+}
+
+func TestEmbedSampleRates(t *testing.T) {
+	// Neighbouring frames and bins overlap, so the watermark may rise a little above the strength.
+	for _, sampleRate := range []int{8000, 16000, 48000} {
+		in := speech(5*time.Second, sampleRate)
+		for _, strength := range []float64{-3, -6, -12} {
+			mark := shapedMark(in, sampleRate, &payload, &Options{Strength: strength})
+			if nmr := noiseToMask(in, mark, sampleRate); nmr > strength+3 {
+				t.Errorf("%d Hz at %v dB: watermark rises %.1f dB above the masking threshold", sampleRate, strength, nmr)
+			}
+		}
+	}
+}
+
+func TestDetectChanged(t *testing.T) {
+	in := speech(30*time.Second, 22050)
+	out := Embed(in, 22050, payload, &Options{Key: "secret"})
+
+	quieter := make([]int16, len(out))
+	for i, v := range out {
+		// Half as loud, upside down, and with noise at -40 dB.
+		quieter[i] = -v/2 + int16(i*7919%201-100)
+	}
+
+	for name, test := range map[string]struct {
+		samples    []int16
+		sampleRate int
+	}{
+		"8 kHz":   {resample.Resample(out, 22050, 8000), 8000},
+		"48 kHz":  {resample.Resample(out, 22050, 48000), 48000},
+		"cut":     {out[12345:], 22050},
+		"quieter": {quieter, 22050},
+	} {
+		d := Detect(test.samples, test.sampleRate, &Options{Key: "secret"})
+		if d.Payload == nil || !reflect.DeepEqual(*d.Payload, payload) {
+			t.Errorf("%s: payload is %+v", name, d.Payload)
+		}
+	}
+
+	// Too little audio for the payload may still show the watermark.
+	short := out[:MessageDuration/2*22050/time.Second]
+	if d := Detect(short, 22050, &Options{Key: "secret"}); d.Payload != nil {
+		t.Errorf("payload from %v of audio", MessageDuration/2)
+	}
+}
+
+func TestDetectConfidence(t *testing.T) {
+	// Audio without a watermark, or with a watermark with another key, has a Confidence spread evenly
+	// from 0 to 1, however long it is. The Kolmogorov-Smirnov statistic of 100 such recordings is then
+	// below 0.163 99 times in 100.
+	const sampleRate = 8000
+	voice := speech(20*time.Second, sampleRate)
+	marked := Embed(voice, sampleRate, payload, nil)
+	rng := rand.New(rand.NewSource(1))
+
+	confidences := make([]float64, 100)
+	for i := range confidences {
+		audio := make([]int16, (5+i%4*5)*sampleRate)
+		switch i % 3 {
+		case 0:
+			for j := range audio {
+				audio[j] = int16(rng.NormFloat64() * 1000)
+			}
+		case 1:
+			copy(audio, voice)
+		case 2:
+			copy(audio, marked)
+		}
+		confidences[i] = Detect(audio, sampleRate, &Options{Key: strconv.Itoa(i)}).Confidence
+	}
+
+	sort.Float64s(confidences)
+	var ks float64
+	for i, c := range confidences {
+		n := float64(len(confidences))
+		ks = math.Max(ks, math.Max(c-float64(i)/n, float64(i+1)/n-c))
+	}
+	if ks > 0.163 {
+		t.Errorf("confidence is not spread evenly: Kolmogorov-Smirnov statistic %.3f", ks)
+		t.Logf("confidences %.3f", confidences)
+	}
+}
+
+func TestEmbedMP3(t *testing.T) {
+	opts := &mp3.Options{SampleRate: 16000, Bitrate: 32}
+	in := Embed(speech(60*time.Second, opts.SampleRate), opts.SampleRate, payload, nil)
+
+	var buf bytes.Buffer
+	e, err := mp3.NewEncoder(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteSamples(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var d mp3test.Decoder
+	out, err := d.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]int16, len(out))
+	for i, v := range out {
+		samples[i] = clip16(v * 32768)
+	}
+
+	if got := Detect(samples, opts.SampleRate, nil).Payload; got == nil || !reflect.DeepEqual(*got, payload) {
+		t.Errorf("payload is %+v, want %+v", got, payload)
+	}
+}
@@ -0,0 +1,51 @@
+package espeak_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/watermark"
+)
+
+func TestWatermark(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 6)
+	ctx := synthesize(t, 22050, text)
+	ctx.SetSampleRate(44100)
+
+	payload := watermark.Payload{
+		Generator: 42,
+		Time:      time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		Hash:      watermark.HashRequest([]byte(text)),
+	}
+	opts := &watermark.Options{Key: "test"}
+	ctx.Watermark(payload, opts)
+
+	var wav, flac bytes.Buffer
+	if _, err := ctx.WriteTo(&wav); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.WriteFLAC(&flac, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"wav": wav.Bytes(), "flac": flac.Bytes()} {
+		d, err := espeak.DetectWatermark(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if d.Payload == nil || !reflect.DeepEqual(*d.Payload, payload) {
+			t.Errorf("%s: payload is %+v with confidence %v", name, d.Payload, d.Confidence)
+		}
+	}
+
+	d, err := espeak.DetectWatermark(bytes.NewReader(wav.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Payload != nil {
+		t.Errorf("found %+v without the key", d.Payload)
+	}
+}
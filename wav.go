@@ -4,63 +4,202 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
-// WriteTo writes the Samples in this Context to an io.Writer in WAV format.
+// maxRIFFSize is the largest size that can be stored in a RIFF chunk header. Files that would be larger
+// are written in the RF64 format from EBU Tech 3306, which stores 64-bit sizes in a ds64 chunk and this
+// value in the RIFF and data chunk headers.
+const maxRIFFSize = 0xFFFFFFFF
+
+// riffSizeLimit is the largest RIFF size that is written as a plain WAV file. It is only a variable as a
+// test hook: the tests lower it to exercise RF64 and the size error of WAV-only codecs without writing
+// gigabytes of data. Nothing else may change it.
+var riffSizeLimit uint64 = maxRIFFSize
+
+// based on https://gist.github.com/Jon-Schneider/8b7c53d27a7a13346a643dac9c19d34f
+type riffHeader struct {
+	RiffHeader [4]byte
+	WavSize    uint32
+	WaveHeader [4]byte
+}
+
+type ds64Chunk struct {
+	Ds64Header  [4]byte
+	ChunkSize   uint32
+	RiffSize    uint64
+	DataSize    uint64
+	SampleCount uint64
+	TableLength uint32
+}
+
+type fmtChunk struct {
+	FmtHeader       [4]byte
+	FmtChunkSize    uint32
+	AudioFormat     uint16
+	NumChannels     uint16
+	SampleRate      uint32
+	ByteRate        uint32
+	SampleAlignment uint16
+	BitDepth        uint16
+}
+
+// fmtExtensionSize is the size of the extension of a WAVE_FORMAT_EXTENSIBLE fmt chunk: the number of
+// valid bits, the channel mask, and the GUID of the format.
+const fmtExtensionSize = 22
+
+// extensibleGUID is the end of the GUID of a WAVE_FORMAT_EXTENSIBLE format. The first two bytes are the
+// format tag.
+var extensibleGUID = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+type chunkHeader struct {
+	ID   [4]byte
+	Size uint32
+}
+
+// WriteTo writes the Samples in this Context to an io.Writer in WAV format. If the audio is too long to
+// fit in a WAV file, it is written in the compatible RF64 format instead.
+//
+// WriteTo needs all of the samples up front. To write a file while it is still being synthesized, use
+// the Writer in package gopkg.in/BenLubar/espeak.v2/wav.
 func (ctx *Context) WriteTo(w io.Writer) (int64, error) {
-	check32 := func(n int) int32 {
-		if n < 0 {
-			panic(fmt.Sprintf("espeak: unexpected negative number in wav: %d (possible overflow?)", n))
-		}
+	return ctx.WriteWAV(w, nil)
+}
 
-		if int(int32(n)) != n {
-			panic(fmt.Sprintf("espeak: value %d in wav header overflows int32", n))
-		}
+// WriteWAV is like WriteTo, but opts can add metadata to the file. A nil opts is the same as WriteTo.
+func (ctx *Context) WriteWAV(w io.Writer, opts *WAVOptions) (int64, error) {
+	return ctx.writeWAV(w, opts, ctx.Samples, Mono)
+}
+
+// writeWAV writes interleaved samples with the given layout, using the events and settings of ctx for
+// metadata.
+func (ctx *Context) writeWAV(w io.Writer, opts *WAVOptions, samples []int16, layout Layout) (int64, error) {
+	if opts == nil {
+		opts = &WAVOptions{}
+	}
+
+	enc, err := newSampleEncoder(opts.Format, binary.LittleEndian, opts.Dither)
+	if err != nil {
+		return 0, err
+	}
+
+	channels := layout.Channels()
+	width := opts.Format.Size()
+	frameSize := width * channels
+	frames := len(samples) / channels
+	sampleRate := ctx.SampleRate()
+	if sampleRate <= 0 || int64(sampleRate)*int64(frameSize) > maxRIFFSize {
+		return 0, fmt.Errorf("espeak: sample rate %d cannot be stored in a wav file", sampleRate)
+	}
+	if frameSize > math.MaxUint16 {
+		return 0, fmt.Errorf("espeak: %d channels cannot be stored in a wav file", channels)
+	}
+
+	format := fmtChunk{
+		FmtHeader:       [...]byte{'f', 'm', 't', ' '},
+		FmtChunkSize:    16,
+		AudioFormat:     wavFormatPCM,
+		NumChannels:     uint16(channels),
+		SampleRate:      uint32(sampleRate),
+		ByteRate:        uint32(sampleRate * frameSize),
+		SampleAlignment: uint16(frameSize),
+		BitDepth:        uint16(width * 8),
+	}
 
-		return int32(n)
+	// Formats other than integer PCM need an empty cbSize field at the end of the fmt chunk, followed by
+	// a fact chunk holding the number of samples.
+	switch opts.Format {
+	case Float32:
+		format.AudioFormat = wavFormatIEEEFloat
+	case ULaw:
+		format.AudioFormat = wavFormatMuLaw
+	case ALaw:
+		format.AudioFormat = wavFormatALaw
 	}
 
-	// based on https://gist.github.com/Jon-Schneider/8b7c53d27a7a13346a643dac9c19d34f
-	var header struct {
-		RiffHeader [4]byte
-		WavSize    int32
-		WaveHeader [4]byte
-
-		FmtHeader       [4]byte
-		FmtChunkSize    int32
-		AudioFormat     int16
-		NumChannels     int16
-		SampleRate      int32
-		ByteRate        int32
-		SampleAlignment int16
-		BitDepth        int16
-
-		DataHeader [4]byte
-		DataBytes  int32
+	// Layouts other than mono and stereo need WAVE_FORMAT_EXTENSIBLE to store the channel mask, which
+	// moves the format tag into the extension.
+	var extension []byte
+	if layout != Mono && layout != Stereo {
+		extension = make([]byte, 2+fmtExtensionSize)
+		binary.LittleEndian.PutUint16(extension, fmtExtensionSize)
+		binary.LittleEndian.PutUint16(extension[2:], format.BitDepth)
+		binary.LittleEndian.PutUint32(extension[4:], uint32(layout))
+		binary.LittleEndian.PutUint16(extension[8:], format.AudioFormat)
+		copy(extension[10:], extensibleGUID[:])
+
+		format.FmtChunkSize += uint32(len(extension))
+		format.AudioFormat = wavFormatExtensible
 	}
 
-	// RIFF header
-	header.RiffHeader = [...]byte{'R', 'I', 'F', 'F'}
-	header.WavSize = check32(len(ctx.Samples)*2 + binary.Size(header) - 8)
-	header.WaveHeader = [...]byte{'W', 'A', 'V', 'E'}
-
-	// Format header
-	header.FmtHeader = [...]byte{'f', 'm', 't', ' '}
-	header.FmtChunkSize = 16
-	header.AudioFormat = 1
-	header.NumChannels = 1
-	header.SampleRate = check32(SampleRate())
-	header.ByteRate = check32(SampleRate() * 2)
-	header.SampleAlignment = 2
-	header.BitDepth = 16
-
-	// Data
-	header.DataHeader = [...]byte{'d', 'a', 't', 'a'}
-	header.DataBytes = check32(len(ctx.Samples) * 2)
+	var fact []byte
+	if format.AudioFormat != wavFormatPCM {
+		if extension == nil {
+			format.FmtChunkSize += 2
+			fact = make([]byte, 2+12)
+		} else {
+			fact = make([]byte, 12)
+		}
+		copy(fact[len(fact)-12:], "fact")
+		binary.LittleEndian.PutUint32(fact[len(fact)-8:], 4)
+		binary.LittleEndian.PutUint32(fact[len(fact)-4:], uint32(frames))
+	}
+
+	// Metadata is small, so it is built in memory first to find the size of the file.
+	info := ctx.infoChunk(opts.Info)
+	cues := ctx.cueChunks(opts, sampleRate)
+
+	// Chunks start at even offsets, so an odd-length data chunk is followed by a pad byte that is not
+	// counted in its size.
+	dataBytes := uint64(len(samples)) * uint64(width)
+	var pad []byte
+	if dataBytes%2 == 1 {
+		pad = []byte{0}
+	}
+	riffSize := uint64(4+binary.Size(format)+len(extension)+len(fact)+len(info)+binary.Size(chunkHeader{})+len(pad)+len(cues)) + dataBytes
+
+	header := riffHeader{
+		RiffHeader: [...]byte{'R', 'I', 'F', 'F'},
+		WavSize:    uint32(riffSize),
+		WaveHeader: [...]byte{'W', 'A', 'V', 'E'},
+	}
+	data := chunkHeader{
+		ID:   [...]byte{'d', 'a', 't', 'a'},
+		Size: uint32(dataBytes),
+	}
 
 	cw := countWriter{w: w}
-	cw.check(binary.Write(&cw, binary.LittleEndian, &header))
-	cw.check(binary.Write(&cw, binary.LittleEndian, ctx.Samples))
+
+	if riffSize > riffSizeLimit {
+		ds64 := ds64Chunk{
+			Ds64Header:  [...]byte{'d', 's', '6', '4'},
+			ChunkSize:   28,
+			RiffSize:    riffSize + 36,
+			DataSize:    dataBytes,
+			SampleCount: uint64(frames),
+		}
+
+		header.RiffHeader = [...]byte{'R', 'F', '6', '4'}
+		header.WavSize = maxRIFFSize
+		data.Size = maxRIFFSize
+		if fact != nil {
+			binary.LittleEndian.PutUint32(fact[len(fact)-4:], maxRIFFSize)
+		}
+
+		cw.check(binary.Write(&cw, binary.LittleEndian, &header))
+		cw.check(binary.Write(&cw, binary.LittleEndian, &ds64))
+	} else {
+		cw.check(binary.Write(&cw, binary.LittleEndian, &header))
+	}
+
+	cw.check(binary.Write(&cw, binary.LittleEndian, &format))
+	cw.Write(extension)
+	cw.Write(fact)
+	cw.Write(info)
+	cw.check(binary.Write(&cw, binary.LittleEndian, &data))
+	cw.writeSamples(samples, enc)
+	cw.Write(pad)
+	cw.Write(cues)
 
 	return cw.n, cw.err
 }
@@ -87,3 +226,24 @@ func (cw *countWriter) check(err error) {
 		cw.err = err
 	}
 }
+
+// writeSamples encodes samples a block at a time, so that long recordings do not need to be copied in
+// full.
+func (cw *countWriter) writeSamples(samples []int16, enc *sampleEncoder) {
+	var buf [4096]byte
+
+	width := enc.format.Size()
+	for len(samples) != 0 && cw.err == nil {
+		n := len(samples)
+		if n > len(buf)/width {
+			n = len(buf) / width
+		}
+
+		for i, s := range samples[:n] {
+			enc.put(buf[i*width:], s)
+		}
+
+		cw.Write(buf[:n*width])
+		samples = samples[n:]
+	}
+}
@@ -0,0 +1,249 @@
+// Package wav encodes audio from package espeak as a stream in the WAVE file format.
+package wav // import "gopkg.in/BenLubar/espeak.v2/wav"
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// unknownLength is stored in the RIFF and data chunk sizes when the length of the stream is not known
+// and cannot be fixed afterwards. Most decoders treat it as "read until the end of the file". RF64 files
+// also store it in those fields, with the real sizes in the ds64 chunk.
+const unknownLength = 0xFFFFFFFF
+
+// riffSizeLimit is the largest RIFF size that Close stores in the header before converting the file to
+// RF64. It is only a variable as a test hook: the tests lower it to exercise the RF64 conversion without
+// writing gigabytes of data. Nothing else may change it.
+var riffSizeLimit int64 = unknownLength
+
+type riffHeader struct {
+	RiffHeader [4]byte
+	WavSize    uint32
+	WaveHeader [4]byte
+}
+
+// ds64Chunk holds the 64-bit sizes of an RF64 file (EBU Tech 3306). Seekable files reserve space for it
+// with a JUNK chunk of the same size, which Close replaces if the file grows too large for RIFF.
+type ds64Chunk struct {
+	Ds64Header  [4]byte
+	ChunkSize   uint32
+	RiffSize    uint64
+	DataSize    uint64
+	SampleCount uint64
+	TableLength uint32
+}
+
+// fmtChunk and the data chunk header for 16-bit mono PCM.
+type fmtChunk struct {
+	FmtHeader       [4]byte
+	FmtChunkSize    uint32
+	AudioFormat     uint16
+	NumChannels     uint16
+	SampleRate      uint32
+	ByteRate        uint32
+	SampleAlignment uint16
+	BitDepth        uint16
+
+	DataHeader [4]byte
+	DataBytes  uint32
+}
+
+// sizes of the header structures
+const (
+	riffHeaderSize = 12
+	ds64ChunkSize  = 36
+	fmtChunkSize   = 32
+)
+
+// Writer encodes 16-bit mono PCM samples as a WAVE file without knowing the length in advance.
+//
+// A placeholder header is written by NewWriter. If the destination is an io.WriteSeeker, Close goes back
+// and fills in the real sizes, switching to the RF64 format if the file is larger than 4 GiB. Otherwise,
+// the sizes are left as 0xFFFFFFFF, the conventional value for a stream of unknown length.
+type Writer struct {
+	w     io.Writer
+	n     int64 // bytes of sample data written
+	start int64 // offset of the header in a seekable destination, or -1
+	err   error
+
+	sampleRate int
+	resampler  *resample.Resampler // converts from the input rate set by SetInputRate, or nil
+}
+
+// NewWriter writes a WAVE header for audio at the given sample rate to w and returns a Writer that
+// appends samples to it. Use espeak.Context.SampleRate for audio generated by package espeak.
+func NewWriter(w io.Writer, sampleRate int) (*Writer, error) {
+	if sampleRate <= 0 || int64(sampleRate)*2 > unknownLength {
+		return nil, errors.New("wav: invalid sample rate")
+	}
+
+	wr := &Writer{w: w, start: -1, sampleRate: sampleRate}
+
+	if s, ok := w.(io.WriteSeeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			wr.start = start
+		}
+	}
+
+	header := riffHeader{
+		RiffHeader: [...]byte{'R', 'I', 'F', 'F'},
+		WavSize:    unknownLength,
+		WaveHeader: [...]byte{'W', 'A', 'V', 'E'},
+	}
+
+	junk := ds64Chunk{
+		Ds64Header: [...]byte{'J', 'U', 'N', 'K'},
+		ChunkSize:  ds64ChunkSize - 8,
+	}
+
+	format := fmtChunk{
+		FmtHeader:       [...]byte{'f', 'm', 't', ' '},
+		FmtChunkSize:    16,
+		AudioFormat:     1,
+		NumChannels:     1,
+		SampleRate:      uint32(sampleRate),
+		ByteRate:        uint32(sampleRate * 2),
+		SampleAlignment: 2,
+		BitDepth:        16,
+
+		DataHeader: [...]byte{'d', 'a', 't', 'a'},
+		DataBytes:  unknownLength,
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if wr.start != -1 {
+		if err := binary.Write(w, binary.LittleEndian, &junk); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &format); err != nil {
+		return nil, err
+	}
+
+	return wr, nil
+}
+
+// SetInputRate sets the sample rate of the audio passed to WriteSamples, if it differs from the sample
+// rate of the file. The samples are converted as they are written. SetInputRate must be called before
+// the first call to WriteSamples.
+func (w *Writer) SetInputRate(rate int) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.n != 0 || w.resampler != nil {
+		return errors.New("wav: SetInputRate called after WriteSamples")
+	}
+
+	if rate <= 0 {
+		return errors.New("wav: invalid sample rate")
+	}
+
+	if rate != w.sampleRate {
+		w.resampler = resample.New(rate, w.sampleRate)
+	}
+
+	return nil
+}
+
+// WriteSamples appends samples to the data chunk. Once an error has occurred, WriteSamples and Close
+// return that error without writing anything.
+func (w *Writer) WriteSamples(samples []int16) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.resampler != nil {
+		samples = w.resampler.Process(samples)
+	}
+
+	return w.write(samples)
+}
+
+func (w *Writer) write(samples []int16) error {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	w.err = err
+
+	return err
+}
+
+// Close finishes the file. If the destination is seekable, the sizes in the header are updated and the
+// destination is left positioned at the end of the file. Close does not close the destination.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.resampler != nil {
+		if err := w.write(w.resampler.Flush()); err != nil {
+			return err
+		}
+	}
+
+	w.err = errors.New("wav: Writer is closed")
+
+	if w.start == -1 {
+		return nil
+	}
+
+	s := w.w.(io.WriteSeeker)
+	riffSize := ds64ChunkSize + fmtChunkSize + 4 + w.n
+	end := w.start + 8 + riffSize
+
+	header := riffHeader{
+		RiffHeader: [...]byte{'R', 'I', 'F', 'F'},
+		WavSize:    uint32(riffSize),
+		WaveHeader: [...]byte{'W', 'A', 'V', 'E'},
+	}
+	dataBytes := uint32(w.n)
+
+	if riffSize > riffSizeLimit {
+		header.RiffHeader = [...]byte{'R', 'F', '6', '4'}
+		header.WavSize = unknownLength
+		dataBytes = unknownLength
+
+		ds64 := ds64Chunk{
+			Ds64Header:  [...]byte{'d', 's', '6', '4'},
+			ChunkSize:   ds64ChunkSize - 8,
+			RiffSize:    uint64(riffSize),
+			DataSize:    uint64(w.n),
+			SampleCount: uint64(w.n / 2),
+		}
+
+		if err := writeAt(s, w.start+riffHeaderSize, &ds64); err != nil {
+			return err
+		}
+	}
+
+	if err := writeAt(s, w.start, &header); err != nil {
+		return err
+	}
+
+	if err := writeAt(s, w.start+riffHeaderSize+ds64ChunkSize+fmtChunkSize-4, dataBytes); err != nil {
+		return err
+	}
+
+	_, err := s.Seek(end, io.SeekStart)
+	return err
+}
+
+func writeAt(s io.WriteSeeker, offset int64, v interface{}) error {
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return binary.Write(s, binary.LittleEndian, v)
+}
@@ -0,0 +1,170 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+
+	n := copy(b.buf[b.pos:], p)
+	b.pos += n
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	b.pos = int(offset)
+	return offset, nil
+}
+
+func writeChunks(t *testing.T, w io.Writer) {
+	wr, err := NewWriter(w, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chunk := range [][]int16{{1, 2, 3}, {-1, -2}, nil, {32767}} {
+		if err := wr.WriteSamples(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterSeekable(t *testing.T) {
+	var b seekBuffer
+	b.Write([]byte("prefix"))
+	writeChunks(t, &b)
+
+	data := b.buf[len("prefix"):]
+	const headerSize = riffHeaderSize + ds64ChunkSize + fmtChunkSize
+	if len(data) != headerSize+12 {
+		t.Fatalf("wrong file size: %d", len(data))
+	}
+
+	if id := string(data[0:4]); id != "RIFF" {
+		t.Errorf("file type = %q", id)
+	}
+
+	if size := binary.LittleEndian.Uint32(data[4:]); size != headerSize-8+12 {
+		t.Errorf("RIFF size = %d", size)
+	}
+
+	if id := string(data[riffHeaderSize:][:4]); id != "JUNK" {
+		t.Errorf("reserved chunk = %q", id)
+	}
+
+	if size := binary.LittleEndian.Uint32(data[headerSize-4:]); size != 12 {
+		t.Errorf("data size = %d", size)
+	}
+
+	if b.pos != len(b.buf) {
+		t.Errorf("destination left at %d, want end of file (%d)", b.pos, len(b.buf))
+	}
+}
+
+func TestWriterRF64(t *testing.T) {
+	defer func(size int64) { riffSizeLimit = size }(riffSizeLimit)
+	riffSizeLimit = 80
+
+	var b seekBuffer
+	writeChunks(t, &b)
+
+	data := b.buf
+	if id := string(data[0:4]); id != "RF64" {
+		t.Errorf("file type = %q", id)
+	}
+
+	if size := binary.LittleEndian.Uint32(data[4:]); size != unknownLength {
+		t.Errorf("RIFF size = %#x", size)
+	}
+
+	var ds64 ds64Chunk
+	if err := binary.Read(bytes.NewReader(data[riffHeaderSize:]), binary.LittleEndian, &ds64); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ds64.Ds64Header[:]) != "ds64" || ds64.RiffSize != uint64(len(data)-8) || ds64.DataSize != 12 || ds64.SampleCount != 6 {
+		t.Errorf("wrong ds64 chunk: %+v", ds64)
+	}
+}
+
+func TestWriterStream(t *testing.T) {
+	var b bytes.Buffer
+	writeChunks(t, &b)
+
+	data := b.Bytes()
+	const headerSize = riffHeaderSize + fmtChunkSize
+	if len(data) != headerSize+12 {
+		t.Fatalf("wrong file size: %d", len(data))
+	}
+
+	if size := binary.LittleEndian.Uint32(data[4:]); size != unknownLength {
+		t.Errorf("RIFF size = %#x", size)
+	}
+
+	if size := binary.LittleEndian.Uint32(data[headerSize-4:]); size != unknownLength {
+		t.Errorf("data size = %#x", size)
+	}
+
+	if got := int16(binary.LittleEndian.Uint16(data[headerSize+10:])); got != 32767 {
+		t.Errorf("last sample = %d", got)
+	}
+}
+
+func TestWriterSetInputRate(t *testing.T) {
+	var b seekBuffer
+	wr, err := NewWriter(&b, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wr.SetInputRate(16000); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := wr.WriteSamples(make([]int16, 101)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := wr.SetInputRate(22050); err == nil {
+		t.Error("SetInputRate after WriteSamples did not return an error")
+	}
+
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	const headerSize = riffHeaderSize + ds64ChunkSize + fmtChunkSize
+	if size := binary.LittleEndian.Uint32(b.buf[headerSize-4:]); size != 505*2 {
+		t.Errorf("data size = %d, want %d", size, 505*2)
+	}
+}
@@ -0,0 +1,290 @@
+package espeak_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+	"gopkg.in/BenLubar/espeak.v2/espeaktest"
+)
+
+func TestReadFrom(t *testing.T) {
+	src := synthesize(t, 16000, "Hello, world.")
+
+	var buf bytes.Buffer
+	if _, err := src.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(buf.Len())
+
+	same := espeak.Context{Engine: espeaktest.New(16000)}
+	n, err := same.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != size {
+		t.Errorf("read %d bytes, but file is %d bytes", n, size)
+	}
+	if !reflect.DeepEqual(same.Samples, src.Samples) {
+		t.Error("samples changed when reading at the same sample rate")
+	}
+
+	resampled := espeak.Context{Engine: espeaktest.New(8000)}
+	if _, err := resampled.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if want := (len(src.Samples) + 1) / 2; len(resampled.Samples) != want {
+		t.Errorf("resampled to %d samples, want %d", len(resampled.Samples), want)
+	}
+}
+
+func TestWriteWAVCues(t *testing.T) {
+	const text = `Hello, wörld. <mark name="here"/>Again!`
+
+	src := synthesize(t, 16000, text)
+
+	var buf bytes.Buffer
+	if _, err := src.WriteWAV(&buf, &espeak.WAVOptions{
+		Cues: []espeak.SynthEventType{espeak.EventWord, espeak.EventSentence, espeak.EventMark},
+		Info: &espeak.WAVInfo{Title: "test"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, label := range []string{"Hello\x00", "wörld\x00", "sentence 2\x00", "here\x00", "INAM", "test\x00"} {
+		if !bytes.Contains(buf.Bytes(), []byte(label)) {
+			t.Errorf("missing %q in file", label)
+		}
+	}
+
+	dst := espeak.Context{Engine: espeaktest.New(16000)}
+	if _, err := dst.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Text != text {
+		t.Errorf("text is %q, want %q", dst.Text, text)
+	}
+
+	var want []*espeak.SynthEvent
+	for _, e := range src.Events {
+		if e.Type == espeak.EventWord || e.Type == espeak.EventSentence || e.Type == espeak.EventMark {
+			want = append(want, e)
+		}
+	}
+
+	if !reflect.DeepEqual(dst.Events, want) {
+		t.Errorf("events were not restored:")
+		for _, e := range dst.Events {
+			t.Logf("got  %+v", *e)
+		}
+		for _, e := range want {
+			t.Logf("want %+v", *e)
+		}
+	}
+}
+
+func TestReadFromText(t *testing.T) {
+	src := synthesize(t, 16000, "Hello there.")
+
+	var buf bytes.Buffer
+	if _, err := src.WriteWAV(&buf, &espeak.WAVOptions{Cues: []espeak.SynthEventType{espeak.EventWord}}); err != nil {
+		t.Fatal(err)
+	}
+	withText := buf.Bytes()
+
+	src.Text = ""
+	buf = bytes.Buffer{}
+	if _, err := src.WriteWAV(&buf, &espeak.WAVOptions{Cues: []espeak.SynthEventType{espeak.EventWord}}); err != nil {
+		t.Fatal(err)
+	}
+	withoutText := buf.Bytes()
+
+	for _, tt := range []struct {
+		name  string
+		data  []byte
+		words string
+	}{
+		{"with text", withText, "Goodbye now Hello there"},
+		{"without text", withoutText, "Goodbye now"},
+	} {
+		dst := synthesize(t, 16000, "Goodbye now.")
+		if _, err := dst.ReadFrom(bytes.NewReader(tt.data)); err != nil {
+			t.Fatal(err)
+		}
+
+		var words []string
+		for _, e := range dst.Events {
+			if e.Type != espeak.EventWord {
+				continue
+			}
+			if e.TextPosition == 0 {
+				if e.Length != 0 {
+					t.Errorf("%s: word %d has length %d but no position", tt.name, e.Number, e.Length)
+				}
+				continue
+			}
+			words = append(words, string([]rune(dst.Text)[e.TextPosition-1:e.TextPosition-1+e.Length]))
+		}
+		if got := strings.Join(words, " "); got != tt.words {
+			t.Errorf("%s: words are %q, want %q", tt.name, got, tt.words)
+		}
+	}
+}
+
+func TestWriteWAVRF64(t *testing.T) {
+	defer espeak.SetRIFFSizeLimit(1000)()
+
+	src := synthesize(t, 16000, "Hello, world.")
+
+	for _, format := range []espeak.SampleFormat{espeak.PCM16, espeak.Float32} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := src.WriteWAV(&buf, &espeak.WAVOptions{
+				Format: format,
+				Cues:   []espeak.SynthEventType{espeak.EventWord},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := buf.Bytes()
+			if n != int64(len(data)) {
+				t.Errorf("wrote %d bytes, but returned %d", len(data), n)
+			}
+			if id := string(data[0:4]); id != "RF64" {
+				t.Errorf("file type = %q", id)
+			}
+			if size := binary.LittleEndian.Uint32(data[4:]); size != 0xFFFFFFFF {
+				t.Errorf("RIFF size = %#x", size)
+			}
+			if id := string(data[12:16]); id != "ds64" {
+				t.Fatalf("first chunk = %q", id)
+			}
+
+			dataBytes := uint64(len(src.Samples) * format.Size())
+			if size := binary.LittleEndian.Uint64(data[20:]); size != uint64(len(data)-8) {
+				t.Errorf("ds64 RIFF size = %d, want %d", size, len(data)-8)
+			}
+			if size := binary.LittleEndian.Uint64(data[28:]); size != dataBytes {
+				t.Errorf("ds64 data size = %d, want %d", size, dataBytes)
+			}
+			if count := binary.LittleEndian.Uint64(data[36:]); count != uint64(len(src.Samples)) {
+				t.Errorf("ds64 sample count = %d, want %d", count, len(src.Samples))
+			}
+
+			dst, err := espeak.ReadAudio(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dst.Samples, src.Samples) {
+				t.Error("samples changed in RF64 round trip")
+			}
+			if len(dst.Events) == 0 {
+				t.Error("cues after the RF64 data chunk were not read")
+			}
+		})
+	}
+}
+
+func TestWriteWAVTooLarge(t *testing.T) {
+	// The byte rate of 16-bit audio at 2^31 Hz does not fit in the fmt chunk.
+	ctx := espeak.Context{Engine: espeaktest.New(1 << 31), Samples: make([]int16, 10)}
+
+	var buf bytes.Buffer
+	if _, err := ctx.WriteWAV(&buf, nil); err == nil {
+		t.Error("expected an error for a sample rate that cannot be stored")
+	}
+
+	// IMA ADPCM is only written as WAV, and WriteTelephony has no RF64 fallback for it.
+	defer espeak.SetRIFFSizeLimit(100)()
+
+	ctx = espeak.Context{Engine: espeaktest.New(8000)}
+	if err := ctx.SynthesizeText("Hello."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.WriteTelephony(&buf, &espeak.TelephonyOptions{Codec: espeak.CodecIMAADPCM}); err == nil {
+		t.Error("expected an error for ADPCM audio that is too long")
+	}
+}
+
+func TestReadWAVLargeMetadata(t *testing.T) {
+	src := synthesize(t, 16000, "Hello, world.")
+
+	var buf bytes.Buffer
+	if _, err := src.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := func(id string, size int) []byte {
+		b := make([]byte, 8+size)
+		copy(b, id)
+		binary.LittleEndian.PutUint32(b[4:], uint32(size))
+		copy(b[8:], "adtl")
+		return b
+	}
+
+	// A LIST chunk before the audio and a cue chunk after it, both too large to read into memory.
+	const fmtEnd = 12 + 24
+	wav := buf.Bytes()
+	var file []byte
+	file = append(file, wav[:fmtEnd]...)
+	file = append(file, chunk("LIST", 2<<20)...)
+	file = append(file, wav[fmtEnd:]...)
+	file = append(file, chunk("cue ", 2<<20)...)
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(file)-8))
+
+	dst, err := espeak.ReadAudio(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst.Samples, src.Samples) {
+		t.Error("samples changed by skipping metadata")
+	}
+}
+
+func TestWriteWAVOddLength(t *testing.T) {
+	src := synthesize(t, 16000, `Hello, <mark name="there"/>world.`)
+	if len(src.Samples)%2 == 0 {
+		src.Samples = src.Samples[:len(src.Samples)-1]
+	}
+
+	for _, format := range []espeak.SampleFormat{espeak.PCM16, espeak.PCM8, espeak.PCM24, espeak.PCM32, espeak.Float32, espeak.ULaw, espeak.ALaw} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := src.WriteWAV(&buf, &espeak.WAVOptions{
+				Format: format,
+				Cues:   []espeak.SynthEventType{espeak.EventMark},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			data := buf.Bytes()
+			if size := binary.LittleEndian.Uint32(data[4:]); size != uint32(len(data)-8) {
+				t.Errorf("RIFF size = %d, want %d", size, len(data)-8)
+			}
+
+			// Walk the chunks the way a strict reader would, padding each one to an even length.
+			_, ids := chunks(t, data, 12, riffFormat)
+			if ids[len(ids)-1] != "LIST" {
+				t.Errorf("chunks = %q, want the cue labels last", ids)
+			}
+
+			dst, err := espeak.ReadAudio(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dst.Samples) != len(src.Samples) {
+				t.Errorf("read %d samples, want %d", len(dst.Samples), len(src.Samples))
+			}
+			if format.Size() >= 2 && !reflect.DeepEqual(dst.Samples, src.Samples) {
+				t.Error("samples changed in round trip")
+			}
+			if len(dst.Events) != 1 || dst.Events[0].Name != "there" {
+				t.Errorf("cues were not read after the data chunk: %+v", dst.Events)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WAVOptions controls the optional parts of a file written by Context.WriteWAV.
+type WAVOptions struct {
+	// Format is the encoding of each sample. Float32, ULaw, and ALaw files are written as
+	// WAVE_FORMAT_IEEE_FLOAT, WAVE_FORMAT_MULAW, and WAVE_FORMAT_ALAW with a fact chunk, and the rest as
+	// integer PCM.
+	Format SampleFormat
+
+	// Dither adds noise when reducing the bit depth, as described for RawOptions.
+	Dither bool
+
+	// Cues lists the types of events that are written as cue points, each with a label, so that audio
+	// editors show them as markers. Useful types are EventWord, EventSentence, and EventMark. Word cue
+	// points are labeled with the word from the Text of the Context, or with their number if Text does
+	// not hold it. Cue points also record the rest of each event, and the Text that their TextPosition
+	// refers to, so ReadFrom can restore them.
+	Cues []SynthEventType
+
+	// Info is written as a LIST/INFO chunk if it is not nil.
+	Info *WAVInfo
+}
+
+// WAVInfo holds the text tags of a LIST/INFO chunk. Empty fields are left out, except that Software and
+// Comment are filled in from the Context if they are empty.
+type WAVInfo struct {
+	Title    string // INAM
+	Artist   string // IART, for example the name of the voice
+	Software string // ISFT; defaults to the name of this package
+	Comment  string // ICMT; defaults to a description of the Context's settings
+}
+
+// Software is the default WAVInfo.Software.
+const Software = "espeak-ng (gopkg.in/BenLubar/espeak.v2)"
+
+func (ctx *Context) infoChunk(info *WAVInfo) []byte {
+	if info == nil {
+		return nil
+	}
+
+	software, comment := info.Software, info.Comment
+	if software == "" {
+		software = Software
+	}
+	if comment == "" {
+		comment = ctx.describeSettings()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("INFO")
+
+	for _, tag := range []struct {
+		id, text string
+	}{
+		{"INAM", info.Title},
+		{"IART", info.Artist},
+		{"ISFT", software},
+		{"ICMT", comment},
+	} {
+		if tag.text != "" {
+			writeSubChunk(&buf, tag.id, []byte(tag.text+"\x00"))
+		}
+	}
+
+	return listChunk(buf.Bytes())
+}
+
+// describeSettings returns the settings of ctx in a form suitable for a comment.
+func (ctx *Context) describeSettings() string {
+	s := ctx.Settings()
+
+	desc := fmt.Sprintf("rate=%d volume=%d pitch=%d range=%d", s.Rate, s.Volume, s.Pitch, s.Range)
+	if s.Voice.Name != "" {
+		desc += " voice=" + strconv.Quote(s.Voice.Name)
+	}
+	if s.Voice.Language != "" {
+		desc += " language=" + s.Voice.Language
+	}
+	if s.Voice.Gender != Unknown {
+		desc += " gender=" + strconv.Itoa(int(s.Voice.Gender))
+	}
+	if s.Voice.Age != 0 {
+		desc += " age=" + strconv.Itoa(int(s.Voice.Age))
+	}
+	if s.Voice.Variant != 0 {
+		desc += " variant=" + strconv.Itoa(int(s.Voice.Variant))
+	}
+
+	return desc
+}
+
+// ltxtHeader starts the labeled text sub-chunk of a LIST/adtl chunk, which is followed by the text.
+type ltxtHeader struct {
+	CueID        uint32
+	SampleLength uint32
+	Purpose      [4]byte
+	Country      uint16
+	Language     uint16
+	Dialect      uint16
+	CodePage     uint16
+}
+
+// Text is written as a labeled text sub-chunk that is not attached to a cue point, spanning all of the
+// audio, with the purpose of a script.
+var (
+	textPurpose  = [...]byte{'s', 'c', 'r', 'p'}
+	textCodePage = uint16(65001) // UTF-8
+)
+
+// cueChunks returns the cue chunk and the LIST/adtl chunk holding its labels and notes, and the Text
+// that the events refer to.
+func (ctx *Context) cueChunks(opts *WAVOptions, sampleRate int) []byte {
+	if len(opts.Cues) == 0 {
+		return nil
+	}
+
+	wanted := make(map[SynthEventType]bool)
+	for _, t := range opts.Cues {
+		wanted[t] = true
+	}
+
+	var (
+		points []cuePoint
+		adtl   bytes.Buffer
+	)
+	adtl.WriteString("adtl")
+
+	for _, e := range ctx.Events {
+		if !wanted[e.Type] {
+			continue
+		}
+
+		offset := uint32(e.AudioPosition * time.Duration(sampleRate) / time.Second)
+		id := uint32(len(points) + 1)
+		points = append(points, cuePoint{
+			ID:           id,
+			Position:     offset,
+			DataChunkID:  [...]byte{'d', 'a', 't', 'a'},
+			SampleOffset: offset,
+		})
+
+		writeSubChunk(&adtl, "labl", cueText(id, cueLabel(e, ctx.Text)))
+		writeSubChunk(&adtl, "note", cueText(id, cueNotePrefix+formatCueNote(e)))
+	}
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	if ctx.Text != "" {
+		var ltxt bytes.Buffer
+		binary.Write(&ltxt, binary.LittleEndian, &ltxtHeader{
+			SampleLength: uint32(ctx.Duration() * time.Duration(sampleRate) / time.Second),
+			Purpose:      textPurpose,
+			CodePage:     textCodePage,
+		})
+		ltxt.WriteString(ctx.Text)
+		writeSubChunk(&adtl, "ltxt", ltxt.Bytes())
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &chunkHeader{
+		ID:   [...]byte{'c', 'u', 'e', ' '},
+		Size: uint32(4 + len(points)*binary.Size(cuePoint{})),
+	})
+	binary.Write(&buf, binary.LittleEndian, uint32(len(points)))
+	binary.Write(&buf, binary.LittleEndian, points)
+
+	buf.Write(listChunk(adtl.Bytes()))
+
+	return buf.Bytes()
+}
+
+// cueLabel returns the label shown by audio editors for an event.
+func cueLabel(e *SynthEvent, text string) string {
+	switch e.Type {
+	case EventWord:
+		if word := textAt(text, e.TextPosition, e.Length); word != "" {
+			return word
+		}
+		return "word " + strconv.Itoa(e.Number)
+	case EventSentence:
+		return "sentence " + strconv.Itoa(e.Number)
+	case EventMark, EventPlay:
+		return e.Name
+	case EventPhoneme:
+		return e.Phoneme
+	case EventEnd:
+		return "end"
+	default:
+		return "event " + strconv.Itoa(int(e.Type))
+	}
+}
+
+// textAt returns length characters of text starting at the 1-based character position pos, or "" if
+// that is out of range.
+func textAt(text string, pos, length int) string {
+	if pos < 1 || length < 1 {
+		return ""
+	}
+
+	n, start := 0, -1 // n is the number of characters before i
+	for i := range text {
+		if n == pos-1 {
+			start = i
+		}
+		if n == pos-1+length {
+			return text[start:i]
+		}
+		n++
+	}
+
+	if start != -1 && n == pos-1+length {
+		return text[start:]
+	}
+
+	return ""
+}
+
+func cueText(id uint32, text string) []byte {
+	buf := make([]byte, 4, 4+len(text)+1)
+	binary.LittleEndian.PutUint32(buf, id)
+	buf = append(buf, text...)
+	return append(buf, 0)
+}
+
+func writeSubChunk(buf *bytes.Buffer, id string, data []byte) {
+	binary.Write(buf, binary.LittleEndian, &chunkHeader{
+		ID:   [...]byte{id[0], id[1], id[2], id[3]},
+		Size: uint32(len(data)),
+	})
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func listChunk(data []byte) []byte {
+	var buf bytes.Buffer
+	writeSubChunk(&buf, "LIST", data)
+	return buf.Bytes()
+}
+
+// formatCueNote encodes e, except for its AudioPosition, as "type text+length number name".
+func formatCueNote(e *SynthEvent) string {
+	name := e.Name
+	if e.Type == EventPhoneme {
+		name = e.Phoneme
+	}
+
+	return fmt.Sprintf("%d %d+%d %d %s", e.Type, e.TextPosition, e.Length, e.Number, strconv.Quote(name))
+}
@@ -0,0 +1,481 @@
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"gopkg.in/BenLubar/espeak.v2/g711"
+	"gopkg.in/BenLubar/espeak.v2/resample"
+)
+
+// WAV format tags understood by ReadFrom.
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatIEEEFloat  = 0x0003
+	wavFormatALaw       = 0x0006
+	wavFormatMuLaw      = 0x0007
+	wavFormatExtensible = 0xFFFE
+)
+
+// ErrFormat is returned when reading audio in a format this package does not understand.
+var ErrFormat = errors.New("espeak: unsupported audio format")
+
+// ReadWAV decodes a WAV file into a new Context that uses DefaultEngine. See Context.ReadFrom.
+func ReadWAV(r io.Reader) (*Context, error) {
+	ctx := &Context{}
+
+	if _, err := ctx.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// ReadFrom decodes a WAV file and appends its audio to Samples, so that recorded audio can be combined
+// with synthesized speech. Integer PCM from 8 to 32 bits, 32-bit and 64-bit floating point, and RF64
+// files are supported. Audio with more than one channel is mixed down to mono, and audio at a different
+// sample rate is resampled to match SampleRate.
+//
+// If the file contains cue points written by WriteTo, the events they describe are appended to Events,
+// and the text they were synthesized from is appended to Text. Cue points with a label from other
+// software become EventMark events named after the label. As with SynthesizeText, AudioPosition and
+// TextPosition are measured from the start of Samples and Text. Events from a file without its text
+// have no TextPosition or Length.
+//
+// The returned count is the number of bytes read from r.
+func (ctx *Context) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countReader{r: bufio.NewReader(r)}
+
+	d, err := decodeWAV(cr)
+	if err != nil {
+		return cr.n, err
+	}
+
+	samples := d.samples
+	if rate := ctx.SampleRate(); rate != d.sampleRate {
+		samples = resample.Resample(samples, d.sampleRate, rate)
+	}
+
+	events := d.events()
+	rebaseEvents(events, ctx.Duration(), ctx.textLength())
+
+	ctx.Samples = append(ctx.Samples, samples...)
+	ctx.Events = append(ctx.Events, events...)
+	ctx.Text += d.text
+
+	return cr.n, nil
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+type cuePoint struct {
+	ID           uint32
+	Position     uint32
+	DataChunkID  [4]byte
+	ChunkStart   uint32
+	BlockStart   uint32
+	SampleOffset uint32
+}
+
+// decodedWAV is the audio and cue information in a WAV file.
+type decodedWAV struct {
+	sampleRate int
+	samples    []int16
+
+	cues   []cuePoint
+	labels map[uint32]string
+	notes  map[uint32]string
+
+	text    string // the Text of the Context that wrote the file
+	hasText bool
+}
+
+func (d *decodedWAV) events() []*SynthEvent {
+	var events []*SynthEvent
+
+	for _, cue := range d.cues {
+		position := time.Duration(cue.SampleOffset) * time.Second / time.Duration(d.sampleRate)
+
+		if note, ok := d.notes[cue.ID]; ok && strings.HasPrefix(note, cueNotePrefix) {
+			if e, err := parseCueNote(note[len(cueNotePrefix):]); err == nil {
+				e.AudioPosition = position
+				if !d.hasText {
+					// The positions would refer to whatever text the events are read along with.
+					e.TextPosition, e.Length = 0, 0
+				}
+				events = append(events, e)
+				continue
+			}
+		}
+
+		if label, ok := d.labels[cue.ID]; ok {
+			events = append(events, &SynthEvent{
+				Type:          EventMark,
+				AudioPosition: position,
+				Name:          label,
+			})
+		}
+	}
+
+	return events
+}
+
+func decodeWAV(r io.Reader) (*decodedWAV, error) {
+	var header riffHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	rf64 := string(header.RiffHeader[:]) == "RF64"
+	if (!rf64 && string(header.RiffHeader[:]) != "RIFF") || string(header.WaveHeader[:]) != "WAVE" {
+		return nil, errors.New("espeak: not a wav file")
+	}
+
+	var (
+		d        decodedWAV
+		format   *fmtChunk
+		subtype  uint16
+		ds64Size uint64
+		haveData bool
+	)
+
+	for {
+		var chunk chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			if err == io.EOF && haveData {
+				return &d, nil
+			}
+			if err == io.EOF {
+				err = errors.New("espeak: missing data chunk in wav file")
+			}
+			return nil, err
+		}
+
+		remaining := int64(chunk.Size) // bytes of the chunk that have not been read
+		pad := remaining & 1
+
+		switch string(chunk.ID[:]) {
+		case "ds64":
+			buf, err := readChunk(r, remaining)
+			if err != nil {
+				return nil, err
+			}
+
+			var ds64 ds64Chunk
+			if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &ds64); err != nil {
+				return nil, err
+			}
+
+			ds64Size = ds64.DataSize
+			remaining = 0
+		case "fmt ":
+			buf, err := readChunk(r, remaining)
+			if err != nil {
+				return nil, err
+			}
+
+			f, sub, err := parseFormat(buf)
+			if err != nil {
+				return nil, err
+			}
+
+			format, subtype = f, sub
+			d.sampleRate = int(f.SampleRate)
+			remaining = 0
+		case "data":
+			if format == nil {
+				return nil, errors.New("espeak: missing fmt chunk in wav file")
+			}
+
+			var data io.Reader
+			switch {
+			case chunk.Size == maxRIFFSize && rf64:
+				data = io.LimitReader(r, int64(ds64Size))
+			case chunk.Size == maxRIFFSize:
+				// The length was unknown when the file was written, so the data continues to the end.
+				data = r
+			default:
+				data = io.LimitReader(r, remaining)
+			}
+
+			samples, n, err := decodeSamples(data, format, subtype)
+			if err != nil {
+				return nil, err
+			}
+
+			d.samples = samples
+			haveData = true
+			remaining, pad = 0, n&1
+		case "cue ":
+			if remaining > maxMetadataSize {
+				// Too many cues to hold in memory. They are only metadata, so the audio is still read.
+				break
+			}
+
+			var count uint32
+			if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+				return nil, err
+			}
+
+			remaining -= 4 + int64(count)*int64(binary.Size(cuePoint{}))
+			if remaining < 0 {
+				return nil, errors.New("espeak: malformed cue chunk in wav file")
+			}
+
+			d.cues = make([]cuePoint, count)
+			if err := binary.Read(r, binary.LittleEndian, d.cues); err != nil {
+				return nil, err
+			}
+		case "LIST":
+			if remaining > maxMetadataSize {
+				break
+			}
+
+			buf, err := readChunk(r, remaining)
+			if err != nil {
+				return nil, err
+			}
+
+			if body := buf[8:]; len(body) >= 4 && string(body[:4]) == "adtl" {
+				d.parseADTL(body[4:])
+			}
+
+			remaining = 0
+		}
+
+		if _, err := io.CopyN(io.Discard, r, remaining+pad); err != nil {
+			if err == io.EOF && haveData {
+				return &d, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// maxMetadataSize is the largest chunk that is read into memory. Larger format chunks are an error, but
+// larger metadata chunks, such as the cue and LIST chunks of a long recording with many labels, are
+// skipped.
+const maxMetadataSize = 1 << 20
+
+// readChunk reads the body of a chunk, returning it prefixed by 8 zero bytes in place of the chunk
+// header, so that it can be decoded into the same structures used for writing.
+func readChunk(r io.Reader, size int64) ([]byte, error) {
+	if size > maxMetadataSize {
+		return nil, errors.New("espeak: unexpectedly large chunk in wav file")
+	}
+
+	buf := make([]byte, 8+size)
+	_, err := io.ReadFull(r, buf[8:])
+	return buf, err
+}
+
+// parseADTL reads the labl and note sub-chunks of a LIST/adtl chunk, and the text written by cueChunks.
+func (d *decodedWAV) parseADTL(buf []byte) {
+	for len(buf) >= 8 {
+		id := string(buf[:4])
+		size := int(binary.LittleEndian.Uint32(buf[4:]))
+		buf = buf[8:]
+
+		if size > len(buf) {
+			return
+		}
+
+		if (id == "labl" || id == "note") && size >= 4 {
+			cue := binary.LittleEndian.Uint32(buf)
+			text := string(buf[4:size])
+			if i := strings.IndexByte(text, 0); i != -1 {
+				text = text[:i]
+			}
+
+			if id == "labl" {
+				if d.labels == nil {
+					d.labels = make(map[uint32]string)
+				}
+				d.labels[cue] = text
+			} else {
+				if d.notes == nil {
+					d.notes = make(map[uint32]string)
+				}
+				d.notes[cue] = text
+			}
+		}
+
+		if id == "ltxt" && size >= binary.Size(ltxtHeader{}) {
+			var h ltxtHeader
+			binary.Read(bytes.NewReader(buf), binary.LittleEndian, &h)
+			if h.CueID == 0 && h.Purpose == textPurpose && h.CodePage == textCodePage {
+				d.text = string(buf[binary.Size(h):size])
+				d.hasText = true
+			}
+		}
+
+		size += size & 1
+		if size > len(buf) {
+			return
+		}
+		buf = buf[size:]
+	}
+}
+
+func parseFormat(buf []byte) (*fmtChunk, uint16, error) {
+	var f fmtChunk
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &f); err != nil {
+		return nil, 0, errors.New("espeak: malformed fmt chunk in wav file")
+	}
+
+	subtype := f.AudioFormat
+	if subtype == wavFormatExtensible {
+		// cbSize, wValidBitsPerSample, dwChannelMask, then the sub-format GUID, whose first two bytes
+		// are the format tag.
+		if len(buf) < 8+40 {
+			return nil, 0, errors.New("espeak: malformed WAVE_FORMAT_EXTENSIBLE chunk in wav file")
+		}
+		subtype = binary.LittleEndian.Uint16(buf[8+24:])
+	}
+
+	if f.NumChannels == 0 || f.SampleRate == 0 {
+		return nil, 0, errors.New("espeak: malformed fmt chunk in wav file")
+	}
+
+	if bytesPerSample(subtype, f.BitDepth) == 0 {
+		return nil, 0, fmt.Errorf("%v: format %#04x with %d bits per sample", ErrFormat, subtype, f.BitDepth)
+	}
+
+	return &f, subtype, nil
+}
+
+func bytesPerSample(format, bits uint16) int {
+	switch {
+	case format == wavFormatPCM && (bits == 8 || bits == 16 || bits == 24 || bits == 32):
+		return int(bits) / 8
+	case format == wavFormatIEEEFloat && (bits == 32 || bits == 64):
+		return int(bits) / 8
+	case (format == wavFormatMuLaw || format == wavFormatALaw) && bits == 8:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// decodeSamples reads all of r as interleaved samples in the given format, mixing channels down to mono.
+// It returns the number of bytes read.
+func decodeSamples(r io.Reader, f *fmtChunk, subtype uint16) ([]int16, int64, error) {
+	width := bytesPerSample(subtype, f.BitDepth)
+	channels := int(f.NumChannels)
+	frameSize := width * channels
+
+	var (
+		samples []int16
+		n       int64
+		buf     = make([]byte, frameSize*1024)
+		partial int
+	)
+
+	for {
+		m, err := r.Read(buf[partial:])
+		n += int64(m)
+		m += partial
+
+		frames := m / frameSize
+		for i := 0; i < frames; i++ {
+			var sum float64
+			for c := 0; c < channels; c++ {
+				sum += decodeSample(buf[(i*channels+c)*width:], subtype, width)
+			}
+			samples = append(samples, floatToSample(sum/float64(channels)))
+		}
+
+		partial = copy(buf, buf[frames*frameSize:m])
+
+		if err == io.EOF {
+			return samples, n, nil
+		}
+		if err != nil {
+			return nil, n, err
+		}
+	}
+}
+
+// decodeSample returns a sample in the range [-1, 1).
+func decodeSample(b []byte, format uint16, width int) float64 {
+	switch format {
+	case wavFormatMuLaw:
+		return float64(g711.DecodeULaw(b[0])) / 32768
+	case wavFormatALaw:
+		return float64(g711.DecodeALaw(b[0])) / 32768
+	}
+
+	if format == wavFormatIEEEFloat {
+		if width == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+
+	switch width {
+	case 1:
+		return float64(int(b[0])-128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 3:
+		return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)) / (1 << 31)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+// floatToSample converts a sample in the range [-1, 1) to 16 bits, clipping values outside of the range.
+func floatToSample(v float64) int16 {
+	v = math.Floor(v*32768 + 0.5)
+
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return int16(v)
+}
+
+// cueNotePrefix starts the note attached to each cue point written for a SynthEvent, which records the
+// fields of the event that do not fit in the cue point itself.
+const cueNotePrefix = "espeak:"
+
+func parseCueNote(s string) (*SynthEvent, error) {
+	var (
+		e    SynthEvent
+		typ  int
+		name string
+	)
+
+	if _, err := fmt.Sscanf(s, "%d %d+%d %d %q", &typ, &e.TextPosition, &e.Length, &e.Number, &name); err != nil {
+		return nil, err
+	}
+
+	e.Type = SynthEventType(typ)
+	if e.Type == EventPhoneme {
+		e.Phoneme = name
+	} else {
+		e.Name = name
+	}
+
+	return &e, nil
+}
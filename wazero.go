@@ -0,0 +1,370 @@
+// +build !js,espeak_wazero,!espeak_cli
+
+package espeak // import "gopkg.in/BenLubar/espeak.v2"
+
+// This backend is selected with the espeak_wazero build tag. It embeds the files in the wasi directory,
+// which are not part of the repository and must be built with build/make_wasi.bash first. It also
+// needs the github.com/tetratelabs/wazero module. build/check_tags.bash checks that it compiles.
+
+import (
+	"context"
+	"embed"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasiBinary is espeak-ng compiled for WASI by build/make_wasi.bash.
+//
+//go:embed wasi/libespeak-ng.wasm
+var wasiBinary []byte
+
+//go:embed wasi/espeak-ng-data
+var wasiData embed.FS
+
+var (
+	wasiCtx = context.Background()
+	module  api.Module
+)
+
+func call(name string, args ...uint64) uint64 {
+	ret, err := module.ExportedFunction(name).Call(wasiCtx, args...)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(ret) == 0 {
+		return 0
+	}
+
+	return ret[0]
+}
+
+func deref(ptr uint32) uint32 {
+	val, ok := module.Memory().ReadUint32Le(ptr)
+	if !ok {
+		panic("espeak: out of bounds memory access")
+	}
+
+	return val
+}
+
+func getU8(ptr uint32) uint8 {
+	val, ok := module.Memory().ReadByte(ptr)
+	if !ok {
+		panic("espeak: out of bounds memory access")
+	}
+
+	return val
+}
+
+func getI32(ptr uint32) int {
+	return int(int32(deref(ptr)))
+}
+
+func setPtr(ptr, val uint32) {
+	if !module.Memory().WriteUint32Le(ptr, val) {
+		panic("espeak: out of bounds memory access")
+	}
+}
+
+func setU8(ptr uint32, val uint8) {
+	if !module.Memory().WriteByte(ptr, val) {
+		panic("espeak: out of bounds memory access")
+	}
+}
+
+func getBytes(ptr uint32, n int) []byte {
+	buf, ok := module.Memory().Read(ptr, uint32(n))
+	if !ok {
+		panic("espeak: out of bounds memory access")
+	}
+
+	return buf
+}
+
+func malloc(size uint32) uint32 {
+	return uint32(call("malloc", uint64(size)))
+}
+
+func free(ptr uint32) {
+	call("free", uint64(ptr))
+}
+
+func fromString(s string) uint32 {
+	ptr := malloc(uint32(len(s) + 1))
+
+	buf := make([]byte, len(s)+1)
+	copy(buf, s)
+	if !module.Memory().Write(ptr, buf) {
+		panic("espeak: out of bounds memory access")
+	}
+
+	return ptr
+}
+
+func toString(ptr uint32) string {
+	var buf []byte
+
+	b := getU8(ptr)
+	for b != 0 {
+		buf = append(buf, b)
+		ptr++
+		b = getU8(ptr)
+	}
+
+	return string(buf)
+}
+
+func toStringN(ptr uint32, n int) string {
+	buf := getBytes(ptr, n)
+	for i, b := range buf {
+		if b == 0 {
+			return string(buf[:i])
+		}
+	}
+
+	return string(buf)
+}
+
+var errBuf uint32
+
+func init() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	r := wazero.NewRuntime(wasiCtx)
+	wasi_snapshot_preview1.MustInstantiate(wasiCtx, r)
+
+	_, err := r.NewHostModuleBuilder("env").
+		NewFunctionBuilder().WithFunc(synthCallback).Export("synth_callback").
+		Instantiate(wasiCtx)
+	if err != nil {
+		panic(err)
+	}
+
+	data, err := fs.Sub(wasiData, "wasi/espeak-ng-data")
+	if err != nil {
+		panic(err)
+	}
+
+	config := wazero.NewModuleConfig().
+		WithFSConfig(wazero.NewFSConfig().WithFSMount(data, "/usr/share/espeak-ng-data")).
+		WithStderr(os.Stderr).
+		WithStartFunctions("_initialize")
+
+	module, err = r.InstantiateWithConfig(wasiCtx, wasiBinary, config)
+	if err != nil {
+		panic(err)
+	}
+
+	errBuf = malloc(512)
+
+	call("espeak_ng_InitializePath", 0)
+
+	errCtx := malloc(4)
+	defer free(errCtx)
+	setPtr(errCtx, 0)
+	defer call("espeak_ng_ClearErrorContext", uint64(errCtx))
+
+	status := call("espeak_ng_Initialize", uint64(errCtx))
+	err = toErr(status)
+	if err != nil {
+		call("espeak_ng_PrintStatusCodeMessage", status, call("get_stderr"), uint64(deref(errCtx)))
+		panic(err)
+	}
+
+	status = call("espeak_ng_InitializeOutput", outputModeSynchronous, 0, 0)
+	err = toErr(status)
+	if err != nil {
+		call("espeak_ng_PrintStatusCodeMessage", status, call("get_stderr"), uint64(deref(errCtx)))
+		panic(err)
+	}
+
+	call("set_synth_callback")
+}
+
+func toErr(status uint64) error {
+	if uint32(status) == sOK {
+		return nil
+	}
+
+	call("espeak_ng_GetStatusCodeMessage", status, uint64(errBuf), 512)
+	return &Error{
+		Code:    uint32(status),
+		Message: toStringN(errBuf, 512),
+	}
+}
+
+func getSampleRate() int {
+	return int(int32(call("espeak_ng_GetSampleRate")))
+}
+
+func listVoices() []*Voice {
+	var voices []*Voice
+
+	for cVoices := uint32(call("espeak_ListVoices", 0)); deref(cVoices) != 0; cVoices += 4 {
+		voices = append(voices, toVoice(deref(cVoices)))
+	}
+
+	return voices
+}
+
+func toVoice(cVoice uint32) *Voice {
+	return &Voice{
+		Name:       toString(deref(cVoice + voiceNameOffset)),
+		Languages:  toLanguages(deref(cVoice + voiceLanguagesOffset)),
+		Identifier: toString(deref(cVoice + voiceIdentifierOffset)),
+		Gender:     Gender(getU8(cVoice + voiceGenderOffset)),
+		Age:        getU8(cVoice + voiceAgeOffset),
+	}
+}
+
+func toLanguages(data uint32) []Language {
+	var languages []Language
+
+	for {
+		priority := getU8(data)
+		if priority == 0 {
+			return languages
+		}
+
+		start, length, next := findNextLanguage(data)
+		languages = append(languages, Language{
+			Priority: priority,
+			Name:     toStringN(start, length),
+		})
+		data = next
+	}
+}
+
+func setRate(rate int) error {
+	return toErr(call("espeak_ng_SetParameter", espeakRATE, uint64(rate), 0))
+}
+
+func setVolume(volume int) error {
+	return toErr(call("espeak_ng_SetParameter", espeakVOLUME, uint64(volume), 0))
+}
+
+func setPitch(pitch int) error {
+	return toErr(call("espeak_ng_SetParameter", espeakPITCH, uint64(pitch), 0))
+}
+
+func setTone(tone int) error {
+	return toErr(call("espeak_ng_SetParameter", espeakRANGE, uint64(tone), 0))
+}
+
+func setVoice(name, language string, gender Gender, age, variant uint8) error {
+	voice := malloc(voiceSize)
+	defer free(voice)
+
+	if !module.Memory().Write(voice, make([]byte, voiceSize)) {
+		panic("espeak: out of bounds memory access")
+	}
+
+	if name != "" {
+		cName := fromString(name)
+		defer free(cName)
+		setPtr(voice+voiceNameOffset, cName)
+	}
+
+	if name != "" && language == "" && gender == Unknown && age == 0 && variant == 0 {
+		return toErr(call("espeak_ng_SetVoiceByName", uint64(deref(voice+voiceNameOffset))))
+	}
+
+	if language != "" {
+		cLanguage := fromString(language)
+		defer free(cLanguage)
+		setPtr(voice+voiceLanguagesOffset, cLanguage)
+	}
+
+	setU8(voice+voiceGenderOffset, uint8(gender))
+	setU8(voice+voiceAgeOffset, age)
+	setU8(voice+voiceVariantOffset, variant)
+
+	return toErr(call("espeak_ng_SetVoiceByProperties", uint64(voice)))
+}
+
+var synthCtx *Context
+
+// synthCallback is imported by build/wasi_callback.c as env.synth_callback.
+func synthCallback(_ context.Context, _ api.Module, wav, numsamples, events uint32) int32 {
+	buf := getBytes(wav, int(numsamples)*2)
+	for i := 0; i < int(numsamples); i++ {
+		synthCtx.Samples = append(synthCtx.Samples, int16(binary.LittleEndian.Uint16(buf[i*2:])))
+	}
+
+	for getI32(events+eventTypeOffset) != espeakEVENT_LIST_TERMINATED {
+		if e := toEvent(events); e != nil {
+			synthCtx.Events = append(synthCtx.Events, e)
+		}
+
+		events += eventSize
+	}
+
+	return 0 // continue synthesis
+}
+
+func toEvent(event uint32) *SynthEvent {
+	var synthEvent SynthEvent
+
+	switch getI32(event + eventTypeOffset) {
+	case espeakEVENT_WORD:
+		synthEvent.Type = EventWord
+		synthEvent.Number = getI32(event + eventNumberOffset)
+	case espeakEVENT_SENTENCE:
+		synthEvent.Type = EventSentence
+		synthEvent.Number = getI32(event + eventNumberOffset)
+	case espeakEVENT_MARK:
+		synthEvent.Type = EventMark
+		synthEvent.Name = toString(deref(event + eventNameOffset))
+	case espeakEVENT_PLAY:
+		synthEvent.Type = EventPlay
+		synthEvent.Name = toString(deref(event + eventNameOffset))
+	case espeakEVENT_END:
+		synthEvent.Type = EventEnd
+	case espeakEVENT_MSG_TERMINATED:
+		synthEvent.Type = EventMsgTerminated
+	case espeakEVENT_PHONEME:
+		synthEvent.Type = EventPhoneme
+		synthEvent.Phoneme = toStringN(event+eventStringOffset, 8)
+	default:
+		return nil
+	}
+
+	synthEvent.TextPosition = getI32(event + eventTextPositionOffset)
+	synthEvent.Length = getI32(event + eventLengthOffset)
+	synthEvent.AudioPosition = time.Duration(getI32(event+eventAudioPositionOffset)) * time.Millisecond
+
+	return &synthEvent
+}
+
+func synthesize(text string, ctx *Context) error {
+	synthCtx = ctx
+	defer func() {
+		synthCtx = nil
+	}()
+
+	cText := fromString(text)
+	defer free(cText)
+
+	return toErr(call("espeak_ng_Synthesize", uint64(cText), 0, 0, posCharacter, 0, espeakCHARS_UTF8|espeakSSML, 0, 0))
+}
+
+func findNextLanguage(data uint32) (start uint32, len int, next uint32) {
+	data++
+	start = data
+	for getU8(data) != 0 {
+		data++
+		len++
+	}
+	data++
+	next = data
+
+	return
+}
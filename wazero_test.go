@@ -0,0 +1,57 @@
+// +build !js,espeak_wazero,!espeak_cli
+
+package espeak_test
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/BenLubar/espeak.v2"
+)
+
+// TestWazero checks that the structure layouts in js_defs.gen.go match the WASI build, by reading
+// voices and events out of its memory.
+func TestWazero(t *testing.T) {
+	voices := espeak.ListVoices()
+	if len(voices) == 0 {
+		t.Fatal("no voices in the WASI build")
+	}
+	for _, v := range voices {
+		if v.Name == "" || v.Identifier == "" || len(v.Languages) == 0 {
+			t.Errorf("voice read from the wrong offsets: %+v", *v)
+		}
+		if v.Gender != espeak.Unknown && v.Gender != espeak.Male && v.Gender != espeak.Female {
+			t.Errorf("voice %q has gender %d", v.Name, v.Gender)
+		}
+		for _, l := range v.Languages {
+			if l.Priority == 0 || l.Name == "" || strings.ContainsRune(l.Name, 0) {
+				t.Errorf("voice %q has language %+v", v.Name, l)
+			}
+		}
+	}
+
+	var ctx espeak.Context
+	if err := ctx.SetVoice(voices[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetRate(300)
+	if err := ctx.SynthesizeText(`One <mark name="two"/>two.`); err != nil {
+		t.Fatal(err)
+	}
+
+	var words, marks []string
+	for _, e := range ctx.Events {
+		switch e.Type {
+		case espeak.EventWord:
+			words = append(words, string([]rune(ctx.Text)[e.TextPosition-1:e.TextPosition-1+e.Length]))
+		case espeak.EventMark:
+			marks = append(marks, e.Name)
+		}
+	}
+	if strings.Join(words, " ") != "One two" {
+		t.Errorf("words are %q", words)
+	}
+	if len(marks) != 1 || marks[0] != "two" {
+		t.Errorf("marks are %q", marks)
+	}
+}